@@ -0,0 +1,128 @@
+package couchdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// CreateServerAdmin creates a server admin account on a cluster node, or
+// changes the password of an existing admin. If node is empty, the account
+// is created on the node handling the request. In a cluster, the call must
+// be repeated for every node.
+//
+// http://docs.couchdb.org/en/latest/config/auth.html#config-admins
+func (c *Client) CreateServerAdmin(node, user, password string) error {
+	if node == "" {
+		node = "_local"
+	}
+	path := new(pathBuilder).addRaw("_node").add(node).addRaw("_config/admins").add(user).path()
+	body, _ := json.Marshal(password)
+	_, err := c.closedRequest("PUT", path, bytes.NewReader(body))
+	return err
+}
+
+// AdminParty reports whether the server is in "admin party" mode, i.e.
+// whether anonymous requests have admin rights because no server admin
+// has been created yet. The check is performed without the credentials
+// configured on the client.
+func (c *Client) AdminParty() (bool, error) {
+	req, err := c.newAnonRequest("GET", "/_session", nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return false, err
+	}
+	var session struct {
+		UserCtx struct {
+			Roles []string `json:"roles"`
+		} `json:"userCtx"`
+	}
+	if err := readBody(resp, &session); err != nil {
+		return false, err
+	}
+	for _, role := range session.UserCtx.Roles {
+		if role == "_admin" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// NodeVersions contains the versions of the software components
+// of a cluster node.
+type NodeVersions struct {
+	ErlangVersion string `json:"erlang_version"`
+
+	JavaScriptEngine struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"javascript_engine"`
+
+	CollationDriver struct {
+		Name             string   `json:"name"`
+		LibraryVersion   string   `json:"library_version"`
+		CollatorVersions []string `json:"collator_versions"`
+	} `json:"collation_driver"`
+}
+
+// NodeVersions retrieves the versions of the software components of a
+// cluster node. If node is empty, the versions of the node handling the
+// request are returned. The endpoint exists in CouchDB 2.2 and later.
+//
+// http://docs.couchdb.org/en/latest/api/server/common.html#node-node-name-versions
+func (c *Client) NodeVersions(node string) (*NodeVersions, error) {
+	if node == "" {
+		node = "_local"
+	}
+	resp, err := c.request("GET", new(pathBuilder).addRaw("_node").add(node).addRaw("_versions").path(), nil)
+	if err != nil {
+		return nil, err
+	}
+	v := new(NodeVersions)
+	return v, readBody(resp, v)
+}
+
+// ClusterVersions retrieves the versions of all nodes in the cluster, keyed
+// by node name. Use it to verify that a rolling upgrade has reached every node.
+func (c *Client) ClusterVersions() (map[string]*NodeVersions, error) {
+	nodes, err := c.clusterNodeNames()
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[string]*NodeVersions, len(nodes))
+	for _, node := range nodes {
+		v, err := c.NodeVersions(node)
+		if err != nil {
+			return nil, fmt.Errorf("couchdb: node %s: %v", node, err)
+		}
+		versions[node] = v
+	}
+	return versions, nil
+}
+
+// RestartNode restarts a cluster node. If node is empty, the node handling
+// the request is restarted. The call returns before the node is back up;
+// use Ping or the /_up endpoint of the node to wait for it. Servers that
+// don't support restarting over HTTP respond with an error that satisfies
+// NotFound.
+//
+// http://docs.couchdb.org/en/latest/api/server/common.html#node-node-name-restart
+func (c *Client) RestartNode(node string) error {
+	if node == "" {
+		node = "_local"
+	}
+	path := new(pathBuilder).addRaw("_node").add(node).addRaw("_restart").path()
+	req, err := c.newRequest("POST", path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("content-type", "application/json")
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,91 @@
+package couchdb_test
+
+import (
+	"io"
+	"io/ioutil"
+	. "net/http"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestCreateServerAdmin(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("PUT /_node/_local/_config/admins/root", func(resp ResponseWriter, req *Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		check(t, "request body", `"secret"`, string(body))
+		io.WriteString(resp, `""`)
+	})
+	if err := c.CreateServerAdmin("", "root", "secret"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdminParty(t *testing.T) {
+	c := newTestClient(t)
+	c.SetAuth(couchdb.BasicAuth("user", "pass"))
+	roles := `["_admin"]`
+	c.Handle("GET /_session", func(resp ResponseWriter, req *Request) {
+		check(t, "Authorization header", "", req.Header.Get("Authorization"))
+		io.WriteString(resp, `{"ok": true, "userCtx": {"name": null, "roles": `+roles+`}}`)
+	})
+
+	party, err := c.AdminParty()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "admin party", true, party)
+
+	roles = `[]`
+	party, err = c.AdminParty()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "admin party", false, party)
+}
+
+func TestClusterVersions(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /_membership", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"all_nodes": [], "cluster_nodes": ["couchdb@node1", "couchdb@node2"]}`)
+	})
+	for _, node := range []string{"node1", "node2"} {
+		erlang := "24.3." + node[len(node)-1:]
+		c.Handle("GET /_node/couchdb%40"+node+"/_versions", func(resp ResponseWriter, req *Request) {
+			io.WriteString(resp, `{
+				"erlang_version": "`+erlang+`",
+				"javascript_engine": {"name": "spidermonkey", "version": "91"},
+				"collation_driver": {"name": "libicu", "library_version": "70.1", "collator_versions": ["153.112"]}
+			}`)
+		})
+	}
+
+	versions, err := c.ClusterVersions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "node count", 2, len(versions))
+	check(t, "node1 erlang", "24.3.1", versions["couchdb@node1"].ErlangVersion)
+	check(t, "node2 erlang", "24.3.2", versions["couchdb@node2"].ErlangVersion)
+	check(t, "JS engine", "spidermonkey", versions["couchdb@node1"].JavaScriptEngine.Name)
+	check(t, "collators", []string{"153.112"}, versions["couchdb@node1"].CollationDriver.CollatorVersions)
+}
+
+func TestRestartNode(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("POST /_node/_local/_restart", func(resp ResponseWriter, req *Request) {
+		check(t, "content type", "application/json", req.Header.Get("content-type"))
+		io.WriteString(resp, `{"ok": true}`)
+	})
+	c.Handle("POST /_node/couchdb%40node1/_restart", func(resp ResponseWriter, req *Request) {
+		resp.WriteHeader(StatusNotFound)
+		io.WriteString(resp, `{"error": "not_found", "reason": "missing"}`)
+	})
+
+	if err := c.RestartNode(""); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RestartNode("couchdb@node1"); !couchdb.NotFound(err) {
+		t.Fatalf("expected NotFound error, got %v", err)
+	}
+}
@@ -1,10 +1,13 @@
 package couchdb
 
 import (
+	"bytes"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 )
 
 // Attachment represents document attachments.
@@ -73,23 +76,17 @@ func (db *DB) PutAttachment(docid string, att *Attachment, rev string) (newrev s
 		return rev, fmt.Errorf("couchdb.PutAttachment: nil attachment Body")
 	}
 
-	path := db.path().docID(docid).addRaw(att.Name).rev(rev)
-	req, err := db.newRequest("PUT", path, att.Body)
+	path := db.path().docID(docid).addRaw(att.Name)
+	req, err := db.newRevRequest("PUT", path, rev, att.Body)
 	if err != nil {
 		return rev, err
 	}
 	req.Header.Set("content-type", att.Type)
-
-	resp, err := db.http.Do(req)
+	newrev, err = writeRev(db.do(req))
 	if err != nil {
 		return rev, err
 	}
-	var result struct{ Rev string }
-	if err := readBody(resp, &result); err != nil {
-		// TODO: close body if it implements io.ReadCloser
-		return rev, fmt.Errorf("couchdb.PutAttachment: couldn't decode rev: %v", err)
-	}
-	return result.Rev, nil
+	return newrev, nil
 }
 
 // DeleteAttachment removes an attachment.
@@ -101,9 +98,85 @@ func (db *DB) DeleteAttachment(docid, name, rev string) (newrev string, err erro
 		return rev, fmt.Errorf("couchdb.PutAttachment: empty name")
 	}
 
-	path := db.path().docID(docid).addRaw(name).rev(rev)
-	resp, err := db.closedRequest("DELETE", path, nil)
-	return responseRev(resp, err)
+	path := db.path().docID(docid).addRaw(name)
+	return writeRev(db.revRequest("DELETE", path, rev, nil))
+}
+
+// PutKeepAttachments stores a document like Put, but keeps the attachments
+// of the current revision if the encoded document has no _attachments field.
+// A plain Put of such a document, e.g. from a struct without an _attachments
+// field, removes all attachments.
+//
+// The attachment stubs are read from revision rev, which must be the current
+// revision of the document.
+func (db *DB) PutKeepAttachments(id string, doc interface{}, rev string) (newrev string, err error) {
+	enc, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(enc, &fields); err != nil {
+		return "", fmt.Errorf("couchdb.PutKeepAttachments: document is not a JSON object")
+	}
+	if rev == "" {
+		rev = docRev(enc)
+	}
+	if _, ok := fields["_attachments"]; !ok && rev != "" {
+		var current struct {
+			Attachments json.RawMessage `json:"_attachments"`
+		}
+		err := db.Get(id, &current, Options{"rev": rev})
+		if err != nil && !NotFound(err) {
+			return "", err
+		}
+		if current.Attachments != nil {
+			fields["_attachments"] = current.Attachments
+			if enc, err = json.Marshal(fields); err != nil {
+				return "", err
+			}
+		}
+	}
+	return db.Put(id, json.RawMessage(enc), rev)
+}
+
+// InlineAttachment is an attachment as it appears in the _attachments field
+// of a document. Data is only present when the document was requested with
+// the "attachments" option. Encoding and EncodedLength are set when the
+// "att_encoding_info" option is used and the attachment is stored compressed.
+type InlineAttachment struct {
+	ContentType   string `json:"content_type"`
+	Data          []byte `json:"data,omitempty"`
+	Digest        string `json:"digest,omitempty"`
+	Length        int64  `json:"length,omitempty"`
+	RevPos        int    `json:"revpos,omitempty"`
+	Stub          bool   `json:"stub,omitempty"`
+	Encoding      string `json:"encoding,omitempty"`
+	EncodedLength int64  `json:"encoded_length,omitempty"`
+}
+
+// InlineAttachments decodes the _attachments field of an encoded document.
+// It returns nil if the document has no attachments.
+func InlineAttachments(doc json.RawMessage) (map[string]*InlineAttachment, error) {
+	var d struct {
+		Attachments map[string]*InlineAttachment `json:"_attachments"`
+	}
+	if err := json.Unmarshal(doc, &d); err != nil {
+		return nil, fmt.Errorf("couchdb: can't decode attachments: %v", err)
+	}
+	return d.Attachments, nil
+}
+
+// Attachment converts an inline attachment to an Attachment. The Body is
+// nil for stubs. MD5 is set if the digest is an MD5 checksum.
+func (a *InlineAttachment) Attachment(name string) *Attachment {
+	att := &Attachment{Name: name, Type: a.ContentType}
+	if !a.Stub {
+		att.Body = bytes.NewReader(a.Data)
+	}
+	if strings.HasPrefix(a.Digest, "md5-") {
+		att.MD5, _ = base64.StdEncoding.DecodeString(a.Digest[4:])
+	}
+	return att
 }
 
 func attFromHeaders(name string, resp *http.Response) (*Attachment, error) {
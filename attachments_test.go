@@ -100,6 +100,36 @@ func TestPutAttachment(t *testing.T) {
 	check(t, "att.MD5", []byte(nil), att.MD5)
 }
 
+func TestPutAttachmentETag(t *testing.T) {
+	c := newTestClient(t)
+	c.SetUseIfMatch(true)
+	c.Handle("PUT /db/doc/att", func(resp ResponseWriter, req *Request) {
+		check(t, "If-Match header", "1-619db7ba8551c0de3f3a178775509611", req.Header.Get("If-Match"))
+		resp.Header().Set("ETag", `"2-619db7ba8551c0de3f3a178775509611"`)
+		resp.WriteHeader(StatusAccepted)
+		io.WriteString(resp, `{"ok": true, "id": "doc", "rev": "2-619db7ba8551c0de3f3a178775509611"}`)
+	})
+	att := &couchdb.Attachment{Name: "att", Type: "text/plain", Body: bytes.NewBufferString("x")}
+	newrev, err := c.DB("db").PutAttachment("doc", att, "1-619db7ba8551c0de3f3a178775509611")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "newrev", "2-619db7ba8551c0de3f3a178775509611", newrev)
+}
+
+func TestPutAttachmentConflict(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("PUT /db/doc/att", func(resp ResponseWriter, req *Request) {
+		resp.WriteHeader(StatusConflict)
+		io.WriteString(resp, `{"error": "conflict", "reason": "Document update conflict."}`)
+	})
+	att := &couchdb.Attachment{Name: "att", Type: "text/plain", Body: bytes.NewBufferString("x")}
+	_, err := c.DB("db").PutAttachment("doc", att, "1-619db7ba8551c0de3f3a178775509611")
+	if !couchdb.Conflict(err) {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+}
+
 func TestDeleteAttachment(t *testing.T) {
 	c := newTestClient(t)
 	c.Handle("DELETE /db/doc/attachment/1",
@@ -123,3 +153,37 @@ func TestDeleteAttachment(t *testing.T) {
 
 	check(t, "newrev", "2-619db7ba8551c0de3f3a178775509611", newrev)
 }
+
+func TestPutKeepAttachments(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/doc", func(resp ResponseWriter, req *Request) {
+		check(t, "request query string", "rev=1-619db7ba8551c0de3f3a178775509611", req.URL.RawQuery)
+		io.WriteString(resp, `{
+			"_id": "doc",
+			"_rev": "1-619db7ba8551c0de3f3a178775509611",
+			"_attachments": {"a.txt": {"content_type": "text/plain", "revpos": 1, "stub": true}}
+		}`)
+	})
+	c.Handle("PUT /db/doc", func(resp ResponseWriter, req *Request) {
+		var body map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&body)
+		expected := map[string]interface{}{
+			"_rev":  "1-619db7ba8551c0de3f3a178775509611",
+			"field": float64(2),
+			"_attachments": map[string]interface{}{
+				"a.txt": map[string]interface{}{"content_type": "text/plain", "revpos": float64(1), "stub": true},
+			},
+		}
+		check(t, "request body", expected, body)
+		resp.Header().Set("ETag", `"2-619db7ba8551c0de3f3a178775509611"`)
+		resp.WriteHeader(StatusCreated)
+		io.WriteString(resp, `{"id": "doc", "ok": true, "rev": "2-619db7ba8551c0de3f3a178775509611"}`)
+	})
+
+	doc := &testDocument{Rev: "1-619db7ba8551c0de3f3a178775509611", Field: 2}
+	newrev, err := c.DB("db").PutKeepAttachments("doc", doc, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "newrev", "2-619db7ba8551c0de3f3a178775509611", newrev)
+}
@@ -0,0 +1,170 @@
+package couchdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AuditOptions configures an Auditor.
+type AuditOptions struct {
+	// SampleRate is the fraction of writes that are recorded.
+	// The default is 1, i.e. all writes are recorded.
+	SampleRate float64
+
+	// Actor returns the actor responsible for a write,
+	// e.g. the user of the current request.
+	Actor func(*WriteEvent) string
+
+	// If Diff is true, updated documents are compared with their
+	// previous revision and the names of changed fields are recorded.
+	// This requires reading the previous revision after each update.
+	Diff bool
+
+	// FlushInterval is the maximum time entries are buffered before
+	// they are written. The default is one second.
+	FlushInterval time.Duration
+}
+
+// AuditEntry is the audit database document that records a write.
+type AuditEntry struct {
+	Type    string    `json:"type"` // always "audit"
+	Time    time.Time `json:"time"`
+	Actor   string    `json:"actor,omitempty"`
+	DB      string    `json:"db"`
+	DocID   string    `json:"doc_id"`
+	Op      string    `json:"op"`
+	PrevRev string    `json:"prev_rev,omitempty"`
+	Rev     string    `json:"rev,omitempty"`
+	Deleted bool      `json:"deleted,omitempty"`
+	Changed []string  `json:"changed,omitempty"` // set if AuditOptions.Diff is enabled
+	Error   string    `json:"error,omitempty"`
+}
+
+// Auditor records writes as AuditEntry documents in an audit database.
+// Entries are buffered and stored by a BulkWriter. Writes to the audit
+// database itself are never recorded.
+type Auditor struct {
+	opts AuditOptions
+	w    *BulkWriter
+	ids  IDGenerator
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// NewAuditor creates an auditor that stores entries in auditDB.
+// Close must be called to write buffered entries.
+func NewAuditor(auditDB *DB, opts AuditOptions) *Auditor {
+	if opts.SampleRate <= 0 || opts.SampleRate > 1 {
+		opts.SampleRate = 1
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	target := *auditDB
+	target.hooks = nil
+	return &Auditor{
+		opts: opts,
+		w:    target.NewBulkWriter(BulkWriterOptions{FlushInterval: opts.FlushInterval}),
+		ids:  UUIDv7(),
+		rnd:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Attach returns a copy of db whose writes are recorded.
+func (a *Auditor) Attach(db *DB) *DB {
+	return db.WithAfterWrite(a.record)
+}
+
+// AttachClient records the writes of all database objects
+// created by the client after the call.
+func (a *Auditor) AttachClient(c *Client) {
+	c.AddWriteHooks(nil, a.record)
+}
+
+// Flush writes buffered entries. It returns a *BulkError if
+// entries could not be stored.
+func (a *Auditor) Flush() error {
+	return a.w.Flush()
+}
+
+// Close writes buffered entries and stops the auditor.
+// Writes performed after Close are not recorded.
+func (a *Auditor) Close() error {
+	return a.w.Close()
+}
+
+func (a *Auditor) record(ev *WriteEvent) {
+	if a.opts.SampleRate < 1 {
+		a.mu.Lock()
+		skip := a.rnd.Float64() >= a.opts.SampleRate
+		a.mu.Unlock()
+		if skip {
+			return
+		}
+	}
+	entry := &AuditEntry{
+		Type:    "audit",
+		Time:    time.Now().UTC(),
+		DB:      ev.DB.Name(),
+		DocID:   ev.ID,
+		Op:      ev.Op,
+		PrevRev: ev.Rev,
+		Rev:     ev.NewRev,
+		Deleted: ev.Delete,
+	}
+	if a.opts.Actor != nil {
+		entry.Actor = a.opts.Actor(ev)
+	}
+	if ev.Err != nil {
+		entry.Error = ev.Err.Error()
+	} else if a.opts.Diff && ev.Doc != nil {
+		entry.Changed = changedFields(ev)
+	}
+	// Errors are ignored here. The writer fails only after Close.
+	a.w.Put(a.ids.NewID(), entry, "")
+}
+
+// changedFields returns the names of top-level fields that differ between
+// the written document and its previous revision. For new documents, all
+// fields are returned.
+func changedFields(ev *WriteEvent) []string {
+	var prev map[string]json.RawMessage
+	if ev.Rev != "" {
+		if err := ev.DB.Get(ev.ID, &prev, Options{"rev": ev.Rev}); err != nil {
+			return nil
+		}
+	}
+	var changed []string
+	for k, v := range ev.Doc {
+		if k == "_id" || k == "_rev" {
+			continue
+		}
+		if old, ok := prev[k]; !ok || !jsonEqual(old, v) {
+			changed = append(changed, k)
+		}
+	}
+	for k := range prev {
+		if _, ok := ev.Doc[k]; !ok && k != "_id" && k != "_rev" {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// jsonEqual compares encoded JSON values, ignoring formatting.
+func jsonEqual(a, b json.RawMessage) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	var ca, cb bytes.Buffer
+	if json.Compact(&ca, a) != nil || json.Compact(&cb, b) != nil {
+		return false
+	}
+	return bytes.Equal(ca.Bytes(), cb.Bytes())
+}
@@ -0,0 +1,99 @@
+package couchdb_test
+
+import (
+	"io"
+	. "net/http"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestAuditor(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("PUT /db/a", func(resp ResponseWriter, req *Request) {
+		resp.Header().Set("ETag", `"2-b"`)
+		resp.WriteHeader(StatusCreated)
+		io.WriteString(resp, `{"ok": true, "id": "a", "rev": "2-b"}`)
+	})
+	c.Handle("GET /db/a", func(resp ResponseWriter, req *Request) {
+		check(t, "rev of previous revision", "1-a", req.URL.Query().Get("rev"))
+		io.WriteString(resp, `{"_id": "a", "_rev": "1-a", "field": 1, "old": true}`)
+	})
+	c.Handle("DELETE /db/b", func(resp ResponseWriter, req *Request) {
+		resp.WriteHeader(StatusConflict)
+		io.WriteString(resp, `{"error": "conflict", "reason": "Document update conflict."}`)
+	})
+	var entries []map[string]interface{}
+	c.Handle("POST /audit/_bulk_docs", func(resp ResponseWriter, req *Request) {
+		docs := bulkRequest(t, req)
+		entries = append(entries, docs...)
+		io.WriteString(resp, `[{"id": "x", "rev": "1-x"}, {"id": "y", "rev": "1-y"}]`)
+	})
+
+	auditor := couchdb.NewAuditor(c.DB("audit"), couchdb.AuditOptions{
+		Diff:  true,
+		Actor: func(*couchdb.WriteEvent) string { return "bob" },
+	})
+	db := auditor.Attach(c.DB("db"))
+	if _, err := db.Put("a", &testDocument{Rev: "1-a", Field: 2}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Delete("b", "1-b"); err == nil {
+		t.Fatal("expected conflict error")
+	}
+	if err := auditor.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("got %d audit entries, want 2", len(entries))
+	}
+	for _, e := range entries {
+		if e["_id"] == "" || e["time"] == "" {
+			t.Errorf("entry lacks id or time: %v", e)
+		}
+		delete(e, "_id")
+		delete(e, "time")
+	}
+	check(t, "put entry", map[string]interface{}{
+		"type":     "audit",
+		"actor":    "bob",
+		"db":       "db",
+		"doc_id":   "a",
+		"op":       "put",
+		"prev_rev": "1-a",
+		"rev":      "2-b",
+		"changed":  []interface{}{"field", "old"},
+	}, entries[0])
+	check(t, "delete entry", map[string]interface{}{
+		"type":     "audit",
+		"actor":    "bob",
+		"db":       "db",
+		"doc_id":   "b",
+		"op":       "delete",
+		"prev_rev": "1-b",
+		"deleted":  true,
+		"error":    "DELETE http://testClient:5984/db/b?rev=1-b: (409) conflict: Document update conflict.",
+	}, entries[1])
+}
+
+func TestAuditorSampling(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("PUT /db/a", func(resp ResponseWriter, req *Request) {
+		resp.Header().Set("ETag", `"1-a"`)
+		resp.WriteHeader(StatusCreated)
+		io.WriteString(resp, `{"ok": true, "id": "a", "rev": "1-a"}`)
+	})
+	auditor := couchdb.NewAuditor(c.DB("audit"), couchdb.AuditOptions{SampleRate: 1e-9})
+	db := auditor.Attach(c.DB("db"))
+	for i := 0; i < 10; i++ {
+		if _, err := db.Put("a", &testDocument{Field: 1}, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// No handler is registered for the audit database, so Close would
+	// fail if any entry had been recorded.
+	if err := auditor.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,13 +1,17 @@
 package couchdb
 
 import (
+	"bytes"
 	"crypto/hmac"
 	"crypto/sha1"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 )
 
 // Auth is implemented by HTTP authentication mechanisms.
@@ -17,6 +21,25 @@ type Auth interface {
 	AddAuth(*http.Request)
 }
 
+// Refresher is an optional interface for Auth implementations whose
+// credentials expire, e.g. session cookies or bearer tokens.
+//
+// When a request fails with status 401 and the client's Auth implements
+// Refresher, Refresh is called and the request is retried once with the new
+// credentials. Refresh receives the HTTP client and the server URL so it can
+// talk to the server, e.g. to obtain a new session. If Refresh fails, the
+// original 401 error is returned. Requests with bodies that cannot be
+// replayed are not retried.
+//
+// The failed argument is the rejected request. Concurrent requests fail
+// together when credentials expire, and implementations can use it to skip
+// refreshing credentials that were already renewed after it was sent.
+// It is nil if the client refreshes credentials without a failed request.
+type Refresher interface {
+	Auth
+	Refresh(client *http.Client, serverURL string, failed *http.Request) error
+}
+
 type basicauth string
 
 // BasicAuth returns an Auth that performs HTTP Basic Authentication.
@@ -56,3 +79,103 @@ func (a proxyauth) AddAuth(req *http.Request) {
 		req.Header.Set("X-Auth-CouchDB-Token", a.tok)
 	}
 }
+
+type sessionauth struct {
+	username, password string
+
+	mu       sync.Mutex
+	cookie   string
+	inflight *sessionLogin
+}
+
+type sessionLogin struct {
+	done chan struct{}
+	err  error
+}
+
+// SessionAuth returns an Auth that performs CouchDB cookie authentication.
+// The session is created on the first request that fails with status 401
+// and is renewed in the same way when it expires.
+//
+// The returned Auth holds the session cookie. It can be set on any number of
+// clients, which then share a single session. Concurrent renewals are
+// coalesced into one login request.
+func SessionAuth(username, password string) Auth {
+	return &sessionauth{username: username, password: password}
+}
+
+func (a *sessionauth) AddAuth(req *http.Request) {
+	a.mu.Lock()
+	cookie := a.cookie
+	a.mu.Unlock()
+	if cookie == "" {
+		return
+	}
+	// Replace the cookie of an expired session when retrying a request.
+	// CouchDB uses the first AuthSession cookie it finds.
+	cookies := req.Cookies()
+	req.Header.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != "AuthSession" {
+			req.AddCookie(c)
+		}
+	}
+	req.AddCookie(&http.Cookie{Name: "AuthSession", Value: cookie})
+}
+
+func (a *sessionauth) Refresh(client *http.Client, serverURL string, failed *http.Request) error {
+	a.mu.Lock()
+	if failed != nil && a.renewedSince(failed) {
+		a.mu.Unlock()
+		return nil
+	}
+	if l := a.inflight; l != nil {
+		a.mu.Unlock()
+		<-l.done
+		return l.err
+	}
+	l := &sessionLogin{done: make(chan struct{})}
+	a.inflight = l
+	a.mu.Unlock()
+
+	cookie, err := a.login(client, serverURL)
+	a.mu.Lock()
+	if err == nil {
+		a.cookie = cookie
+	}
+	a.inflight = nil
+	a.mu.Unlock()
+	l.err = err
+	close(l.done)
+	return err
+}
+
+// renewedSince reports whether the session has been renewed since req
+// was sent, i.e. whether req can be retried without logging in again.
+// It must be called with a.mu held.
+func (a *sessionauth) renewedSince(req *http.Request) bool {
+	sent, err := req.Cookie("AuthSession")
+	return a.cookie != "" && (err != nil || sent.Value != a.cookie)
+}
+
+func (a *sessionauth) login(client *http.Client, serverURL string) (string, error) {
+	body, _ := json.Marshal(map[string]string{"name": a.username, "password": a.password})
+	req, err := http.NewRequest("POST", serverURL+"/_session", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	} else if resp.StatusCode >= 400 {
+		return "", parseError(req, resp)
+	}
+	resp.Body.Close()
+	for _, c := range resp.Cookies() {
+		if c.Name == "AuthSession" {
+			return c.Value, nil
+		}
+	}
+	return "", errors.New("couchdb: no AuthSession cookie in _session response")
+}
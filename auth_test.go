@@ -1,9 +1,15 @@
 package couchdb_test
 
 import (
-	"github.com/fjl/go-couchdb"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
+
+	"github.com/fjl/go-couchdb"
 )
 
 func TestBasicAuth(t *testing.T) {
@@ -48,3 +54,196 @@ func TestProxyAuthWithToken(t *testing.T) {
 	}
 	check(t, "req headers", expected, req.Header)
 }
+
+type tokenAuth struct {
+	token     string
+	refreshes int
+	serverURL string
+}
+
+func (a *tokenAuth) AddAuth(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+a.token)
+}
+
+func (a *tokenAuth) Refresh(client *http.Client, serverURL string, failed *http.Request) error {
+	a.refreshes++
+	a.serverURL = serverURL
+	a.token = "fresh"
+	return nil
+}
+
+func TestRefresher(t *testing.T) {
+	c := newTestClient(t)
+	auth := &tokenAuth{token: "expired"}
+	c.SetAuth(auth)
+	c.Handle("PUT /db/doc", func(resp http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		check(t, "request body", `{"field":1}`, string(body))
+		if req.Header.Get("Authorization") != "Bearer fresh" {
+			resp.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(resp, `{"error": "unauthorized", "reason": "token expired"}`)
+			return
+		}
+		resp.Header().Set("ETag", `"1-619db7ba8551c0de3f3a178775509611"`)
+		resp.WriteHeader(http.StatusCreated)
+		io.WriteString(resp, `{"id": "doc", "ok": true, "rev": "1-619db7ba8551c0de3f3a178775509611"}`)
+	})
+
+	rev, err := c.DB("db").Put("doc", &testDocument{Field: 1}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "rev", "1-619db7ba8551c0de3f3a178775509611", rev)
+	check(t, "refreshes", 1, auth.refreshes)
+	check(t, "serverURL", "http://testClient:5984", auth.serverURL)
+
+	// The request is retried only once.
+	auth.token = "bad"
+	c.Handle("GET /db/doc", func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(resp, `{"error": "unauthorized", "reason": "bad token"}`)
+	})
+	var doc testDocument
+	err = c.DB("db").Get("doc", &doc, nil)
+	check(t, "Unauthorized(err)", true, couchdb.Unauthorized(err))
+	check(t, "refreshes", 2, auth.refreshes)
+}
+
+// These tests use vectors from the AWS Signature Version 4 test suite.
+func TestSigV4Auth(t *testing.T) {
+	tests := []struct {
+		method, url string
+		expected    string
+	}{
+		{
+			"GET", "https://example.amazonaws.com/",
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			"GET", "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			"POST", "https://example.amazonaws.com/",
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+	}
+	auth := couchdb.SigV4Auth("AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "", "us-east-1", "service")
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, test.url, nil)
+		req.Header.Set("X-Amz-Date", "20150830T123600Z")
+		auth.AddAuth(req)
+		check(t, test.method+" "+test.url, test.expected, req.Header.Get("Authorization"))
+	}
+}
+
+func TestSessionAuth(t *testing.T) {
+	auth := couchdb.SessionAuth("user", "pass")
+	logins := 0
+	login := func(resp http.ResponseWriter, req *http.Request) {
+		logins++
+		body, _ := ioutil.ReadAll(req.Body)
+		check(t, "login body", `{"name":"user","password":"pass"}`, string(body))
+		http.SetCookie(resp, &http.Cookie{Name: "AuthSession", Value: "c1", Path: "/"})
+		io.WriteString(resp, `{"ok": true, "name": "user", "roles": []}`)
+	}
+	getdoc := func(resp http.ResponseWriter, req *http.Request) {
+		if c, err := req.Cookie("AuthSession"); err != nil || c.Value != "c1" {
+			resp.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(resp, `{"error": "unauthorized", "reason": "You are not authorized to access this db."}`)
+			return
+		}
+		io.WriteString(resp, `{"field": 1}`)
+	}
+
+	// Two clients share the session.
+	c1, c2 := newTestClient(t), newTestClient(t)
+	for _, c := range []*testClient{c1, c2} {
+		c.SetAuth(auth)
+		c.Handle("POST /_session", login)
+		c.Handle("GET /db/doc", getdoc)
+	}
+	var doc testDocument
+	if err := c1.DB("db").Get("doc", &doc, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c2.DB("db").Get("doc", &doc, nil); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "logins", 1, logins)
+}
+
+func TestSessionAuthRenewal(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		session = 1 // number of the valid session cookie
+		logins  = 0
+		expired sync.WaitGroup
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/_session" {
+			mu.Lock()
+			logins++
+			session++
+			cookie := fmt.Sprint("c", session)
+			mu.Unlock()
+			http.SetCookie(resp, &http.Cookie{Name: "AuthSession", Value: cookie, Path: "/"})
+			io.WriteString(resp, `{"ok": true, "name": "user", "roles": []}`)
+			return
+		}
+		mu.Lock()
+		want := fmt.Sprint("c", session)
+		mu.Unlock()
+		var sent []string
+		for _, c := range req.Cookies() {
+			if c.Name == "AuthSession" {
+				sent = append(sent, c.Value)
+			}
+		}
+		if len(sent) != 1 || sent[0] != want {
+			if len(sent) > 0 {
+				// Expired session: wait until all concurrent
+				// requests have been rejected.
+				expired.Done()
+				expired.Wait()
+			}
+			resp.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(resp, `{"error": "unauthorized", "reason": "You are not authorized to access this db."}`)
+			return
+		}
+		io.WriteString(resp, `{"field": 1}`)
+	}))
+	defer srv.Close()
+	c, err := couchdb.NewClient(srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetAuth(couchdb.SessionAuth("user", "pass"))
+
+	var doc testDocument
+	if err := c.DB("db").Get("doc", &doc, nil); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "logins", 1, logins)
+
+	// The server expires the session while three requests are made.
+	// All of them must succeed with a single new login.
+	mu.Lock()
+	session++
+	mu.Unlock()
+	const n = 3
+	expired.Add(n)
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			var doc testDocument
+			errs <- c.DB("db").Get("doc", &doc, nil)
+		}()
+	}
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Error("request after expiry failed:", err)
+		}
+	}
+	check(t, "logins", 2, logins)
+}
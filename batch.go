@@ -0,0 +1,184 @@
+package couchdb
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Batch stages document writes that are applied together by Commit.
+//
+// CouchDB has no transactions. If some writes of a batch fail, Commit
+// attempts to undo the successful ones: created documents are deleted and
+// updated or deleted documents are restored to their previous content as a
+// new revision. Rollback is best effort; other clients may observe the
+// intermediate state and may modify the documents concurrently.
+type Batch struct {
+	db  *DB
+	ops []*bulkOp
+}
+
+// NewBatch creates an empty batch for the database.
+func (db *DB) NewBatch() *Batch {
+	return &Batch{db: db}
+}
+
+// Put stages a document write. The rev argument is the current revision of
+// the document and must be empty for new documents. If rev is empty and doc
+// contains a _rev field, that revision is used.
+func (b *Batch) Put(id string, doc interface{}, rev string) error {
+	op, err := newBulkOp(id, doc, rev)
+	if err != nil {
+		return err
+	}
+	b.ops = append(b.ops, op)
+	return nil
+}
+
+// Delete stages the deletion of a document revision.
+func (b *Batch) Delete(id, rev string) {
+	op := &bulkOp{doc: map[string]json.RawMessage{"_deleted": json.RawMessage("true")}}
+	op.doc["_id"], _ = json.Marshal(id)
+	op.setRev(rev)
+	b.ops = append(b.ops, op)
+}
+
+// Len returns the number of staged writes.
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// BatchError is returned by Batch.Commit if some writes failed.
+type BatchError struct {
+	// Failed contains the results of the writes that failed.
+	Failed []BulkResult
+
+	// RolledBack contains the IDs of documents whose successful
+	// write was undone.
+	RolledBack []string
+
+	// RollbackFailed contains the results of undo operations that failed.
+	// These documents remain in the state written by the batch.
+	RollbackFailed []BulkResult
+}
+
+func (e *BatchError) Error() string {
+	msg := fmt.Sprintf("couchdb: %d batch write(s) failed (first: %s: %s: %s)",
+		len(e.Failed), e.Failed[0].ID, e.Failed[0].Error, e.Failed[0].Reason)
+	if len(e.RollbackFailed) > 0 {
+		msg += fmt.Sprintf(", %d write(s) could not be rolled back", len(e.RollbackFailed))
+	}
+	return msg
+}
+
+// Commit applies the staged writes in a single _bulk_docs request. On success
+// it returns the results of all writes. If some writes fail, the successful
+// ones are rolled back and a *BatchError describes the outcome. Other errors
+// mean that the request failed; its writes may or may not have been applied.
+//
+// The batch is empty after Commit returns.
+func (b *Batch) Commit() ([]BulkResult, error) {
+	ops := b.ops
+	b.ops = nil
+	if len(ops) == 0 {
+		return nil, nil
+	}
+
+	// Read the current content of updated documents,
+	// which is needed to restore them.
+	prev, err := b.currentDocs(ops)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]interface{}, len(ops))
+	for i, op := range ops {
+		docs[i] = op.doc
+	}
+	results, err := b.db.BulkDocs(docs)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != len(ops) {
+		return nil, fmt.Errorf("couchdb: _bulk_docs returned %d results for %d documents", len(results), len(ops))
+	}
+
+	batchErr := new(BatchError)
+	var undo []interface{}
+	for i, res := range results {
+		if res.Error != "" {
+			batchErr.Failed = append(batchErr.Failed, res)
+			continue
+		}
+		undo = append(undo, undoDoc(res, prev[ops[i].id()]))
+	}
+	if len(batchErr.Failed) == 0 {
+		return results, nil
+	}
+	if len(undo) > 0 {
+		undoResults, err := b.db.BulkDocs(undo)
+		for i, doc := range undo {
+			id := doc.(map[string]json.RawMessage)["_id"]
+			var res BulkResult
+			json.Unmarshal(id, &res.ID)
+			switch {
+			case err != nil:
+				res.Error, res.Reason = "request_failed", err.Error()
+			case i >= len(undoResults):
+				res.Error, res.Reason = "missing_result", "no result from _bulk_docs"
+			default:
+				res = undoResults[i]
+			}
+			if res.Error != "" {
+				batchErr.RollbackFailed = append(batchErr.RollbackFailed, res)
+			} else {
+				batchErr.RolledBack = append(batchErr.RolledBack, res.ID)
+			}
+		}
+	}
+	return results, batchErr
+}
+
+// currentDocs fetches the current content of documents that are
+// updated by ops.
+func (b *Batch) currentDocs(ops []*bulkOp) (map[string]map[string]json.RawMessage, error) {
+	var keys []string
+	for _, op := range ops {
+		if op.doc["_rev"] != nil {
+			keys = append(keys, op.id())
+		}
+	}
+	prev := make(map[string]map[string]json.RawMessage)
+	if len(keys) == 0 {
+		return prev, nil
+	}
+	var result struct {
+		Rows []struct {
+			ID  string                     `json:"id"`
+			Doc map[string]json.RawMessage `json:"doc"`
+		} `json:"rows"`
+	}
+	if err := b.db.AllDocs(&result, Options{"keys": keys, "include_docs": true}); err != nil {
+		return nil, err
+	}
+	for _, row := range result.Rows {
+		if row.Doc != nil {
+			prev[row.ID] = row.Doc
+		}
+	}
+	return prev, nil
+}
+
+// undoDoc creates the document that reverts a successful write. If the
+// document existed before, its previous content is restored on top of
+// the new revision. Otherwise the new revision is deleted.
+func undoDoc(res BulkResult, prev map[string]json.RawMessage) map[string]json.RawMessage {
+	doc := make(map[string]json.RawMessage, len(prev)+2)
+	if prev == nil {
+		doc["_deleted"] = json.RawMessage("true")
+	}
+	for k, v := range prev {
+		doc[k] = v
+	}
+	doc["_id"], _ = json.Marshal(res.ID)
+	doc["_rev"], _ = json.Marshal(res.Rev)
+	return doc
+}
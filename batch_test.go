@@ -0,0 +1,84 @@
+package couchdb_test
+
+import (
+	"io"
+	. "net/http"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestBatchCommit(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/_all_docs", func(resp ResponseWriter, req *Request) {
+		check(t, "keys", `["b"]`, req.URL.Query().Get("keys"))
+		io.WriteString(resp, `{"rows": [{"id": "b", "doc": {"_id": "b", "_rev": "1-b", "field": 1}}]}`)
+	})
+	var requests [][]map[string]interface{}
+	c.Handle("POST /db/_bulk_docs", func(resp ResponseWriter, req *Request) {
+		requests = append(requests, bulkRequest(t, req))
+		io.WriteString(resp, `[{"id": "a", "rev": "1-a"}, {"id": "b", "rev": "2-b"}]`)
+	})
+
+	b := c.DB("db").NewBatch()
+	b.Put("a", &testDocument{Field: 1}, "")
+	b.Put("b", &testDocument{Field: 2}, "1-b")
+	results, err := b.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "results", []couchdb.BulkResult{{ID: "a", Rev: "1-a"}, {ID: "b", Rev: "2-b"}}, results)
+	check(t, "request count", 1, len(requests))
+	check(t, "batch len after commit", 0, b.Len())
+}
+
+func TestBatchRollback(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/_all_docs", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"rows": [
+			{"id": "b", "doc": {"_id": "b", "_rev": "1-b", "field": 1}},
+			{"id": "d", "doc": {"_id": "d", "_rev": "4-d", "field": 4}}
+		]}`)
+	})
+	var requests [][]map[string]interface{}
+	c.Handle("POST /db/_bulk_docs", func(resp ResponseWriter, req *Request) {
+		requests = append(requests, bulkRequest(t, req))
+		if len(requests) == 1 {
+			io.WriteString(resp, `[
+				{"id": "a", "rev": "1-a"},
+				{"id": "b", "rev": "2-b"},
+				{"id": "c", "error": "forbidden", "reason": "invalid"},
+				{"id": "d", "rev": "5-d"}
+			]`)
+		} else {
+			io.WriteString(resp, `[
+				{"id": "a", "rev": "2-a"},
+				{"id": "b", "error": "conflict", "reason": "Document update conflict."},
+				{"id": "d", "rev": "6-d"}
+			]`)
+		}
+	})
+
+	b := c.DB("db").NewBatch()
+	b.Put("a", &testDocument{Field: 1}, "")
+	b.Put("b", &testDocument{Field: 2}, "1-b")
+	b.Put("c", &testDocument{Field: 3}, "")
+	b.Delete("d", "4-d")
+	_, err := b.Commit()
+
+	batchErr, ok := err.(*couchdb.BatchError)
+	if !ok {
+		t.Fatalf("expected *couchdb.BatchError, got %#v", err)
+	}
+	check(t, "failed", []couchdb.BulkResult{{ID: "c", Error: "forbidden", Reason: "invalid"}}, batchErr.Failed)
+	check(t, "rolled back", []string{"a", "d"}, batchErr.RolledBack)
+	check(t, "rollback failed", []couchdb.BulkResult{
+		{ID: "b", Error: "conflict", Reason: "Document update conflict."},
+	}, batchErr.RollbackFailed)
+
+	check(t, "undo request", []map[string]interface{}{
+		{"_id": "a", "_rev": "1-a", "_deleted": true},
+		{"_id": "b", "_rev": "2-b", "field": float64(1)},
+		{"_id": "d", "_rev": "5-d", "field": float64(4)},
+	}, requests[1])
+}
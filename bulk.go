@@ -0,0 +1,482 @@
+package couchdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// BulkResult is the outcome of a single document update in a
+// _bulk_docs request.
+type BulkResult struct {
+	ID  string `json:"id"`
+	Rev string `json:"rev,omitempty"`
+
+	// These two fields are set if the update failed.
+	Error  string `json:"error,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Err returns the error of a failed update as a *DocError, or nil if
+// the update succeeded. The error works with the Conflict, Forbidden,
+// Unauthorized and NotFound helpers.
+func (r BulkResult) Err() error {
+	if r.Error == "" {
+		return nil
+	}
+	return docError(r.ID, r.Error, r.Reason)
+}
+
+// DocError is the error of a single document in a bulk request.
+type DocError struct {
+	ID         string // document ID
+	StatusCode int    // HTTP status corresponding to ErrorCode
+	ErrorCode  string // error reported by CouchDB, e.g. "conflict"
+	Reason     string // error message reported by CouchDB
+}
+
+func (e *DocError) Error() string {
+	return fmt.Sprintf("couchdb: document %q: %s: %s", e.ID, e.ErrorCode, e.Reason)
+}
+
+func docError(id, code, reason string) *DocError {
+	return &DocError{ID: id, StatusCode: docErrorStatus(code), ErrorCode: code, Reason: reason}
+}
+
+// bulkErrorStatus maps error codes reported for individual documents
+// of bulk requests to the equivalent HTTP status codes.
+var bulkErrorStatus = map[string]int{
+	"not_found":    http.StatusNotFound,
+	"conflict":     http.StatusConflict,
+	"forbidden":    http.StatusForbidden,
+	"unauthorized": http.StatusUnauthorized,
+	"bad_request":  http.StatusBadRequest,
+}
+
+// docErrorStatus returns the HTTP status code for a bulk error code.
+func docErrorStatus(code string) int {
+	if status, ok := bulkErrorStatus[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// BulkSummary aggregates the results of a bulk request.
+type BulkSummary struct {
+	OK        int // number of successful updates
+	Conflicts int // number of updates that failed with a conflict
+	Errors    int // number of updates that failed for other reasons
+
+	// Conflicted and Failed contain the indexes of failed updates
+	// in the results, which are also the indexes in the request.
+	Conflicted []int
+	Failed     []int
+}
+
+// SummarizeBulk counts the outcomes of a bulk request. Writers can use
+// the indexes in the summary to retry just the conflicting documents.
+func SummarizeBulk(results []BulkResult) BulkSummary {
+	var s BulkSummary
+	for i, r := range results {
+		switch {
+		case r.Error == "":
+			s.OK++
+		case r.Error == "conflict":
+			s.Conflicts++
+			s.Conflicted = append(s.Conflicted, i)
+		default:
+			s.Errors++
+			s.Failed = append(s.Failed, i)
+		}
+	}
+	return s
+}
+
+// BulkDocs stores multiple documents in a single request. The documents must
+// contain their _id and, for updates of existing documents, _rev fields.
+//
+// The returned slice contains one result for each document, in the same order
+// as docs. A nil error means that the request succeeded, individual
+// documents can still have failed. Use BulkResult.Err to get typed errors
+// for them and SummarizeBulk to count failures.
+//
+// http://docs.couchdb.org/en/latest/api/database/bulk-api.html#db-bulk-docs
+func (db *DB) BulkDocs(docs []interface{}) ([]BulkResult, error) {
+	var events []*WriteEvent
+	if db.hooks != nil {
+		var err error
+		if docs, events, err = db.beforeBulkWrite(docs); err != nil {
+			return nil, err
+		}
+	}
+	if err := db.checkBulkDocSizes(docs); err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(struct {
+		Docs []interface{} `json:"docs"`
+	}{docs})
+	if err != nil {
+		return nil, err
+	}
+	path := db.path().addRaw("_bulk_docs").path()
+	resp, err := db.request("POST", path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	var results []BulkResult
+	err = readBody(resp, &results)
+	if events != nil && err == nil {
+		for i, ev := range events {
+			if i >= len(results) {
+				break
+			}
+			if ev.ID == "" {
+				ev.ID = results[i].ID
+			}
+			db.afterWrite(ev, results[i].Rev, results[i].Err())
+		}
+	}
+	return results, err
+}
+
+// beforeBulkWrite runs the before hooks for all documents of a
+// _bulk_docs request and returns the modified documents.
+func (db *DB) beforeBulkWrite(docs []interface{}) ([]interface{}, []*WriteEvent, error) {
+	modified := make([]interface{}, len(docs))
+	events := make([]*WriteEvent, len(docs))
+	for i, doc := range docs {
+		body, err := json.Marshal(doc)
+		if err != nil {
+			return nil, nil, err
+		}
+		if events[i], body, err = db.beforeWrite("bulk", "", "", body); err != nil {
+			return nil, nil, err
+		}
+		modified[i] = json.RawMessage(body)
+	}
+	return modified, events, nil
+}
+
+// GetAllReport lists the documents that GetAll could not return.
+type GetAllReport struct {
+	Missing []string // documents that don't exist
+	Deleted []string // documents that have been deleted
+}
+
+// GetAll fetches the documents with the given IDs in a single request and
+// decodes them into out, which must be a pointer to a slice. Elements are
+// appended in the order of ids. Missing and deleted documents are skipped
+// and listed in the returned report.
+//
+//     var users []User
+//     report, err := db.GetAll([]string{"u1", "u2"}, &users)
+func (db *DB) GetAll(ids []string, out interface{}) (*GetAllReport, error) {
+	slice := reflect.ValueOf(out)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		return nil, fmt.Errorf("couchdb.GetAll: out must be a pointer to a slice, not %T", out)
+	}
+	slice = slice.Elem()
+	if ids == nil {
+		ids = []string{}
+	}
+
+	var result struct {
+		Rows []struct {
+			Key   string `json:"key"`
+			Error string `json:"error"`
+			Value struct {
+				Deleted bool `json:"deleted"`
+			} `json:"value"`
+			Doc json.RawMessage `json:"doc"`
+		} `json:"rows"`
+	}
+	if err := db.AllDocs(&result, Options{"keys": ids, "include_docs": true}); err != nil {
+		return nil, err
+	}
+	report := new(GetAllReport)
+	for _, row := range result.Rows {
+		switch {
+		case row.Error != "":
+			report.Missing = append(report.Missing, row.Key)
+		case row.Value.Deleted || len(row.Doc) == 0 || string(row.Doc) == "null":
+			report.Deleted = append(report.Deleted, row.Key)
+		default:
+			elem := reflect.New(slice.Type().Elem())
+			if err := db.newDecoder(bytes.NewReader(row.Doc)).Decode(elem.Interface()); err != nil {
+				return nil, fmt.Errorf("couchdb.GetAll: can't decode document %q: %v", row.Key, err)
+			}
+			slice.Set(reflect.Append(slice, elem.Elem()))
+		}
+	}
+	return report, nil
+}
+
+// BulkWriterOptions configures a BulkWriter.
+type BulkWriterOptions struct {
+	// MaxDocs is the number of buffered operations that triggers a flush.
+	// The default is 500.
+	MaxDocs int
+
+	// MaxBytes is the encoded size of buffered documents that triggers
+	// a flush. If zero, the size is not limited.
+	MaxBytes int
+
+	// FlushInterval is the maximum amount of time an operation is
+	// buffered. If zero, buffered operations are only written when
+	// one of the size limits is reached or Flush is called.
+	FlushInterval time.Duration
+
+	// ConflictRetries is the number of times a conflicting operation is
+	// retried using the current revision of the document. Retrying turns
+	// Put into an unconditional overwrite. If zero, conflicts are reported
+	// as errors.
+	ConflictRetries int
+}
+
+// BulkError is reported by BulkWriter when documents could not be written.
+type BulkError struct {
+	// Failed contains the results of all failed operations.
+	// If a whole request failed, the Reason of its operations
+	// is the request error.
+	Failed []BulkResult
+}
+
+func (e *BulkError) Error() string {
+	first := e.Failed[0]
+	return fmt.Sprintf("couchdb: %d bulk operation(s) failed (first: %s: %s: %s)",
+		len(e.Failed), first.ID, first.Error, first.Reason)
+}
+
+// BulkWriter buffers document updates and writes them using the _bulk_docs
+// API. Buffered operations are written when a size or time threshold is
+// reached, when Flush is called and when the writer is closed.
+//
+// Operations that fail are collected and returned as a *BulkError by
+// the next call to Flush or Close. It is safe to use a BulkWriter
+// from more than one goroutine. Batches filled by different goroutines
+// may be written concurrently, so the order in which operations on the
+// same document are applied is only defined within a single batch.
+type BulkWriter struct {
+	db   *DB
+	opts BulkWriterOptions
+
+	mu       sync.Mutex
+	ops      []*bulkOp
+	size     int
+	timer    *time.Timer
+	failed   []BulkResult
+	closed   bool
+	inflight int        // number of batches being written
+	idle     *sync.Cond // signaled when inflight drops to zero
+}
+
+// bulkOp is a buffered operation.
+type bulkOp struct {
+	doc map[string]json.RawMessage
+	len int
+}
+
+// newBulkOp encodes doc and sets its _id and _rev fields.
+// If rev is empty, the _rev field of doc is kept.
+func newBulkOp(id string, doc interface{}, rev string) (*bulkOp, error) {
+	enc, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(enc, &obj); err != nil || obj == nil {
+		return nil, fmt.Errorf("couchdb: document %q is not a JSON object", id)
+	}
+	op := &bulkOp{doc: obj, len: len(enc)}
+	op.doc["_id"], _ = json.Marshal(id)
+	if rev != "" {
+		op.setRev(rev)
+	}
+	return op, nil
+}
+
+func (op *bulkOp) setRev(rev string) {
+	enc, _ := json.Marshal(rev)
+	op.doc["_rev"] = enc
+}
+
+func (op *bulkOp) id() string {
+	var id string
+	json.Unmarshal(op.doc["_id"], &id)
+	return id
+}
+
+// NewBulkWriter creates a bulk writer for the database.
+// Close must be called to write remaining buffered operations.
+func (db *DB) NewBulkWriter(opts BulkWriterOptions) *BulkWriter {
+	if opts.MaxDocs <= 0 {
+		opts.MaxDocs = 500
+	}
+	w := &BulkWriter{db: db, opts: opts}
+	w.idle = sync.NewCond(&w.mu)
+	return w
+}
+
+// Put queues a document for storage. The rev argument is
+// the current revision of the document and may be empty for
+// new documents. If rev is empty and doc contains a _rev field,
+// that revision is used.
+func (w *BulkWriter) Put(id string, doc interface{}, rev string) error {
+	op, err := newBulkOp(id, doc, rev)
+	if err != nil {
+		return err
+	}
+	return w.add(op)
+}
+
+// Delete queues the deletion of a document revision.
+func (w *BulkWriter) Delete(id, rev string) error {
+	op := &bulkOp{doc: map[string]json.RawMessage{"_deleted": json.RawMessage("true")}}
+	op.doc["_id"], _ = json.Marshal(id)
+	op.setRev(rev)
+	op.len = len(id) + len(rev) + 40
+	return w.add(op)
+}
+
+func (w *BulkWriter) add(op *bulkOp) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return fmt.Errorf("couchdb: BulkWriter is closed")
+	}
+	w.ops = append(w.ops, op)
+	w.size += op.len
+	var batch []*bulkOp
+	if len(w.ops) >= w.opts.MaxDocs || (w.opts.MaxBytes > 0 && w.size >= w.opts.MaxBytes) {
+		batch = w.take()
+	} else if w.timer == nil && w.opts.FlushInterval > 0 {
+		w.timer = time.AfterFunc(w.opts.FlushInterval, w.timedFlush)
+	}
+	w.mu.Unlock()
+
+	w.write(batch)
+	return nil
+}
+
+// Flush writes all buffered operations and waits for batches that
+// are being written by other goroutines. It returns a *BulkError if
+// any operation failed since the last call to Flush.
+func (w *BulkWriter) Flush() error {
+	w.mu.Lock()
+	batch := w.take()
+	w.mu.Unlock()
+
+	w.write(batch)
+	return w.wait()
+}
+
+// Close flushes the writer. Further operations are rejected.
+func (w *BulkWriter) Close() error {
+	w.mu.Lock()
+	batch := w.take()
+	w.closed = true
+	w.mu.Unlock()
+
+	w.write(batch)
+	return w.wait()
+}
+
+func (w *BulkWriter) timedFlush() {
+	w.mu.Lock()
+	batch := w.take()
+	w.mu.Unlock()
+
+	w.write(batch)
+}
+
+// wait blocks until no batch is being written and returns
+// the collected failures.
+func (w *BulkWriter) wait() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.inflight > 0 {
+		w.idle.Wait()
+	}
+	if len(w.failed) == 0 {
+		return nil
+	}
+	err := &BulkError{Failed: w.failed}
+	w.failed = nil
+	return err
+}
+
+// take removes the buffered operations from the writer.
+// It must be called with w.mu held. The returned batch must
+// be passed to write.
+func (w *BulkWriter) take() []*bulkOp {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	ops := w.ops
+	w.ops, w.size = nil, 0
+	if len(ops) > 0 {
+		w.inflight++
+	}
+	return ops
+}
+
+// write writes a batch returned by take. It must be called without
+// holding w.mu, which is only taken to record failed operations.
+func (w *BulkWriter) write(ops []*bulkOp) {
+	if len(ops) == 0 {
+		return
+	}
+	failed := w.writeBatch(ops)
+
+	w.mu.Lock()
+	w.failed = append(w.failed, failed...)
+	w.inflight--
+	if w.inflight == 0 {
+		w.idle.Broadcast()
+	}
+	w.mu.Unlock()
+}
+
+// writeBatch stores ops using _bulk_docs, retrying conflicts
+// according to the options. It returns the failed operations.
+func (w *BulkWriter) writeBatch(ops []*bulkOp) (failed []BulkResult) {
+	for attempt := 0; len(ops) > 0; attempt++ {
+		docs := make([]interface{}, len(ops))
+		for i, op := range ops {
+			docs[i] = op.doc
+		}
+		results, err := w.db.BulkDocs(docs)
+		if err == nil && len(results) != len(ops) {
+			err = fmt.Errorf("couchdb: _bulk_docs returned %d results for %d documents", len(results), len(ops))
+		}
+		if err != nil {
+			for _, op := range ops {
+				failed = append(failed, BulkResult{ID: op.id(), Error: "request_failed", Reason: err.Error()})
+			}
+			return failed
+		}
+
+		var retry []*bulkOp
+		for i, res := range results {
+			switch {
+			case res.Error == "":
+			case res.Error == "conflict" && attempt < w.opts.ConflictRetries:
+				if rev, err := w.db.Rev(res.ID); err == nil {
+					ops[i].setRev(rev)
+					retry = append(retry, ops[i])
+					continue
+				}
+				fallthrough
+			default:
+				failed = append(failed, res)
+			}
+		}
+		ops = retry
+	}
+	return failed
+}
@@ -0,0 +1,250 @@
+package couchdb_test
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	. "net/http"
+	"testing"
+	"time"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestBulkDocs(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("POST /db/_bulk_docs", func(resp ResponseWriter, req *Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		check(t, "request body", `{"docs":[{"_id":"a","field":1},{"_id":"b","_rev":"1-x","field":2}]}`, string(body))
+		resp.WriteHeader(StatusCreated)
+		io.WriteString(resp, `[
+			{"ok": true, "id": "a", "rev": "1-a"},
+			{"id": "b", "error": "conflict", "reason": "Document update conflict."}
+		]`)
+	})
+
+	results, err := c.DB("db").BulkDocs([]interface{}{
+		map[string]interface{}{"_id": "a", "field": 1},
+		map[string]interface{}{"_id": "b", "_rev": "1-x", "field": 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []couchdb.BulkResult{
+		{ID: "a", Rev: "1-a"},
+		{ID: "b", Error: "conflict", Reason: "Document update conflict."},
+	}
+	check(t, "results", expected, results)
+}
+
+func TestBulkResultErrors(t *testing.T) {
+	results := []couchdb.BulkResult{
+		{ID: "a", Rev: "1-a"},
+		{ID: "b", Error: "conflict", Reason: "Document update conflict."},
+		{ID: "c", Error: "forbidden", Reason: "invalid type"},
+		{ID: "d", Error: "conflict", Reason: "Document update conflict."},
+		{ID: "e", Error: "unknown_error", Reason: "boom"},
+	}
+
+	check(t, "ok result error", nil, results[0].Err())
+	if err := results[1].Err(); !couchdb.Conflict(err) {
+		t.Errorf("expected conflict error, got %v", err)
+	}
+	if err := results[2].Err(); !couchdb.Forbidden(err) {
+		t.Errorf("expected forbidden error, got %v", err)
+	}
+	check(t, "error message", `couchdb: document "c": forbidden: invalid type`, results[2].Err().Error())
+	check(t, "unknown error status", 500, results[4].Err().(*couchdb.DocError).StatusCode)
+
+	check(t, "summary", couchdb.BulkSummary{
+		OK:         1,
+		Conflicts:  2,
+		Errors:     2,
+		Conflicted: []int{1, 3},
+		Failed:     []int{2, 4},
+	}, couchdb.SummarizeBulk(results))
+}
+
+func TestGetAll(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/_all_docs", func(resp ResponseWriter, req *Request) {
+		check(t, "keys", `["a","b","c"]`, req.URL.Query().Get("keys"))
+		check(t, "include_docs", "true", req.URL.Query().Get("include_docs"))
+		io.WriteString(resp, `{"rows": [
+			{"id": "a", "key": "a", "value": {"rev": "1-a"}, "doc": {"_id": "a", "_rev": "1-a", "field": 1}},
+			{"key": "b", "error": "not_found"},
+			{"id": "c", "key": "c", "value": {"rev": "2-c", "deleted": true}, "doc": null}
+		]}`)
+	})
+
+	var docs []testDocument
+	report, err := c.DB("db").GetAll([]string{"a", "b", "c"}, &docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "docs", []testDocument{{Rev: "1-a", Field: 1}}, docs)
+	check(t, "report", &couchdb.GetAllReport{Missing: []string{"b"}, Deleted: []string{"c"}}, report)
+
+	if _, err := c.DB("db").GetAll(nil, docs); err == nil {
+		t.Error("expected error for non-pointer argument")
+	}
+}
+
+// bulkRequest decodes the documents of a _bulk_docs request.
+func bulkRequest(t *testing.T, req *Request) []map[string]interface{} {
+	var body struct{ Docs []map[string]interface{} }
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		t.Fatalf("can't decode _bulk_docs request: %v", err)
+	}
+	return body.Docs
+}
+
+func TestBulkWriterMaxDocs(t *testing.T) {
+	c := newTestClient(t)
+	var requests [][]map[string]interface{}
+	c.Handle("POST /db/_bulk_docs", func(resp ResponseWriter, req *Request) {
+		docs := bulkRequest(t, req)
+		requests = append(requests, docs)
+		results := make([]couchdb.BulkResult, len(docs))
+		for i, doc := range docs {
+			results[i] = couchdb.BulkResult{ID: doc["_id"].(string), Rev: "1-x"}
+		}
+		json.NewEncoder(resp).Encode(results)
+	})
+
+	w := c.DB("db").NewBulkWriter(couchdb.BulkWriterOptions{MaxDocs: 2})
+	w.Put("a", &testDocument{Field: 1}, "")
+	check(t, "requests after first Put", 0, len(requests))
+	w.Delete("b", "1-b")
+	check(t, "requests after Delete", 1, len(requests))
+	w.Put("c", &testDocument{Rev: "3-c", Field: 3}, "")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]map[string]interface{}{
+		{
+			{"_id": "a", "field": float64(1)},
+			{"_id": "b", "_rev": "1-b", "_deleted": true},
+		},
+		{
+			{"_id": "c", "_rev": "3-c", "field": float64(3)},
+		},
+	}
+	check(t, "requests", expected, requests)
+
+	if err := w.Put("d", &testDocument{}, ""); err == nil {
+		t.Error("expected error for Put after Close")
+	}
+}
+
+func TestBulkWriterConflictRetry(t *testing.T) {
+	c := newTestClient(t)
+	var requests [][]map[string]interface{}
+	c.Handle("POST /db/_bulk_docs", func(resp ResponseWriter, req *Request) {
+		docs := bulkRequest(t, req)
+		requests = append(requests, docs)
+		if len(requests) == 1 {
+			io.WriteString(resp, `[
+				{"id": "a", "rev": "1-a"},
+				{"id": "b", "error": "conflict", "reason": "Document update conflict."},
+				{"id": "c", "error": "forbidden", "reason": "invalid"}
+			]`)
+		} else {
+			io.WriteString(resp, `[{"id": "b", "rev": "3-b"}]`)
+		}
+	})
+	c.Handle("HEAD /db/b", func(resp ResponseWriter, req *Request) {
+		resp.Header().Set("ETag", `"2-b"`)
+	})
+
+	w := c.DB("db").NewBulkWriter(couchdb.BulkWriterOptions{ConflictRetries: 1})
+	w.Put("a", &testDocument{Field: 1}, "")
+	w.Put("b", &testDocument{Field: 2}, "1-b")
+	w.Put("c", &testDocument{Field: 3}, "")
+	err := w.Flush()
+
+	check(t, "number of requests", 2, len(requests))
+	check(t, "retried doc", map[string]interface{}{"_id": "b", "_rev": "2-b", "field": float64(2)}, requests[1][0])
+	bulkErr, ok := err.(*couchdb.BulkError)
+	if !ok {
+		t.Fatalf("expected *couchdb.BulkError, got %#v", err)
+	}
+	check(t, "failed", []couchdb.BulkResult{{ID: "c", Error: "forbidden", Reason: "invalid"}}, bulkErr.Failed)
+	check(t, "second Flush error", nil, w.Flush())
+}
+
+func TestBulkWriterRequestError(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("POST /db/_bulk_docs", func(resp ResponseWriter, req *Request) {
+		resp.WriteHeader(StatusBadRequest)
+		io.WriteString(resp, `{"error":"bad_request","reason":"invalid UTF-8 JSON"}`)
+	})
+
+	w := c.DB("db").NewBulkWriter(couchdb.BulkWriterOptions{})
+	w.Put("a", &testDocument{Field: 1}, "")
+	err := w.Close()
+	bulkErr, ok := err.(*couchdb.BulkError)
+	if !ok {
+		t.Fatalf("expected *couchdb.BulkError, got %#v", err)
+	}
+	check(t, "failed docs", 1, len(bulkErr.Failed))
+	check(t, "failed ID", "a", bulkErr.Failed[0].ID)
+	check(t, "failed Error", "request_failed", bulkErr.Failed[0].Error)
+}
+
+func TestBulkWriterFlushInterval(t *testing.T) {
+	c := newTestClient(t)
+	flushed := make(chan []map[string]interface{}, 1)
+	c.Handle("POST /db/_bulk_docs", func(resp ResponseWriter, req *Request) {
+		flushed <- bulkRequest(t, req)
+		io.WriteString(resp, `[{"id": "a", "rev": "1-a"}]`)
+	})
+
+	w := c.DB("db").NewBulkWriter(couchdb.BulkWriterOptions{FlushInterval: 10 * time.Millisecond})
+	defer w.Close()
+	w.Put("a", &testDocument{Field: 1}, "")
+	select {
+	case docs := <-flushed:
+		check(t, "flushed docs", 1, len(docs))
+	case <-time.After(time.Second):
+		t.Fatal("buffered operation not flushed")
+	}
+}
+
+func TestBulkWriterPutDuringFlush(t *testing.T) {
+	c := newTestClient(t)
+	started, release := make(chan struct{}), make(chan struct{})
+	c.Handle("POST /db/_bulk_docs", func(resp ResponseWriter, req *Request) {
+		docs := bulkRequest(t, req)
+		if docs[0]["_id"] == "a" {
+			close(started)
+			<-release
+		}
+		results := make([]couchdb.BulkResult, len(docs))
+		for i, doc := range docs {
+			results[i] = couchdb.BulkResult{ID: doc["_id"].(string), Rev: "1-x"}
+		}
+		json.NewEncoder(resp).Encode(results)
+	})
+
+	w := c.DB("db").NewBulkWriter(couchdb.BulkWriterOptions{MaxDocs: 2})
+	w.Put("a", &testDocument{Field: 1}, "")
+	go w.Put("b", &testDocument{Field: 2}, "")
+	<-started
+
+	// The first batch is being written. Buffering another
+	// operation must not wait for the request.
+	done := make(chan error, 1)
+	go func() { done <- w.Put("c", &testDocument{Field: 3}, "") }()
+	select {
+	case err := <-done:
+		check(t, "Put error", nil, err)
+	case <-time.After(time.Second):
+		t.Fatal("Put blocked by in-flight batch")
+	}
+	close(release)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,75 @@
+package couchdb
+
+import (
+	"sync"
+	"time"
+)
+
+// CheckpointStore persists the position of changes feed consumers.
+// Implementations must be safe for concurrent use.
+type CheckpointStore interface {
+	// LoadCheckpoint returns the sequence stored under the given name.
+	// It returns a nil sequence and no error if there is no checkpoint.
+	LoadCheckpoint(name string) (seq interface{}, err error)
+
+	// SaveCheckpoint stores the sequence under the given name.
+	SaveCheckpoint(name string, seq interface{}) error
+}
+
+// LocalCheckpoints returns a CheckpointStore that keeps checkpoints in
+// _local documents of db. _local documents are not replicated and don't
+// appear in the changes feed. The document ID of a checkpoint is
+// "_local/" + name.
+//
+// Writes never fail with conflicts: if another writer updated the
+// checkpoint, the store overwrites it with its own sequence.
+func LocalCheckpoints(db *DB) CheckpointStore {
+	return &localCheckpoints{db: db, revs: make(map[string]string)}
+}
+
+type localCheckpoints struct {
+	db   *DB
+	mu   sync.Mutex
+	revs map[string]string // last known revision of each checkpoint
+}
+
+type checkpointDoc struct {
+	Rev       string      `json:"_rev,omitempty"`
+	Seq       interface{} `json:"seq"`
+	UpdatedAt UnixMillis  `json:"updated_at"`
+}
+
+func (s *localCheckpoints) LoadCheckpoint(name string) (interface{}, error) {
+	var doc checkpointDoc
+	err := s.db.Get("_local/"+name, &doc, nil)
+	if NotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.revs[name] = doc.Rev
+	s.mu.Unlock()
+	return doc.Seq, nil
+}
+
+func (s *localCheckpoints) SaveCheckpoint(name string, seq interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := "_local/" + name
+	doc := checkpointDoc{Rev: s.revs[name], Seq: seq, UpdatedAt: UnixMillis{time.Now()}}
+	rev, err := s.db.Put(id, &doc, "")
+	if Conflict(err) {
+		var current checkpointDoc
+		if err := s.db.Get(id, &current, nil); err != nil && !NotFound(err) {
+			return err
+		}
+		doc.Rev = current.Rev
+		rev, err = s.db.Put(id, &doc, "")
+	}
+	if err != nil {
+		return err
+	}
+	s.revs[name] = rev
+	return nil
+}
@@ -0,0 +1,70 @@
+package couchdb_test
+
+import (
+	"encoding/json"
+	"io"
+	. "net/http"
+	"strconv"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestLocalCheckpoints(t *testing.T) {
+	c := newTestClient(t)
+	var (
+		stored json.RawMessage
+		revnum int
+	)
+	c.Handle("GET /db/_local/follower", func(resp ResponseWriter, req *Request) {
+		if stored == nil {
+			resp.WriteHeader(StatusNotFound)
+			io.WriteString(resp, `{"error": "not_found", "reason": "missing"}`)
+			return
+		}
+		resp.Write(stored)
+	})
+	c.Handle("PUT /db/_local/follower", func(resp ResponseWriter, req *Request) {
+		var doc map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&doc)
+		if doc["_rev"] != nil && doc["_rev"] != "0-"+strconv.Itoa(revnum) || doc["_rev"] == nil && revnum > 0 {
+			resp.WriteHeader(StatusConflict)
+			io.WriteString(resp, `{"error": "conflict", "reason": "Document update conflict."}`)
+			return
+		}
+		revnum++
+		rev := "0-" + strconv.Itoa(revnum)
+		doc["_rev"] = rev
+		stored, _ = json.Marshal(doc)
+		resp.Header().Set("ETag", `"`+rev+`"`)
+		resp.WriteHeader(StatusCreated)
+		io.WriteString(resp, `{"ok": true, "id": "_local/follower", "rev": "`+rev+`"}`)
+	})
+
+	store := couchdb.LocalCheckpoints(c.DB("db"))
+	seq, err := store.LoadCheckpoint("follower")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "initial seq", nil, seq)
+
+	if err := store.SaveCheckpoint("follower", "5-abc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveCheckpoint("follower", "7-abc"); err != nil {
+		t.Fatal(err)
+	}
+	seq, err = store.LoadCheckpoint("follower")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "seq", "7-abc", seq)
+
+	// Another store doesn't know the revision, but overwrites the checkpoint.
+	other := couchdb.LocalCheckpoints(c.DB("db"))
+	if err := other.SaveCheckpoint("follower", "9-abc"); err != nil {
+		t.Fatal(err)
+	}
+	seq, _ = store.LoadCheckpoint("follower")
+	check(t, "seq", "9-abc", seq)
+}
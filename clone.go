@@ -0,0 +1,113 @@
+package couchdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// CloneOptions configures CloneDBWithOptions.
+type CloneOptions struct {
+	// Exclude contains patterns of document IDs that are not copied.
+	// In patterns, '*' matches any sequence of characters and '?' matches
+	// a single character, e.g. "_design/*" excludes all design documents.
+	Exclude []string
+}
+
+// CloneDB creates the target database and replicates all documents of the
+// source database into it. It is meant for provisioning databases from a
+// template. Like CreateDB, it fails if the target already exists.
+// If replication fails, the target database is deleted again.
+//
+// Replication is performed by the server using the client's URL and
+// credentials, so the URL must be reachable from the server. The call
+// returns when replication has finished.
+func (c *Client) CloneDB(source, target string) (*DB, error) {
+	return c.CloneDBWithOptions(source, target, CloneOptions{})
+}
+
+// CloneDBWithOptions is like CloneDB, but allows excluding documents.
+// Exclusion requires CouchDB 2.0 or later.
+func (c *Client) CloneDBWithOptions(source, target string, opts CloneOptions) (*DB, error) {
+	source, err := c.checkDBName(source)
+	if err != nil {
+		return nil, err
+	}
+	db, err := c.CreateDB(target)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.replicateInto(source, db.name, opts); err != nil {
+		// Don't leave a partial copy behind. The replication error
+		// is more useful to the caller than a failed cleanup.
+		c.DeleteDB(db.name)
+		return nil, err
+	}
+	return db, nil
+}
+
+// replicateInto replicates the source database into target.
+func (c *Client) replicateInto(source, target string, opts CloneOptions) error {
+	var err error
+	rep := map[string]interface{}{}
+	if rep["source"], err = c.replicationEndpoint(source); err != nil {
+		return err
+	}
+	if rep["target"], err = c.replicationEndpoint(target); err != nil {
+		return err
+	}
+	if len(opts.Exclude) > 0 {
+		nor := make([]interface{}, len(opts.Exclude))
+		for i, pat := range opts.Exclude {
+			nor[i] = map[string]interface{}{"_id": map[string]string{"$regex": globRegexp(pat)}}
+		}
+		rep["selector"] = map[string]interface{}{"$nor": nor}
+	}
+	body, err := json.Marshal(rep)
+	if err != nil {
+		return err
+	}
+	resp, err := c.request("POST", "/_replicate", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	var result struct {
+		OK bool `json:"ok"`
+	}
+	if err := readBody(resp, &result); err != nil {
+		return err
+	}
+	if !result.OK {
+		return errors.New("couchdb: replication of " + source + " to " + target + " failed")
+	}
+	return nil
+}
+
+// replicationEndpoint returns the replication source or target object for a
+// database of the server. It carries the headers of the client, which contain
+// the credentials of most Auth implementations.
+func (c *Client) replicationEndpoint(name string) (map[string]interface{}, error) {
+	req, err := c.newRequest("GET", dbpath(name), nil)
+	if err != nil {
+		return nil, err
+	}
+	ep := map[string]interface{}{"url": req.URL.String()}
+	if len(req.Header) > 0 {
+		headers := make(map[string]string, len(req.Header))
+		for k, v := range req.Header {
+			headers[k] = strings.Join(v, ", ")
+		}
+		ep["headers"] = headers
+	}
+	return ep, nil
+}
+
+// globRegexp converts an ID pattern to an anchored regular expression.
+func globRegexp(pattern string) string {
+	re := regexp.QuoteMeta(pattern)
+	re = strings.Replace(re, `\*`, ".*", -1)
+	re = strings.Replace(re, `\?`, ".", -1)
+	return "^" + re + "$"
+}
@@ -0,0 +1,82 @@
+package couchdb_test
+
+import (
+	"encoding/json"
+	"io"
+	. "net/http"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestCloneDB(t *testing.T) {
+	c := newTestClient(t)
+	c.SetAuth(couchdb.BasicAuth("admin", "secret"))
+	c.Handle("PUT /tenant-1", func(resp ResponseWriter, req *Request) {
+		resp.WriteHeader(StatusCreated)
+		io.WriteString(resp, `{"ok": true}`)
+	})
+	c.Handle("POST /_replicate", func(resp ResponseWriter, req *Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		headers := map[string]interface{}{"Authorization": "Basic YWRtaW46c2VjcmV0"}
+		check(t, "source", map[string]interface{}{
+			"url":     "http://testClient:5984/template",
+			"headers": headers,
+		}, body["source"])
+		check(t, "target", map[string]interface{}{
+			"url":     "http://testClient:5984/tenant-1",
+			"headers": headers,
+		}, body["target"])
+		check(t, "selector", map[string]interface{}{
+			"$nor": []interface{}{
+				map[string]interface{}{"_id": map[string]interface{}{"$regex": `^_design/.*$`}},
+				map[string]interface{}{"_id": map[string]interface{}{"$regex": `^draft\..$`}},
+			},
+		}, body["selector"])
+		io.WriteString(resp, `{"ok": true, "session_id": "a0b1", "history": []}`)
+	})
+
+	db, err := c.CloneDBWithOptions("template", "tenant-1", couchdb.CloneOptions{
+		Exclude: []string{"_design/*", "draft.?"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "db name", "tenant-1", db.Name())
+}
+
+func TestCloneDBFailure(t *testing.T) {
+	tests := map[string]func(resp ResponseWriter){
+		"not ok": func(resp ResponseWriter) {
+			io.WriteString(resp, `{"ok": false}`)
+		},
+		"http error": func(resp ResponseWriter) {
+			resp.WriteHeader(StatusNotFound)
+			io.WriteString(resp, `{"error": "not_found", "reason": "Database does not exist."}`)
+		},
+	}
+	for name, replicate := range tests {
+		c := newTestClient(t)
+		c.Handle("PUT /tenant-1", func(resp ResponseWriter, req *Request) {
+			resp.WriteHeader(StatusCreated)
+			io.WriteString(resp, `{"ok": true}`)
+		})
+		c.Handle("POST /_replicate", func(resp ResponseWriter, req *Request) {
+			replicate(resp)
+		})
+		deleted := false
+		c.Handle("DELETE /tenant-1", func(resp ResponseWriter, req *Request) {
+			deleted = true
+			io.WriteString(resp, `{"ok": true}`)
+		})
+
+		db, err := c.CloneDB("template", "tenant-1")
+		if err == nil {
+			t.Errorf("%s: expected error, got db %v", name, db)
+		}
+		check(t, name+": target deleted", true, deleted)
+	}
+}
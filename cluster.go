@@ -0,0 +1,258 @@
+package couchdb
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ClusterOptions configures cluster routing.
+type ClusterOptions struct {
+	// Nodes are the base URLs of the cluster nodes, e.g. "http://10.0.0.2:5984".
+	// If nil, the nodes are discovered using the _membership endpoint. Discovered
+	// nodes use the scheme and port of the client URL.
+	Nodes []string
+
+	// HealthCheckInterval is the time between node health checks.
+	// The default is 30 seconds.
+	HealthCheckInterval time.Duration
+}
+
+// RouteCluster makes the client distribute requests across the nodes of a
+// CouchDB cluster instead of sending them all to the client URL. This avoids the
+// need for a load balancer in small deployments.
+//
+// Requests are sent to healthy nodes in round-robin fashion. Requests for
+// _changes feeds of a database always go to the same node while it is healthy.
+// Nodes are checked using the /_up endpoint, which also reports nodes in
+// maintenance mode as unavailable. Failed GET and HEAD requests are retried
+// once on another node.
+//
+// Health checks stop when the client is closed or the context of the
+// client is canceled.
+//
+// RouteCluster replaces the transport of the client's HTTP client without
+// synchronization. It must be called before the client is used, i.e. before
+// any request is made through the client or a DB, feed or other object
+// obtained from it, since all of them share the HTTP client.
+//
+// Routing rewrites the Host of requests after authentication information has
+// been added, which invalidates request signatures. RouteCluster returns an
+// error if the client uses SigV4Auth, and SigV4Auth must not be set after
+// calling it.
+func (c *Client) RouteCluster(opts ClusterOptions) error {
+	c.mu.RLock()
+	_, signed := c.auth.(*sigv4auth)
+	c.mu.RUnlock()
+	if signed {
+		return errors.New("couchdb.RouteCluster: can't route requests signed by SigV4Auth")
+	}
+	if opts.HealthCheckInterval <= 0 {
+		opts.HealthCheckInterval = 30 * time.Second
+	}
+	nodes := opts.Nodes
+	if nodes == nil {
+		var err error
+		if nodes, err = c.discoverNodes(); err != nil {
+			return err
+		}
+	}
+	if len(nodes) == 0 {
+		return errors.New("couchdb.RouteCluster: no cluster nodes")
+	}
+	r := &clusterRouter{next: c.http.Transport, interval: opts.HealthCheckInterval}
+	r.ctx, r.cancel = context.WithCancel(c.Context())
+	if r.next == nil {
+		r.next = http.DefaultTransport
+	}
+	for _, n := range nodes {
+		u, err := url.Parse(n)
+		if err != nil {
+			r.cancel()
+			return err
+		}
+		r.nodes = append(r.nodes, &clusterNode{scheme: u.Scheme, host: u.Host})
+	}
+	r.check()
+	c.http.Transport = r
+	return nil
+}
+
+func (c *Client) discoverNodes() ([]string, error) {
+	names, err := c.clusterNodeNames()
+	if err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(c.prefix)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []string
+	for _, name := range names {
+		// Node names have the form "couchdb@host".
+		host := name[strings.IndexByte(name, '@')+1:]
+		if port := base.Port(); port != "" {
+			host += ":" + port
+		}
+		nodes = append(nodes, base.Scheme+"://"+host)
+	}
+	return nodes, nil
+}
+
+// clusterNodeNames returns the names of the nodes in the cluster.
+func (c *Client) clusterNodeNames() ([]string, error) {
+	resp, err := c.request("GET", "/_membership", nil)
+	if err != nil {
+		return nil, err
+	}
+	var membership struct {
+		ClusterNodes []string `json:"cluster_nodes"`
+	}
+	if err := readBody(resp, &membership); err != nil {
+		return nil, err
+	}
+	return membership.ClusterNodes, nil
+}
+
+const healthCheckTimeout = 5 * time.Second
+
+type clusterNode struct {
+	scheme, host string
+	healthy      int32 // accessed atomically
+}
+
+func (n *clusterNode) isHealthy() bool {
+	return atomic.LoadInt32(&n.healthy) == 1
+}
+
+func (n *clusterNode) setHealthy(ok bool) {
+	var v int32
+	if ok {
+		v = 1
+	}
+	atomic.StoreInt32(&n.healthy, v)
+}
+
+type clusterRouter struct {
+	next     http.RoundTripper
+	nodes    []*clusterNode
+	interval time.Duration
+	counter  uint32
+
+	// Health checks are canceled when the client is closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	lastCheck time.Time
+	checking  bool
+}
+
+func (r *clusterRouter) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.maybeCheck()
+	node := r.pick(req)
+	resp, err := r.send(node, req)
+	if err != nil && (req.Method == "GET" || req.Method == "HEAD") {
+		node.setHealthy(false)
+		if next := r.pick(req); next != node {
+			resp, err = r.send(next, req)
+		}
+	}
+	return resp, err
+}
+
+func (r *clusterRouter) send(node *clusterNode, req *http.Request) (*http.Response, error) {
+	nreq := req.Clone(req.Context())
+	nreq.URL.Scheme = node.scheme
+	nreq.URL.Host = node.host
+	nreq.Host = node.host
+	return r.next.RoundTrip(nreq)
+}
+
+// pick chooses the node for a request.
+func (r *clusterRouter) pick(req *http.Request) *clusterNode {
+	healthy := make([]*clusterNode, 0, len(r.nodes))
+	for _, n := range r.nodes {
+		if n.isHealthy() {
+			healthy = append(healthy, n)
+		}
+	}
+	if len(healthy) == 0 {
+		healthy = r.nodes
+	}
+	path := req.URL.EscapedPath()
+	if i := strings.Index(path, "/_changes"); i > 0 {
+		// Sticky routing for feeds.
+		h := fnv.New32a()
+		h.Write([]byte(path[:i]))
+		return healthy[h.Sum32()%uint32(len(healthy))]
+	}
+	return healthy[atomic.AddUint32(&r.counter, 1)%uint32(len(healthy))]
+}
+
+// maybeCheck starts a health check in the background
+// if the last check is older than the interval.
+func (r *clusterRouter) maybeCheck() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.checking || time.Since(r.lastCheck) < r.interval || r.ctx.Err() != nil {
+		return
+	}
+	r.checking = true
+	go r.check()
+}
+
+// check checks the health of all nodes.
+func (r *clusterRouter) check() {
+	var wg sync.WaitGroup
+	for _, n := range r.nodes {
+		wg.Add(1)
+		go func(n *clusterNode) {
+			defer wg.Done()
+			n.setHealthy(r.checkNode(n))
+		}(n)
+	}
+	wg.Wait()
+	r.mu.Lock()
+	r.lastCheck = time.Now()
+	r.checking = false
+	r.mu.Unlock()
+}
+
+func (r *clusterRouter) checkNode(n *clusterNode) bool {
+	ctx, cancel := context.WithTimeout(r.ctx, healthCheckTimeout)
+	defer cancel()
+	req, err := http.NewRequest("GET", n.scheme+"://"+n.host+"/_up", nil)
+	if err != nil {
+		return false
+	}
+	req = req.WithContext(ctx)
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	// Nodes in maintenance mode respond with 404.
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// close cancels health checks in progress and prevents new ones.
+func (r *clusterRouter) close() {
+	r.cancel()
+}
+
+// CloseIdleConnections closes idle connections of the wrapped RoundTripper.
+func (r *clusterRouter) CloseIdleConnections() {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if ci, ok := r.next.(closeIdler); ok {
+		ci.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,158 @@
+package couchdb_test
+
+import (
+	"io"
+	. "net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestRouteCluster(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /_membership", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{
+			"all_nodes": ["couchdb@n1", "couchdb@n2", "couchdb@n3"],
+			"cluster_nodes": ["couchdb@n1", "couchdb@n2", "couchdb@n3"]
+		}`)
+	})
+	c.Handle("GET /_up", func(resp ResponseWriter, req *Request) {
+		if req.Host == "n3:5984" {
+			resp.WriteHeader(StatusNotFound)
+			io.WriteString(resp, `{"status": "maintenance_mode"}`)
+			return
+		}
+		io.WriteString(resp, `{"status": "ok"}`)
+	})
+	var hosts []string
+	c.Handle("HEAD /db/doc", func(resp ResponseWriter, req *Request) {
+		hosts = append(hosts, req.Host)
+		resp.Header().Set("ETag", `"1-619db7ba8551c0de3f3a178775509611"`)
+	})
+	c.Handle("GET /db/_changes", func(resp ResponseWriter, req *Request) {
+		hosts = append(hosts, req.Host)
+		io.WriteString(resp, `{"results": [], "last_seq": "1-..."}`)
+	})
+
+	if err := c.RouteCluster(couchdb.ClusterOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	db := c.DB("db")
+	for i := 0; i < 4; i++ {
+		if _, err := db.Rev("doc"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(t, "hosts", []string{"n2:5984", "n1:5984", "n2:5984", "n1:5984"}, hosts)
+
+	// Feed requests are sticky.
+	hosts = nil
+	for i := 0; i < 3; i++ {
+		feed, err := db.Changes(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		feed.Close()
+	}
+	if hosts[0] != hosts[1] || hosts[1] != hosts[2] {
+		t.Errorf("feed requests went to different nodes: %v", hosts)
+	}
+}
+
+type closeIdleRecorder struct {
+	*Transport
+	closed bool
+}
+
+func (t *closeIdleRecorder) CloseIdleConnections() {
+	t.closed = true
+	t.Transport.CloseIdleConnections()
+}
+
+func TestRouteClusterTransport(t *testing.T) {
+	srv := httptest.NewServer(HandlerFunc(func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"status": "ok"}`)
+	}))
+	defer srv.Close()
+
+	// The node is down, so the initial health check doesn't leave a
+	// connection behind that would race with SetIdleConnTimeout.
+	down := httptest.NewServer(nil)
+	down.Close()
+	tr := &Transport{}
+	c, err := couchdb.NewClient(down.URL, tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RouteCluster(couchdb.ClusterOptions{Nodes: []string{down.URL}}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "SetIdleConnTimeout", true, c.SetIdleConnTimeout(time.Minute))
+	check(t, "IdleConnTimeout", time.Minute, tr.IdleConnTimeout)
+
+	rec := &closeIdleRecorder{Transport: &Transport{}}
+	c, err = couchdb.NewClient(srv.URL, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RouteCluster(couchdb.ClusterOptions{Nodes: []string{srv.URL}}); err != nil {
+		t.Fatal(err)
+	}
+	c.CloseIdleConnections()
+	check(t, "CloseIdleConnections forwarded", true, rec.closed)
+}
+
+func TestRouteClusterClose(t *testing.T) {
+	var upCalls int32
+	checking, canceled := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(HandlerFunc(func(resp ResponseWriter, req *Request) {
+		if req.URL.Path != "/_up" {
+			io.WriteString(resp, `{"couchdb": "Welcome"}`)
+			return
+		}
+		if atomic.AddInt32(&upCalls, 1) == 1 {
+			io.WriteString(resp, `{"status": "ok"}`)
+			return
+		}
+		// Background checks hang until they are canceled.
+		close(checking)
+		<-req.Context().Done()
+		close(canceled)
+	}))
+	defer srv.Close()
+
+	c, err := couchdb.NewClient(srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := couchdb.ClusterOptions{Nodes: []string{srv.URL}, HealthCheckInterval: time.Nanosecond}
+	if err := c.RouteCluster(opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-checking:
+	case <-time.After(time.Second):
+		t.Fatal("background health check not started")
+	}
+	c.Close()
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("health check not canceled by Close")
+	}
+}
+
+func TestRouteClusterSigV4(t *testing.T) {
+	c := newTestClient(t)
+	c.SetAuth(couchdb.SigV4Auth("AKID", "secret", "", "us-east-1", "execute-api"))
+	err := c.RouteCluster(couchdb.ClusterOptions{Nodes: []string{"http://n1:5984"}})
+	if err == nil {
+		t.Fatal("expected error for SigV4Auth")
+	}
+}
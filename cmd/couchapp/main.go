@@ -1,4 +1,6 @@
 // The couchapp tool deploys a directory as a CouchDB design document.
+// Instead of a directory, a .zip, .tar, .tar.gz or .tgz archive
+// containing the app can be given.
 package main
 
 import (
@@ -17,10 +19,30 @@ func main() {
 		dbname = flag.String("db", "", "Database name (required)")
 		docid  = flag.String("docid", "", "Design document name (required)")
 		ignore = flag.String("ignore", "", "Ignore patterns.")
+		tmpl   = flag.Bool("template", false, `Substitute {{env "VAR"}} in files`)
+		check  = flag.Bool("validate", false, "Check JavaScript files for syntax errors")
+		vendor = flag.Bool("vendor", false, "Merge components in the vendor directory")
+		minify = flag.Bool("minify", false, "Remove comments and whitespace from JavaScript files")
+		target = flag.String("target", "default", "Manifest target (used without -db and -docid)")
+		subdir = flag.String("archive-dir", ".", "App directory within the archive")
 	)
 	flag.Parse()
 	if flag.NArg() != 1 {
-		fatalf("Need directory as argument.")
+		fatalf("Need directory or archive as argument.")
+	}
+	dir := flag.Arg(0)
+	var archive *couchapp.Archive
+	if isArchive(dir) {
+		var err error
+		if archive, err = couchapp.OpenArchive(dir); err != nil {
+			fatalf("%v", err)
+		}
+		defer archive.Close()
+		dir = *subdir
+	}
+	if *dbname == "" && *docid == "" {
+		deployManifest(archive, dir, *target)
+		return
 	}
 	if *docid == "" {
 		fatalf("-docid is required.")
@@ -29,9 +51,21 @@ func main() {
 		fatalf("-db is required.")
 	}
 
-	dir := flag.Arg(0)
 	ignores := strings.Split(*ignore, ",")
-	doc, err := couchapp.LoadDirectory(dir, ignores)
+	opts := couchapp.LoadOptions{
+		Ignores:     ignores,
+		Template:    *tmpl,
+		Validate:    *check,
+		MergeVendor: *vendor,
+		Minify:      *minify,
+	}
+	var doc couchapp.Doc
+	var err error
+	if archive != nil {
+		doc, err = archive.LoadDirectory(dir, opts)
+	} else {
+		doc, err = couchapp.LoadDirectoryWithOptions(dir, opts)
+	}
 	if err != nil {
 		fatalf("%v", err)
 	}
@@ -46,6 +80,48 @@ func main() {
 	fmt.Println(rev)
 }
 
+func isArchive(file string) bool {
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(file, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// deployManifest deploys using the manifest in dir.
+// If archive is non-nil, dir is a directory of the archive.
+func deployManifest(archive *couchapp.Archive, dir, target string) {
+	var m *couchapp.Manifest
+	var err error
+	if archive != nil {
+		m, err = archive.LoadManifest(dir)
+	} else {
+		m, err = couchapp.LoadManifest(dir)
+	}
+	if os.IsNotExist(err) {
+		fatalf("-db and -docid are required when %s does not exist.", couchapp.ManifestFile)
+	} else if err != nil {
+		fatalf("%v", err)
+	}
+	var deployed []couchapp.Deployment
+	if archive != nil {
+		deployed, err = m.DeployArchive(archive, dir, target)
+	} else {
+		deployed, err = m.Deploy(dir, target)
+	}
+	for _, d := range deployed {
+		if m.Attachments != "" {
+			fmt.Printf("%s %s (attachments: %d uploaded, %d unchanged)\n", d.DB, d.Rev, d.Attachments.Uploaded, d.Attachments.Skipped)
+		} else {
+			fmt.Println(d.DB, d.Rev)
+		}
+	}
+	if err != nil {
+		fatalf("%v", err)
+	}
+}
+
 func fatalf(format string, args ...interface{}) {
 	fmt.Fprintf(os.Stderr, format+"\n", args...)
 	os.Exit(1)
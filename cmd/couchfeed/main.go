@@ -1,11 +1,15 @@
 // The couchfeed tool logs CouchDB feeds.
 // This tool is not very useful, it's mostly an API demo.
+//
+// In scripts, -since now -count 1 waits for the next change and
+// -idle-timeout reads changes until the database is quiet.
 package main
 
 import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/fjl/go-couchdb"
 )
@@ -16,23 +20,37 @@ func main() {
 		dbname    = flag.String("db", "", "Database name")
 		dbupdates = flag.Bool("dbupdates", false, "Show DB updates feed")
 		follow    = flag.Bool("f", false, "Use 'continuous' feed mode")
+		since     = flag.String("since", "", `Start after this update sequence, e.g. "now"`)
+		count     = flag.Int("count", 0, "Exit after this many events")
+		idle      = flag.Duration("idle-timeout", 0, "Exit when no change arrives for this long (implies -f)")
 	)
 	flag.Parse()
 	if !*dbupdates && *dbname == "" {
 		fatalf("-db or -dbupdates is required.")
 	}
+	if *dbupdates && *idle > 0 {
+		fatalf("-idle-timeout is not supported with -dbupdates.")
+	}
 	opt := couchdb.Options{"feed": "normal"}
-	if *follow {
+	if *follow || *idle > 0 {
 		opt["feed"] = "continuous"
 	}
+	if *since != "" {
+		opt["since"] = *since
+	}
+	if *idle > 0 {
+		// Heartbeats make Next return while the feed is quiet.
+		opt["heartbeat"] = heartbeatInterval(*idle)
+	}
 
 	client, err := couchdb.NewClient(*server, nil)
 	if err != nil {
-		fatalf("can't create database client: %v")
+		fatalf("can't create database client: %v", err)
 	}
 
 	var f feed
 	var show func()
+	isHeartbeat := func() bool { return false }
 	if *dbupdates {
 		f, err = client.DBUpdates(opt)
 		show = func() {
@@ -41,6 +59,10 @@ func main() {
 		}
 	} else {
 		f, err = client.DB(*dbname).Changes(opt)
+		if err == nil && *idle > 0 {
+			f.(*couchdb.ChangesFeed).ReportHeartbeats(true)
+			isHeartbeat = func() bool { return f.(*couchdb.ChangesFeed).Heartbeat }
+		}
 		show = func() {
 			chf := f.(*couchdb.ChangesFeed)
 			if chf.Deleted {
@@ -54,14 +76,36 @@ func main() {
 		fatalf("can't open feed: %v", err)
 	}
 	defer f.Close()
+	events, lastChange := 0, time.Now()
 	for f.Next() {
+		if isHeartbeat() {
+			if time.Since(lastChange) >= *idle {
+				return
+			}
+			continue
+		}
 		show()
+		events, lastChange = events+1, time.Now()
+		if events == *count {
+			return
+		}
 	}
 	if f.Err() != nil {
 		fatalf("feed error: %#v", f.Err())
 	}
 }
 
+// heartbeatInterval returns the heartbeat option for an idle timeout,
+// in milliseconds. Heartbeats are requested at a fraction of the timeout
+// so the quiet period is detected without much delay.
+func heartbeatInterval(idle time.Duration) int64 {
+	ms := int64(idle/time.Millisecond) / 4
+	if ms < 50 {
+		ms = 50
+	}
+	return ms
+}
+
 type feed interface {
 	Next() bool
 	Err() error
@@ -0,0 +1,87 @@
+// The couchfixture tool records documents and view responses from a CouchDB
+// database into a Go source file for use with package couchtest.
+//
+//	couchfixture -db users -ids alice,bob -view _design/app/by_name -o fixture_test.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/fjl/go-couchdb"
+	"github.com/fjl/go-couchdb/couchtest"
+)
+
+type viewFlags []couchtest.ViewQuery
+
+func (v *viewFlags) String() string { return "" }
+
+// Set parses a view flag of the form ddoc/view or ddoc/view?{"key":"value"}.
+func (v *viewFlags) Set(s string) error {
+	var vq couchtest.ViewQuery
+	if i := strings.IndexByte(s, '?'); i >= 0 {
+		if err := json.Unmarshal([]byte(s[i+1:]), &vq.Options); err != nil {
+			return fmt.Errorf("invalid view options: %v", err)
+		}
+		s = s[:i]
+	}
+	s = strings.TrimPrefix(s, "_design/")
+	i := strings.IndexByte(s, '/')
+	if i < 1 || i == len(s)-1 {
+		return fmt.Errorf("view must be given as ddoc/view")
+	}
+	vq.DDoc, vq.View = s[:i], s[i+1:]
+	*v = append(*v, vq)
+	return nil
+}
+
+func main() {
+	var (
+		views   viewFlags
+		server  = flag.String("server", "http://127.0.0.1:5984/", "CouchDB server URL")
+		dbname  = flag.String("db", "", "Database name")
+		ids     = flag.String("ids", "", "Comma-separated list of document IDs")
+		alldocs = flag.Bool("all", false, "Include all documents")
+		pkg     = flag.String("pkg", "main", "Package name of generated file")
+		varname = flag.String("var", "fixture", "Variable name of the fixture")
+		output  = flag.String("o", "", "Output file (default stdout)")
+	)
+	flag.Var(&views, "view", "View to record, as ddoc/view or ddoc/view?{options} (repeatable)")
+	flag.Parse()
+	if *dbname == "" {
+		fatalf("-db is required.")
+	}
+
+	client, err := couchdb.NewClient(*server, nil)
+	if err != nil {
+		fatalf("can't create database client: %v", err)
+	}
+	opts := couchtest.SnapshotOptions{AllDocs: *alldocs, Views: views}
+	if *ids != "" {
+		opts.IDs = strings.Split(*ids, ",")
+	}
+	fixture, err := couchtest.Snapshot(client.DB(*dbname), opts)
+	if err != nil {
+		fatalf("snapshot failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := couchtest.WriteGoFile(&buf, *pkg, *varname, fixture); err != nil {
+		fatalf("can't generate code: %v", err)
+	}
+	if *output == "" {
+		os.Stdout.Write(buf.Bytes())
+	} else if err := ioutil.WriteFile(*output, buf.Bytes(), 0644); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
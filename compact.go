@@ -0,0 +1,174 @@
+package couchdb
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Fragmentation returns the fraction of the file that is not occupied by
+// live data, i.e. the fraction of space that compaction would reclaim.
+// It returns zero if the file size is unknown.
+func (s Sizes) Fragmentation() float64 {
+	if s.File <= 0 || s.Active > s.File {
+		return 0
+	}
+	return float64(s.File-s.Active) / float64(s.File)
+}
+
+// sizes returns the database sizes, including those reported by CouchDB 1.x.
+func (info *DBInfo) sizes() Sizes {
+	if info.Sizes.File == 0 && info.DiskSize > 0 {
+		return Sizes{File: info.DiskSize, Active: info.DataSize}
+	}
+	return info.Sizes
+}
+
+// sizes returns the index sizes, including those reported by CouchDB 1.x.
+func (info *ViewIndexInfo) sizes() Sizes {
+	if info.Sizes.File == 0 && info.DiskSize > 0 {
+		return Sizes{File: info.DiskSize, Active: info.DataSize}
+	}
+	return info.Sizes
+}
+
+// Compact starts compaction of the database file.
+// Compaction runs in the background on the server.
+func (db *DB) Compact() error {
+	return db.postCompact(db.path().addRaw("_compact").path())
+}
+
+// CompactViews starts compaction of the view index of a design document.
+// The ddoc argument must start with "_design/".
+func (db *DB) CompactViews(ddoc string) error {
+	return db.postCompact(db.path().addRaw("_compact").add(strings.TrimPrefix(ddoc, "_design/")).path())
+}
+
+// ViewCleanup removes view index files that are no longer
+// used by any design document.
+func (db *DB) ViewCleanup() error {
+	return db.postCompact(db.path().addRaw("_view_cleanup").path())
+}
+
+func (db *DB) postCompact(path string) error {
+	req, err := db.newRequest("POST", path, nil)
+	if err != nil {
+		return err
+	}
+	// CouchDB rejects these requests without a JSON content type.
+	req.Header.Set("content-type", "application/json")
+	resp, err := db.do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// CompactOptions configures AutoCompact.
+type CompactOptions struct {
+	// DBThreshold and ViewThreshold are the fragmentation levels
+	// (between 0 and 1) above which the database file and view indexes
+	// are compacted. The default for both is 0.5.
+	DBThreshold   float64
+	ViewThreshold float64
+
+	// Files smaller than MinFileSize bytes are never compacted.
+	MinFileSize int64
+
+	// Interval is the time between checks of AutoCompactLoop.
+	// The default is one hour.
+	Interval time.Duration
+
+	// Report is called by AutoCompactLoop after every check.
+	Report func(*CompactReport, error)
+}
+
+func (o CompactOptions) withDefaults() CompactOptions {
+	if o.DBThreshold <= 0 {
+		o.DBThreshold = 0.5
+	}
+	if o.ViewThreshold <= 0 {
+		o.ViewThreshold = 0.5
+	}
+	if o.Interval <= 0 {
+		o.Interval = time.Hour
+	}
+	return o
+}
+
+// CompactReport describes the compactions started by AutoCompact.
+type CompactReport struct {
+	DB    bool     // database compaction was started
+	Views []string // design documents whose index compaction was started
+}
+
+// AutoCompact inspects the fragmentation of the database file and the view
+// indexes of all design documents and starts compaction of those above the
+// thresholds. Files that are already being compacted are skipped.
+func (db *DB) AutoCompact(opts CompactOptions) (*CompactReport, error) {
+	opts = opts.withDefaults()
+	report := new(CompactReport)
+
+	info, err := db.Info()
+	if err != nil {
+		return nil, err
+	}
+	if s := info.sizes(); !info.CompactRunning && s.File >= opts.MinFileSize && s.Fragmentation() > opts.DBThreshold {
+		if err := db.Compact(); err != nil {
+			return report, err
+		}
+		report.DB = true
+	}
+
+	var ddocs struct {
+		Rows []struct {
+			ID string `json:"id"`
+		} `json:"rows"`
+	}
+	err = db.AllDocs(&ddocs, Options{"startkey": "_design/", "endkey": "_design0"})
+	if err != nil {
+		return report, err
+	}
+	for _, row := range ddocs.Rows {
+		dinfo, err := db.DesignInfo(row.ID)
+		if err != nil {
+			if NotFound(err) {
+				continue // deleted concurrently
+			}
+			return report, err
+		}
+		vi := &dinfo.ViewIndex
+		if s := vi.sizes(); !vi.CompactRunning && s.File >= opts.MinFileSize && s.Fragmentation() > opts.ViewThreshold {
+			if err := db.CompactViews(row.ID); err != nil {
+				return report, err
+			}
+			report.Views = append(report.Views, row.ID)
+		}
+	}
+	return report, nil
+}
+
+// AutoCompactLoop runs AutoCompact immediately and then periodically
+// until the context is canceled. The context applies to all requests, so
+// canceling it also stops a run in progress. The result of every run is
+// passed to opts.Report. Errors do not stop the loop.
+func (db *DB) AutoCompactLoop(ctx context.Context, opts CompactOptions) error {
+	opts = opts.withDefaults()
+	db = db.WithContext(ctx)
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for {
+		report, err := db.AutoCompact(opts)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if opts.Report != nil {
+			opts.Report(report, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package couchdb_test
+
+import (
+	"context"
+	"io"
+	. "net/http"
+	"net/url"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestSizesFragmentation(t *testing.T) {
+	check(t, "fragmentation", 0.75, couchdb.Sizes{File: 400, Active: 100}.Fragmentation())
+	check(t, "fragmentation", 0.0, couchdb.Sizes{}.Fragmentation())
+}
+
+func TestAutoCompact(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"db_name": "db", "sizes": {"file": 1000, "active": 100}}`)
+	})
+	c.Handle("GET /db/_all_docs", func(resp ResponseWriter, req *Request) {
+		expected := url.Values{"startkey": {`"_design/"`}, "endkey": {`"_design0"`}}
+		check(t, "request query values", expected, req.URL.Query())
+		io.WriteString(resp, `{"rows": [{"id": "_design/a"}, {"id": "_design/b"}, {"id": "_design/c"}]}`)
+	})
+	c.Handle("GET /db/_design/a/_info", func(resp ResponseWriter, req *Request) {
+		// CouchDB 1.x style sizes.
+		io.WriteString(resp, `{"name": "a", "view_index": {"disk_size": 1000, "data_size": 900}}`)
+	})
+	c.Handle("GET /db/_design/b/_info", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"name": "b", "view_index": {"sizes": {"file": 1000, "active": 200}}}`)
+	})
+	c.Handle("GET /db/_design/c/_info", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"name": "c", "view_index": {"compact_running": true, "sizes": {"file": 1000, "active": 200}}}`)
+	})
+	var compacted []string
+	compact := func(resp ResponseWriter, req *Request) {
+		check(t, "content-type", "application/json", req.Header.Get("content-type"))
+		compacted = append(compacted, req.URL.Path)
+		resp.WriteHeader(StatusAccepted)
+		io.WriteString(resp, `{"ok": true}`)
+	}
+	c.Handle("POST /db/_compact", compact)
+	c.Handle("POST /db/_compact/b", compact)
+
+	report, err := c.DB("db").AutoCompact(couchdb.CompactOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "report", &couchdb.CompactReport{DB: true, Views: []string{"_design/b"}}, report)
+	check(t, "compacted", []string{"/db/_compact", "/db/_compact/b"}, compacted)
+
+	// MinFileSize prevents compaction of small files.
+	compacted = nil
+	report, err = c.DB("db").AutoCompact(couchdb.CompactOptions{MinFileSize: 2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "report", &couchdb.CompactReport{}, report)
+	check(t, "compacted", []string(nil), compacted)
+}
+
+func TestAutoCompactLoopCancel(t *testing.T) {
+	c := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "compact"))
+	var ctxValue interface{}
+	c.Handle("GET /db", func(resp ResponseWriter, req *Request) {
+		ctxValue = req.Context().Value(ctxKey{})
+		io.WriteString(resp, `{"db_name": "db", "sizes": {"file": 1000, "active": 1000}}`)
+	})
+	c.Handle("GET /db/_all_docs", func(resp ResponseWriter, req *Request) {
+		// Cancel during the scan.
+		cancel()
+		io.WriteString(resp, `{"rows": [{"id": "_design/a"}]}`)
+	})
+	c.Handle("GET /db/_design/a/_info", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"name": "a", "view_index": {"sizes": {"file": 1000, "active": 1000}}}`)
+	})
+
+	reports := 0
+	opts := couchdb.CompactOptions{Report: func(*couchdb.CompactReport, error) { reports++ }}
+	err := c.DB("db").AutoCompactLoop(ctx, opts)
+	check(t, "error", context.Canceled, err)
+	check(t, "request context", "compact", ctxValue)
+	check(t, "reports", 0, reports)
+}
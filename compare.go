@@ -0,0 +1,197 @@
+package couchdb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+)
+
+// DiffKind describes how a document differs between two databases.
+type DiffKind int
+
+const (
+	MissingInTarget DiffKind = iota // document exists only in the source
+	MissingInSource                 // document exists only in the target
+	Different                       // document differs
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case MissingInTarget:
+		return "missing in target"
+	case MissingInSource:
+		return "missing in source"
+	case Different:
+		return "different"
+	default:
+		return fmt.Sprintf("DiffKind(%d)", int(k))
+	}
+}
+
+// Diff is a document that differs between two databases.
+type Diff struct {
+	ID        string
+	Kind      DiffKind
+	SourceRev string // empty if missing in source
+	TargetRev string // empty if missing in target
+}
+
+// CompareOptions configures CompareDBs.
+type CompareOptions struct {
+	// Content makes CompareDBs compare document content instead of
+	// revisions. Use it to verify migrations that don't preserve revision
+	// IDs. Attachments are compared by digest. This option reads all
+	// documents of both databases.
+	Content bool
+
+	// OnDiff is called for every difference as it is found. If OnDiff
+	// is set, differences are not collected in the result. If OnDiff
+	// returns an error, the comparison is aborted with that error.
+	OnDiff func(Diff) error
+}
+
+// CompareResult is the outcome of CompareDBs.
+type CompareResult struct {
+	Compared int64  // number of distinct document IDs seen
+	Diffs    []Diff // differences, unless OnDiff is set
+}
+
+// Equal reports whether no differences were found.
+func (r *CompareResult) Equal() bool {
+	return len(r.Diffs) == 0
+}
+
+// CompareDBs compares the documents of two databases, e.g. to verify that
+// a replication or migration is complete. It reads the _all_docs index of
+// both databases in parallel, so its memory use doesn't depend on the size
+// of the databases. Deleted documents are not compared.
+//
+// By default, documents are considered equal if their current revisions
+// match. Conflicting revisions are not taken into account.
+func CompareDBs(source, target *DB, opts CompareOptions) (*CompareResult, error) {
+	query := Options{}
+	if opts.Content {
+		query["include_docs"] = true
+	}
+	src, err := source.AllDocsRows(query)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	dst, err := target.AllDocsRows(query)
+	if err != nil {
+		return nil, err
+	}
+	defer dst.Close()
+
+	result := new(CompareResult)
+	report := func(d Diff) error {
+		if opts.OnDiff != nil {
+			return opts.OnDiff(d)
+		}
+		result.Diffs = append(result.Diffs, d)
+		return nil
+	}
+
+	var s, d *compareRow
+	if s, err = nextCompareRow(src, opts.Content); err != nil {
+		return nil, err
+	}
+	if d, err = nextCompareRow(dst, opts.Content); err != nil {
+		return nil, err
+	}
+	for s != nil || d != nil {
+		result.Compared++
+		var diff *Diff
+		advanceSrc, advanceDst := true, true
+		switch {
+		case d == nil || (s != nil && s.id < d.id):
+			diff = &Diff{ID: s.id, Kind: MissingInTarget, SourceRev: s.rev}
+			advanceDst = false
+		case s == nil || d.id < s.id:
+			diff = &Diff{ID: d.id, Kind: MissingInSource, TargetRev: d.rev}
+			advanceSrc = false
+		case !s.equal(d):
+			diff = &Diff{ID: s.id, Kind: Different, SourceRev: s.rev, TargetRev: d.rev}
+		}
+		if diff != nil {
+			if err := report(*diff); err != nil {
+				return result, err
+			}
+		}
+		if advanceSrc {
+			if s, err = nextCompareRow(src, opts.Content); err != nil {
+				return result, err
+			}
+		}
+		if advanceDst {
+			if d, err = nextCompareRow(dst, opts.Content); err != nil {
+				return result, err
+			}
+		}
+	}
+	return result, nil
+}
+
+type compareRow struct {
+	id, rev string
+	hash    *[sha256.Size]byte // set if content is compared
+}
+
+func (r *compareRow) equal(o *compareRow) bool {
+	if r.hash != nil && o.hash != nil {
+		return *r.hash == *o.hash
+	}
+	return r.rev == o.rev
+}
+
+// nextCompareRow reads the next row of an _all_docs iterator.
+// It returns nil at the end of the result.
+func nextCompareRow(rows *Rows, content bool) (*compareRow, error) {
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	var value struct {
+		Rev string `json:"rev"`
+	}
+	if err := json.Unmarshal(rows.Value, &value); err != nil {
+		return nil, fmt.Errorf("couchdb: invalid _all_docs row %q: %v", rows.ID, err)
+	}
+	row := &compareRow{id: rows.ID, rev: value.Rev}
+	if content {
+		hash, err := contentHash(rows.Doc)
+		if err != nil {
+			return nil, fmt.Errorf("couchdb: invalid document %q: %v", rows.ID, err)
+		}
+		row.hash = &hash
+	}
+	return row, nil
+}
+
+// contentHash hashes a document without its revision. Attachments are
+// represented by their digest only because the other metadata depends
+// on the revision history. Numbers are kept as written because decoding
+// them as float64 would make large integers that differ hash equal.
+func contentHash(doc json.RawMessage) ([sha256.Size]byte, error) {
+	var fields map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	delete(fields, "_rev")
+	if atts, ok := fields["_attachments"].(map[string]interface{}); ok {
+		for name, att := range atts {
+			if m, ok := att.(map[string]interface{}); ok {
+				atts[name] = m["digest"]
+			}
+		}
+	}
+	// encoding/json sorts map keys, which makes the encoding canonical.
+	enc, err := json.Marshal(fields)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(enc), nil
+}
@@ -0,0 +1,90 @@
+package couchdb_test
+
+import (
+	"errors"
+	"io"
+	. "net/http"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestCompareDBs(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /src/_all_docs", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"total_rows": 4, "offset": 0, "rows": [
+			{"id": "a", "key": "a", "value": {"rev": "1-a"}},
+			{"id": "b", "key": "b", "value": {"rev": "2-b"}},
+			{"id": "c", "key": "c", "value": {"rev": "1-c"}},
+			{"id": "e", "key": "e", "value": {"rev": "1-e"}}
+		]}`)
+	})
+	c.Handle("GET /dst/_all_docs", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"total_rows": 3, "offset": 0, "rows": [
+			{"id": "a", "key": "a", "value": {"rev": "1-a"}},
+			{"id": "b", "key": "b", "value": {"rev": "1-b"}},
+			{"id": "d", "key": "d", "value": {"rev": "1-d"}}
+		]}`)
+	})
+
+	result, err := couchdb.CompareDBs(c.DB("src"), c.DB("dst"), couchdb.CompareOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "compared", int64(5), result.Compared)
+	check(t, "equal", false, result.Equal())
+	check(t, "diffs", []couchdb.Diff{
+		{ID: "b", Kind: couchdb.Different, SourceRev: "2-b", TargetRev: "1-b"},
+		{ID: "c", Kind: couchdb.MissingInTarget, SourceRev: "1-c"},
+		{ID: "d", Kind: couchdb.MissingInSource, TargetRev: "1-d"},
+		{ID: "e", Kind: couchdb.MissingInTarget, SourceRev: "1-e"},
+	}, result.Diffs)
+
+	// Streaming mode stops at the first error.
+	stop := errors.New("stop")
+	var seen []string
+	_, err = couchdb.CompareDBs(c.DB("src"), c.DB("dst"), couchdb.CompareOptions{
+		OnDiff: func(d couchdb.Diff) error {
+			seen = append(seen, d.ID)
+			if d.ID == "c" {
+				return stop
+			}
+			return nil
+		},
+	})
+	check(t, "error", stop, err)
+	check(t, "streamed diffs", []string{"b", "c"}, seen)
+}
+
+func TestCompareDBsContent(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /src/_all_docs", func(resp ResponseWriter, req *Request) {
+		check(t, "query", "include_docs=true", req.URL.RawQuery)
+		io.WriteString(resp, `{"rows": [
+			{"id": "a", "value": {"rev": "1-a"}, "doc": {"_id": "a", "_rev": "1-a", "x": 1, "y": [1, 2]}},
+			{"id": "b", "value": {"rev": "1-b"}, "doc": {"_id": "b", "_rev": "1-b", "x": 1,
+				"_attachments": {"f": {"digest": "md5-abc", "revpos": 1, "stub": true}}}},
+			{"id": "c", "value": {"rev": "1-c"}, "doc": {"_id": "c", "_rev": "1-c", "x": 1}},
+			{"id": "d", "value": {"rev": "1-d"}, "doc": {"_id": "d", "_rev": "1-d", "n": 9007199254740993}}
+		]}`)
+	})
+	c.Handle("GET /dst/_all_docs", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"rows": [
+			{"id": "a", "value": {"rev": "1-other"}, "doc": {"y": [1, 2], "_rev": "1-other", "x": 1, "_id": "a"}},
+			{"id": "b", "value": {"rev": "3-b"}, "doc": {"_id": "b", "_rev": "3-b", "x": 1,
+				"_attachments": {"f": {"digest": "md5-abc", "revpos": 2, "stub": true}}}},
+			{"id": "c", "value": {"rev": "1-c"}, "doc": {"_id": "c", "_rev": "1-c", "x": 2}},
+			{"id": "d", "value": {"rev": "1-d"}, "doc": {"_id": "d", "_rev": "1-d", "n": 9007199254740992}}
+		]}`)
+	})
+
+	result, err := couchdb.CompareDBs(c.DB("src"), c.DB("dst"), couchdb.CompareOptions{Content: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "diffs", []couchdb.Diff{
+		{ID: "c", Kind: couchdb.Different, SourceRev: "1-c", TargetRev: "1-c"},
+		// Integers beyond float64 precision are compared exactly.
+		{ID: "d", Kind: couchdb.Different, SourceRev: "1-d", TargetRev: "1-d"},
+	}, result.Diffs)
+}
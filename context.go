@@ -0,0 +1,96 @@
+package couchdb
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WithContext returns a copy of the client that sends all requests with the
+// given context. Canceling the context aborts pending requests and closes
+// open feeds. Database objects created by DB inherit the context.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	if ctx == nil {
+		panic("couchdb: nil context")
+	}
+	return &Client{transport: c.transport, ctx: ctx}
+}
+
+// Context returns the context of the client.
+// The default is context.Background().
+func (c *Client) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// WithTimeout returns a copy of the client whose requests fail after the
+// given duration has passed. The returned function releases the resources
+// of the timeout and should be called when the client copy is no longer used.
+func (c *Client) WithTimeout(d time.Duration) (*Client, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(c.Context(), d)
+	return c.WithContext(ctx), cancel
+}
+
+// WithContext returns a copy of the database object that sends all requests
+// with the given context.
+func (db *DB) WithContext(ctx context.Context) *DB {
+	if ctx == nil {
+		panic("couchdb: nil context")
+	}
+	cpy := *db
+	cpy.ctx = ctx
+	return &cpy
+}
+
+// Context returns the context of the database object.
+// The default is context.Background().
+func (db *DB) Context() context.Context {
+	if db.ctx == nil {
+		return context.Background()
+	}
+	return db.ctx
+}
+
+// WithTimeout returns a copy of the database object whose requests fail
+// after the given duration has passed. See Client.WithTimeout.
+func (db *DB) WithTimeout(d time.Duration) (*DB, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(db.Context(), d)
+	return db.WithContext(ctx), cancel
+}
+
+// The following methods shadow the request methods of the transport
+// so that requests sent by client methods use the client context.
+
+func (c *Client) newRequest(method, path string, body io.Reader) (*http.Request, error) {
+	return c.withContext(c.transport.newRequest(method, path, body))
+}
+
+func (c *Client) newAnonRequest(method, path string, body io.Reader) (*http.Request, error) {
+	return c.withContext(c.transport.newAnonRequest(method, path, body))
+}
+
+func (c *Client) withContext(req *http.Request, err error) (*http.Request, error) {
+	if err != nil || c.ctx == nil {
+		return req, err
+	}
+	return req.WithContext(c.ctx), nil
+}
+
+func (c *Client) request(method, path string, body io.Reader) (*http.Response, error) {
+	req, err := c.newRequest(method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+func (c *Client) closedRequest(method, path string, body io.Reader) (*http.Response, error) {
+	resp, err := c.request(method, path, body)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return resp, err
+}
@@ -0,0 +1,77 @@
+package couchdb_test
+
+import (
+	"context"
+	"io"
+	. "net/http"
+	"testing"
+	"time"
+)
+
+type ctxKey struct{}
+
+func TestWithContext(t *testing.T) {
+	c := newTestClient(t)
+	var got []interface{}
+	record := func(req *Request) {
+		got = append(got, req.Context().Value(ctxKey{}))
+	}
+	c.Handle("GET /_all_dbs", func(resp ResponseWriter, req *Request) {
+		record(req)
+		io.WriteString(resp, `[]`)
+	})
+	c.Handle("GET /_db_updates", func(resp ResponseWriter, req *Request) {
+		record(req)
+		io.WriteString(resp, `{"results": [], "last_seq": "1-a"}`)
+	})
+	c.Handle("GET /db/doc/att", func(resp ResponseWriter, req *Request) {
+		record(req)
+		io.WriteString(resp, `x`)
+	})
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "client")
+	cc := c.WithContext(ctx)
+	if _, err := cc.AllDBs(); err != nil {
+		t.Fatal(err)
+	}
+	feed, err := cc.DBUpdates(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed.Close()
+	// Databases inherit the client context.
+	if _, err := cc.DB("db").Attachment("doc", "att", ""); err != nil {
+		t.Fatal(err)
+	}
+	// The context of a database can be replaced.
+	dbctx := context.WithValue(context.Background(), ctxKey{}, "db")
+	if _, err := c.DB("db").WithContext(dbctx).Attachment("doc", "att", ""); err != nil {
+		t.Fatal(err)
+	}
+	// The original client is unaffected.
+	if _, err := c.AllDBs(); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "contexts", []interface{}{"client", "client", "client", "db", nil}, got)
+}
+
+func TestWithTimeout(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db", func(resp ResponseWriter, req *Request) {
+		if _, ok := req.Context().Deadline(); !ok {
+			t.Error("request has no deadline")
+		}
+		<-req.Context().Done()
+		resp.WriteHeader(StatusGatewayTimeout)
+	})
+
+	db, cancel := c.DB("db").WithTimeout(10 * time.Millisecond)
+	defer cancel()
+	db.Info()
+	check(t, "context error", context.DeadlineExceeded, db.Context().Err())
+
+	cc, cancel := c.WithTimeout(time.Minute)
+	cancel()
+	check(t, "client context error", context.Canceled, cc.Context().Err())
+	check(t, "default context", context.Background(), c.Context())
+}
@@ -0,0 +1,222 @@
+package couchapp
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fjl/go-couchdb"
+)
+
+// fileSystem is the source of app files. Paths use forward slashes.
+type fileSystem interface {
+	readDir(dir string) ([]os.FileInfo, error)
+	readFile(name string) ([]byte, error)
+	open(name string) (io.ReadCloser, error)
+}
+
+// osFS reads files from disk.
+type osFS struct{}
+
+func (osFS) readDir(dir string) ([]os.FileInfo, error) { return ioutil.ReadDir(dir) }
+func (osFS) readFile(name string) ([]byte, error)      { return ioutil.ReadFile(name) }
+func (osFS) open(name string) (io.ReadCloser, error)   { return os.Open(name) }
+
+// Archive is a zip or tar archive containing app directories, e.g. a build
+// artifact published by CI. Its directories can be loaded and deployed like
+// directories on disk.
+type Archive struct {
+	files  map[string]openFunc // nil for directories
+	dirs   map[string][]os.FileInfo
+	closer io.Closer
+}
+
+type openFunc func() (io.ReadCloser, error)
+
+// OpenArchive opens an archive file. The format is chosen by the file
+// extension: ".zip", ".tar", ".tar.gz" or ".tgz". Tar archives are read
+// into memory, zip archives are read on demand and must be closed.
+func OpenArchive(file string) (*Archive, error) {
+	switch {
+	case strings.HasSuffix(file, ".zip"):
+		r, err := zip.OpenReader(file)
+		if err != nil {
+			return nil, err
+		}
+		a := newArchive()
+		a.closer = r
+		a.addZip(r.File)
+		return a, nil
+	case strings.HasSuffix(file, ".tar"), strings.HasSuffix(file, ".tar.gz"), strings.HasSuffix(file, ".tgz"):
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		var r io.Reader = f
+		if !strings.HasSuffix(file, ".tar") {
+			gz, err := gzip.NewReader(f)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", file, err)
+			}
+			defer gz.Close()
+			r = gz
+		}
+		a, err := ReadTar(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		return a, nil
+	default:
+		return nil, fmt.Errorf("%s: unknown archive format", file)
+	}
+}
+
+// ReadTar reads an uncompressed tar archive into memory.
+func ReadTar(r io.Reader) (*Archive, error) {
+	a := newArchive()
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return a, nil
+		} else if err != nil {
+			return nil, err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			a.add(hdr.Name, nil, nil)
+		case tar.TypeReg, tar.TypeRegA:
+			content, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			a.add(hdr.Name, hdr.FileInfo(), func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(bytes.NewReader(content)), nil
+			})
+		}
+	}
+}
+
+// ReadZip reads a zip archive.
+func ReadZip(r io.ReaderAt, size int64) (*Archive, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	a := newArchive()
+	a.addZip(zr.File)
+	return a, nil
+}
+
+func (a *Archive) addZip(files []*zip.File) {
+	for _, f := range files {
+		if f.FileInfo().IsDir() {
+			a.add(f.Name, nil, nil)
+		} else {
+			a.add(f.Name, f.FileInfo(), f.Open)
+		}
+	}
+}
+
+func newArchive() *Archive {
+	return &Archive{
+		files: make(map[string]openFunc),
+		dirs:  map[string][]os.FileInfo{".": nil},
+	}
+}
+
+// add registers a file or, if open is nil, a directory.
+// Parent directories are created as needed.
+func (a *Archive) add(name string, info os.FileInfo, open openFunc) {
+	name = path.Clean("/" + name)[1:]
+	if name == "" {
+		return
+	}
+	if _, ok := a.files[name]; ok {
+		return
+	}
+	if open == nil {
+		info = dirInfo(path.Base(name))
+		a.dirs[name] = nil
+	}
+	a.files[name] = open
+	parent := path.Dir(name)
+	if _, ok := a.files[parent]; !ok && parent != "." {
+		a.add(parent, nil, nil)
+	}
+	a.dirs[parent] = append(a.dirs[parent], info)
+}
+
+// Close releases the archive file.
+func (a *Archive) Close() error {
+	if a.closer != nil {
+		return a.closer.Close()
+	}
+	return nil
+}
+
+// LoadDirectory loads a directory of the archive like LoadDirectoryWithOptions.
+// Use "." for the root directory.
+func (a *Archive) LoadDirectory(dir string, opts LoadOptions) (Doc, error) {
+	return loadDirectory(a, dir, opts)
+}
+
+// LoadManifest reads the manifest of an app directory in the archive.
+// Use Manifest.DeployArchive to deploy the app.
+func (a *Archive) LoadManifest(dir string) (*Manifest, error) {
+	return loadManifest(a, dir)
+}
+
+// StoreAttachments uploads the files in a directory of the archive
+// like the StoreAttachments function.
+func (a *Archive) StoreAttachments(db *couchdb.DB, docid, rev, dir string, ignores []string) (string, error) {
+	return storeAttachments(a, db, docid, rev, dir, ignores)
+}
+
+func (a *Archive) readDir(dir string) ([]os.FileInfo, error) {
+	dir = path.Clean(dir)
+	infos, ok := a.dirs[dir]
+	if !ok {
+		return nil, &os.PathError{Op: "readdir", Path: dir, Err: os.ErrNotExist}
+	}
+	infos = append([]os.FileInfo(nil), infos...)
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (a *Archive) readFile(name string) ([]byte, error) {
+	r, err := a.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func (a *Archive) open(name string) (io.ReadCloser, error) {
+	open := a.files[path.Clean(name)]
+	if open == nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return open()
+}
+
+// dirInfo describes directories that have no entry in the archive.
+type dirInfo string
+
+func (d dirInfo) Name() string       { return string(d) }
+func (d dirInfo) Size() int64        { return 0 }
+func (d dirInfo) Mode() os.FileMode  { return os.ModeDir | 0755 }
+func (d dirInfo) ModTime() time.Time { return time.Time{} }
+func (d dirInfo) IsDir() bool        { return true }
+func (d dirInfo) Sys() interface{}   { return nil }
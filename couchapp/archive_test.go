@@ -0,0 +1,143 @@
+package couchapp
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeArchive packs the files in dir into an archive.
+// The format is chosen by the extension of file.
+func writeArchive(t *testing.T, file, dir, prefix string) {
+	out, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	var add func(name string, content []byte) error
+	var closeAll func() error
+	if filepath.Ext(file) == ".zip" {
+		zw := zip.NewWriter(out)
+		add = func(name string, content []byte) error {
+			w, err := zw.Create(name)
+			if err == nil {
+				_, err = w.Write(content)
+			}
+			return err
+		}
+		closeAll = zw.Close
+	} else {
+		gz := gzip.NewWriter(out)
+		tw := tar.NewWriter(gz)
+		add = func(name string, content []byte) error {
+			hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			_, err := tw.Write(content)
+			return err
+		}
+		closeAll = func() error {
+			tw.Close()
+			return gz.Close()
+		}
+	}
+
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		content, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		return add(prefix+filepath.ToSlash(rel), content)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := closeAll(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchiveLoadDirectory(t *testing.T) {
+	want, err := LoadDirectory("testdata/dir", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp := t.TempDir()
+	for _, name := range []string{"app.zip", "app.tar.gz"} {
+		file := filepath.Join(tmp, name)
+		writeArchive(t, file, "testdata/dir", "build/app/")
+		a, err := OpenArchive(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, err := a.LoadDirectory("build/app", LoadOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, name+" doc", want, doc)
+		if _, err := a.LoadDirectory("missing", LoadOptions{}); err == nil {
+			t.Errorf("%s: expected error for missing directory", name)
+		}
+		a.Close()
+	}
+
+	if _, err := OpenArchive(filepath.Join(tmp, "app.rar")); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestManifestDeployArchive(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.tgz")
+	writeArchive(t, file, "testdata/manifest", "./")
+	a, err := OpenArchive(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	m, err := a.LoadManifest(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath())
+		io.Copy(ioutil.Discard, r.Body)
+		switch r.Method {
+		case "GET":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error": "not_found", "reason": "missing"}`)
+		case "PUT":
+			w.Header().Set("ETag", fmt.Sprintf(`"%d-x"`, len(requests)))
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"ok": true, "rev": "%d-x"}`, len(requests))
+		}
+	}))
+	defer srv.Close()
+	m.Targets["default"] = Target{Server: srv.URL, DBs: m.Targets["default"].DBs}
+
+	deployed, err := m.DeployArchive(a, ".", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "deployed", []Deployment{{DB: "app", Rev: "3-x", Attachments: AttachmentStats{Uploaded: 1}}}, deployed)
+	check(t, "requests", []string{
+		"GET /app/_design/app",
+		"PUT /app/_design/app",
+		"PUT /app/_design/app/index.html",
+	}, requests)
+}
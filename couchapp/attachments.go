@@ -0,0 +1,130 @@
+package couchapp
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/fjl/go-couchdb"
+)
+
+// AttachmentStats counts the attachments processed by SyncAttachments.
+type AttachmentStats struct {
+	Uploaded int // files whose content differed from the stored attachment
+	Skipped  int // files that were already stored
+}
+
+// SyncAttachments is like StoreAttachments, but uploads only files whose
+// content differs from the attachments of the stored document. Files are
+// compared with attachment stubs by MD5 digest and content type. Stored
+// attachments without a corresponding file are kept.
+//
+// CouchDB compresses attachments of compressible types such as text/html,
+// text/css and application/javascript when storing them. The digest of
+// such attachments covers the compressed data and the digest of the
+// original content is not available, so they are always uploaded.
+//
+// A correct revision id is returned in all cases, even if there was an error.
+func SyncAttachments(
+	db *couchdb.DB,
+	docid, rev, dir string,
+	ignores []string,
+) (newrev string, stats AttachmentStats, err error) {
+	stubs, _, err := storedAttachments(db, docid)
+	if err != nil {
+		return rev, stats, err
+	}
+	return syncAttachments(osFS{}, db, docid, rev, dir, ignores, stubs)
+}
+
+// storedAttachments returns the attachment stubs and revision of a
+// document. It returns no error if the document does not exist.
+func storedAttachments(db *couchdb.DB, docid string) (map[string]*couchdb.InlineAttachment, string, error) {
+	var raw json.RawMessage
+	opts := couchdb.Options{"att_encoding_info": true}
+	if err := db.Get(docid, &raw, opts); couchdb.NotFound(err) {
+		return nil, "", nil
+	} else if err != nil {
+		return nil, "", err
+	}
+	var doc struct {
+		Rev string `json:"_rev"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, "", err
+	}
+	stubs, err := couchdb.InlineAttachments(raw)
+	return stubs, doc.Rev, err
+}
+
+// attachmentFiles returns the attachment names of the files in dir.
+func attachmentFiles(fsys fileSystem, dir string, ignores []string) (map[string]bool, error) {
+	names := make(map[string]bool)
+	err := walk(fsys, dir, ignores, func(p string, isDir, dirEnd bool) error {
+		if !isDir {
+			names[strings.TrimPrefix(p, dir+"/")] = true
+		}
+		return nil
+	})
+	return names, err
+}
+
+func syncAttachments(
+	fsys fileSystem,
+	db *couchdb.DB,
+	docid, rev, dir string,
+	ignores []string,
+	stubs map[string]*couchdb.InlineAttachment,
+) (newrev string, stats AttachmentStats, err error) {
+	newrev = rev
+	err = walk(fsys, dir, ignores, func(p string, isDir, dirEnd bool) error {
+		if isDir {
+			return nil
+		}
+		name := strings.TrimPrefix(p, dir+"/")
+		ctype := mime.TypeByExtension(path.Ext(p))
+		// Digests of encoded attachments can't be compared with the file.
+		stub := stubs[name]
+		if stub != nil && stub.Encoding == "" && (ctype == "" || stub.ContentType == ctype) {
+			digest, err := fileDigest(fsys, p)
+			if err != nil {
+				return err
+			}
+			if digest == stub.Digest {
+				stats.Skipped++
+				return nil
+			}
+		}
+
+		body, err := fsys.open(p)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+		att := &couchdb.Attachment{Name: name, Type: ctype, Body: body}
+		if newrev, err = db.PutAttachment(docid, att, newrev); err != nil {
+			return err
+		}
+		stats.Uploaded++
+		return nil
+	})
+	return
+}
+
+// fileDigest computes the digest of a file in the format used by CouchDB.
+func fileDigest(fsys fileSystem, name string) (string, error) {
+	f, err := fsys.open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "md5-" + base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
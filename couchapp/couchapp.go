@@ -10,12 +10,15 @@ package couchapp
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"mime"
 	"os"
 	"path"
 	"strings"
+	"text/template"
 
 	"github.com/fjl/go-couchdb"
 )
@@ -77,12 +80,75 @@ func LoadFile(file string) (Doc, error) {
 // If nil is given, the default patterns are used. The patterns are
 // matched against the basename, not the full path.
 func LoadDirectory(dirname string, ignores []string) (Doc, error) {
+	return LoadDirectoryWithOptions(dirname, LoadOptions{Ignores: ignores})
+}
+
+// LoadOptions configures LoadDirectoryWithOptions.
+type LoadOptions struct {
+	// Ignores is a slice of glob patterns for ignored files.
+	// If nil, the default patterns are used.
+	Ignores []string
+
+	// If Template is true, file contents are executed as text/template
+	// templates before they are used. This can be used to inject
+	// deploy-time configuration into documents. The following functions
+	// are available in templates:
+	//
+	//     {{env "VAR"}}               value of VAR, fails if VAR is not set
+	//     {{envOr "VAR" "default"}}   value of VAR or the default
+	//     {{json .}}                  JSON encoding of the argument
+	//
+	// Note that JSON files must quote substituted strings, e.g. by
+	// writing {{env "VAR" | json}}.
+	Template bool
+
+	// Env looks up environment variables for templates.
+	// If nil, os.LookupEnv is used.
+	Env func(string) (string, bool)
+
+	// If Validate is true, files with the .js extension are checked for
+	// syntax errors such as unbalanced brackets or unterminated strings.
+	// Files must contain a function expression, except for CommonJS modules
+	// in directories named "lib". The check is not a full JavaScript parser.
+	Validate bool
+
+	// If MergeVendor is true, vendored components in the "vendor"
+	// directory are merged into the document. See MergeVendor.
+	MergeVendor bool
+
+	// If Minify is true, comments and redundant whitespace are removed
+	// from files with the .js extension. This makes design documents
+	// smaller and keeps their content stable when only comments or
+	// indentation change, so views are not rebuilt needlessly.
+	Minify bool
+
+	// Exclude lists files and directories that are not loaded, as
+	// slash-separated paths relative to the app directory. Unlike
+	// Ignores, which match file names anywhere in the tree, Exclude
+	// matches a single location such as "static/assets".
+	Exclude []string
+}
+
+// LoadDirectoryWithOptions is like LoadDirectory, but
+// supports additional options.
+func LoadDirectoryWithOptions(dirname string, opts LoadOptions) (Doc, error) {
+	return loadDirectory(osFS{}, dirname, opts)
+}
+
+func loadDirectory(fsys fileSystem, dirname string, opts LoadOptions) (Doc, error) {
 	stack := &objstack{obj: make(Doc)}
-	err := walk(dirname, ignores, func(p string, isDir, dirEnd bool) error {
+	exclude := make(map[string]bool, len(opts.Exclude))
+	for _, p := range opts.Exclude {
+		exclude[path.Join(dirname, p)] = true
+	}
+	err := walk(fsys, dirname, opts.Ignores, func(p string, isDir, dirEnd bool) error {
 		if dirEnd {
 			stack = stack.parent // pop
 			return nil
 		}
+		if exclude[p] {
+			return errSkip
+		}
 
 		name := path.Base(p)
 		if isDir {
@@ -90,7 +156,7 @@ func LoadDirectory(dirname string, ignores []string) (Doc, error) {
 			stack.obj[name] = val
 			stack = &objstack{obj: val, parent: stack} // push
 		} else {
-			content, err := load(p)
+			content, err := load(fsys, p, &opts)
 			if err != nil {
 				return err
 			}
@@ -101,6 +167,11 @@ func LoadDirectory(dirname string, ignores []string) (Doc, error) {
 	if err != nil {
 		return nil, err
 	}
+	if opts.MergeVendor {
+		if err := MergeVendor(stack.obj); err != nil {
+			return nil, fmt.Errorf("%s: %v", dirname, err)
+		}
+	}
 	return stack.obj, err
 }
 
@@ -109,21 +180,73 @@ type objstack struct {
 	parent *objstack
 }
 
-func load(filename string) (interface{}, error) {
-	if path.Ext(filename) == ".json" {
-		return loadJSON(filename)
+func load(fsys fileSystem, filename string, opts *LoadOptions) (interface{}, error) {
+	content, err := fsys.readFile(filename)
+	if err != nil {
+		return nil, err
 	}
-	return loadString(filename)
+	if opts.Template {
+		if content, err = opts.execTemplate(filename, content); err != nil {
+			return nil, err
+		}
+	}
+	switch path.Ext(filename) {
+	case ".json":
+		return decodeJSON(filename, content)
+	case ".js":
+		if opts.Validate {
+			isFunc := !strings.Contains("/"+path.Dir(filename)+"/", "/lib/")
+			if err := checkJS(filename, string(content), isFunc); err != nil {
+				return nil, err
+			}
+		}
+		if opts.Minify {
+			return minifyJS(trimString(content)), nil
+		}
+	}
+	return trimString(content), nil
 }
 
-// loadString returns the given file's contents as a string
-// and strips off any surrounding whitespace.
-func loadString(file string) (string, error) {
-	data, err := ioutil.ReadFile(file)
+// execTemplate executes content as a template.
+func (opts *LoadOptions) execTemplate(filename string, content []byte) ([]byte, error) {
+	lookup := opts.Env
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	funcs := template.FuncMap{
+		"env": func(name string) (string, error) {
+			v, ok := lookup(name)
+			if !ok {
+				return "", fmt.Errorf("environment variable %s is not set", name)
+			}
+			return v, nil
+		},
+		"envOr": func(name, def string) string {
+			if v, ok := lookup(name); ok {
+				return v
+			}
+			return def
+		},
+		"json": func(v interface{}) (string, error) {
+			enc, err := json.Marshal(v)
+			return string(enc), err
+		},
+	}
+	tmpl, err := template.New(filename).Funcs(funcs).Parse(string(content))
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		return nil, err
 	}
-	return string(bytes.Trim(data, " \n\r")), nil
+	return buf.Bytes(), nil
+}
+
+// trimString returns content as a string
+// and strips off any surrounding whitespace.
+func trimString(content []byte) string {
+	return string(bytes.Trim(content, " \n\r"))
 }
 
 // loadJSON decodes the content of the given file as JSON.
@@ -132,9 +255,17 @@ func loadJSON(file string) (interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
-	// TODO: use json.Number
+	return decodeJSON(file, content)
+}
+
+// decodeJSON decodes content as JSON. The file name is used in errors.
+func decodeJSON(file string, content []byte) (interface{}, error) {
+	// Numbers are decoded as json.Number so integers
+	// larger than 2^53 survive the round trip.
 	var val interface{}
-	if err := json.Unmarshal(content, &val); err != nil {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+	if err := dec.Decode(&val); err != nil {
 		if syntaxerr, ok := err.(*json.SyntaxError); ok {
 			line := findLine(content, syntaxerr.Offset)
 			err = fmt.Errorf("JSON syntax error at %v:%v: %v", file, line, err)
@@ -142,6 +273,10 @@ func loadJSON(file string) (interface{}, error) {
 		}
 		return nil, fmt.Errorf("JSON unmarshal error in %v: %v", file, err)
 	}
+	if _, err := dec.Token(); err != io.EOF {
+		line := findLine(content, dec.InputOffset())
+		return nil, fmt.Errorf("JSON syntax error at %v:%v: data after top-level value", file, line)
+	}
 	return val, nil
 }
 
@@ -195,18 +330,25 @@ func StoreAttachments(
 	docid, rev, dir string,
 	ignores []string,
 ) (newrev string, err error) {
+	return storeAttachments(osFS{}, db, docid, rev, dir, ignores)
+}
+
+func storeAttachments(fsys fileSystem, db *couchdb.DB, docid, rev, dir string, ignores []string) (newrev string, err error) {
 	newrev = rev
-	err = walk(dir, ignores, func(p string, isDir, dirEnd bool) error {
+	err = walk(fsys, dir, ignores, func(p string, isDir, dirEnd bool) error {
 		if isDir {
 			return nil
 		}
 
+		body, err := fsys.open(p)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
 		att := &couchdb.Attachment{
 			Name: strings.TrimPrefix(p, dir+"/"),
 			Type: mime.TypeByExtension(path.Ext(p)),
-		}
-		if att.Body, err = os.Open(p); err != nil {
-			return err
+			Body: body,
 		}
 		newrev, err = db.PutAttachment(docid, att, newrev)
 		return err
@@ -214,13 +356,18 @@ func StoreAttachments(
 	return
 }
 
+// walkFunc is called by walk for every file and directory. For directories,
+// it is called before and after (dirEnd) visiting their content. Returning
+// errSkip from the first call skips the file or directory.
 type walkFunc func(path string, isDir, dirEnd bool) error
 
-func walk(dir string, ignores []string, callback walkFunc) error {
+var errSkip = errors.New("skip")
+
+func walk(fsys fileSystem, dir string, ignores []string, callback walkFunc) error {
 	if ignores == nil {
 		ignores = DefaultIgnorePatterns
 	}
-	files, err := ioutil.ReadDir(dir)
+	files, err := fsys.readDir(dir)
 	if err != nil {
 		return err
 	}
@@ -237,11 +384,13 @@ func walk(dir string, ignores []string, callback walkFunc) error {
 			}
 		}
 
-		if err := callback(subpath, isDir, false); err != nil {
+		if err := callback(subpath, isDir, false); err == errSkip {
+			goto next
+		} else if err != nil {
 			return err
 		}
 		if isDir {
-			if err := walk(subpath, ignores, callback); err != nil {
+			if err := walk(fsys, subpath, ignores, callback); err != nil {
 				return err
 			}
 			if err := callback(subpath, true, true); err != nil {
@@ -1,6 +1,10 @@
 package couchapp
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"path"
 	"reflect"
 	"testing"
@@ -14,12 +18,21 @@ func TestLoadFile(t *testing.T) {
 
 	expdoc := Doc{
 		"_id":   "doc",
-		"float": 1.0,
-		"array": []interface{}{1.0, 2.0, 3.0},
+		"float": json.Number("1.0"),
+		"array": []interface{}{json.Number("1"), json.Number("2"), json.Number("3")},
 	}
 	check(t, "doc", expdoc, doc)
 }
 
+func TestLoadDirectoryMinify(t *testing.T) {
+	doc, err := LoadDirectoryWithOptions("testdata/dir", LoadOptions{Minify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	view := doc["views"].(map[string]interface{})["abc.xyz"].(map[string]interface{})
+	check(t, "map", "function(x){return x;}", view["map"])
+}
+
 func TestLoadDirectory(t *testing.T) {
 	doc, err := LoadDirectory("testdata/dir", nil)
 	if err != nil {
@@ -40,6 +53,50 @@ func TestLoadDirectory(t *testing.T) {
 	check(t, "doc", expdoc, doc)
 }
 
+func TestLoadDirectoryTemplate(t *testing.T) {
+	env := map[string]string{"SERVICE_URL": "https://example.com/", "DB_NAME": `db"1`}
+	opts := LoadOptions{
+		Template: true,
+		Env: func(name string) (string, bool) {
+			v, ok := env[name]
+			return v, ok
+		},
+	}
+	doc, err := LoadDirectoryWithOptions("testdata/tmpl", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expdoc := Doc{
+		"url":    "https://example.com/",
+		"config": map[string]interface{}{"db": `db"1`, "flag": false},
+	}
+	check(t, "doc", expdoc, doc)
+
+	// Without Template, files are loaded as is.
+	doc, err = LoadDirectory("testdata/tmpl", []string{"*.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "doc", Doc{"url": `{{env "SERVICE_URL"}}`}, doc)
+
+	// Unset variables are an error.
+	delete(env, "DB_NAME")
+	if _, err := LoadDirectoryWithOptions("testdata/tmpl", opts); err == nil {
+		t.Fatal("expected error for unset variable")
+	}
+}
+
+func TestLoadDirectoryValidate(t *testing.T) {
+	_, err := LoadDirectoryWithOptions("testdata/broken", LoadOptions{Validate: true})
+	want := `testdata/broken/views/v/map.js:3: unexpected '}', '(' from line 2 is not closed`
+	if err == nil || err.Error() != want {
+		t.Fatalf("wrong error: got %v, want %s", err, want)
+	}
+	if _, err := LoadDirectoryWithOptions("testdata/dir", LoadOptions{Validate: true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestBrokenIgnorePattern(t *testing.T) {
 	doc, err := LoadDirectory("testdata/dir", []string{"[]"})
 	check(t, "doc", Doc(nil), doc)
@@ -51,3 +108,197 @@ func check(t *testing.T, field string, expected, actual interface{}) {
 		t.Errorf("%s mismatch: want %#v, got %#v", field, expected, actual)
 	}
 }
+
+func TestLoadDirectoryMergeVendor(t *testing.T) {
+	doc, err := LoadDirectoryWithOptions("testdata/vendor", LoadOptions{MergeVendor: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expdoc := Doc{
+		"lists": map[string]interface{}{
+			"index": `function (head, req) { return "index"; }`,
+			"table": `function (head, req) { return "table"; }`,
+		},
+		"shows": map[string]interface{}{
+			"item": `function (doc, req) { return doc.title; }`,
+		},
+		"views": map[string]interface{}{
+			"lib": map[string]interface{}{
+				"app":     "exports.app = 1;",
+				"helpers": "exports.helpers = 1;",
+			},
+		},
+		"vendor": map[string]interface{}{
+			"helpers": map[string]interface{}{
+				"lib": map[string]interface{}{
+					"render": "exports.render = function (x) { return x; };",
+				},
+			},
+		},
+	}
+	check(t, "doc", expdoc, doc)
+}
+
+func TestMergeVendorConflict(t *testing.T) {
+	doc := Doc{
+		"shows": map[string]interface{}{"item": "function () {}"},
+		"vendor": map[string]interface{}{
+			"a": map[string]interface{}{
+				"shows": map[string]interface{}{"item": "function () { return 1; }"},
+			},
+		},
+	}
+	err := MergeVendor(doc)
+	want := "vendor/a: shows.item is already defined"
+	if err == nil || err.Error() != want {
+		t.Fatalf("wrong error: got %v, want %s", err, want)
+	}
+}
+
+func TestManifestDeploy(t *testing.T) {
+	m, err := LoadManifest("testdata/manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests []string
+	var stored map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath())
+		switch r.Method {
+		case "GET":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error": "not_found", "reason": "missing"}`)
+		case "PUT":
+			if r.URL.EscapedPath() == "/app/_design/app" {
+				json.NewDecoder(r.Body).Decode(&stored)
+			}
+			w.Header().Set("ETag", fmt.Sprintf(`"%d-x"`, len(requests)))
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"ok": true, "rev": "%d-x"}`, len(requests))
+		}
+	}))
+	defer srv.Close()
+	m.Targets["default"] = Target{Server: srv.URL, DBs: m.Targets["default"].DBs}
+
+	deployed, err := m.Deploy("testdata/manifest", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "deployed", []Deployment{{DB: "app", Rev: "3-x", Attachments: AttachmentStats{Uploaded: 1}}}, deployed)
+	check(t, "requests", []string{
+		"GET /app/_design/app",
+		"PUT /app/_design/app",
+		"PUT /app/_design/app/index.html",
+	}, requests)
+	check(t, "stored doc", map[string]interface{}{
+		"shows": map[string]interface{}{"item": "function (doc, req) { return doc.title; }"},
+	}, stored)
+
+	if _, err := m.Deploy("testdata/manifest", "prod"); err == nil {
+		t.Error("expected error for unknown target")
+	}
+}
+
+func TestManifestNestedAttachments(t *testing.T) {
+	m, err := LoadManifest("testdata/nested")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := LoadDirectoryWithOptions("testdata/nested", m.LoadOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the attachments directory is excluded, not other
+	// directories with the same name.
+	check(t, "doc", Doc{
+		"static": map[string]interface{}{"robots": "User-agent: *"},
+		"lib": map[string]interface{}{
+			"assets": map[string]interface{}{"data": "asset"},
+		},
+	}, doc)
+}
+
+func TestManifestDeploySkipsAttachments(t *testing.T) {
+	m, err := LoadManifest("testdata/manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests []string
+	var stored map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath())
+		switch r.Method {
+		case "GET":
+			check(t, "query", "att_encoding_info=true", r.URL.RawQuery)
+			fmt.Fprint(w, `{
+				"_id": "_design/app",
+				"_rev": "1-x",
+				"_attachments": {
+					"index.html": {"content_type": "text/html; charset=utf-8", "digest": "md5-OR67TI2toHk8PZoe87saWA==", "revpos": 1, "stub": true},
+					"removed.css": {"content_type": "text/css; charset=utf-8", "digest": "md5-AAAAAAAAAAAAAAAAAAAAAA==", "revpos": 1, "stub": true}
+				}
+			}`)
+		case "PUT":
+			check(t, "rev", "1-x", r.URL.Query().Get("rev"))
+			json.NewDecoder(r.Body).Decode(&stored)
+			w.Header().Set("ETag", `"2-x"`)
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"ok": true, "rev": "2-x"}`)
+		}
+	}))
+	defer srv.Close()
+	m.Targets["default"] = Target{Server: srv.URL, DBs: m.Targets["default"].DBs}
+
+	deployed, err := m.Deploy("testdata/manifest", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "deployed", []Deployment{{DB: "app", Rev: "2-x", Attachments: AttachmentStats{Skipped: 1}}}, deployed)
+	check(t, "requests", []string{"GET /app/_design/app", "PUT /app/_design/app"}, requests)
+	check(t, "stored attachments", map[string]interface{}{
+		"index.html": map[string]interface{}{"stub": true},
+	}, stored["_attachments"])
+}
+
+func TestManifestDeployEncodedAttachments(t *testing.T) {
+	m, err := LoadManifest("testdata/manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath())
+		switch r.Method {
+		case "GET":
+			// The digest of gzip-encoded attachments is not the MD5 of the
+			// file, even if it happens to match.
+			fmt.Fprint(w, `{
+				"_id": "_design/app",
+				"_rev": "1-x",
+				"_attachments": {
+					"index.html": {"content_type": "text/html; charset=utf-8", "digest": "md5-OR67TI2toHk8PZoe87saWA==", "revpos": 1, "stub": true, "encoding": "gzip", "encoded_length": 40}
+				}
+			}`)
+		case "PUT":
+			rev := "2-x"
+			if r.URL.Path != "/app/_design/app" {
+				rev = "3-x"
+			}
+			w.Header().Set("ETag", `"`+rev+`"`)
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"ok": true, "rev": %q}`, rev)
+		}
+	}))
+	defer srv.Close()
+	m.Targets["default"] = Target{Server: srv.URL, DBs: m.Targets["default"].DBs}
+
+	deployed, err := m.Deploy("testdata/manifest", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "deployed", []Deployment{{DB: "app", Rev: "3-x", Attachments: AttachmentStats{Uploaded: 1}}}, deployed)
+	check(t, "requests", []string{"GET /app/_design/app", "PUT /app/_design/app", "PUT /app/_design/app/index.html"}, requests)
+}
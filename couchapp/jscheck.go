@@ -0,0 +1,197 @@
+package couchapp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkJS performs a lightweight syntax check of a JavaScript function as it
+// appears in design documents. It verifies that brackets, strings, template
+// literals, regular expressions and comments are properly balanced and
+// terminated. If isFunc is true, the source must also be a function
+// expression. This is not required for CommonJS modules.
+//
+// This is not a full JavaScript parser. It catches the most common editing
+// mistakes before the design document is deployed.
+func checkJS(file string, src string, isFunc bool) error {
+	s := &jsScanner{src: src, line: 1}
+	trimmed := stripComments(src)
+	if isFunc && !strings.HasPrefix(trimmed, "function") && !strings.HasPrefix(trimmed, "(function") {
+		return fmt.Errorf("%s:%d: JavaScript source is not a function expression", file, s.firstLine())
+	}
+	if err := s.scan(); err != nil {
+		return fmt.Errorf("%s:%v", file, err)
+	}
+	return nil
+}
+
+type jsScanner struct {
+	src   string
+	pos   int
+	line  int
+	stack []jsBracket
+	prev  byte   // last significant character
+	word  string // last identifier
+}
+
+type jsBracket struct {
+	char byte
+	line int
+}
+
+var closing = map[byte]byte{')': '(', ']': '[', '}': '{'}
+
+func (s *jsScanner) firstLine() int {
+	line := 1
+	for _, c := range s.src {
+		if c == '\n' {
+			line++
+		} else if c != ' ' && c != '\t' && c != '\r' {
+			break
+		}
+	}
+	return line
+}
+
+func (s *jsScanner) scan() error {
+	for s.pos < len(s.src) {
+		c := s.src[s.pos]
+		switch {
+		case c == '\n':
+			s.line++
+			s.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			s.pos++
+		case strings.HasPrefix(s.src[s.pos:], "//"):
+			for s.pos < len(s.src) && s.src[s.pos] != '\n' {
+				s.pos++
+			}
+		case strings.HasPrefix(s.src[s.pos:], "/*"):
+			start := s.line
+			end := strings.Index(s.src[s.pos+2:], "*/")
+			if end < 0 {
+				return fmt.Errorf("%d: unterminated comment", start)
+			}
+			s.advance(end + 4)
+		case c == '"' || c == '\'' || c == '`':
+			if err := s.quoted(c); err != nil {
+				return err
+			}
+			s.prev, s.word = c, ""
+		case c == '/' && s.regexpAllowed():
+			if err := s.quoted('/'); err != nil {
+				return err
+			}
+			s.prev, s.word = c, ""
+		case c == '(' || c == '[' || c == '{':
+			s.stack = append(s.stack, jsBracket{c, s.line})
+			s.prev, s.word = c, ""
+			s.pos++
+		case c == ')' || c == ']' || c == '}':
+			if len(s.stack) == 0 {
+				return fmt.Errorf("%d: unexpected %q", s.line, c)
+			}
+			top := s.stack[len(s.stack)-1]
+			if top.char != closing[c] {
+				return fmt.Errorf("%d: unexpected %q, %q from line %d is not closed", s.line, c, top.char, top.line)
+			}
+			s.stack = s.stack[:len(s.stack)-1]
+			s.prev, s.word = c, ""
+			s.pos++
+		case isIdentChar(c):
+			start := s.pos
+			for s.pos < len(s.src) && isIdentChar(s.src[s.pos]) {
+				s.pos++
+			}
+			s.prev, s.word = c, s.src[start:s.pos]
+		default:
+			s.prev, s.word = c, ""
+			s.pos++
+		}
+	}
+	if len(s.stack) > 0 {
+		top := s.stack[len(s.stack)-1]
+		return fmt.Errorf("%d: %q is not closed", top.line, top.char)
+	}
+	return nil
+}
+
+// quoted skips over a string, template or regular expression literal.
+func (s *jsScanner) quoted(q byte) error {
+	start := s.line
+	s.pos++
+	for s.pos < len(s.src) {
+		c := s.src[s.pos]
+		switch {
+		case c == '\\':
+			s.advance(2)
+			continue
+		case c == q:
+			s.pos++
+			if q == '/' {
+				// skip flags
+				for s.pos < len(s.src) && isIdentChar(s.src[s.pos]) {
+					s.pos++
+				}
+			}
+			return nil
+		case c == '\n':
+			if q != '`' {
+				return fmt.Errorf("%d: unterminated literal", start)
+			}
+			s.line++
+		}
+		s.pos++
+	}
+	return fmt.Errorf("%d: unterminated literal", start)
+}
+
+// regexpAllowed reports whether a '/' at the current position
+// starts a regular expression literal rather than a division.
+func (s *jsScanner) regexpAllowed() bool {
+	switch s.word {
+	case "":
+	case "return", "typeof", "instanceof", "in", "of", "new", "delete", "void", "throw", "case", "do", "else":
+		return true
+	default:
+		return false
+	}
+	return s.prev == 0 || strings.IndexByte("(,=:[!&|?{};+-*%<>~^", s.prev) >= 0
+}
+
+func (s *jsScanner) advance(n int) {
+	end := s.pos + n
+	if end > len(s.src) {
+		end = len(s.src)
+	}
+	s.line += strings.Count(s.src[s.pos:end], "\n")
+	s.pos = end
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 ||
+		'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// stripComments removes leading comments from src.
+func stripComments(src string) string {
+	for {
+		src = strings.TrimSpace(src)
+		switch {
+		case strings.HasPrefix(src, "//"):
+			if i := strings.IndexByte(src, '\n'); i >= 0 {
+				src = src[i:]
+			} else {
+				return ""
+			}
+		case strings.HasPrefix(src, "/*"):
+			if i := strings.Index(src, "*/"); i >= 0 {
+				src = src[i+2:]
+			} else {
+				return ""
+			}
+		default:
+			return src
+		}
+	}
+}
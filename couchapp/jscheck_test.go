@@ -0,0 +1,32 @@
+package couchapp
+
+import "testing"
+
+func TestCheckJS(t *testing.T) {
+	tests := []struct {
+		src    string
+		isFunc bool
+		err    string
+	}{
+		{src: `function (doc) { emit(doc._id, null); }`, isFunc: true},
+		{src: "// comment\nfunction (doc) {\n  if (/^a[}]/.test(doc.x)) emit(doc.x / 2, '}');\n}", isFunc: true},
+		{src: "function (doc) {\n  var s = `multi\nline ${doc.x}`;\n  return s; /* } */\n}", isFunc: true},
+		{src: `exports.f = function () {};`, isFunc: false},
+		{src: `exports.f = function () {};`, isFunc: true, err: "f.js:1: JavaScript source is not a function expression"},
+		{src: "function (doc) {\n  emit(doc._id;\n}", isFunc: true, err: `f.js:3: unexpected '}', '(' from line 2 is not closed`},
+		{src: "function (doc) {\n  if (doc.x) {\n    emit(doc._id);\n}", isFunc: true, err: `f.js:1: '{' is not closed`},
+		{src: "function (doc) {\n  emit('abc);\n}", isFunc: true, err: "f.js:2: unterminated literal"},
+		{src: "function (doc) {}\n}", isFunc: true, err: `f.js:2: unexpected '}'`},
+		{src: "function (doc) {} /*", isFunc: true, err: "f.js:1: unterminated comment"},
+	}
+	for _, test := range tests {
+		err := checkJS("f.js", test.src, test.isFunc)
+		errstr := ""
+		if err != nil {
+			errstr = err.Error()
+		}
+		if errstr != test.err {
+			t.Errorf("wrong error for %q:\n got  %q\n want %q", test.src, errstr, test.err)
+		}
+	}
+}
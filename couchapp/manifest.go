@@ -0,0 +1,204 @@
+package couchapp
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/fjl/go-couchdb"
+)
+
+// ManifestFile is the name of the deploy manifest in an app directory.
+const ManifestFile = ".couchapp.json"
+
+// Manifest describes how an app directory is deployed. It is read from
+// the ManifestFile in the app directory:
+//
+//     {
+//       "docid": "_design/app",
+//       "ignore": ["*~", ".*", "_*", "*.md"],
+//       "vendor": true,
+//       "attachments": "_attachments",
+//       "targets": {
+//         "default": {"server": "http://127.0.0.1:5984/", "dbs": ["app"]},
+//         "prod": {"server": "https://db.example.com/", "dbs": ["app", "app-eu"]}
+//       }
+//     }
+//
+// Only JSON manifests are supported.
+type Manifest struct {
+	// DocID is the ID of the design document.
+	DocID string `json:"docid"`
+
+	// Ignore contains glob patterns for ignored files.
+	// If nil, the default patterns are used.
+	Ignore []string `json:"ignore"`
+
+	// Template, Validate, MergeVendor and Minify set the
+	// LoadOptions fields of the same name.
+	Template    bool `json:"template"`
+	Validate    bool `json:"validate"`
+	MergeVendor bool `json:"vendor"`
+	Minify      bool `json:"minify"`
+
+	// Attachments is a directory, relative to the app directory, whose
+	// files are stored as attachments of the design document. It may be
+	// nested, e.g. "static/assets", and is not loaded into the document.
+	Attachments string `json:"attachments"`
+	// AttachmentIgnore contains glob patterns for files that are not
+	// stored as attachments. If nil, the default patterns are used.
+	AttachmentIgnore []string `json:"attachment_ignore"`
+
+	// Targets are named deployment targets.
+	Targets map[string]Target `json:"targets"`
+}
+
+// Target is a deployment target of a manifest.
+type Target struct {
+	// Server is the URL of the CouchDB server. It may contain credentials.
+	Server string `json:"server"`
+	// DBs are the databases the app is stored in.
+	DBs []string `json:"dbs"`
+}
+
+// LoadManifest reads the manifest of an app directory.
+func LoadManifest(dir string) (*Manifest, error) {
+	return loadManifest(osFS{}, dir)
+}
+
+func loadManifest(fsys fileSystem, dir string) (*Manifest, error) {
+	file := path.Join(dir, ManifestFile)
+	content, err := fsys.readFile(file)
+	if err != nil {
+		return nil, err
+	}
+	m := new(Manifest)
+	if err := json.Unmarshal(content, m); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %v", file, err)
+	}
+	if m.DocID == "" {
+		return nil, fmt.Errorf("invalid manifest %s: docid is not set", file)
+	}
+	for name, t := range m.Targets {
+		if t.Server == "" || len(t.DBs) == 0 {
+			return nil, fmt.Errorf("invalid manifest %s: target %q needs server and dbs", file, name)
+		}
+	}
+	return m, nil
+}
+
+// LoadOptions returns the options for loading the app directory.
+// The manifest itself is always ignored.
+func (m *Manifest) LoadOptions() LoadOptions {
+	ignores := m.Ignore
+	if ignores == nil {
+		ignores = DefaultIgnorePatterns
+	}
+	ignores = append(ignores[:len(ignores):len(ignores)], ManifestFile)
+	var exclude []string
+	if m.Attachments != "" {
+		exclude = append(exclude, path.Clean(m.Attachments))
+	}
+	return LoadOptions{
+		Ignores:     ignores,
+		Exclude:     exclude,
+		Template:    m.Template,
+		Validate:    m.Validate,
+		MergeVendor: m.MergeVendor,
+		Minify:      m.Minify,
+	}
+}
+
+// Deployment is the result of deploying to one database.
+type Deployment struct {
+	DB          string
+	Rev         string
+	Attachments AttachmentStats
+}
+
+// Deploy loads the app in dir and stores it in all databases of the named
+// target. Attachments are uploaded after the design document has been stored.
+// Files that are already stored as attachments are not uploaded again, and
+// attachments whose file has been removed are deleted. Deploy stops at the
+// first database that fails.
+func (m *Manifest) Deploy(dir, target string) ([]Deployment, error) {
+	return m.deploy(osFS{}, dir, target)
+}
+
+// DeployArchive is like Deploy, but loads the app from
+// a directory of an archive.
+func (m *Manifest) DeployArchive(a *Archive, dir, target string) ([]Deployment, error) {
+	return m.deploy(a, dir, target)
+}
+
+func (m *Manifest) deploy(fsys fileSystem, dir, target string) ([]Deployment, error) {
+	t, ok := m.Targets[target]
+	if !ok {
+		names := make([]string, 0, len(m.Targets))
+		for name := range m.Targets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown target %q (available: %v)", target, names)
+	}
+	doc, err := loadDirectory(fsys, dir, m.LoadOptions())
+	if err != nil {
+		return nil, err
+	}
+	client, err := couchdb.NewClient(t.Server, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var deployed []Deployment
+	for _, name := range t.DBs {
+		db := client.DB(name)
+		var d Deployment
+		var err error
+		if m.Attachments == "" {
+			d.Rev, err = Store(db, m.DocID, doc)
+		} else {
+			d, err = m.deployWithAttachments(fsys, db, doc, path.Join(dir, m.Attachments))
+		}
+		if err != nil {
+			return deployed, fmt.Errorf("%s: %v", name, err)
+		}
+		d.DB = name
+		deployed = append(deployed, d)
+	}
+	return deployed, nil
+}
+
+// deployWithAttachments stores the design document, keeping the stored
+// attachments that still exist in attdir. Only changed files are uploaded.
+func (m *Manifest) deployWithAttachments(fsys fileSystem, db *couchdb.DB, doc Doc, attdir string) (Deployment, error) {
+	var d Deployment
+	stubs, rev, err := storedAttachments(db, m.DocID)
+	if err != nil {
+		return d, err
+	}
+	files, err := attachmentFiles(fsys, attdir, m.AttachmentIgnore)
+	if err != nil {
+		return d, err
+	}
+	kept := make(map[string]interface{})
+	for name := range stubs {
+		if files[name] {
+			kept[name] = map[string]bool{"stub": true}
+		}
+	}
+	if len(kept) > 0 {
+		withStubs := make(Doc, len(doc)+1)
+		for k, v := range doc {
+			withStubs[k] = v
+		}
+		withStubs["_attachments"] = kept
+		doc = withStubs
+	}
+	if rev, err = db.Put(m.DocID, doc, rev); err != nil {
+		return d, err
+	}
+	d.Rev, d.Attachments, err = syncAttachments(fsys, db, m.DocID, rev, attdir, m.AttachmentIgnore, stubs)
+	return d, err
+}
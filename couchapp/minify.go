@@ -0,0 +1,93 @@
+package couchapp
+
+import (
+	"strings"
+)
+
+// minifyJS removes comments and redundant whitespace from JavaScript source.
+// Runs of whitespace that contain a line break are replaced by a single line
+// break unless it can't end a statement, so automatic semicolon insertion
+// keeps working. String, template and regular expression literals are not
+// modified. If src can't be scanned, it is returned unchanged.
+func minifyJS(src string) string {
+	s := &jsScanner{src: src, line: 1}
+	m := &minifier{}
+	for s.pos < len(s.src) {
+		c := s.src[s.pos]
+		switch {
+		case c == '\n':
+			m.space, m.newline = true, true
+			s.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			m.space = true
+			s.pos++
+		case strings.HasPrefix(s.src[s.pos:], "//"):
+			for s.pos < len(s.src) && s.src[s.pos] != '\n' {
+				s.pos++
+			}
+		case strings.HasPrefix(s.src[s.pos:], "/*"):
+			end := strings.Index(s.src[s.pos+2:], "*/")
+			if end < 0 {
+				return src
+			}
+			m.space = true
+			m.newline = m.newline || strings.Contains(s.src[s.pos:s.pos+end+4], "\n")
+			s.advance(end + 4)
+		case c == '"' || c == '\'' || c == '`' || (c == '/' && s.regexpAllowed()):
+			start := s.pos
+			if err := s.quoted(c); err != nil {
+				return src
+			}
+			m.emit(s.src[start:s.pos])
+			s.prev, s.word = c, ""
+		case isIdentChar(c):
+			start := s.pos
+			for s.pos < len(s.src) && isIdentChar(s.src[s.pos]) {
+				s.pos++
+			}
+			m.emit(s.src[start:s.pos])
+			s.prev, s.word = c, s.src[start:s.pos]
+		default:
+			m.emit(s.src[s.pos : s.pos+1])
+			s.prev, s.word = c, ""
+			s.pos++
+		}
+	}
+	return m.out.String()
+}
+
+type minifier struct {
+	out     strings.Builder
+	last    byte // last byte written
+	space   bool // whitespace is pending
+	newline bool // pending whitespace contains a line break
+}
+
+func (m *minifier) emit(tok string) {
+	first := tok[0]
+	if m.space && m.out.Len() > 0 {
+		switch {
+		case m.newline && strings.IndexByte("{([,;", m.last) < 0 && strings.IndexByte(")]},;", first) < 0:
+			m.out.WriteByte('\n')
+		case needSpace(m.last, first):
+			m.out.WriteByte(' ')
+		}
+	}
+	m.space, m.newline = false, false
+	m.out.WriteString(tok)
+	m.last = tok[len(tok)-1]
+}
+
+// needSpace reports whether two tokens ending and starting with
+// the given characters must be separated.
+func needSpace(last, first byte) bool {
+	switch {
+	case isIdentChar(last):
+		return isIdentChar(first) || first == '.' // 1 .toString()
+	case last == '+' || last == '-':
+		return first == last // a - -b
+	case last == '/':
+		return first == '/' || first == '*'
+	}
+	return false
+}
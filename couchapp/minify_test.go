@@ -0,0 +1,35 @@
+package couchapp
+
+import "testing"
+
+func TestMinifyJS(t *testing.T) {
+	tests := []struct{ src, want string }{
+		{
+			src:  "function (doc) {\n  // emit all docs\n  emit(doc._id, null);\n}",
+			want: "function(doc){emit(doc._id,null);}",
+		},
+		{
+			src:  "function (doc) {\n  if (/^a[}]/.test(doc.x)) emit(doc.x / 2, '}  //');\n}",
+			want: "function(doc){if(/^a[}]/.test(doc.x))emit(doc.x/2,'}  //');}",
+		},
+		{
+			// Line breaks that may end a statement are kept.
+			src:  "function (doc) {\n  var a = doc.a\n  var b = a - -1 /* two\nlines */\n  return `x  ${a}`\n}",
+			want: "function(doc){var a=doc.a\nvar b=a- -1\nreturn`x  ${a}`}",
+		},
+		{
+			src:  "function (doc) { return 1 .toString() + +doc.x; }",
+			want: "function(doc){return 1 .toString()+ +doc.x;}",
+		},
+		{
+			// Broken sources are not modified.
+			src:  "function (doc) { emit('abc); }",
+			want: "function (doc) { emit('abc); }",
+		},
+	}
+	for _, test := range tests {
+		if got := minifyJS(test.src); got != test.want {
+			t.Errorf("wrong result for %q:\n got  %q\n want %q", test.src, got, test.want)
+		}
+	}
+}
@@ -0,0 +1 @@
+exports.x = 1;
@@ -0,0 +1 @@
+function (doc, req) { return doc.title; }
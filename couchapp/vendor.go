@@ -0,0 +1,94 @@
+package couchapp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// vendorSections are the design document fields whose entries are moved
+// from vendored components into the top level of the document.
+var vendorSections = []string{"filters", "lists", "shows", "updates", "views"}
+
+// MergeVendor merges vendored components into a design document. Following
+// the classic couchapp convention, each subdirectory of "vendor" is a
+// component that is loaded as doc["vendor"][name]:
+//
+//     <root>/
+//       lists/
+//         index.js
+//       vendor/
+//         helpers/
+//           lib/
+//             render.js
+//           shows/
+//             item.js
+//
+// The functions a component defines in "filters", "lists", "shows",
+// "updates" and "views" are merged into the corresponding fields of the
+// design document, i.e. helpers/shows/item.js becomes shows.item. All other
+// content stays in the namespace of the component and can be loaded by the
+// app using require("vendor/helpers/lib/render").
+//
+// An error is returned if a merged function has the same name as one defined
+// by the app or by another component. Components are merged in order of
+// their names.
+func MergeVendor(doc Doc) error {
+	vendor, ok := doc["vendor"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	names := make([]string, 0, len(vendor))
+	for name := range vendor {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		component, ok := vendor[name].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("vendor/%s is not a directory", name)
+		}
+		for _, section := range vendorSections {
+			src, ok := component[section].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			dst, ok := doc[section].(map[string]interface{})
+			if !ok {
+				if doc[section] != nil {
+					return fmt.Errorf("vendor/%s: %s is not an object", name, section)
+				}
+				dst = make(map[string]interface{})
+				doc[section] = dst
+			}
+			if err := mergeObject(dst, src, []string{section}); err != nil {
+				return fmt.Errorf("vendor/%s: %v", name, err)
+			}
+			delete(component, section)
+		}
+	}
+	return nil
+}
+
+// mergeObject copies the entries of src into dst. Objects are merged
+// recursively. It fails if any other value exists in both.
+func mergeObject(dst, src map[string]interface{}, path []string) error {
+	for k, v := range src {
+		p := append(path[:len(path):len(path)], k)
+		existing, ok := dst[k]
+		if !ok {
+			dst[k] = v
+			continue
+		}
+		dstObj, ok1 := existing.(map[string]interface{})
+		srcObj, ok2 := v.(map[string]interface{})
+		if !ok1 || !ok2 {
+			return fmt.Errorf("%s is already defined", strings.Join(p, "."))
+		}
+		if err := mergeObject(dstObj, srcObj, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package couchdaemon
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConfigBool reads a boolean parameter from the CouchDB configuration.
+// If the parameter is unset, def is returned.
+func ConfigBool(section, item string, def bool) (bool, error) {
+	val, err := ConfigVal(section, item)
+	if err == ErrNotFound {
+		return def, nil
+	} else if err != nil {
+		return def, err
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(val))
+	if err != nil {
+		return def, fmt.Errorf("couchdaemon: invalid boolean value for %s/%s: %q", section, item, val)
+	}
+	return b, nil
+}
+
+// ConfigInt reads an integer parameter from the CouchDB configuration.
+// If the parameter is unset, def is returned.
+func ConfigInt(section, item string, def int) (int, error) {
+	val, err := ConfigVal(section, item)
+	if err == ErrNotFound {
+		return def, nil
+	} else if err != nil {
+		return def, err
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(val))
+	if err != nil {
+		return def, fmt.Errorf("couchdaemon: invalid integer value for %s/%s: %q", section, item, val)
+	}
+	return i, nil
+}
+
+// ConfigDuration reads a duration parameter from the CouchDB configuration.
+// If the parameter is unset, def is returned.
+//
+// CouchDB usually stores durations as plain numbers, e.g. "5000" for
+// os_process_timeout. Plain numbers are multiplied by unit. Values with
+// a unit suffix such as "1m30s" are parsed using time.ParseDuration.
+func ConfigDuration(section, item string, unit, def time.Duration) (time.Duration, error) {
+	val, err := ConfigVal(section, item)
+	if err == ErrNotFound {
+		return def, nil
+	} else if err != nil {
+		return def, err
+	}
+	val = strings.TrimSpace(val)
+	if n, err := strconv.ParseInt(val, 10, 64); err == nil {
+		return time.Duration(n) * unit, nil
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return def, fmt.Errorf("couchdaemon: invalid duration value for %s/%s: %q", section, item, val)
+	}
+	return d, nil
+}
+
+// ConfigWatcher reports changes of a configuration parameter.
+// Create watchers using WatchConfig.
+type ConfigWatcher struct {
+	// C receives the new value whenever the parameter changes.
+	// The empty string is sent when the parameter is removed.
+	// C is closed when the watcher is stopped or the CouchDB
+	// connection fails.
+	C <-chan string
+
+	quit     chan struct{}
+	stopOnce sync.Once
+}
+
+// WatchConfig polls a configuration parameter at the given interval.
+// The initial value is read before WatchConfig returns, only
+// subsequent changes are delivered on the watcher's channel.
+//
+// If the initial read fails with an error other than ErrNotFound,
+// the error is returned.
+func WatchConfig(section, item string, interval time.Duration) (*ConfigWatcher, error) {
+	current, err := ConfigVal(section, item)
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	c := make(chan string)
+	w := &ConfigWatcher{C: c, quit: make(chan struct{})}
+	go w.loop(c, section, item, current, interval)
+	return w, nil
+}
+
+// Stop terminates the watcher and closes its channel.
+func (w *ConfigWatcher) Stop() {
+	w.stopOnce.Do(func() { close(w.quit) })
+}
+
+func (w *ConfigWatcher) loop(c chan<- string, section, item, current string, interval time.Duration) {
+	defer close(c)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.quit:
+			return
+		case <-ticker.C:
+		}
+		val, err := ConfigVal(section, item)
+		if err != nil && err != ErrNotFound {
+			return
+		}
+		if val == current {
+			continue
+		}
+		current = val
+		select {
+		case c <- val:
+		case <-w.quit:
+			return
+		}
+	}
+}
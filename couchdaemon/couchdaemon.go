@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"strings"
 	"sync"
@@ -37,8 +38,19 @@ var (
 // You should call this function early in your initialization.
 // The other API functions will return ErrNotInitialized until Init
 // has been called.
+//
+// If the COUCHDB_URL environment variable is set, Init configures HTTP mode
+// instead (see InitHTTP) and stdin/stdout are not used. Credentials can be
+// given in the URL or through COUCHDB_USER and COUCHDB_PASSWORD. The node
+// name can be set using COUCHDB_NODE. Init panics if COUCHDB_URL is set
+// but invalid.
 func Init(exit chan<- struct{}) {
 	initOnce.Do(func() {
+		if ok, err := initHTTPFromEnv(); err != nil {
+			panic("couchdaemon: can't use COUCHDB_URL: " + err.Error())
+		} else if ok {
+			return
+		}
 		if exit == nil {
 			start(os.Stdin, os.Stdout, func() { os.Exit(0) })
 		} else {
@@ -52,7 +64,12 @@ func Init(exit chan<- struct{}) {
 // the returned map will be nil.
 func ConfigSection(section string) (map[string]string, error) {
 	var val *map[string]string
-	err := request(&val, "get", section)
+	var err error
+	if h := currentHTTPMode(); h != nil {
+		err = h.get(&val, section)
+	} else {
+		err = request(&val, "get", section)
+	}
 	switch {
 	case err != nil:
 		return nil, err
@@ -68,7 +85,12 @@ func ConfigSection(section string) (map[string]string, error) {
 // returned string will be empty.
 func ConfigVal(section, item string) (string, error) {
 	var val *string
-	err := request(&val, "get", section, item)
+	var err error
+	if h := currentHTTPMode(); h != nil {
+		err = h.get(&val, section, item)
+	} else {
+		err = request(&val, "get", section, item)
+	}
 	switch {
 	case err != nil:
 		return "", err
@@ -81,6 +103,9 @@ func ConfigVal(section, item string) (string, error) {
 
 // ServerURL returns the URL of the CouchDB server that started the daemon.
 func ServerURL() (string, error) {
+	if h := currentHTTPMode(); h != nil {
+		return h.serverURL(), nil
+	}
 	port, err := ConfigVal("httpd", "port")
 	if err != nil {
 		return "", err
@@ -123,6 +148,31 @@ func (logger) Write(msg []byte) (int, error) {
 	return len(msg), nil
 }
 
+// NewLogger creates a standard library logger that writes to the CouchDB log
+// at the given level, which must be "error", "info" or "debug". Any other
+// level value leaves the choice of level to CouchDB.
+func NewLogger(level, prefix string, flag int) *log.Logger {
+	var opts *json.RawMessage
+	switch level {
+	case "error":
+		opts = &optsError
+	case "info":
+		opts = &optsInfo
+	case "debug":
+		opts = &optsDebug
+	}
+	return log.New(levelWriter{opts}, prefix, flag)
+}
+
+type levelWriter struct{ opts *json.RawMessage }
+
+func (w levelWriter) Write(msg []byte) (int, error) {
+	if err := logwrite(string(msg), w.opts); err != nil {
+		return 0, err
+	}
+	return len(msg), nil
+}
+
 var (
 	optsError = json.RawMessage(`{"level":"error"}`)
 	optsInfo  = json.RawMessage(`{"level":"info"}`)
@@ -131,6 +181,9 @@ var (
 
 func logwrite(msg string, opts *json.RawMessage) error {
 	msg = strings.TrimRight(msg, "\n")
+	if h := currentHTTPMode(); h != nil {
+		return h.log(msg, opts)
+	}
 	if opts == nil {
 		return request(nil, "log", msg)
 	}
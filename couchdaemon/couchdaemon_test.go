@@ -5,7 +5,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -16,6 +20,7 @@ type testHost struct {
 	exitchan chan struct{}
 	config   testConfig
 	outW     io.Closer
+	mu       sync.Mutex // protects config
 	wg       sync.WaitGroup
 	stopOnce sync.Once
 }
@@ -50,6 +55,7 @@ func startTestHost(t *testing.T, config testConfig) *testHost {
 			}
 
 			t.Logf("testHost: got request %v", req)
+			th.mu.Lock()
 			switch {
 			case len(req) <= 1:
 				t.Errorf("request array to short")
@@ -68,6 +74,7 @@ func startTestHost(t *testing.T, config testConfig) *testHost {
 			default:
 				t.Errorf("testHost: unmatched request")
 			}
+			th.mu.Unlock()
 		}
 	}()
 
@@ -75,6 +82,16 @@ func startTestHost(t *testing.T, config testConfig) *testHost {
 	return th
 }
 
+// set changes a config value while the host is running.
+func (th *testHost) set(section, item, value string) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	if th.config[section] == nil {
+		th.config[section] = make(map[string]string)
+	}
+	th.config[section][item] = value
+}
+
 // stop stops listening and returns the accumulated output.
 func (th *testHost) stop() string {
 	th.stopOnce.Do(func() {
@@ -289,3 +306,159 @@ func TestExit(t *testing.T) {
 		t.Error("exit func has not been called")
 	}
 }
+
+func TestNewLogger(t *testing.T) {
+	th := startTestHost(t, nil)
+	defer th.stop()
+
+	NewLogger("error", "daemon: ", 0).Printf("failed: %d", 42)
+	NewLogger("", "", 0).Print("plain")
+	output := th.stop()
+	exp := `["log","daemon: failed: 42",{"level":"error"}]` + "\n" + `["log","plain"]` + "\n"
+	if output != exp {
+		t.Errorf("wrong JSON output: %s", output)
+	}
+}
+
+func TestConfigTyped(t *testing.T) {
+	th := startTestHost(t, testConfig{
+		"s": {
+			"bool":     "true",
+			"int":      " 42",
+			"ms":       "5000",
+			"duration": "1m30s",
+			"garbage":  "x",
+		},
+	})
+	defer th.stop()
+
+	if v, err := ConfigBool("s", "bool", false); err != nil || v != true {
+		t.Errorf(`ConfigBool("s", "bool") = %v, %v`, v, err)
+	}
+	if v, err := ConfigBool("s", "missing", true); err != nil || v != true {
+		t.Errorf(`ConfigBool("s", "missing") = %v, %v`, v, err)
+	}
+	if _, err := ConfigBool("s", "garbage", false); err == nil {
+		t.Errorf(`ConfigBool("s", "garbage") should've returned an error`)
+	}
+	if v, err := ConfigInt("s", "int", 0); err != nil || v != 42 {
+		t.Errorf(`ConfigInt("s", "int") = %v, %v`, v, err)
+	}
+	if v, err := ConfigInt("s", "missing", 7); err != nil || v != 7 {
+		t.Errorf(`ConfigInt("s", "missing") = %v, %v`, v, err)
+	}
+	if _, err := ConfigInt("s", "garbage", 0); err == nil {
+		t.Errorf(`ConfigInt("s", "garbage") should've returned an error`)
+	}
+	if v, err := ConfigDuration("s", "ms", time.Millisecond, 0); err != nil || v != 5*time.Second {
+		t.Errorf(`ConfigDuration("s", "ms") = %v, %v`, v, err)
+	}
+	if v, err := ConfigDuration("s", "duration", time.Second, 0); err != nil || v != 90*time.Second {
+		t.Errorf(`ConfigDuration("s", "duration") = %v, %v`, v, err)
+	}
+	if v, err := ConfigDuration("s", "missing", time.Second, time.Hour); err != nil || v != time.Hour {
+		t.Errorf(`ConfigDuration("s", "missing") = %v, %v`, v, err)
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	th := startTestHost(t, testConfig{"s": {"k": "1"}})
+	defer th.stop()
+
+	w, err := WatchConfig("s", "k", 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	th.set("s", "k", "2")
+	select {
+	case v := <-w.C:
+		if v != "2" {
+			t.Errorf("got value %q, want %q", v, "2")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for change")
+	}
+
+	w.Stop()
+	for range w.C {
+	}
+}
+
+func TestWatchConfigHostExit(t *testing.T) {
+	th := startTestHost(t, testConfig{"s": {"k": "1"}})
+	w, err := WatchConfig("s", "k", 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	th.stop()
+
+	select {
+	case _, ok := <-w.C:
+		if ok {
+			t.Error("unexpected value on watcher channel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watcher channel not closed after host exit")
+	}
+}
+
+func TestHTTPMode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "admin" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error":"unauthorized","reason":"Name or password is incorrect."}`)
+			return
+		}
+		switch r.URL.EscapedPath() {
+		case "/_node/_local/_config/httpd/port":
+			io.WriteString(w, `"5984"`)
+		case "/_node/_local/_config/couch%20db":
+			io.WriteString(w, `{"a":"1","b":"2"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"error":"not_found","reason":"unknown_config_value"}`)
+		}
+	}))
+	defer srv.Close()
+	defer func() { httpMode = nil }()
+
+	u := strings.Replace(srv.URL, "http://", "http://admin:secret@", 1)
+	if err := InitHTTP(u, ""); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := ConfigVal("httpd", "port"); err != nil || val != "5984" {
+		t.Errorf(`ConfigVal("httpd", "port") = %q, %v`, val, err)
+	}
+	if _, err := ConfigVal("httpd", "missing"); err != ErrNotFound {
+		t.Errorf(`ConfigVal("httpd", "missing") got err: %v, want: ErrNotFound`, err)
+	}
+	expSection := map[string]string{"a": "1", "b": "2"}
+	if val, err := ConfigSection("couch db"); err != nil || !reflect.DeepEqual(val, expSection) {
+		t.Errorf(`ConfigSection("couch db") = %v, %v`, val, err)
+	}
+	if val, err := ServerURL(); err != nil || val != srv.URL+"/" {
+		t.Errorf("ServerURL() = %q, %v", val, err)
+	}
+
+	if err := InitHTTP(srv.URL, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ConfigVal("httpd", "port"); err == nil || err == ErrNotFound {
+		t.Errorf("expected authorization error, got %v", err)
+	}
+}
+
+func TestHTTPModeInvalidURL(t *testing.T) {
+	defer func() { httpMode = nil }()
+	defer os.Unsetenv("COUCHDB_URL")
+
+	for _, u := range []string{"localhost:5984", "http://[::1", "/no/host"} {
+		os.Setenv("COUCHDB_URL", u)
+		if ok, err := initHTTPFromEnv(); ok || err == nil {
+			t.Errorf("COUCHDB_URL=%q: got ok=%v, err=%v, want error", u, ok, err)
+		}
+		if httpMode != nil {
+			t.Errorf("COUCHDB_URL=%q: HTTP mode enabled", u)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package couchdaemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// httpTimeout limits the duration of configuration requests in HTTP mode.
+const httpTimeout = 30 * time.Second
+
+// httpConfig is the configuration backend for CouchDB 2.x and later,
+// which do not support os_daemons.
+type httpConfig struct {
+	server *url.URL // without credentials
+	node   string
+	user   *url.Userinfo
+	client *http.Client
+}
+
+// httpMode is non-nil when the package is initialized with InitHTTP.
+// It is protected by mutex.
+var httpMode *httpConfig
+
+// InitHTTP configures the package to access the server configuration through
+// the /_node/{node}/_config HTTP API instead of the os_daemon protocol. This
+// allows daemon code to run unchanged as a regular process next to CouchDB
+// 2.x and later, which no longer support os_daemons.
+//
+// If serverURL contains credentials, they are used for HTTP Basic Authentication.
+// Accessing the configuration requires server admin rights. The node argument
+// can be empty to use the node that handles the request ("_local").
+//
+// In HTTP mode, log messages are written to stderr.
+func InitHTTP(serverURL, node string) error {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("couchdaemon: invalid server URL %q", u.Redacted())
+	}
+	if node == "" {
+		node = "_local"
+	}
+	conf := &httpConfig{node: node, user: u.User, client: &http.Client{Timeout: httpTimeout}}
+	u.User, u.RawQuery, u.Fragment = nil, "", ""
+	u.Path = strings.TrimRight(u.Path, "/")
+	conf.server = u
+
+	mutex.Lock()
+	httpMode = conf
+	mutex.Unlock()
+	return nil
+}
+
+// initHTTPFromEnv enables HTTP mode if the COUCHDB_URL environment variable
+// is set. Credentials may also be supplied through COUCHDB_USER and
+// COUCHDB_PASSWORD, the node name through COUCHDB_NODE. It returns an error
+// if COUCHDB_URL is set but invalid.
+func initHTTPFromEnv() (bool, error) {
+	rawurl := os.Getenv("COUCHDB_URL")
+	if rawurl == "" {
+		return false, nil
+	}
+	if user := os.Getenv("COUCHDB_USER"); user != "" {
+		u, err := url.Parse(rawurl)
+		if err != nil {
+			return false, err
+		}
+		u.User = url.UserPassword(user, os.Getenv("COUCHDB_PASSWORD"))
+		rawurl = u.String()
+	}
+	if err := InitHTTP(rawurl, os.Getenv("COUCHDB_NODE")); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func currentHTTPMode() *httpConfig {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return httpMode
+}
+
+// get fetches a config section or item. The result is nil if
+// the server reports that the key does not exist.
+func (c *httpConfig) get(result interface{}, keys ...string) error {
+	path := c.server.Path + "/_node/" + url.PathEscape(c.node) + "/_config"
+	for _, k := range keys {
+		path += "/" + url.PathEscape(k)
+	}
+	u := *c.server
+	u.Path, u.RawPath = "", ""
+	req, err := http.NewRequest("GET", u.String()+path, nil)
+	if err != nil {
+		return err
+	}
+	if c.user != nil {
+		passwd, _ := c.user.Password()
+		req.SetBasicAuth(c.user.Username(), passwd)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil
+	case resp.StatusCode >= 400:
+		var reply struct{ Error, Reason string }
+		json.NewDecoder(resp.Body).Decode(&reply)
+		return fmt.Errorf("couchdaemon: GET %s: (%d) %s: %s",
+			path, resp.StatusCode, reply.Error, reply.Reason)
+	default:
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+}
+
+// serverURL returns the server URL without credentials.
+func (c *httpConfig) serverURL() string {
+	return c.server.String() + "/"
+}
+
+func (c *httpConfig) log(msg string, opts *json.RawMessage) error {
+	level := "info"
+	switch opts {
+	case &optsError:
+		level = "error"
+	case &optsDebug:
+		level = "debug"
+	}
+	_, err := fmt.Fprintf(os.Stderr, "[%s] %s\n", level, msg)
+	return err
+}
@@ -0,0 +1,91 @@
+//go:build go1.21
+// +build go1.21
+
+package couchdaemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+)
+
+// NewSlogHandler creates a structured logging handler that writes to the
+// CouchDB log. Records are formatted like slog.TextHandler output, but without
+// the time and level attributes because CouchDB adds those itself.
+//
+// Levels are mapped to the CouchDB log levels as follows: records below
+// slog.LevelInfo are logged as "debug", records below slog.LevelError
+// (including warnings) as "info", and everything else as "error".
+//
+// opts may be nil to use the default options.
+func NewSlogHandler(opts *slog.HandlerOptions) slog.Handler {
+	h := &slogHandler{state: new(slogState)}
+	var textopts slog.HandlerOptions
+	if opts != nil {
+		textopts = *opts
+	}
+	replace := textopts.ReplaceAttr
+	textopts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+		if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+			return slog.Attr{}
+		}
+		if replace != nil {
+			return replace(groups, a)
+		}
+		return a
+	}
+	h.text = slog.NewTextHandler(slogWriter{h.state}, &textopts)
+	return h
+}
+
+type slogHandler struct {
+	text  slog.Handler
+	state *slogState
+}
+
+// slogState is shared by all handlers derived from the same NewSlogHandler call.
+// It carries the level of the record that is being written to slogWriter.
+type slogState struct {
+	mu    sync.Mutex
+	level *json.RawMessage
+}
+
+func (h *slogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.text.Enabled(ctx, level)
+}
+
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.state.mu.Lock()
+	defer h.state.mu.Unlock()
+
+	switch {
+	case r.Level < slog.LevelInfo:
+		h.state.level = &optsDebug
+	case r.Level < slog.LevelError:
+		h.state.level = &optsInfo
+	default:
+		h.state.level = &optsError
+	}
+	return h.text.Handle(ctx, r)
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &slogHandler{text: h.text.WithAttrs(attrs), state: h.state}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	return &slogHandler{text: h.text.WithGroup(name), state: h.state}
+}
+
+// slogWriter receives formatted records from the text handler.
+// It is only called while the state lock is held.
+type slogWriter struct{ state *slogState }
+
+func (w slogWriter) Write(msg []byte) (int, error) {
+	if err := logwrite(string(bytes.TrimSpace(msg)), w.state.level); err != nil {
+		return 0, err
+	}
+	return len(msg), nil
+}
@@ -0,0 +1,40 @@
+//go:build go1.21
+// +build go1.21
+
+package couchdaemon
+
+import (
+	"log/slog"
+	"testing"
+)
+
+func TestSlogHandler(t *testing.T) {
+	th := startTestHost(t, nil)
+	defer th.stop()
+
+	log := slog.New(NewSlogHandler(&slog.HandlerOptions{Level: slog.LevelDebug}))
+	log.Debug("starting", "port", 8080)
+	log.Warn("slow request", "ms", 1200)
+	log.With("db", "users").WithGroup("req").Error("failed", "status", 500)
+
+	output := th.stop()
+	exp := `["log","msg=starting port=8080",{"level":"debug"}]` + "\n" +
+		`["log","msg=\"slow request\" ms=1200",{"level":"info"}]` + "\n" +
+		`["log","msg=failed db=users req.status=500",{"level":"error"}]` + "\n"
+	if output != exp {
+		t.Errorf("wrong JSON output:\ngot  %s\nwant %s", output, exp)
+	}
+}
+
+func TestSlogHandlerLevel(t *testing.T) {
+	th := startTestHost(t, nil)
+	defer th.stop()
+
+	log := slog.New(NewSlogHandler(nil))
+	log.Debug("hidden")
+	log.Info("shown")
+
+	if output := th.stop(); output != `["log","msg=shown",{"level":"info"}]`+"\n" {
+		t.Errorf("wrong JSON output: %s", output)
+	}
+}
@@ -6,16 +6,22 @@ package couchdb
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 )
 
 // Client represents a remote CouchDB server.
-type Client struct{ *transport }
+type Client struct {
+	*transport
+	ctx context.Context // nil unless set by WithContext
+}
 
 // NewClient creates a new client object.
 //
@@ -23,8 +29,9 @@ type Client struct{ *transport }
 // using HTTP Basic Authentication. If rawurl has a query string,
 // it is ignored.
 //
-// The second argument can be nil to use http.Transport,
-// which should be good enough in most cases.
+// The second argument can be nil to use an http.Transport with
+// the settings of http.DefaultTransport, which should be good
+// enough in most cases.
 func NewClient(rawurl string, rt http.RoundTripper) (*Client, error) {
 	url, err := url.Parse(rawurl)
 	if err != nil {
@@ -37,7 +44,7 @@ func NewClient(rawurl string, rt http.RoundTripper) (*Client, error) {
 		auth = BasicAuth(url.User.Username(), passwd)
 		url.User = nil
 	}
-	return &Client{newTransport(url.String(), rt, auth)}, nil
+	return &Client{transport: newTransport(url.String(), rt, auth)}, nil
 }
 
 // URL returns the URL prefix of the server.
@@ -61,17 +68,161 @@ func (c *Client) SetAuth(a Auth) {
 	c.transport.setAuth(a)
 }
 
+// SetUseNumber controls how JSON numbers are decoded into interface{} values
+// of documents, view results and feed events. By default, numbers are decoded
+// as float64, which loses precision for integers larger than 2^53. After
+// SetUseNumber(true), they are decoded as json.Number instead.
+//
+// The setting applies to all databases and feeds created by the client.
+func (c *Client) SetUseNumber(enable bool) {
+	c.transport.setUseNumber(enable)
+}
+
+// SetUseIfMatch controls how Put and Delete send the document revision.
+// By default, the revision is sent in the "rev" query parameter. After
+// SetUseIfMatch(true), it is sent in the If-Match header instead.
+func (c *Client) SetUseIfMatch(enable bool) {
+	c.transport.setUseIfMatch(enable)
+}
+
+// SetHeader sets a header that is sent with all requests of the client,
+// e.g. an API gateway key. If value is empty, the header is removed.
+// Use DB.WithHeader to override headers for a single database.
+func (c *Client) SetHeader(key, value string) {
+	c.transport.setHeader(key, value)
+}
+
+// CloseIdleConnections closes connections to the server that are not
+// in use. Open feeds and row iterators keep their connection until
+// they are closed.
+func (c *Client) CloseIdleConnections() {
+	c.http.CloseIdleConnections()
+}
+
+// ErrClientClosed is returned for requests of a closed client
+// and its database objects.
+var ErrClientClosed = errors.New("couchdb: client is closed")
+
+// Close shuts down the client. Requests in flight are canceled, which also
+// terminates open feeds, row iterators and followers, and idle connections
+// are closed. All further requests of the client and the database objects
+// created by it fail with ErrClientClosed. Clients created by WithContext
+// share their state with the original client, so closing any of them closes
+// all of them. Close always returns nil.
+func (c *Client) Close() error {
+	c.transport.close()
+	if r, ok := c.http.Transport.(*clusterRouter); ok {
+		r.close()
+	}
+	c.http.CloseIdleConnections()
+	return nil
+}
+
+// SetIdleConnTimeout sets the time after which idle connections are closed.
+// Long-running processes can use this to avoid keeping connections to cluster
+// nodes that have been removed. It works only if the client's RoundTripper is
+// an *http.Transport, which is modified. It returns false otherwise. The
+// RoundTripper wrapped by RouteCluster is considered as well.
+// SetIdleConnTimeout should be called before the client is used.
+func (c *Client) SetIdleConnTimeout(d time.Duration) bool {
+	rt := c.http.Transport
+	if r, ok := rt.(*clusterRouter); ok {
+		rt = r.next
+	}
+	t, ok := rt.(*http.Transport)
+	if ok {
+		t.IdleConnTimeout = d
+	}
+	return ok
+}
+
+// SetMaxConcurrentRequests limits the number of requests that the client
+// has in flight at any time. A request occupies its slot until the response
+// body has been read, i.e. open feeds and row iterators count against the
+// limit until they are closed. Requests that exceed the limit wait for a free
+// slot or until their context is canceled. Use zero to remove the limit.
+func (c *Client) SetMaxConcurrentRequests(n int) {
+	c.transport.setMaxConcurrentRequests(n)
+}
+
+// SetMaxURLLength sets the URL length above which View, AllDocs and Changes
+// requests are sent as POST with the options in the request body. Long
+// URLs, e.g. caused by large "keys" lists, are often rejected by proxies.
+// The default is 8000 bytes. Use zero to always use GET.
+//
+// Sending all view options in the body requires CouchDB 2.2 or later.
+func (c *Client) SetMaxURLLength(n int) {
+	c.transport.setMaxURLLength(n)
+}
+
+// SetDefaultOptions sets options that are added to all requests that
+// accept Options, e.g. {"stable": true, "update": "lazy"}. Options
+// given for a particular call take precedence over the defaults.
+//
+// Calling SetDefaultOptions replaces any previously set defaults.
+// Use DB.WithOptions to set defaults for a single database.
+func (c *Client) SetDefaultOptions(opts Options) {
+	c.transport.setDefaultOptions(opts)
+}
+
 // CreateDB creates a new database.
 // The request will fail with status "412 Precondition Failed" if the database
 // already exists. A valid DB object is returned in all cases, even if the
 // request fails.
 func (c *Client) CreateDB(name string) (*DB, error) {
+	name, err := c.checkDBName(name)
+	if err != nil {
+		return c.DB(name), err
+	}
 	if _, err := c.closedRequest("PUT", dbpath(name), nil); err != nil {
 		return c.DB(name), err
 	}
 	return c.DB(name), nil
 }
 
+// DBCreateOptions contains the cluster parameters of a new database.
+// Fields with zero value are not sent to the server and the server
+// defaults apply.
+type DBCreateOptions struct {
+	Q           int    // number of shards
+	N           int    // number of replicas of each shard
+	Placement   string // zone placement, e.g. "metro-dc-a:2,metro-dc-b:1"
+	Partitioned bool   // create a partitioned database
+}
+
+// CreateDBWithOptions creates a new database with the given cluster
+// parameters. As with CreateDB, a valid DB object is returned in all cases,
+// even if the request fails.
+//
+// http://docs.couchdb.org/en/latest/api/database/common.html#put--db
+func (c *Client) CreateDBWithOptions(name string, o DBCreateOptions) (*DB, error) {
+	name, err := c.checkDBName(name)
+	if err != nil {
+		return c.DB(name), err
+	}
+	opts := make(Options)
+	if o.Q > 0 {
+		opts["q"] = o.Q
+	}
+	if o.N > 0 {
+		opts["n"] = o.N
+	}
+	if o.Placement != "" {
+		opts["placement"] = o.Placement
+	}
+	if o.Partitioned {
+		opts["partitioned"] = true
+	}
+	path, err := new(pathBuilder).add(name).options(opts, nil)
+	if err != nil {
+		return c.DB(name), err
+	}
+	if _, err := c.closedRequest("PUT", path, nil); err != nil {
+		return c.DB(name), err
+	}
+	return c.DB(name), nil
+}
+
 // EnsureDB ensures that a database with the given name exists.
 func (c *Client) EnsureDB(name string) (*DB, error) {
 	db, err := c.CreateDB(name)
@@ -83,7 +234,11 @@ func (c *Client) EnsureDB(name string) (*DB, error) {
 
 // DeleteDB deletes an existing database.
 func (c *Client) DeleteDB(name string) error {
-	_, err := c.closedRequest("DELETE", dbpath(name), nil)
+	name, err := c.checkDBName(name)
+	if err != nil {
+		return err
+	}
+	_, err = c.closedRequest("DELETE", dbpath(name), nil)
 	return err
 }
 
@@ -100,14 +255,200 @@ func (c *Client) AllDBs() (names []string, err error) {
 // DB represents a remote CouchDB database.
 type DB struct {
 	*transport
-	name string
+	name     string
+	defaults Options
+	header   http.Header
+	idgen    IDGenerator
+	checkIDs bool
+	nameErr  error // set if the name is invalid
+	quorum   Quorum
+	hooks    *writeHooks
+	ctx      context.Context // nil unless set by WithContext
 }
 
 // DB creates a database object.
 // The database inherits the authentication and http.RoundTripper
 // of the client. The database's actual existence is not verified.
+// The name is checked according to the client's DBNameMode.
+// If the client has a context, the database inherits it.
 func (c *Client) DB(name string) *DB {
-	return &DB{c.transport, name}
+	name, err := c.checkDBName(name)
+	c.mu.RLock()
+	hooks := c.hooks
+	c.mu.RUnlock()
+	return &DB{transport: c.transport, name: name, nameErr: err, hooks: hooks, ctx: c.ctx}
+}
+
+// WithOptions returns a copy of the database object that adds the
+// given options to all requests that accept Options. They take
+// precedence over the client defaults set by SetDefaultOptions,
+// but options given for a particular call take precedence over them.
+func (db *DB) WithOptions(opts Options) *DB {
+	cpy := *db
+	cpy.defaults = db.defaults.merge(opts).clone()
+	return &cpy
+}
+
+// WithHeader returns a copy of the database object that sends the
+// given header with all requests, overriding the client headers set
+// by SetHeader. If value is empty, the header is not sent.
+func (db *DB) WithHeader(key, value string) *DB {
+	cpy := *db
+	cpy.header = make(http.Header, len(db.header)+1)
+	for k, v := range db.header {
+		cpy.header[k] = v
+	}
+	cpy.header[http.CanonicalHeaderKey(key)] = []string{value}
+	return &cpy
+}
+
+// newRequest creates a request using the transport and
+// adds the database headers and context.
+func (db *DB) newRequest(method, path string, body io.Reader) (*http.Request, error) {
+	if db.nameErr != nil {
+		return nil, db.nameErr
+	}
+	req, err := db.transport.newRequest(method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	if db.ctx != nil {
+		req = req.WithContext(db.ctx)
+	}
+	for k, v := range db.header {
+		if v[0] == "" {
+			req.Header.Del(k)
+		} else {
+			req.Header[k] = append([]string(nil), v...)
+		}
+	}
+	return req, nil
+}
+
+// request is like transport.request, but adds the database headers.
+func (db *DB) request(method, path string, body io.Reader) (*http.Response, error) {
+	req, err := db.newRequest(method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	return db.do(req)
+}
+
+// closedRequest is like transport.closedRequest, but adds the database headers.
+func (db *DB) closedRequest(method, path string, body io.Reader) (*http.Response, error) {
+	resp, err := db.request(method, path, body)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return resp, err
+}
+
+// revRequest sends a request that modifies a document revision.
+// The response body must be closed by the caller, usually by writeRev.
+func (db *DB) revRequest(method string, p *pathBuilder, rev string, body io.Reader) (*http.Response, error) {
+	req, err := db.newRevRequest(method, p, rev, body)
+	if err != nil {
+		return nil, err
+	}
+	return db.do(req)
+}
+
+// newRevRequest creates a request that modifies a document revision.
+// Depending on the client setting, the revision is sent in the
+// query string or in the If-Match header.
+func (db *DB) newRevRequest(method string, p *pathBuilder, rev string, body io.Reader) (*http.Request, error) {
+	db.mu.RLock()
+	ifMatch := db.useIfMatch
+	db.mu.RUnlock()
+
+	var req *http.Request
+	var err error
+	switch {
+	case db.quorum.W > 0:
+		query := Options{"w": db.quorum.W}
+		if rev != "" && !ifMatch {
+			query["rev"] = rev
+		}
+		var path string
+		if path, err = p.options(query, nil); err == nil {
+			req, err = db.newRequest(method, path, body)
+		}
+		if err == nil && rev != "" && ifMatch {
+			req.Header.Set("If-Match", rev)
+		}
+	case ifMatch:
+		req, err = db.newRequest(method, p.path(), body)
+		if err == nil && rev != "" {
+			req.Header.Set("If-Match", rev)
+		}
+	default:
+		req, err = db.newRequest(method, p.rev(rev), body)
+	}
+	return req, err
+}
+
+// queryRequest sends a GET request with the given options. If the URL is
+// longer than the configured maximum, it sends a POST request instead and
+// moves the options named in bodyKeys into a JSON request body. All
+// options are moved if bodyKeys is nil. If any of the options in bodyKeys
+// is set, the request is always sent as POST.
+func (db *DB) queryRequest(p *pathBuilder, opts Options, jskeys, bodyKeys []string) (*http.Response, error) {
+	path, err := p.options(opts, jskeys)
+	if err != nil {
+		return nil, err
+	}
+	db.mu.RLock()
+	max := db.maxURLLen
+	db.mu.RUnlock()
+	if !hasAnyOption(opts, bodyKeys) && (max <= 0 || len(db.prefix)+len(path) <= max) {
+		return db.request("GET", path, nil)
+	}
+
+	body, query := make(map[string]interface{}), make(Options)
+	for k, v := range opts {
+		if bodyKeys == nil || containsString(bodyKeys, k) {
+			body[k] = v
+		} else {
+			query[k] = v
+		}
+	}
+	path = path[:strings.IndexByte(path, '?')]
+	if len(query) > 0 {
+		q, err := new(pathBuilder).options(query, jskeys)
+		if err != nil {
+			return nil, err
+		}
+		path += q
+	}
+	enc, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return db.request("POST", path, bytes.NewReader(enc))
+}
+
+func hasAnyOption(opts Options, keys []string) bool {
+	for _, k := range keys {
+		if _, ok := opts[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// options merges the default options of the client and the
+// database into opts.
+func (db *DB) options(opts Options) Options {
+	return db.withDefaults(db.defaults.merge(opts))
 }
 
 func (db *DB) path() *pathBuilder {
@@ -129,7 +470,7 @@ var getJsonKeys = []string{"open_revs", "atts_since"}
 //
 // http://docs.couchdb.org/en/latest/api/document/common.html?highlight=doc#get--db-docid
 func (db *DB) Get(id string, doc interface{}, opts Options) error {
-	path, err := db.path().docID(id).options(opts, getJsonKeys)
+	path, err := db.path().docID(id).options(db.readOptions(opts), getJsonKeys)
 	if err != nil {
 		return err
 	}
@@ -137,7 +478,46 @@ func (db *DB) Get(id string, doc interface{}, opts Options) error {
 	if err != nil {
 		return err
 	}
-	return readBody(resp, &doc)
+	return db.readBody(resp, doc)
+}
+
+// DocMeta contains document metadata returned by GetMeta.
+type DocMeta struct {
+	Rev     string // revision of the returned document
+	Deleted bool   // the returned revision is a deletion
+	ETag    string // ETag header of the response, including quotes
+}
+
+// GetMeta retrieves a document like Get and also returns its metadata.
+// This is useful for decoding into types that don't have a _rev field.
+func (db *DB) GetMeta(id string, doc interface{}, opts Options) (*DocMeta, error) {
+	path, err := db.path().docID(id).options(db.readOptions(opts), getJsonKeys)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := db.request("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	var raw json.RawMessage
+	if err := readBody(resp, &raw); err != nil {
+		return nil, err
+	}
+	var fields struct {
+		Rev     string `json:"_rev"`
+		Deleted bool   `json:"_deleted"`
+	}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	if err := db.newDecoder(bytes.NewReader(raw)).Decode(doc); err != nil {
+		return nil, err
+	}
+	meta := &DocMeta{Rev: fields.Rev, Deleted: fields.Deleted, ETag: resp.Header.Get("Etag")}
+	if meta.Rev == "" && len(meta.ETag) > 2 {
+		meta.Rev = meta.ETag[1 : len(meta.ETag)-1]
+	}
+	return meta, nil
 }
 
 // Rev fetches the current revision of a document.
@@ -148,28 +528,158 @@ func (db *DB) Rev(id string) (string, error) {
 	return responseRev(db.closedRequest("HEAD", path, nil))
 }
 
+// DocHead contains document metadata returned by Head.
+type DocHead struct {
+	Rev     string // current revision
+	Size    int64  // size of the JSON body in bytes, -1 if unknown
+	Deleted bool   // the document has been deleted
+}
+
+// Head fetches the revision and size of a document without
+// downloading its body.
+//
+// If the document has been deleted, Head returns a DocHead with
+// Deleted set and a nil error. If the document never existed, the
+// error is a 404 error.
+func (db *DB) Head(id string) (*DocHead, error) {
+	path := db.path().docID(id).path()
+	resp, err := db.closedRequest("HEAD", path, nil)
+	if NotFound(err) {
+		// HEAD responses have no body. Issue a GET to learn whether
+		// the document was deleted. The response is a small error object.
+		resp, err = db.closedRequest("GET", path, nil)
+		if err == nil {
+			// Recreated in the meantime. The GET response carries
+			// the same metadata as a HEAD response.
+			rev, err := responseRev(resp, nil)
+			if err != nil {
+				return nil, err
+			}
+			return &DocHead{Rev: rev, Size: resp.ContentLength}, nil
+		}
+		if dberr, ok := err.(*Error); ok && dberr.StatusCode == http.StatusNotFound && dberr.Reason == "deleted" {
+			return &DocHead{Size: -1, Deleted: true}, nil
+		}
+		return nil, err
+	}
+	rev, err := responseRev(resp, err)
+	if err != nil {
+		return nil, err
+	}
+	return &DocHead{Rev: rev, Size: resp.ContentLength}, nil
+}
+
 // Put stores a document into the given database.
+//
+// The rev argument is the current revision of the document. It
+// can be left empty for new documents. If it is empty and the
+// encoded document has a _rev field, the revision is taken from
+// that field.
 func (db *DB) Put(id string, doc interface{}, rev string) (newrev string, err error) {
-	path := db.path().docID(id).rev(rev)
+	if db.checkIDs {
+		if err := ValidateDocID(id); err != nil {
+			return "", err
+		}
+	}
 	// TODO: make it possible to stream encoder output somehow
-	json, err := json.Marshal(doc)
+	body, err := json.Marshal(doc)
 	if err != nil {
 		return "", err
 	}
-	b := bytes.NewReader(json)
-	return responseRev(db.closedRequest("PUT", path, b))
+	if rev == "" {
+		rev = docRev(body)
+	}
+	if db.hooks == nil {
+		if err := db.checkDocSize(db.docSizeOptions(), id, int64(len(body))); err != nil {
+			return "", err
+		}
+		return writeRev(db.revRequest("PUT", db.path().docID(id), rev, bytes.NewReader(body)))
+	}
+	ev, body, err := db.beforeWrite("put", id, rev, body)
+	if err != nil {
+		return "", err
+	}
+	if err := db.checkDocSize(db.docSizeOptions(), id, int64(len(body))); err != nil {
+		return "", err
+	}
+	newrev, err = writeRev(db.revRequest("PUT", db.path().docID(id), rev, bytes.NewReader(body)))
+	db.afterWrite(ev, newrev, err)
+	return newrev, err
 }
 
 // Delete marks a document revision as deleted.
 func (db *DB) Delete(id, rev string) (newrev string, err error) {
-	path := db.path().docID(id).rev(rev)
-	return responseRev(db.closedRequest("DELETE", path, nil))
+	if db.hooks == nil {
+		return writeRev(db.revRequest("DELETE", db.path().docID(id), rev, nil))
+	}
+	ev, _, err := db.beforeWrite("delete", id, rev, nil)
+	if err != nil {
+		return "", err
+	}
+	newrev, err = writeRev(db.revRequest("DELETE", db.path().docID(id), rev, nil))
+	db.afterWrite(ev, newrev, err)
+	return newrev, err
+}
+
+// docRev returns the _rev field of an encoded document.
+func docRev(doc []byte) string {
+	var meta struct {
+		Rev string `json:"_rev"`
+	}
+	json.Unmarshal(doc, &meta)
+	return meta.Rev
 }
 
 // Security represents database security objects.
 type Security struct {
 	Admins  Members `json:"admins"`
 	Members Members `json:"members"`
+
+	// Extra contains all other fields of the security object, e.g. the
+	// "cloudant" and "couchdb_auth_only" fields used by Cloudant. They are
+	// preserved when the object is stored with PutSecurity.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// securityFields is used to prevent recursion in the JSON methods.
+type securityFields Security
+
+// MarshalJSON implements json.Marshaler.
+func (s *Security) MarshalJSON() ([]byte, error) {
+	known, err := json.Marshal((*securityFields)(s))
+	if err != nil || len(s.Extra) == 0 {
+		return known, err
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(known, &obj); err != nil {
+		return nil, err
+	}
+	for k, v := range s.Extra {
+		if _, ok := obj[k]; !ok {
+			obj[k] = v
+		}
+	}
+	return json.Marshal(obj)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Security) UnmarshalJSON(input []byte) error {
+	var known securityFields
+	if err := json.Unmarshal(input, &known); err != nil {
+		return err
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(input, &obj); err != nil {
+		return err
+	}
+	delete(obj, "admins")
+	delete(obj, "members")
+	known.Extra = nil
+	if len(obj) > 0 {
+		known.Extra = obj
+	}
+	*s = Security(known)
+	return nil
 }
 
 // Members represents member lists in database security objects.
@@ -194,13 +704,47 @@ func (db *DB) Security() (*Security, error) {
 	return secobj, nil
 }
 
-// PutSecurity sets the database security object.
+// PutSecurity sets the database security object. Only admins of the
+// database can do this. If the server rejects the request for lack of
+// permissions, the returned error is an *AdminRequiredError.
 func (db *DB) PutSecurity(secobj *Security) error {
-	json, _ := json.Marshal(secobj)
-	body := bytes.NewReader(json)
+	enc, err := json.Marshal(secobj)
+	if err != nil {
+		return err
+	}
 	path := db.path().addRaw("_security").path()
-	_, err := db.request("PUT", path, body)
-	return err
+	resp, err := db.request("PUT", path, bytes.NewReader(enc))
+	if e, ok := err.(*Error); ok && (e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden) {
+		return &AdminRequiredError{db.name, e}
+	} else if err != nil {
+		return err
+	}
+	var result struct {
+		OK bool `json:"ok"`
+	}
+	if err := readBody(resp, &result); err != nil {
+		return err
+	}
+	if !result.OK {
+		return fmt.Errorf("couchdb: security object of %q not acknowledged by server", db.name)
+	}
+	return nil
+}
+
+// AdminRequiredError is returned by PutSecurity if the client
+// is not an admin of the database.
+type AdminRequiredError struct {
+	DB  string
+	Err *Error
+}
+
+func (e *AdminRequiredError) Error() string {
+	return fmt.Sprintf("couchdb: changing the security object of %q requires admin rights: %v", e.DB, e.Err)
+}
+
+// Unwrap returns the underlying HTTP error.
+func (e *AdminRequiredError) Unwrap() error {
+	return e.Err
 }
 
 var viewJsonKeys = []string{"startkey", "start_key", "key", "endkey", "end_key"}
@@ -219,15 +763,49 @@ func (db *DB) View(ddoc, view string, result interface{}, opts Options) error {
 	if !strings.HasPrefix(ddoc, "_design/") {
 		return errors.New("couchdb.View: design doc name must start with _design/")
 	}
+	p := db.path().docID(ddoc).addRaw("_view").add(view)
+	resp, err := db.viewRequest(p, db.options(opts))
+	if err != nil {
+		return err
+	}
+	return db.readBody(resp, result)
+}
+
+// ViewKeys invokes a view for the given keys. The keys are sent in the
+// body of a POST request, which avoids encoding them into the URL.
+// The result contains rows in the order of the keys. The "keys" option
+// must not be given in opts.
+//
+// http://docs.couchdb.org/en/latest/api/ddoc/views.html#post--db-_design-ddoc-_view-view
+func (db *DB) ViewKeys(ddoc, view string, keys []interface{}, result interface{}, opts Options) error {
+	if !strings.HasPrefix(ddoc, "_design/") {
+		return errors.New("couchdb.ViewKeys: design doc name must start with _design/")
+	}
+	opts = db.options(opts)
+	if _, ok := opts["keys"]; ok {
+		return errors.New(`couchdb.ViewKeys: "keys" option is not allowed`)
+	}
+	if err := ValidateViewOptions(opts); err != nil {
+		return err
+	}
 	path, err := db.path().docID(ddoc).addRaw("_view").add(view).options(opts, viewJsonKeys)
 	if err != nil {
 		return err
 	}
-	resp, err := db.request("GET", path, nil)
+	if keys == nil {
+		keys = []interface{}{}
+	}
+	body, err := json.Marshal(struct {
+		Keys []interface{} `json:"keys"`
+	}{keys})
+	if err != nil {
+		return err
+	}
+	resp, err := db.request("POST", path, bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
-	return readBody(resp, &result)
+	return db.readBody(resp, result)
 }
 
 // AllDocs invokes the _all_docs view of a database.
@@ -239,13 +817,10 @@ func (db *DB) View(ddoc, view string, result interface{}, opts Options) error {
 //
 // http://docs.couchdb.org/en/latest/api/database/bulk-api.html#db-all-docs
 func (db *DB) AllDocs(result interface{}, opts Options) error {
-	path, err := db.path().addRaw("_all_docs").options(opts, viewJsonKeys)
-	if err != nil {
-		return err
-	}
-	resp, err := db.request("GET", path, nil)
+	p := db.path().addRaw("_all_docs")
+	resp, err := db.viewRequest(p, db.options(opts))
 	if err != nil {
 		return err
 	}
-	return readBody(resp, &result)
+	return db.readBody(resp, result)
 }
@@ -1,6 +1,7 @@
 package couchdb_test
 
 import (
+	"encoding/json"
 	"errors"
 	"io"
 	"io/ioutil"
@@ -8,7 +9,9 @@ import (
 	"net/url"
 	"regexp"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/fjl/go-couchdb"
 )
@@ -97,6 +100,31 @@ func TestCreateDB(t *testing.T) {
 	check(t, "db.Name()", "db", db.Name())
 }
 
+func TestCreateDBWithOptions(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("PUT /test%2Fdb", func(resp ResponseWriter, req *Request) {
+		expected := url.Values{
+			"q":           {"8"},
+			"n":           {"3"},
+			"placement":   {"dc-a:2,dc-b:1"},
+			"partitioned": {"true"},
+		}
+		check(t, "request query values", expected, req.URL.Query())
+		resp.WriteHeader(StatusCreated)
+	})
+
+	db, err := c.CreateDBWithOptions("test/db", couchdb.DBCreateOptions{
+		Q:           8,
+		N:           3,
+		Placement:   "dc-a:2,dc-b:1",
+		Partitioned: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "db.Name()", "test/db", db.Name())
+}
+
 func TestDeleteDB(t *testing.T) {
 	c := newTestClient(t)
 	c.Handle("DELETE /db", func(resp ResponseWriter, req *Request) {})
@@ -105,6 +133,50 @@ func TestDeleteDB(t *testing.T) {
 	}
 }
 
+func TestValidateDBName(t *testing.T) {
+	valid := []string{"db", "a1_$()+-/b", "_users", "_replicator", "tenant/_users"}
+	for _, name := range valid {
+		if err := couchdb.ValidateDBName(name); err != nil {
+			t.Errorf("%q: unexpected error: %v", name, err)
+		}
+	}
+	invalid := []string{"", "Db", "1db", "_foo", "db.name", "db name", strings.Repeat("a", 239)}
+	for _, name := range invalid {
+		if _, ok := couchdb.ValidateDBName(name).(*couchdb.DBNameError); !ok {
+			t.Errorf("%q: expected *DBNameError", name)
+		}
+	}
+
+	normalized, err := couchdb.NormalizeDBName("My.App DB")
+	check(t, "normalized", "my_app_db", normalized)
+	check(t, "normalize error", nil, err)
+	if _, err := couchdb.NormalizeDBName("1db"); err == nil {
+		t.Error("expected error for name beginning with digit")
+	}
+}
+
+func TestDBNameMode(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("PUT /my_db", func(resp ResponseWriter, req *Request) {})
+
+	// Strict mode rejects the name without sending a request.
+	c.SetDBNameMode(couchdb.DBNameStrict)
+	db, err := c.CreateDB("My.DB")
+	if _, ok := err.(*couchdb.DBNameError); !ok {
+		t.Fatalf("expected *DBNameError, got %v", err)
+	}
+	if _, ok := db.Get("doc", nil, nil).(*couchdb.DBNameError); !ok {
+		t.Fatal("expected *DBNameError from Get")
+	}
+
+	c.SetDBNameMode(couchdb.DBNameNormalize)
+	db, err = c.CreateDB("My.DB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "db.Name()", "my_db", db.Name())
+}
+
 func TestAllDBs(t *testing.T) {
 	c := newTestClient(t)
 	c.Handle("GET /_all_dbs", func(resp ResponseWriter, req *Request) {
@@ -175,6 +247,7 @@ func TestPutSecurity(t *testing.T) {
 		body, _ := ioutil.ReadAll(req.Body)
 		check(t, "request body", securityObjectJSON, string(body))
 		resp.WriteHeader(200)
+		io.WriteString(resp, `{"ok":true}`)
 	})
 
 	err := c.DB("db").PutSecurity(securityObject)
@@ -183,6 +256,61 @@ func TestPutSecurity(t *testing.T) {
 	}
 }
 
+func TestPutSecurityErrors(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("PUT /db/_security", func(resp ResponseWriter, req *Request) {
+		resp.WriteHeader(StatusForbidden)
+		io.WriteString(resp, `{"error":"forbidden","reason":"You are not a db or server admin."}`)
+	})
+	err := c.DB("db").PutSecurity(securityObject)
+	adminErr, ok := err.(*couchdb.AdminRequiredError)
+	if !ok {
+		t.Fatalf("expected *AdminRequiredError, got %#v", err)
+	}
+	check(t, "adminErr.DB", "db", adminErr.DB)
+	check(t, "Forbidden(err)", true, couchdb.Forbidden(err))
+
+	c.Handle("PUT /db/_security", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"ok":false}`)
+	})
+	if err := c.DB("db").PutSecurity(securityObject); err == nil {
+		t.Error("expected error for unacknowledged security object")
+	}
+
+	badobj := &couchdb.Security{Extra: map[string]json.RawMessage{"x": json.RawMessage("{")}}
+	if err := c.DB("db").PutSecurity(badobj); err == nil {
+		t.Error("expected marshal error")
+	}
+}
+
+func TestSecurityExtra(t *testing.T) {
+	const input = `{"admins":{"names":["a"]},"members":{},"cloudant":{"nobody":["_reader"]},"couchdb_auth_only":true}`
+	c := newTestClient(t)
+	c.Handle("GET /db/_security", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, input)
+	})
+	c.Handle("PUT /db/_security", func(resp ResponseWriter, req *Request) {
+		var body, expected map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&body)
+		json.Unmarshal([]byte(input), &expected)
+		check(t, "request body", expected, body)
+		io.WriteString(resp, `{"ok":true}`)
+	})
+
+	db := c.DB("db")
+	secobj, err := db.Security()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "secobj.Extra", map[string]json.RawMessage{
+		"cloudant":          json.RawMessage(`{"nobody":["_reader"]}`),
+		"couchdb_auth_only": json.RawMessage(`true`),
+	}, secobj.Extra)
+	if err := db.PutSecurity(secobj); err != nil {
+		t.Fatal(err)
+	}
+}
+
 type testDocument struct {
 	Rev   string `json:"_rev,omitempty"`
 	Field int64  `json:"field"`
@@ -234,6 +362,25 @@ func TestGetNonexistingDoc(t *testing.T) {
 	check(t, "couchdb.NotFound(err)", true, couchdb.NotFound(err))
 }
 
+func TestGetMeta(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/doc", func(resp ResponseWriter, req *Request) {
+		check(t, "request query string", "rev=2-abc", req.URL.RawQuery)
+		resp.Header().Set("ETag", `"2-abc"`)
+		io.WriteString(resp, `{"_id": "doc", "_rev": "2-abc", "_deleted": true, "field": 1}`)
+	})
+
+	var doc struct {
+		Field int64 `json:"field"`
+	}
+	meta, err := c.DB("db").GetMeta("doc", &doc, couchdb.Options{"rev": "2-abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "meta", &couchdb.DocMeta{Rev: "2-abc", Deleted: true, ETag: `"2-abc"`}, meta)
+	check(t, "doc.Field", int64(1), doc.Field)
+}
+
 func TestRev(t *testing.T) {
 	c := newTestClient(t)
 	db := c.DB("db")
@@ -258,6 +405,59 @@ func TestRev(t *testing.T) {
 	}
 }
 
+func TestHead(t *testing.T) {
+	c := newTestClient(t)
+	db := c.DB("db")
+	c.Handle("HEAD /db/ok", func(resp ResponseWriter, req *Request) {
+		resp.Header().Set("ETag", `"1-619db7ba8551c0de3f3a178775509611"`)
+		resp.Header().Set("Content-Length", "42")
+	})
+	for _, id := range []string{"deleted", "missing"} {
+		reason := id
+		c.Handle("HEAD /db/"+id, func(resp ResponseWriter, req *Request) {
+			resp.WriteHeader(StatusNotFound)
+		})
+		c.Handle("GET /db/"+id, func(resp ResponseWriter, req *Request) {
+			resp.WriteHeader(StatusNotFound)
+			io.WriteString(resp, `{"error": "not_found", "reason": "`+reason+`"}`)
+		})
+	}
+
+	head, err := db.Head("ok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "head", &couchdb.DocHead{Rev: "1-619db7ba8551c0de3f3a178775509611", Size: 42}, head)
+
+	head, err = db.Head("deleted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "head", &couchdb.DocHead{Size: -1, Deleted: true}, head)
+
+	head, err = db.Head("missing")
+	check(t, "head", (*couchdb.DocHead)(nil), head)
+	check(t, "couchdb.NotFound(err)", true, couchdb.NotFound(err))
+
+	// HEAD and GET disagree, e.g. when sent to different cluster nodes.
+	heads := 0
+	c.Handle("HEAD /db/flapping", func(resp ResponseWriter, req *Request) {
+		heads++
+		resp.WriteHeader(StatusNotFound)
+	})
+	c.Handle("GET /db/flapping", func(resp ResponseWriter, req *Request) {
+		resp.Header().Set("ETag", `"2-a"`)
+		resp.Header().Set("Content-Length", "18")
+		io.WriteString(resp, `{"_id":"flapping"}`)
+	})
+	head, err = db.Head("flapping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "head", &couchdb.DocHead{Rev: "2-a", Size: 18}, head)
+	check(t, "HEAD requests", 1, heads)
+}
+
 func TestRevDBSlash(t *testing.T) {
 	c := newTestClient(t)
 	c.Handle("HEAD /test%2Fdb/doc%2Fid", func(resp ResponseWriter, req *Request) {
@@ -322,6 +522,101 @@ func TestPutWithRev(t *testing.T) {
 	check(t, "returned rev", "2-619db7ba8551c0de3f3a178775509611", rev)
 }
 
+func TestPutRevFromDoc(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("PUT /db/doc", func(resp ResponseWriter, req *Request) {
+		check(t, "request query string",
+			"rev=1-619db7ba8551c0de3f3a178775509611",
+			req.URL.RawQuery)
+		resp.Header().Set("ETag", `"2-619db7ba8551c0de3f3a178775509611"`)
+		resp.WriteHeader(StatusCreated)
+	})
+
+	doc := &testDocument{Rev: "1-619db7ba8551c0de3f3a178775509611", Field: 999}
+	rev, err := c.DB("db").Put("doc", doc, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "returned rev", "2-619db7ba8551c0de3f3a178775509611", rev)
+}
+
+func TestPutIfMatch(t *testing.T) {
+	c := newTestClient(t)
+	c.SetUseIfMatch(true)
+	c.Handle("PUT /db/doc", func(resp ResponseWriter, req *Request) {
+		check(t, "request query string", "", req.URL.RawQuery)
+		check(t, "If-Match header", "1-619db7ba8551c0de3f3a178775509611", req.Header.Get("If-Match"))
+		resp.Header().Set("ETag", `"2-619db7ba8551c0de3f3a178775509611"`)
+		resp.WriteHeader(StatusCreated)
+	})
+	c.Handle("DELETE /db/doc", func(resp ResponseWriter, req *Request) {
+		check(t, "request query string", "", req.URL.RawQuery)
+		check(t, "If-Match header", "2-619db7ba8551c0de3f3a178775509611", req.Header.Get("If-Match"))
+		resp.Header().Set("ETag", `"3-619db7ba8551c0de3f3a178775509611"`)
+	})
+
+	db := c.DB("db")
+	doc := &testDocument{Rev: "1-619db7ba8551c0de3f3a178775509611", Field: 999}
+	rev, err := db.Put("doc", doc, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "returned rev", "2-619db7ba8551c0de3f3a178775509611", rev)
+	rev, err = db.Delete("doc", rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "returned rev", "3-619db7ba8551c0de3f3a178775509611", rev)
+}
+
+func TestPutAccepted(t *testing.T) {
+	c := newTestClient(t)
+	db := c.DB("db")
+
+	// Quorum not met: the revision is in the ETag.
+	c.Handle("PUT /db/doc", func(resp ResponseWriter, req *Request) {
+		resp.Header().Set("ETag", `"1-619db7ba8551c0de3f3a178775509611"`)
+		resp.WriteHeader(StatusAccepted)
+		io.WriteString(resp, `{"id": "doc", "ok": true, "rev": "1-619db7ba8551c0de3f3a178775509611"}`)
+	})
+	rev, err := db.Put("doc", &testDocument{Field: 1}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "rev with quorum not met", "1-619db7ba8551c0de3f3a178775509611", rev)
+
+	// Missing ETag: the revision is taken from the body.
+	c.Handle("PUT /db/doc", func(resp ResponseWriter, req *Request) {
+		resp.WriteHeader(StatusAccepted)
+		io.WriteString(resp, `{"id": "doc", "ok": true, "rev": "1-619db7ba8551c0de3f3a178775509611"}`)
+	})
+	rev, err = db.Put("doc", &testDocument{Field: 1}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "rev from body", "1-619db7ba8551c0de3f3a178775509611", rev)
+
+	// Batch mode: no revision yet.
+	c.Handle("PUT /db/doc", func(resp ResponseWriter, req *Request) {
+		resp.WriteHeader(StatusAccepted)
+		io.WriteString(resp, `{"id": "doc", "ok": true}`)
+	})
+	rev, err = db.Put("doc", &testDocument{Field: 1}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "rev in batch mode", "", rev)
+
+	// A 201 response without any revision is an error.
+	c.Handle("PUT /db/doc", func(resp ResponseWriter, req *Request) {
+		resp.WriteHeader(StatusCreated)
+		io.WriteString(resp, `{"id": "doc", "ok": true}`)
+	})
+	if _, err := db.Put("doc", &testDocument{Field: 1}, ""); err == nil {
+		t.Fatal("expected error for response without revision")
+	}
+}
+
 func TestDelete(t *testing.T) {
 	c := newTestClient(t)
 	c.Handle("DELETE /db/doc", func(resp ResponseWriter, req *Request) {
@@ -412,6 +707,33 @@ func TestView(t *testing.T) {
 	check(t, "result", expected, result)
 }
 
+func TestViewFreshnessOptions(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/_design/test/_view/testview", func(resp ResponseWriter, req *Request) {
+		check(t, "query", "stable=true&update=lazy", req.URL.RawQuery)
+		io.WriteString(resp, `{"rows": []}`)
+	})
+
+	db := c.DB("db")
+	var result struct{ Rows []interface{} }
+	opts := couchdb.Options{"update": couchdb.UpdateLazy, "stable": couchdb.StableTrue}
+	if err := db.View("_design/test", "testview", &result, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []couchdb.Options{
+		{"update": "sometimes"},
+		{"stable": 1},
+		{"stale": "yes"},
+		{"stale": couchdb.StaleOK, "update": couchdb.UpdateFalse},
+	}
+	for _, opts := range invalid {
+		if err := db.View("_design/test", "testview", &result, opts); err == nil {
+			t.Errorf("expected error for options %v", opts)
+		}
+	}
+}
+
 func TestAllDocs(t *testing.T) {
 	c := newTestClient(t)
 	c.Handle("GET /db/_all_docs",
@@ -483,3 +805,382 @@ func TestAllDocs(t *testing.T) {
 	}
 	check(t, "result", expected, result)
 }
+
+func TestGetUseNumber(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/doc", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"_id": "doc", "n": 9007199254740993}`)
+	})
+
+	var doc map[string]interface{}
+	if err := c.DB("db").Get("doc", &doc, nil); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "doc[n] without UseNumber", float64(9007199254740993), doc["n"])
+
+	c.SetUseNumber(true)
+	doc = nil
+	if err := c.DB("db").Get("doc", &doc, nil); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "doc[n]", json.Number("9007199254740993"), doc["n"])
+}
+
+func TestDefaultOptions(t *testing.T) {
+	c := newTestClient(t)
+	c.SetDefaultOptions(couchdb.Options{"stable": true, "update": "lazy"})
+	c.Handle("GET /db/_design/test/_view/v", func(resp ResponseWriter, req *Request) {
+		expected := url.Values{
+			"stable":    {"true"},
+			"update":    {"false"},
+			"partition": {"p1"},
+			"limit":     {"1"},
+		}
+		check(t, "request query values", expected, req.URL.Query())
+		io.WriteString(resp, `{"rows": []}`)
+	})
+	c.Handle("GET /db/_all_docs", func(resp ResponseWriter, req *Request) {
+		expected := url.Values{"stable": {"true"}, "update": {"lazy"}}
+		check(t, "request query values", expected, req.URL.Query())
+		io.WriteString(resp, `{"rows": []}`)
+	})
+
+	db := c.DB("db")
+	pdb := db.WithOptions(couchdb.Options{"partition": "p1", "update": "true"})
+	var result map[string]interface{}
+	err := pdb.View("_design/test", "v", &result, couchdb.Options{"update": false, "limit": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AllDocs(&result, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	c := newTestClient(t)
+	c.SetHeader("x-api-key", "secret")
+	c.SetHeader("x-trace", "t1")
+	c.Handle("GET /db/doc", func(resp ResponseWriter, req *Request) {
+		check(t, "X-Api-Key", "secret", req.Header.Get("x-api-key"))
+		check(t, "X-Trace", "t2", req.Header.Get("x-trace"))
+		io.WriteString(resp, `{}`)
+	})
+	c.Handle("PUT /db/doc", func(resp ResponseWriter, req *Request) {
+		check(t, "X-Api-Key", []string(nil), req.Header["X-Api-Key"])
+		check(t, "X-Trace", "t2", req.Header.Get("x-trace"))
+		resp.Header().Set("ETag", `"1-619db7ba8551c0de3f3a178775509611"`)
+		resp.WriteHeader(StatusCreated)
+		io.WriteString(resp, `{"id": "doc", "ok": true, "rev": "1-619db7ba8551c0de3f3a178775509611"}`)
+	})
+
+	db := c.DB("db").WithHeader("x-trace", "t2")
+	var doc map[string]interface{}
+	if err := db.Get("doc", &doc, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.WithHeader("x-api-key", "").Put("doc", &testDocument{}, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMaxConcurrentRequests(t *testing.T) {
+	c := newTestClient(t)
+	c.SetMaxConcurrentRequests(1)
+	c.Handle("GET /db/_all_docs", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"rows": [{"id": "a", "key": "a", "value": {}}]}`)
+	})
+	c.Handle("HEAD /db/doc", func(resp ResponseWriter, req *Request) {
+		resp.Header().Set("ETag", `"1-619db7ba8551c0de3f3a178775509611"`)
+	})
+
+	rows, err := c.DB("db").AllDocsRows(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The open iterator occupies the only slot.
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.DB("db").Rev("doc")
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("request completed while limit was reached")
+	case <-time.After(20 * time.Millisecond):
+	}
+	rows.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request did not complete after slot was released")
+	}
+}
+
+func TestOptionsEncoding(t *testing.T) {
+	c := newTestClient(t)
+	key := []interface{}{"a b/c", "ü&=+~", 1.5}
+	keyJSON, _ := json.Marshal(key)
+	want := "descending=true&key=" + url.QueryEscape(string(keyJSON)) +
+		"&label=" + url.QueryEscape("update after?") + "&limit=10&w=-3"
+	c.Handle("GET /db/_design/a+b/_view/v%2Fx", func(resp ResponseWriter, req *Request) {
+		check(t, "raw query", want, req.URL.RawQuery)
+		io.WriteString(resp, `{"rows":[]}`)
+	})
+
+	var result struct{ Rows []json.RawMessage }
+	err := c.DB("db").View("_design/a b", "v/x", &result, couchdb.Options{
+		"key":        key,
+		"limit":      uint8(10),
+		"descending": true,
+		"label":      "update after?",
+		"w":          int32(-3),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOptionsListValues(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/_all_docs", func(resp ResponseWriter, req *Request) {
+		check(t, "keys", `["a","b"]`, req.URL.Query().Get("keys"))
+		check(t, "doc_ids", `{"x":[1,2]}`, req.URL.Query().Get("doc_ids"))
+		io.WriteString(resp, `{"rows":[]}`)
+	})
+
+	var result struct{ Rows []json.RawMessage }
+	err := c.DB("db").AllDocs(&result, couchdb.Options{
+		"keys":    []string{"a", "b"},
+		"doc_ids": map[string][2]int{"x": {1, 2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testStale int
+
+func (s testStale) String() string { return [...]string{"ok", "update_after"}[s] }
+
+type testRawKey string
+
+func (k testRawKey) MarshalJSON() ([]byte, error) { return []byte(k), nil }
+
+func TestOptionsTimeStringer(t *testing.T) {
+	c := newTestClient(t)
+	date := time.Date(2015, 3, 1, 12, 30, 0, 0, time.FixedZone("", 3600))
+	c.Handle("GET /db/_design/d/_view/by_date", func(resp ResponseWriter, req *Request) {
+		q := req.URL.Query()
+		check(t, "since", "2015-03-01T12:30:00+01:00", q.Get("since"))
+		check(t, "startkey", `"2015-03-01T12:30:00+01:00"`, q.Get("startkey"))
+		check(t, "stale", "update_after", q.Get("stale"))
+		check(t, "filter", `{"a":1}`, q.Get("filter"))
+		io.WriteString(resp, `{"rows":[]}`)
+	})
+
+	var result struct{ Rows []json.RawMessage }
+	err := c.DB("db").View("_design/d", "by_date", &result, couchdb.Options{
+		"since":    date,
+		"startkey": date,
+		"stale":    testStale(1),
+		"filter":   testRawKey(`{"a":1}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncodeViewOptions(t *testing.T) {
+	var query string
+	c := newTestClient(t)
+	c.Handle("GET /db/_design/d/_view/v", func(resp ResponseWriter, req *Request) {
+		query = req.URL.RawQuery
+		io.WriteString(resp, `{"rows":[]}`)
+	})
+
+	opts := couchdb.Options{"startkey": []interface{}{"a", 1}, "limit": 5, "stale": testStale(0)}
+	var result struct{ Rows []json.RawMessage }
+	if err := c.DB("db").View("_design/d", "v", &result, opts); err != nil {
+		t.Fatal(err)
+	}
+	enc, err := couchdb.EncodeViewOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "query", query, enc)
+}
+
+func TestMaxURLLength(t *testing.T) {
+	c := newTestClient(t)
+	c.SetMaxURLLength(100)
+	keys := make([]string, 20)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+
+	c.Handle("POST /db/_design/d/_view/v", func(resp ResponseWriter, req *Request) {
+		check(t, "view query", "", req.URL.RawQuery)
+		var body struct {
+			Keys  []string `json:"keys"`
+			Limit int      `json:"limit"`
+		}
+		json.NewDecoder(req.Body).Decode(&body)
+		check(t, "view body keys", keys, body.Keys)
+		check(t, "view body limit", 5, body.Limit)
+		io.WriteString(resp, `{"rows":[]}`)
+	})
+	var result struct{ Rows []json.RawMessage }
+	db := c.DB("db")
+	if err := db.View("_design/d", "v", &result, couchdb.Options{"keys": keys, "limit": 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Handle("GET /db/_all_docs", func(resp ResponseWriter, req *Request) {
+		check(t, "all_docs query", "limit=5", req.URL.RawQuery)
+		io.WriteString(resp, `{"rows":[]}`)
+	})
+	if err := db.AllDocs(&result, couchdb.Options{"limit": 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Handle("POST /db/_changes", func(resp ResponseWriter, req *Request) {
+		check(t, "changes query", "filter=_doc_ids", req.URL.RawQuery)
+		var body struct {
+			DocIDs []string `json:"doc_ids"`
+		}
+		json.NewDecoder(req.Body).Decode(&body)
+		check(t, "changes body doc_ids", keys, body.DocIDs)
+		io.WriteString(resp, `{"results":[],"last_seq":"1-..."}`)
+	})
+	feed, err := db.Changes(couchdb.Options{"filter": "_doc_ids", "doc_ids": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed.Close()
+}
+
+func TestViewKeys(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("POST /db/_design/d/_view/v", func(resp ResponseWriter, req *Request) {
+		check(t, "query", "include_docs=true&startkey=%22a%22", req.URL.RawQuery)
+		check(t, "content type", "application/json", req.Header.Get("content-type"))
+		body, _ := ioutil.ReadAll(req.Body)
+		check(t, "body", `{"keys":["b",["c",1],null]}`, string(body))
+		io.WriteString(resp, `{"rows":[{"key":"b"},{"key":["c",1]},{"key":null}]}`)
+	})
+
+	var result struct {
+		Rows []struct{ Key interface{} }
+	}
+	keys := []interface{}{"b", []interface{}{"c", 1}, nil}
+	opts := couchdb.Options{"include_docs": true, "startkey": "a"}
+	if err := c.DB("db").ViewKeys("_design/d", "v", keys, &result, opts); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "row count", 3, len(result.Rows))
+	check(t, "first key", "b", result.Rows[0].Key)
+
+	err := c.DB("db").ViewKeys("_design/d", "v", keys, &result, couchdb.Options{"keys": keys})
+	if err == nil {
+		t.Error("expected error for keys option")
+	}
+}
+
+func TestChangesBodyOptions(t *testing.T) {
+	c := newTestClient(t)
+	db := c.DB("db")
+
+	// Short requests with body options are sent as POST too.
+	var query string
+	var body map[string]interface{}
+	c.Handle("POST /db/_changes", func(resp ResponseWriter, req *Request) {
+		query, body = req.URL.RawQuery, nil
+		json.NewDecoder(req.Body).Decode(&body)
+		io.WriteString(resp, `{"results":[],"last_seq":"1-..."}`)
+	})
+
+	feed, err := db.Changes(couchdb.Options{"filter": "_selector", "selector": map[string]string{"type": "user"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed.Close()
+	check(t, "selector query", "filter=_selector", query)
+	check(t, "selector body", map[string]interface{}{"selector": map[string]interface{}{"type": "user"}}, body)
+
+	feed, err = db.Changes(couchdb.Options{"filter": "_doc_ids", "doc_ids": []string{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed.Close()
+	check(t, "doc_ids query", "filter=_doc_ids", query)
+	check(t, "doc_ids body", map[string]interface{}{"doc_ids": []interface{}{"a", "b"}}, body)
+}
+
+// benchClient returns a client whose transport answers every request with
+// the given body, without going through the network or httptest.
+func benchClient(b *testing.B, body string) *couchdb.Client {
+	rt := roundTripperFunc(func(req *Request) (*Response, error) {
+		if req.Body != nil {
+			io.Copy(ioutil.Discard, req.Body)
+			req.Body.Close()
+		}
+		return &Response{
+			StatusCode: StatusOK,
+			Header:     Header{"Etag": {`"1-619db7ba8551c0de3f3a178775509611"`}},
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+	c, err := couchdb.NewClient("http://testClient:5984/", rt)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return c
+}
+
+func BenchmarkGet(b *testing.B) {
+	db := benchClient(b, `{"_id":"doc","_rev":"1-619db7ba8551c0de3f3a178775509611","field":999}`).DB("db")
+	opts := couchdb.Options{"revs_info": true}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var doc testDocument
+		if err := db.Get("doc", &doc, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPut(b *testing.B) {
+	db := benchClient(b, `{"ok":true}`).DB("db")
+	doc := &testDocument{Rev: "1-619db7ba8551c0de3f3a178775509611", Field: 999}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := db.Put("doc", doc, ""); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkView(b *testing.B) {
+	db := benchClient(b, `{"total_rows":0,"offset":0,"rows":[]}`).DB("db")
+	opts := couchdb.Options{
+		"startkey":     []interface{}{"a", 1},
+		"endkey":       []interface{}{"a", 2},
+		"limit":        100,
+		"include_docs": true,
+		"stale":        "ok",
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var result struct{ Rows []json.RawMessage }
+		if err := db.View("_design/app", "by_key", &result, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
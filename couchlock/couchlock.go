@@ -0,0 +1,259 @@
+// Package couchlock implements distributed locks on top of CouchDB.
+//
+// A lock is a document holding a lease (see couchdb.Lease). The lease is
+// acquired and renewed using revision compare-and-swap, so at most one owner
+// can hold it at any time. Locks are renewed automatically while they are
+// held. If renewal fails, the lock is reported as lost through Lock.Lost.
+//
+// Because a lock may be lost at any time, e.g. when the holding process is
+// paused for longer than the TTL, each acquisition yields a fencing token.
+// Tokens increase with every acquisition of the same lock. Systems protected
+// by the lock should reject requests carrying a token smaller than the
+// largest token they have seen.
+//
+// Lock documents are ordinary JSON documents with "owner" and "expires"
+// fields, so processes written in other languages can take part by
+// following the same protocol.
+package couchlock
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fjl/go-couchdb"
+)
+
+// ErrLost is returned by Lock.Release if the lock was lost before release.
+var ErrLost = errors.New("couchlock: lock lost")
+
+// Options configures a Locker.
+type Options struct {
+	// TTL is the duration of the lease. If the holder of a lock stops
+	// renewing it, other owners can acquire the lock after TTL.
+	// The default is 30 seconds.
+	TTL time.Duration
+
+	// RenewInterval is the time between renewals of held locks.
+	// The default is TTL/3.
+	RenewInterval time.Duration
+
+	// RetryInterval is the time between attempts of Acquire while
+	// the lock is held by another owner. The default is one second.
+	RetryInterval time.Duration
+
+	// Prefix is prepended to lock names to form document IDs.
+	// The default is "lock:".
+	Prefix string
+}
+
+// Locker acquires locks stored in a database.
+type Locker struct {
+	db    *couchdb.DB
+	owner string
+	opts  Options
+
+	mu   sync.Mutex
+	held map[string]*Lock // nil value while acquisition is in progress
+}
+
+// New creates a locker. The owner identifies the process acquiring locks
+// and must be unique among all processes using the same locks. Locks are
+// not reentrant: while a lock is held through a Locker, acquiring it again
+// through the same Locker fails as if it was held by another owner.
+func New(db *couchdb.DB, owner string, opts Options) *Locker {
+	if opts.TTL <= 0 {
+		opts.TTL = 30 * time.Second
+	}
+	if opts.RenewInterval <= 0 || opts.RenewInterval >= opts.TTL {
+		opts.RenewInterval = opts.TTL / 3
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = time.Second
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = "lock:"
+	}
+	return &Locker{db: db, owner: owner, opts: opts, held: make(map[string]*Lock)}
+}
+
+// TryAcquire acquires a lock without waiting. If the lock is held by
+// another owner or through this Locker, the error is a *couchdb.LeaseHeldError.
+func (lk *Locker) TryAcquire(name string) (*Lock, error) {
+	// The lease alone can't tell apart acquisitions by the same owner,
+	// so locks held through this Locker are tracked here.
+	id := lk.opts.Prefix + name
+	lk.mu.Lock()
+	if l, ok := lk.held[name]; ok {
+		lk.mu.Unlock()
+		herr := &couchdb.LeaseHeldError{ID: id, Owner: lk.owner}
+		if l != nil {
+			herr.Expires = l.expires()
+		}
+		return nil, herr
+	}
+	lk.held[name] = nil
+	lk.mu.Unlock()
+
+	lease, err := lk.db.AcquireLease(id, lk.owner, lk.opts.TTL)
+	if err != nil {
+		lk.forget(name)
+		return nil, err
+	}
+	l := &Lock{
+		locker: lk,
+		name:   name,
+		lease:  lease,
+		token:  revGeneration(lease.Rev()),
+		opts:   lk.opts,
+		lost:   make(chan struct{}),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	lk.mu.Lock()
+	lk.held[name] = l
+	lk.mu.Unlock()
+	go l.renewLoop()
+	return l, nil
+}
+
+func (lk *Locker) forget(name string) {
+	lk.mu.Lock()
+	delete(lk.held, name)
+	lk.mu.Unlock()
+}
+
+// Acquire acquires a lock, waiting until it becomes available
+// or the context is canceled.
+func (lk *Locker) Acquire(ctx context.Context, name string) (*Lock, error) {
+	for {
+		l, err := lk.TryAcquire(name)
+		if _, held := err.(*couchdb.LeaseHeldError); !held {
+			return l, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lk.opts.RetryInterval):
+		}
+	}
+}
+
+// Lock is a held lock.
+type Lock struct {
+	locker *Locker
+	name   string
+	token  int64
+	opts   Options
+
+	mu    sync.Mutex
+	lease *couchdb.Lease
+	err   error // set when the lock is lost
+	lost  chan struct{}
+	quit  chan struct{}
+	done  chan struct{}
+
+	releaseOnce sync.Once
+	releaseErr  error
+}
+
+// Name returns the name of the lock.
+func (l *Lock) Name() string {
+	return l.name
+}
+
+// Token returns the fencing token of the acquisition.
+func (l *Lock) Token() int64 {
+	return l.token
+}
+
+// Lost returns a channel that is closed when the lock is lost.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Err returns the reason the lock was lost, or nil if it is held.
+func (l *Lock) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+func (l *Lock) expires() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lease.Expires()
+}
+
+// Release stops renewal and releases the lock. It returns ErrLost
+// if the lock was lost before it could be released. Calling Release
+// more than once returns the result of the first call.
+func (l *Lock) Release() error {
+	l.releaseOnce.Do(func() {
+		l.releaseErr = l.release()
+		l.locker.forget(l.name)
+	})
+	return l.releaseErr
+}
+
+func (l *Lock) release() error {
+	close(l.quit)
+	<-l.done
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return ErrLost
+	}
+	if err := l.lease.Release(); err != nil {
+		if err == couchdb.ErrLeaseLost {
+			return ErrLost
+		}
+		return err
+	}
+	return nil
+}
+
+func (l *Lock) renewLoop() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.opts.RenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.quit:
+			return
+		case <-ticker.C:
+			if !l.renew() {
+				return
+			}
+		}
+	}
+}
+
+// renew renews the lease. Transient errors are tolerated until the lease
+// expires. It returns false if the lock is lost.
+func (l *Lock) renew() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := l.lease.Renew(l.opts.TTL)
+	switch {
+	case err == nil:
+		return true
+	case err == couchdb.ErrLeaseLost || time.Now().After(l.lease.Expires()):
+		l.err = err
+		close(l.lost)
+		return false
+	default:
+		return true
+	}
+}
+
+// revGeneration returns the generation number of a revision. Since every
+// acquisition writes the lock document, generations are increasing.
+func revGeneration(rev string) int64 {
+	n, _ := strconv.ParseInt(strings.SplitN(rev, "-", 2)[0], 10, 64)
+	return n
+}
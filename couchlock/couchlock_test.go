@@ -0,0 +1,134 @@
+package couchlock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fjl/go-couchdb"
+	"github.com/fjl/go-couchdb/couchlock"
+	"github.com/fjl/go-couchdb/couchtest"
+)
+
+func newDB(t *testing.T) *couchdb.DB {
+	srv := couchtest.NewServer()
+	t.Cleanup(srv.Close)
+	db, err := srv.Client().CreateDB("locks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestLockExclusive(t *testing.T) {
+	db := newDB(t)
+	a := couchlock.New(db, "a", couchlock.Options{TTL: time.Minute})
+	b := couchlock.New(db, "b", couchlock.Options{TTL: time.Minute, RetryInterval: 5 * time.Millisecond})
+
+	la, err := a.TryAcquire("job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.TryAcquire("job"); err == nil {
+		t.Fatal("second owner acquired held lock")
+	} else if _, ok := err.(*couchdb.LeaseHeldError); !ok {
+		t.Fatalf("wrong error type %T: %v", err, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := b.Acquire(ctx, "job"); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+
+	if err := la.Release(); err != nil {
+		t.Fatal(err)
+	}
+	lb, err := b.Acquire(context.Background(), "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lb.Token() <= la.Token() {
+		t.Errorf("fencing token did not increase: %d <= %d", lb.Token(), la.Token())
+	}
+	if err := lb.Release(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockRenewal(t *testing.T) {
+	db := newDB(t)
+	opts := couchlock.Options{TTL: 60 * time.Millisecond, RenewInterval: 10 * time.Millisecond}
+	l, err := couchlock.New(db, "a", opts).TryAcquire("job")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The lock stays held for longer than the TTL.
+	time.Sleep(150 * time.Millisecond)
+	if _, err := couchlock.New(db, "b", opts).TryAcquire("job"); err == nil {
+		t.Fatal("lock was not renewed")
+	}
+	select {
+	case <-l.Lost():
+		t.Fatal("lock lost:", l.Err())
+	default:
+	}
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockLost(t *testing.T) {
+	db := newDB(t)
+	opts := couchlock.Options{TTL: time.Minute, RenewInterval: 10 * time.Millisecond}
+	l, err := couchlock.New(db, "a", opts).TryAcquire("job")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Modifying the lock document makes the next renewal fail.
+	if _, err := db.Touch("lock:job", "modified"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-l.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lock not reported as lost")
+	}
+	if err := l.Err(); err != couchdb.ErrLeaseLost {
+		t.Errorf("wrong error %v", err)
+	}
+	if err := l.Release(); err != couchlock.ErrLost {
+		t.Errorf("expected ErrLost from Release, got %v", err)
+	}
+}
+
+func TestLockSameLocker(t *testing.T) {
+	db := newDB(t)
+	lk := couchlock.New(db, "a", couchlock.Options{TTL: time.Minute})
+
+	l, err := lk.TryAcquire("job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lk.TryAcquire("job"); err == nil {
+		t.Fatal("lock acquired twice through the same locker")
+	} else if _, ok := err.(*couchdb.LeaseHeldError); !ok {
+		t.Fatalf("wrong error type %T: %v", err, err)
+	}
+
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Release(); err != nil {
+		t.Fatal("second Release:", err)
+	}
+	l2, err := lk.TryAcquire("job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l2.Release(); err != nil {
+		t.Fatal(err)
+	}
+}
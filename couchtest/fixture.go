@@ -0,0 +1,165 @@
+package couchtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fjl/go-couchdb"
+)
+
+// Fixture is the content of a database served by Server.
+type Fixture struct {
+	DB    string            // database name
+	Docs  []json.RawMessage // documents, including _id and _rev
+	Views []ViewFixture     // recorded view responses
+}
+
+// ViewFixture is a recorded view response.
+type ViewFixture struct {
+	DDoc  string // design document name, without "_design/"
+	View  string
+	Query string // encoded query, as sent by couchdb.DB.View; "" matches any query
+
+	Result json.RawMessage
+}
+
+// ViewQuery selects a view response to be recorded by Snapshot.
+type ViewQuery struct {
+	DDoc    string // design document name, with or without "_design/"
+	View    string
+	Options couchdb.Options
+}
+
+// SnapshotOptions selects the content of a fixture.
+type SnapshotOptions struct {
+	IDs     []string    // documents to include
+	AllDocs bool        // include all documents (IDs is ignored)
+	Views   []ViewQuery // view responses to include
+}
+
+// Snapshot reads documents and view responses from a live database.
+// Design documents are fetched like any other document if listed in IDs.
+func Snapshot(db *couchdb.DB, opts SnapshotOptions) (*Fixture, error) {
+	f := &Fixture{DB: db.Name()}
+	if opts.AllDocs {
+		var result struct {
+			Rows []struct {
+				Doc json.RawMessage `json:"doc"`
+			} `json:"rows"`
+		}
+		if err := db.AllDocs(&result, couchdb.Options{"include_docs": true}); err != nil {
+			return nil, err
+		}
+		for _, row := range result.Rows {
+			f.Docs = append(f.Docs, row.Doc)
+		}
+	} else {
+		for _, id := range opts.IDs {
+			var doc json.RawMessage
+			if err := db.Get(id, &doc, nil); err != nil {
+				return nil, fmt.Errorf("can't get %q: %v", id, err)
+			}
+			f.Docs = append(f.Docs, doc)
+		}
+	}
+	for _, vq := range opts.Views {
+		ddoc := strings.TrimPrefix(vq.DDoc, "_design/")
+		var result json.RawMessage
+		if err := db.View("_design/"+ddoc, vq.View, &result, vq.Options); err != nil {
+			return nil, fmt.Errorf("can't query view %s/%s: %v", ddoc, vq.View, err)
+		}
+		query, err := encodeQuery(vq.Options)
+		if err != nil {
+			return nil, err
+		}
+		f.Views = append(f.Views, ViewFixture{DDoc: ddoc, View: vq.View, Query: query, Result: result})
+	}
+	return f, nil
+}
+
+// encodeQuery encodes view options the way the server sees them.
+func encodeQuery(opts couchdb.Options) (string, error) {
+	query, err := couchdb.EncodeViewOptions(opts)
+	if err != nil {
+		return "", err
+	}
+	// The server matches the normalized encoding of the request query.
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return "", err
+	}
+	return q.Encode(), nil
+}
+
+// WriteGoFile writes a Go source file declaring the fixture as a package-level
+// variable with the given name.
+func WriteGoFile(w io.Writer, pkg, varName string, f *Fixture) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by couchfixture. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	fmt.Fprintf(&buf, "import (\n\t\"encoding/json\"\n\n\t\"github.com/fjl/go-couchdb/couchtest\"\n)\n\n")
+	fmt.Fprintf(&buf, "var %s = &couchtest.Fixture{\n", varName)
+	fmt.Fprintf(&buf, "DB: %q,\n", f.DB)
+	fmt.Fprintf(&buf, "Docs: []json.RawMessage{\n")
+	docs := append([]json.RawMessage(nil), f.Docs...)
+	sort.SliceStable(docs, func(i, j int) bool { return docID(docs[i]) < docID(docs[j]) })
+	for _, doc := range docs {
+		lit, err := jsonLiteral(doc)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, "json.RawMessage(%s),\n", lit)
+	}
+	fmt.Fprintf(&buf, "},\n")
+	if len(f.Views) > 0 {
+		fmt.Fprintf(&buf, "Views: []couchtest.ViewFixture{\n")
+		for _, v := range f.Views {
+			lit, err := jsonLiteral(v.Result)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&buf, "{\nDDoc: %q,\nView: %q,\n", v.DDoc, v.View)
+			if v.Query != "" {
+				fmt.Fprintf(&buf, "Query: %q,\n", v.Query)
+			}
+			fmt.Fprintf(&buf, "Result: json.RawMessage(%s),\n},\n", lit)
+		}
+		fmt.Fprintf(&buf, "},\n")
+	}
+	fmt.Fprintf(&buf, "}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("can't format generated code: %v", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// jsonLiteral returns a Go string literal containing indented JSON.
+func jsonLiteral(raw json.RawMessage) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, raw, "", "\t"); err != nil {
+		return "", err
+	}
+	s := buf.String()
+	if strings.ContainsAny(s, "`\r") {
+		return strconv.Quote(s), nil
+	}
+	return "`" + s + "`", nil
+}
+
+func docID(doc json.RawMessage) string {
+	var v struct {
+		ID string `json:"_id"`
+	}
+	json.Unmarshal(doc, &v)
+	return v.ID
+}
@@ -0,0 +1,115 @@
+package couchtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+var testFixture = &Fixture{
+	DB: "db",
+	Docs: []json.RawMessage{
+		json.RawMessage(`{"_id": "doc", "_rev": "1-abc", "field": 1}`),
+		json.RawMessage(`{"_id": "_design/app", "_rev": "2-def", "views": {"v": {"map": "function(doc){ emit(doc._id, 1) }"}}}`),
+	},
+	Views: []ViewFixture{
+		{DDoc: "app", View: "v", Result: json.RawMessage(`{"total_rows":1,"rows":[{"id":"doc","key":"doc","value":1}]}`)},
+		{DDoc: "app", View: "v", Query: "key=%22x%22", Result: json.RawMessage(`{"total_rows":1,"rows":[]}`)},
+	},
+}
+
+type viewResult struct {
+	Rows []struct {
+		ID    string `json:"id"`
+		Value int    `json:"value"`
+	} `json:"rows"`
+}
+
+func TestServerViews(t *testing.T) {
+	srv := NewServer(testFixture)
+	defer srv.Close()
+	db := srv.Client().DB("db")
+
+	var result viewResult
+	if err := db.View("_design/app", "v", &result, couchdb.Options{"limit": 10}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "fallback rows", 1, len(result.Rows))
+
+	result = viewResult{}
+	if err := db.View("_design/app", "v", &result, couchdb.Options{"key": "x"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "exact query rows", 0, len(result.Rows))
+
+	if err := db.View("_design/app", "missing", &result, nil); !couchdb.NotFound(err) {
+		t.Errorf("expected not found for view without fixture, got %v", err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	srv := NewServer(testFixture)
+	defer srv.Close()
+	db := srv.Client().DB("db")
+
+	f, err := Snapshot(db, SnapshotOptions{
+		IDs: []string{"doc", "_design/app"},
+		Views: []ViewQuery{
+			{DDoc: "_design/app", View: "v", Options: couchdb.Options{"key": "x"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "db", "db", f.DB)
+	check(t, "doc count", 2, len(f.Docs))
+	check(t, "doc id", "_design/app", docID(f.Docs[1]))
+	check(t, "view count", 1, len(f.Views))
+	check(t, "view ddoc", "app", f.Views[0].DDoc)
+	check(t, "view query", "key=%22x%22", f.Views[0].Query)
+
+	// The snapshot must reproduce the same responses.
+	srv2 := NewServer(f)
+	defer srv2.Close()
+	var doc testDocument
+	if err := srv2.Client().DB("db").Get("doc", &doc, nil); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "doc", testDocument{Rev: "1-abc", Field: 1}, doc)
+	var result viewResult
+	err = srv2.Client().DB("db").View("_design/app", "v", &result, couchdb.Options{"key": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "view rows", 0, len(result.Rows))
+}
+
+func TestWriteGoFile(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteGoFile(&buf, "fixtures", "TestDB", testFixture); err != nil {
+		t.Fatal(err)
+	}
+	src := buf.String()
+	if _, err := parser.ParseFile(token.NewFileSet(), "fixture.go", src, 0); err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, src)
+	}
+	for _, want := range []string{
+		"package fixtures\n",
+		"var TestDB = &couchtest.Fixture{",
+		`Query: "key=%22x%22",`,
+		"\"_id\": \"doc\"",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, src)
+		}
+	}
+	// Docs are sorted by ID.
+	if strings.Index(src, `"_design/app"`) > strings.Index(src, `"_id": "doc"`) {
+		t.Errorf("docs not sorted by ID:\n%s", src)
+	}
+}
@@ -0,0 +1,604 @@
+// Package couchtest provides an in-memory CouchDB server for unit tests.
+//
+// The server implements the document API, _all_docs, _bulk_docs, security
+// objects and poll-style _changes feeds. Views are not computed; their results are
+// served from fixtures, which can be recorded from a live database using
+// Snapshot and WriteGoFile (or the couchfixture tool).
+package couchtest
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fjl/go-couchdb"
+)
+
+// Server is a fake CouchDB server.
+type Server struct {
+	// URL is the base URL of the server, e.g. http://127.0.0.1:1234.
+	URL string
+
+	srv   *httptest.Server
+	mu    sync.Mutex
+	dbs   map[string]*database
+	idseq int
+}
+
+type database struct {
+	docs     map[string]*document
+	seq      int
+	views    []ViewFixture
+	security json.RawMessage
+}
+
+type document struct {
+	rev     string
+	seq     int
+	deleted bool
+	fields  map[string]json.RawMessage
+}
+
+// NewServer starts a server. The given fixtures are loaded into it.
+// It panics if a fixture contains invalid documents.
+func NewServer(fixtures ...*Fixture) *Server {
+	s := &Server{dbs: make(map[string]*database)}
+	for _, f := range fixtures {
+		if err := s.Load(f); err != nil {
+			panic("couchtest: " + err.Error())
+		}
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Client returns a client connected to the server.
+func (s *Server) Client() *couchdb.Client {
+	c, err := couchdb.NewClient(s.URL, nil)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Load adds the documents and view results of a fixture to the server.
+// The database is created if it doesn't exist. Documents keep the
+// revision recorded in the fixture.
+func (s *Server) Load(f *Fixture) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db := s.dbs[f.DB]
+	if db == nil {
+		db = &database{docs: make(map[string]*document)}
+		s.dbs[f.DB] = db
+	}
+	for _, raw := range f.Docs {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return fmt.Errorf("invalid document in fixture %q: %v", f.DB, err)
+		}
+		var id, rev string
+		json.Unmarshal(fields["_id"], &id)
+		json.Unmarshal(fields["_rev"], &rev)
+		if id == "" {
+			return fmt.Errorf("document without _id in fixture %q", f.DB)
+		}
+		if rev == "" {
+			rev = newRev(0, fields)
+		}
+		db.store(id, rev, fields)
+	}
+	db.views = append(db.views, f.Views...)
+	return nil
+}
+
+func (db *database) store(id, rev string, fields map[string]json.RawMessage) *document {
+	delete(fields, "_id")
+	delete(fields, "_rev")
+	db.seq++
+	doc := &document{rev: rev, seq: db.seq, fields: fields}
+	if string(fields["_deleted"]) == "true" {
+		doc.deleted = true
+		doc.fields = map[string]json.RawMessage{}
+	}
+	db.docs[id] = doc
+	return doc
+}
+
+// json returns the document including _id and _rev.
+func (doc *document) json(id string) json.RawMessage {
+	m := make(map[string]json.RawMessage, len(doc.fields)+2)
+	for k, v := range doc.fields {
+		m[k] = v
+	}
+	m["_id"], _ = json.Marshal(id)
+	m["_rev"], _ = json.Marshal(doc.rev)
+	if doc.deleted {
+		m["_deleted"] = json.RawMessage("true")
+	}
+	enc, _ := json.Marshal(m)
+	return enc
+}
+
+// newRev computes the revision following gen for a document body.
+func newRev(gen int, fields map[string]json.RawMessage) string {
+	enc, _ := json.Marshal(fields)
+	return fmt.Sprintf("%d-%x", gen+1, md5.Sum(enc))
+}
+
+func revGeneration(rev string) int {
+	n, _ := strconv.Atoi(strings.SplitN(rev, "-", 2)[0])
+	return n
+}
+
+// docResult is returned by handlers that serve a single document.
+type docResult struct {
+	id  string
+	doc *document
+}
+
+// updateResult is the response to a document update.
+type updateResult struct {
+	OK  bool   `json:"ok"`
+	ID  string `json:"id"`
+	Rev string `json:"rev"`
+}
+
+// changesResult is the response of the _changes endpoint. It is a struct
+// because clients expect the results key first.
+type changesResult struct {
+	Results []map[string]interface{} `json:"results"`
+	LastSeq string                   `json:"last_seq"`
+	Pending int                      `json:"pending"`
+}
+
+// allDocsResult is the response of the _all_docs endpoint.
+type allDocsResult struct {
+	TotalRows int                      `json:"total_rows"`
+	Offset    int                      `json:"offset"`
+	Rows      []map[string]interface{} `json:"rows"`
+}
+
+type httpError struct {
+	status       int
+	kind, reason string
+}
+
+func (e *httpError) Error() string { return e.kind + ": " + e.reason }
+
+var (
+	errNotFound   = &httpError{http.StatusNotFound, "not_found", "missing"}
+	errDeleted    = &httpError{http.StatusNotFound, "not_found", "deleted"}
+	errNoDB       = &httpError{http.StatusNotFound, "not_found", "Database does not exist."}
+	errDBExists   = &httpError{http.StatusPreconditionFailed, "file_exists", "The database could not be created, the file already exists."}
+	errConflict   = &httpError{http.StatusConflict, "conflict", "Document update conflict."}
+	errBadRequest = &httpError{http.StatusBadRequest, "bad_request", "invalid request"}
+	errMethod     = &httpError{http.StatusMethodNotAllowed, "method_not_allowed", "Only GET, HEAD, PUT, POST, DELETE allowed"}
+)
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	var path []string
+	for _, seg := range strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/") {
+		seg, err := url.PathUnescape(seg)
+		if err != nil {
+			writeError(w, errBadRequest)
+			return
+		}
+		if seg != "" {
+			path = append(path, seg)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status, result, err := s.route(r, path)
+	if err != nil {
+		if he, ok := err.(*httpError); ok {
+			writeError(w, he)
+		} else {
+			writeError(w, &httpError{http.StatusBadRequest, "bad_request", err.Error()})
+		}
+		return
+	}
+	switch res := result.(type) {
+	case docResult:
+		w.Header().Set("ETag", strconv.Quote(res.doc.rev))
+		result = res.doc.json(res.id)
+	case updateResult:
+		w.Header().Set("ETag", strconv.Quote(res.Rev))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if r.Method != "HEAD" {
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+func writeError(w http.ResponseWriter, err *httpError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.kind, "reason": err.reason})
+}
+
+func (s *Server) route(r *http.Request, path []string) (int, interface{}, error) {
+	switch {
+	case len(path) == 0:
+		return http.StatusOK, map[string]string{"couchdb": "Welcome", "version": "3.3.0"}, nil
+	case path[0] == "_all_dbs":
+		names := make([]string, 0, len(s.dbs))
+		for name := range s.dbs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return http.StatusOK, names, nil
+	case len(path) == 1:
+		return s.serveDB(r, path[0])
+	}
+
+	db := s.dbs[path[0]]
+	if db == nil {
+		return 0, nil, errNoDB
+	}
+	id, rest := path[1], path[2:]
+	if (id == "_design" || id == "_local") && len(rest) > 0 {
+		id, rest = id+"/"+rest[0], rest[1:]
+	}
+	switch {
+	case id == "_all_docs":
+		return db.allDocs(r)
+	case id == "_bulk_docs" && r.Method == "POST":
+		return db.bulkDocs(r)
+	case id == "_changes":
+		return db.changes(r)
+	case id == "_security" && len(rest) == 0:
+		return db.serveSecurity(r)
+	case len(rest) == 2 && rest[0] == "_view":
+		return db.view(r, id, rest[1])
+	case len(rest) == 0 && (!strings.HasPrefix(id, "_") || strings.Contains(id, "/")):
+		return s.serveDoc(r, db, id)
+	}
+	return 0, nil, errNotFound
+}
+
+func (s *Server) serveDB(r *http.Request, name string) (int, interface{}, error) {
+	db := s.dbs[name]
+	if r.Method == "PUT" {
+		if db != nil {
+			return 0, nil, errDBExists
+		}
+		s.dbs[name] = &database{docs: make(map[string]*document)}
+		return http.StatusCreated, map[string]bool{"ok": true}, nil
+	}
+	if db == nil {
+		return 0, nil, errNoDB
+	}
+	switch r.Method {
+	case "GET", "HEAD":
+		count := 0
+		for id, doc := range db.docs {
+			if !doc.deleted && !strings.HasPrefix(id, "_local/") {
+				count++
+			}
+		}
+		return http.StatusOK, map[string]interface{}{
+			"db_name":    name,
+			"doc_count":  count,
+			"update_seq": seqString(db.seq),
+		}, nil
+	case "DELETE":
+		delete(s.dbs, name)
+		return http.StatusOK, map[string]bool{"ok": true}, nil
+	case "POST":
+		fields, err := readFields(r)
+		if err != nil {
+			return 0, nil, err
+		}
+		var id string
+		json.Unmarshal(fields["_id"], &id)
+		if id == "" {
+			s.idseq++
+			id = fmt.Sprintf("%032x", s.idseq)
+		}
+		return db.update(id, fields)
+	}
+	return 0, nil, errMethod
+}
+
+func (db *database) serveSecurity(r *http.Request) (int, interface{}, error) {
+	switch r.Method {
+	case "GET":
+		if db.security == nil {
+			return http.StatusOK, struct{}{}, nil
+		}
+		return http.StatusOK, db.security, nil
+	case "PUT":
+		obj, err := readFields(r)
+		if err != nil {
+			return 0, nil, err
+		}
+		db.security, _ = json.Marshal(obj)
+		return http.StatusOK, map[string]bool{"ok": true}, nil
+	}
+	return 0, nil, errMethod
+}
+
+func (s *Server) serveDoc(r *http.Request, db *database, id string) (int, interface{}, error) {
+	switch r.Method {
+	case "GET", "HEAD":
+		doc := db.docs[id]
+		if doc == nil {
+			return 0, nil, errNotFound
+		} else if doc.deleted {
+			return 0, nil, errDeleted
+		}
+		return http.StatusOK, docResult{id, doc}, nil
+	case "PUT":
+		fields, err := readFields(r)
+		if err != nil {
+			return 0, nil, err
+		}
+		if rev := requestRev(r); rev != "" {
+			fields["_rev"], _ = json.Marshal(rev)
+		}
+		return db.update(id, fields)
+	case "DELETE":
+		fields := map[string]json.RawMessage{"_deleted": json.RawMessage("true")}
+		fields["_rev"], _ = json.Marshal(requestRev(r))
+		return db.update(id, fields)
+	}
+	return 0, nil, errMethod
+}
+
+// update stores a new revision of a document. The revision given in the
+// _rev field must match the current revision.
+func (db *database) update(id string, fields map[string]json.RawMessage) (int, interface{}, error) {
+	var rev string
+	json.Unmarshal(fields["_rev"], &rev)
+	deleting := string(fields["_deleted"]) == "true"
+	cur, gen := db.docs[id], 0
+	switch {
+	case cur == nil && deleting:
+		return 0, nil, errNotFound
+	case cur == nil && rev != "":
+		return 0, nil, errConflict
+	case cur != nil && cur.deleted && deleting:
+		return 0, nil, errDeleted
+	case cur != nil && !cur.deleted && rev != cur.rev:
+		return 0, nil, errConflict
+	case cur != nil && cur.deleted && rev != "" && rev != cur.rev:
+		return 0, nil, errConflict
+	}
+	if cur != nil {
+		gen = revGeneration(cur.rev)
+	}
+	delete(fields, "_id")
+	delete(fields, "_rev")
+	doc := db.store(id, newRev(gen, fields), fields)
+	status := http.StatusCreated
+	if doc.deleted {
+		status = http.StatusOK
+	}
+	return status, updateResult{OK: true, ID: id, Rev: doc.rev}, nil
+}
+
+func (db *database) bulkDocs(r *http.Request) (int, interface{}, error) {
+	var req struct {
+		Docs []map[string]json.RawMessage `json:"docs"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return 0, nil, err
+	}
+	results := make([]interface{}, len(req.Docs))
+	for i, fields := range req.Docs {
+		var id string
+		json.Unmarshal(fields["_id"], &id)
+		if id == "" {
+			id = fmt.Sprintf("%032x", md5.Sum([]byte(fmt.Sprint(db.seq, i))))
+		}
+		_, res, err := db.update(id, fields)
+		if err != nil {
+			he := err.(*httpError)
+			res = map[string]interface{}{"id": id, "error": he.kind, "reason": he.reason}
+		}
+		results[i] = res
+	}
+	return http.StatusCreated, results, nil
+}
+
+func (db *database) allDocs(r *http.Request) (int, interface{}, error) {
+	q := r.URL.Query()
+	var keys []string
+	if r.Method == "POST" {
+		var req struct {
+			Keys []string `json:"keys"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return 0, nil, err
+		}
+		keys = req.Keys
+	} else if q.Get("keys") != "" {
+		if err := json.Unmarshal([]byte(q.Get("keys")), &keys); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	var rows []map[string]interface{}
+	includeDocs := q.Get("include_docs") == "true"
+	if keys != nil {
+		for _, id := range keys {
+			doc := db.docs[id]
+			if doc == nil {
+				rows = append(rows, map[string]interface{}{"key": id, "error": "not_found"})
+				continue
+			}
+			rows = append(rows, allDocsRow(id, doc, includeDocs))
+		}
+	} else {
+		var start, end string
+		json.Unmarshal([]byte(firstOf(q, "startkey", "start_key")), &start)
+		json.Unmarshal([]byte(firstOf(q, "endkey", "end_key")), &end)
+		inclusive := q.Get("inclusive_end") != "false"
+		for _, id := range db.sortedIDs() {
+			doc := db.docs[id]
+			if doc.deleted || strings.HasPrefix(id, "_local/") || id < start {
+				continue
+			}
+			if end != "" && (id > end || !inclusive && id == end) {
+				break
+			}
+			rows = append(rows, allDocsRow(id, doc, includeDocs))
+		}
+		if q.Get("descending") == "true" {
+			for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+				rows[i], rows[j] = rows[j], rows[i]
+			}
+		}
+	}
+	if limit, err := strconv.Atoi(q.Get("limit")); err == nil && limit < len(rows) {
+		rows = rows[:limit]
+	}
+	if rows == nil {
+		rows = []map[string]interface{}{}
+	}
+	return http.StatusOK, allDocsResult{TotalRows: len(db.docs), Rows: rows}, nil
+}
+
+func allDocsRow(id string, doc *document, includeDocs bool) map[string]interface{} {
+	value := map[string]interface{}{"rev": doc.rev}
+	if doc.deleted {
+		value["deleted"] = true
+	}
+	row := map[string]interface{}{"id": id, "key": id, "value": value}
+	if includeDocs {
+		row["doc"] = nil
+		if !doc.deleted {
+			row["doc"] = doc.json(id)
+		}
+	}
+	return row
+}
+
+func (db *database) changes(r *http.Request) (int, interface{}, error) {
+	q := r.URL.Query()
+	if feed := q.Get("feed"); feed != "" && feed != "normal" && feed != "longpoll" {
+		return 0, nil, &httpError{http.StatusBadRequest, "bad_request", "unsupported feed mode " + feed}
+	}
+	since := 0
+	if s := q.Get("since"); s != "" && s != "now" {
+		since, _ = strconv.Atoi(strings.SplitN(s, "-", 2)[0])
+	} else if s == "now" {
+		since = db.seq
+	}
+
+	ids := db.sortedIDs()
+	sort.Slice(ids, func(i, j int) bool { return db.docs[ids[i]].seq < db.docs[ids[j]].seq })
+	results := []map[string]interface{}{}
+	lastSeq := since
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil {
+		limit = -1
+	}
+	for _, id := range ids {
+		doc := db.docs[id]
+		if doc.seq <= since || strings.HasPrefix(id, "_local/") {
+			continue
+		}
+		if limit >= 0 && len(results) == limit {
+			break
+		}
+		row := map[string]interface{}{
+			"seq":     seqString(doc.seq),
+			"id":      id,
+			"changes": []map[string]string{{"rev": doc.rev}},
+		}
+		if doc.deleted {
+			row["deleted"] = true
+		}
+		if q.Get("include_docs") == "true" {
+			row["doc"] = doc.json(id)
+		}
+		results = append(results, row)
+		lastSeq = doc.seq
+	}
+	return http.StatusOK, changesResult{Results: results, LastSeq: seqString(lastSeq)}, nil
+}
+
+func (db *database) view(r *http.Request, ddoc, view string) (int, interface{}, error) {
+	query := r.URL.Query().Encode()
+	var fallback *ViewFixture
+	for i := range db.views {
+		v := &db.views[i]
+		if "_design/"+v.DDoc != ddoc && v.DDoc != ddoc || v.View != view {
+			continue
+		}
+		if v.Query == query {
+			return http.StatusOK, v.Result, nil
+		} else if v.Query == "" && fallback == nil {
+			fallback = v
+		}
+	}
+	if fallback != nil {
+		return http.StatusOK, fallback.Result, nil
+	}
+	return 0, nil, &httpError{http.StatusNotFound, "not_found", "no fixture for view " + ddoc + "/_view/" + view}
+}
+
+func (db *database) sortedIDs() []string {
+	ids := make([]string, 0, len(db.docs))
+	for id := range db.docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func seqString(seq int) string {
+	return strconv.Itoa(seq) + "-fake"
+}
+
+func readFields(r *http.Request) (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	dec := json.NewDecoder(r.Body)
+	if err := dec.Decode(&fields); err != nil {
+		return nil, &httpError{http.StatusBadRequest, "bad_request", "invalid JSON body"}
+	}
+	if fields == nil {
+		return nil, &httpError{http.StatusBadRequest, "bad_request", "document must be an object"}
+	}
+	return fields, nil
+}
+
+// requestRev returns the revision given in the rev parameter or
+// If-Match header.
+func requestRev(r *http.Request) string {
+	if rev := r.URL.Query().Get("rev"); rev != "" {
+		return rev
+	}
+	if rev, err := strconv.Unquote(r.Header.Get("If-Match")); err == nil {
+		return rev
+	}
+	return r.Header.Get("If-Match")
+}
+
+func firstOf(q url.Values, keys ...string) string {
+	for _, k := range keys {
+		if v := q.Get(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,119 @@
+package couchtest
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+type testDocument struct {
+	Rev   string `json:"_rev,omitempty"`
+	Field int64  `json:"field"`
+}
+
+func check(t *testing.T, field string, expected, actual interface{}) {
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("%s mismatch:\nwant %#v\ngot  %#v", field, expected, actual)
+	}
+}
+
+func TestServerDocuments(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	db, err := srv.Client().CreateDB("db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rev, err := db.Put("doc", &testDocument{Field: 1}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Put("doc", &testDocument{Field: 2}, ""); !couchdb.Conflict(err) {
+		t.Errorf("expected conflict, got %v", err)
+	}
+	rev2, err := db.Put("doc", &testDocument{Field: 2}, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "rev generation", "2-", rev2[:2])
+
+	var doc testDocument
+	if err := db.Get("doc", &doc, nil); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "doc", testDocument{Rev: rev2, Field: 2}, doc)
+	if r, err := db.Rev("doc"); err != nil || r != rev2 {
+		t.Errorf("Rev returned %q, %v", r, err)
+	}
+
+	if _, err := db.Delete("doc", rev2); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Get("doc", &doc, nil); !couchdb.NotFound(err) {
+		t.Errorf("expected not found after delete, got %v", err)
+	}
+}
+
+func TestServerChanges(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	db, _ := srv.Client().CreateDB("db")
+	db.Put("a", &testDocument{Field: 1}, "")
+	revb, _ := db.Put("b", &testDocument{Field: 2}, "")
+	db.Delete("b", revb)
+
+	feed, err := db.Changes(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	var deleted []bool
+	for feed.Next() {
+		ids = append(ids, feed.ID)
+		deleted = append(deleted, feed.Deleted)
+	}
+	if err := feed.Err(); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "ids", []string{"a", "b"}, ids)
+	check(t, "deleted", []bool{false, true}, deleted)
+	check(t, "last seq", "3-fake", feed.LastSeq())
+
+	feed, _ = db.Changes(couchdb.Options{"since": "1-fake"})
+	ids = nil
+	for feed.Next() {
+		ids = append(ids, feed.ID)
+	}
+	check(t, "ids since 1", []string{"b"}, ids)
+}
+
+func TestServerAllDocs(t *testing.T) {
+	srv := NewServer(&Fixture{
+		DB: "db",
+		Docs: []json.RawMessage{
+			json.RawMessage(`{"_id": "b", "_rev": "1-b", "field": 2}`),
+			json.RawMessage(`{"_id": "a", "_rev": "3-a", "field": 1}`),
+			json.RawMessage(`{"_id": "c", "field": 3}`),
+		},
+	})
+	defer srv.Close()
+
+	var result struct {
+		Rows []struct {
+			ID  string       `json:"id"`
+			Doc testDocument `json:"doc"`
+		} `json:"rows"`
+	}
+	db := srv.Client().DB("db")
+	err := db.AllDocs(&result, couchdb.Options{"include_docs": true, "endkey": "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "rows", 2, len(result.Rows))
+	check(t, "row 0 id", "a", result.Rows[0].ID)
+	check(t, "row 0 doc", testDocument{Rev: "3-a", Field: 1}, result.Rows[0].Doc)
+	check(t, "row 1 id", "b", result.Rows[1].ID)
+}
@@ -0,0 +1,123 @@
+// Package couchusers implements the database-per-user pattern of CouchDB.
+//
+// Every user gets a private database that only the user (and server admins)
+// can access. Database names are derived from user names like the
+// couch_peruser feature of CouchDB does it: "userdb-" followed by the
+// hex-encoded user name. This makes the name valid for any user name.
+//
+// Provision creates the database, sets its security object and deploys
+// a baseline design document. All steps are idempotent, so Provision can
+// be called on every login or from several processes at once.
+package couchusers
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/fjl/go-couchdb"
+)
+
+// Options configures a Provisioner.
+type Options struct {
+	// Prefix is prepended to the hex-encoded user name to form
+	// the database name. The default is "userdb-".
+	Prefix string
+
+	// AdminRoles are granted admin rights on all user databases,
+	// e.g. a role used by backend services. Server admins always
+	// have access.
+	AdminRoles []string
+
+	// Design is stored in every user database if non-nil, e.g. to
+	// install a validate_doc_update function. Existing design
+	// documents with the same ID are replaced if their content differs.
+	Design *couchdb.Design
+}
+
+// Provisioner creates user databases.
+type Provisioner struct {
+	client *couchdb.Client
+	opts   Options
+}
+
+// New creates a provisioner. The client needs server admin rights.
+func New(client *couchdb.Client, opts Options) *Provisioner {
+	if opts.Prefix == "" {
+		opts.Prefix = "userdb-"
+	}
+	return &Provisioner{client: client, opts: opts}
+}
+
+// DBName returns the name of the database of the given user.
+func (p *Provisioner) DBName(user string) string {
+	return p.opts.Prefix + hex.EncodeToString([]byte(user))
+}
+
+// DB returns the database of the given user. It does not check
+// whether the database exists.
+func (p *Provisioner) DB(user string) *couchdb.DB {
+	return p.client.DB(p.DBName(user))
+}
+
+// Provision creates the database of the given user if it doesn't exist,
+// grants access to the user only and deploys the design document.
+func (p *Provisioner) Provision(user string) (*couchdb.DB, error) {
+	if user == "" {
+		return nil, errors.New("couchusers: empty user name")
+	}
+	db, err := p.client.EnsureDB(p.DBName(user))
+	if err != nil {
+		return nil, err
+	}
+	secobj := &couchdb.Security{
+		Admins:  couchdb.Members{Roles: p.opts.AdminRoles},
+		Members: couchdb.Members{Names: []string{user}},
+	}
+	if err := db.PutSecurity(secobj); err != nil {
+		return nil, err
+	}
+	if p.opts.Design != nil {
+		if err := putDesign(db, p.opts.Design); err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// putDesign stores d unless the database already contains it.
+func putDesign(db *couchdb.DB, d *couchdb.Design) error {
+	want := *d
+	want.ID, want.Rev = designID(want.ID), ""
+	wantJSON, err := json.Marshal(&want)
+	if err != nil {
+		return err
+	}
+	_, err = db.Update(want.ID, func(raw json.RawMessage) (interface{}, error) {
+		if raw != nil {
+			var cur couchdb.Design
+			if err := json.Unmarshal(raw, &cur); err != nil {
+				return nil, err
+			}
+			cur.Rev = ""
+			curJSON, err := json.Marshal(&cur)
+			if err != nil {
+				return nil, err
+			}
+			if bytes.Equal(curJSON, wantJSON) {
+				return nil, nil // already deployed
+			}
+		}
+		return &want, nil
+	})
+	return err
+}
+
+func designID(name string) string {
+	if strings.HasPrefix(name, "_design/") {
+		return name
+	}
+	return "_design/" + name
+}
@@ -0,0 +1,74 @@
+package couchusers_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+	"github.com/fjl/go-couchdb/couchtest"
+	"github.com/fjl/go-couchdb/couchusers"
+)
+
+func check(t *testing.T, field string, expected, actual interface{}) {
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("%s mismatch:\nwant %#v\ngot  %#v", field, expected, actual)
+	}
+}
+
+func TestProvision(t *testing.T) {
+	srv := couchtest.NewServer()
+	defer srv.Close()
+	p := couchusers.New(srv.Client(), couchusers.Options{
+		AdminRoles: []string{"backend"},
+		Design: &couchdb.Design{
+			ID:                "app",
+			ValidateDocUpdate: "function(doc) {}",
+		},
+	})
+	check(t, "DBName", "userdb-616c696365", p.DBName("alice"))
+
+	// Provisioning twice must not fail or create a new design revision.
+	var revs []string
+	for i := 0; i < 2; i++ {
+		db, err := p.Provision("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, "db name", "userdb-616c696365", db.Name())
+		rev, err := db.Rev("_design/app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		revs = append(revs, rev)
+	}
+	check(t, "design revs equal", revs[0], revs[1])
+
+	secobj, err := p.DB("alice").Security()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "members", couchdb.Members{Names: []string{"alice"}}, secobj.Members)
+	check(t, "admins", couchdb.Members{Roles: []string{"backend"}}, secobj.Admins)
+
+	// A changed design document is replaced.
+	design, err := p.DB("alice").GetDesign("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	design.ValidateDocUpdate = "function(doc) { throw 'x'; }"
+	if _, err := p.DB("alice").PutDesign(design); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Provision("alice"); err != nil {
+		t.Fatal(err)
+	}
+	design, err = p.DB("alice").GetDesign("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "restored validate_doc_update", "function(doc) {}", design.ValidateDocUpdate)
+
+	if _, err := p.Provision(""); err == nil {
+		t.Error("expected error for empty user name")
+	}
+}
@@ -0,0 +1,123 @@
+package couchdb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxDBNameLen is the longest database name accepted by CouchDB.
+const maxDBNameLen = 238
+
+// systemDBs are the database names beginning with an underscore
+// that are accepted by CouchDB.
+var systemDBs = []string{"_users", "_replicator", "_global_changes", "_dbs", "_nodes"}
+
+// DBNameMode controls the client-side checks of database names
+// performed by Client.DB, CreateDB and DeleteDB.
+type DBNameMode int
+
+const (
+	DBNameUnchecked DBNameMode = iota // names are sent as given (default)
+	DBNameStrict                      // invalid names are rejected
+	DBNameNormalize                   // names are normalized by NormalizeDBName
+)
+
+// SetDBNameMode sets how database names are checked. In strict and
+// normalize mode, invalid names are reported without contacting the server.
+// Since DB does not return an error, all requests of a database object
+// with an invalid name fail with a *DBNameError.
+func (c *Client) SetDBNameMode(mode DBNameMode) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dbNameMode = mode
+}
+
+// DBNameError is returned for invalid database names.
+type DBNameError struct {
+	Name   string
+	Reason string
+}
+
+func (e *DBNameError) Error() string {
+	return fmt.Sprintf("couchdb: invalid database name %q: %s", e.Name, e.Reason)
+}
+
+// ValidateDBName checks whether name is a valid database name. Names must
+// begin with a lowercase letter and contain only lowercase letters, digits
+// and the characters _$()+-/. They can be at most 238 characters long.
+// System databases such as _users are accepted as well. The returned error
+// is a *DBNameError.
+func ValidateDBName(name string) error {
+	switch {
+	case name == "":
+		return &DBNameError{name, "empty name"}
+	case len(name) > maxDBNameLen:
+		return &DBNameError{name, fmt.Sprintf("longer than %d characters", maxDBNameLen)}
+	case isSystemDB(name):
+		return nil
+	case name[0] < 'a' || name[0] > 'z':
+		return &DBNameError{name, "must begin with a lowercase letter"}
+	}
+	for _, c := range name {
+		if !validDBNameChar(c) {
+			return &DBNameError{name, fmt.Sprintf("character %q is not allowed", c)}
+		}
+	}
+	return nil
+}
+
+// NormalizeDBName converts name into a valid database name by lowercasing
+// it and replacing disallowed characters with '_'. Names that don't begin
+// with a letter or that are too long cannot be normalized.
+func NormalizeDBName(name string) (string, error) {
+	if isSystemDB(name) {
+		return name, nil
+	}
+	var b strings.Builder
+	for _, c := range strings.ToLower(name) {
+		if !validDBNameChar(c) {
+			c = '_'
+		}
+		b.WriteRune(c)
+	}
+	normalized := b.String()
+	if err := ValidateDBName(normalized); err != nil {
+		return "", &DBNameError{name, err.(*DBNameError).Reason}
+	}
+	return normalized, nil
+}
+
+func validDBNameChar(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.ContainsRune("_$()+-/", c)
+}
+
+// isSystemDB reports whether name is a system database. Names like
+// "prefix/_users" are used by some applications for per-tenant databases.
+func isSystemDB(name string) bool {
+	if containsString(systemDBs, name) {
+		return true
+	}
+	if i := strings.LastIndexByte(name, '/'); i > 0 && (name[i+1:] == "_users" || name[i+1:] == "_replicator") {
+		return ValidateDBName(name[:i]) == nil
+	}
+	return false
+}
+
+// checkDBName applies the name mode of the client.
+func (t *transport) checkDBName(name string) (string, error) {
+	t.mu.RLock()
+	mode := t.dbNameMode
+	t.mu.RUnlock()
+	switch mode {
+	case DBNameStrict:
+		return name, ValidateDBName(name)
+	case DBNameNormalize:
+		normalized, err := NormalizeDBName(name)
+		if err != nil {
+			return name, err
+		}
+		return normalized, nil
+	default:
+		return name, nil
+	}
+}
@@ -0,0 +1,120 @@
+package couchdb
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// SetDebugCapture makes the client keep up to n bytes of the request and
+// response bodies of failed requests. They are available in the RequestBody
+// and ResponseBody fields of the returned *Error, which helps reproducing
+// requests that CouchDB rejects.
+//
+// Bodies can contain passwords and document content, so capture is off by
+// default and should only be enabled while diagnosing a problem. Captured
+// bodies are never included in the error message. Use zero to disable
+// capture.
+func (c *Client) SetDebugCapture(n int) {
+	c.transport.mu.Lock()
+	c.transport.debugCapture = n
+	c.transport.mu.Unlock()
+}
+
+func (t *transport) debugCaptureLimit() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.debugCapture
+}
+
+// captureBuffer keeps the first bytes written to it. It is written
+// by the HTTP client while the request body is sent, which may still
+// be happening when the response arrives.
+type captureBuffer struct {
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	limit int
+}
+
+func (b *captureBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n := b.limit - b.buf.Len(); n < len(p) {
+		b.buf.Write(p[:n])
+	} else {
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+func (b *captureBuffer) reset() {
+	b.mu.Lock()
+	b.buf.Reset()
+	b.mu.Unlock()
+}
+
+func (b *captureBuffer) bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.buf.Len() == 0 {
+		return nil
+	}
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+type captureBody struct {
+	io.ReadCloser
+	w io.Writer
+}
+
+func (b *captureBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.w.Write(p[:n])
+	return n, err
+}
+
+// captureRequest makes req record its body in a captureBuffer. Bodies
+// obtained through GetBody, e.g. when the request is retried with new
+// credentials, replace the content of the buffer.
+func captureRequest(req *http.Request, limit int) *captureBuffer {
+	buf := &captureBuffer{limit: limit}
+	if req.Body == nil || req.Body == http.NoBody {
+		return buf
+	}
+	req.Body = &captureBody{req.Body, buf}
+	if getBody := req.GetBody; getBody != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			buf.reset()
+			return &captureBody{body, buf}, nil
+		}
+	}
+	return buf
+}
+
+// captureError parses the error response of a request
+// and attaches the captured bodies to the error.
+func captureError(req *http.Request, resp *http.Response, reqBody *captureBuffer, limit int) error {
+	body, rerr := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	err := parseError(req, resp)
+	if e, ok := err.(*Error); ok {
+		if len(body) > limit {
+			body = body[:limit]
+		}
+		if len(body) > 0 {
+			e.ResponseBody = body
+		}
+		e.RequestBody = reqBody.bytes()
+	}
+	if rerr != nil && err == nil {
+		err = rerr
+	}
+	return err
+}
@@ -0,0 +1,45 @@
+package couchdb_test
+
+import (
+	"io"
+	"io/ioutil"
+	. "net/http"
+	"strings"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestDebugCapture(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("PUT /db/doc", func(resp ResponseWriter, req *Request) {
+		ioutil.ReadAll(req.Body)
+		resp.WriteHeader(StatusBadRequest)
+		io.WriteString(resp, `{"error": "bad_request", "reason": "Invalid rev format"}`)
+	})
+	doc := map[string]string{"secret": "hunter2"}
+
+	// Bodies are not captured by default.
+	_, err := c.DB("db").Put("doc", doc, "x")
+	cerr, ok := err.(*couchdb.Error)
+	if !ok {
+		t.Fatalf("expected *couchdb.Error, got %#v", err)
+	}
+	check(t, "RequestBody", []byte(nil), cerr.RequestBody)
+	check(t, "ResponseBody", []byte(nil), cerr.ResponseBody)
+
+	c.SetDebugCapture(16)
+	_, err = c.DB("db").Put("doc", doc, "x")
+	cerr = err.(*couchdb.Error)
+	check(t, "ErrorCode", "bad_request", cerr.ErrorCode)
+	check(t, "Reason", "Invalid rev format", cerr.Reason)
+	check(t, "RequestBody", `{"secret":"hunte`, string(cerr.RequestBody))
+	check(t, "ResponseBody", `{"error": "bad_r`, string(cerr.ResponseBody))
+	if strings.Contains(err.Error(), "hunte") {
+		t.Errorf("error message contains request body: %s", err)
+	}
+
+	c.SetDebugCapture(0)
+	_, err = c.DB("db").Put("doc", doc, "x")
+	check(t, "RequestBody after disabling", []byte(nil), err.(*couchdb.Error).RequestBody)
+}
@@ -0,0 +1,243 @@
+package couchdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Design is a design document.
+type Design struct {
+	ID       string `json:"_id"` // always starts with "_design/"
+	Rev      string `json:"_rev,omitempty"`
+	Language string `json:"language,omitempty"`
+
+	Views   map[string]View   `json:"views,omitempty"`
+	Filters map[string]string `json:"filters,omitempty"`
+	Updates map[string]string `json:"updates,omitempty"`
+	Shows   map[string]string `json:"shows,omitempty"`
+	Lists   map[string]string `json:"lists,omitempty"`
+
+	ValidateDocUpdate string                 `json:"validate_doc_update,omitempty"`
+	Options           map[string]interface{} `json:"options,omitempty"`
+	Rewrites          *Rewrites              `json:"rewrites,omitempty"`
+
+	// ViewLib contains the CommonJS modules of views, which are
+	// stored under the "lib" key of the views object.
+	ViewLib json.RawMessage `json:"-"`
+
+	// Extra contains all other fields of the document,
+	// e.g. "_attachments".
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// View is a view definition in a design document.
+type View struct {
+	Map    string `json:"map"`
+	Reduce string `json:"reduce,omitempty"`
+}
+
+// Rewrites are the URL rewriting rules of a design document, used by the
+// _rewrite handler. CouchDB accepts either a list of rules or, since
+// version 2.0, the source of a JavaScript function. Exactly one of the
+// fields should be set.
+type Rewrites struct {
+	Rules    []RewriteRule
+	Function string
+}
+
+// RewriteRule is a rule of the rewrites list. From and To may
+// contain :variable and * placeholders.
+type RewriteRule struct {
+	From   string                 `json:"from"`
+	To     string                 `json:"to"`
+	Method string                 `json:"method,omitempty"`
+	Query  map[string]interface{} `json:"query,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r *Rewrites) MarshalJSON() ([]byte, error) {
+	if r.Function != "" {
+		return json.Marshal(r.Function)
+	}
+	if r.Rules == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(r.Rules)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (r *Rewrites) UnmarshalJSON(input []byte) error {
+	*r = Rewrites{}
+	if len(input) > 0 && input[0] == '"' {
+		return json.Unmarshal(input, &r.Function)
+	}
+	return json.Unmarshal(input, &r.Rules)
+}
+
+// designFields is used to prevent recursion in the JSON methods.
+type designFields Design
+
+// MarshalJSON implements json.Marshaler.
+func (d *Design) MarshalJSON() ([]byte, error) {
+	known, err := json.Marshal((*designFields)(d))
+	if err != nil || (len(d.Extra) == 0 && d.ViewLib == nil) {
+		return known, err
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(known, &obj); err != nil {
+		return nil, err
+	}
+	for k, v := range d.Extra {
+		if _, ok := obj[k]; !ok {
+			obj[k] = v
+		}
+	}
+	if d.ViewLib != nil {
+		views := make(map[string]json.RawMessage, len(d.Views)+1)
+		if err := json.Unmarshal(obj["views"], &views); obj["views"] != nil && err != nil {
+			return nil, err
+		}
+		views["lib"] = d.ViewLib
+		if obj["views"], err = json.Marshal(views); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(obj)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Design) UnmarshalJSON(input []byte) error {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(input, &obj); err != nil {
+		return err
+	}
+	var lib json.RawMessage
+	if views, ok := obj["views"]; ok {
+		var vobj map[string]json.RawMessage
+		if err := json.Unmarshal(views, &vobj); err != nil {
+			return err
+		}
+		if lib = vobj["lib"]; lib != nil {
+			delete(vobj, "lib")
+			obj["views"], _ = json.Marshal(vobj)
+		}
+	}
+	var known designFields
+	stripped, _ := json.Marshal(obj)
+	if err := json.Unmarshal(stripped, &known); err != nil {
+		return err
+	}
+	known.ViewLib = lib
+	*d = Design(known)
+	for _, k := range designKeys {
+		delete(obj, k)
+	}
+	if len(obj) > 0 {
+		d.Extra = obj
+	}
+	return nil
+}
+
+var designKeys = []string{
+	"_id", "_rev", "language", "views", "filters", "updates", "shows", "lists",
+	"validate_doc_update", "options", "rewrites",
+}
+
+// designID adds the "_design/" prefix to name if it is missing.
+func designID(name string) string {
+	if strings.HasPrefix(name, "_design/") {
+		return name
+	}
+	return "_design/" + name
+}
+
+// GetDesign retrieves a design document.
+// The "_design/" prefix of name is optional.
+func (db *DB) GetDesign(name string) (*Design, error) {
+	d := new(Design)
+	if err := db.Get(designID(name), d, nil); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// PutDesign stores a design document. The document's ID is prefixed with
+// "_design/" if necessary and d.Rev is used as the current revision. When
+// the document has been stored, d.Rev is set to the new revision.
+func (db *DB) PutDesign(d *Design) (newrev string, err error) {
+	d.ID = designID(d.ID)
+	newrev, err = db.Put(d.ID, d, d.Rev)
+	if err == nil {
+		d.Rev = newrev
+	}
+	return newrev, err
+}
+
+// Rewrite sends a request to the _rewrite handler of a design document.
+// The "_design/" prefix of ddoc is optional. The path is relative to the
+// handler and is not escaped, so it may contain a query string. The caller
+// must close the body of the returned response.
+func (db *DB) Rewrite(method, ddoc, path string, body io.Reader) (*http.Response, error) {
+	p := db.path().docID(designID(ddoc)).addRaw("_rewrite")
+	if path = strings.TrimPrefix(path, "/"); path != "" {
+		p.addRaw(path)
+	}
+	return db.request(method, p.path(), body)
+}
+
+// TempView runs an ad-hoc view that is not stored in a design document.
+// This is meant for developing views; it is slow because the index is
+// built from scratch for every call.
+//
+// CouchDB 1.x supports this through the _temp_view endpoint. Later
+// versions reject such requests, and TempView falls back to storing the
+// view in a throwaway design document, which is deleted after the query.
+// The reduce function is optional.
+func (db *DB) TempView(mapFn, reduceFn string, result interface{}, opts Options) error {
+	opts = db.options(opts)
+	if err := ValidateViewOptions(opts); err != nil {
+		return err
+	}
+	path, err := db.path().addRaw("_temp_view").options(opts, viewJsonKeys)
+	if err != nil {
+		return err
+	}
+	view := View{Map: mapFn, Reduce: reduceFn}
+	body, err := json.Marshal(view)
+	if err != nil {
+		return err
+	}
+	resp, err := db.request("POST", path, bytes.NewReader(body))
+	switch {
+	case err == nil:
+		return db.readBody(resp, result)
+	case ErrorStatus(err, http.StatusGone) || NotFound(err) || ErrorStatus(err, http.StatusBadRequest):
+		return db.throwawayView(view, result, opts)
+	default:
+		return err
+	}
+}
+
+// throwawayView queries a view stored in a temporary design document.
+func (db *DB) throwawayView(view View, result interface{}, opts Options) error {
+	d := &Design{
+		ID:       fmt.Sprintf("_design/tmp-%016x", randUint64()),
+		Language: "javascript",
+		Views:    map[string]View{"view": view},
+	}
+	if _, err := db.PutDesign(d); err != nil {
+		return err
+	}
+	err := db.View(d.ID, "view", result, opts)
+	if _, delErr := db.Delete(d.ID, d.Rev); delErr != nil && err == nil {
+		err = fmt.Errorf("couchdb: can't delete temporary design document %s: %v", d.ID, delErr)
+	}
+	// Remove the index files. This requires admin rights,
+	// so failure is not reported.
+	db.ViewCleanup()
+	return err
+}
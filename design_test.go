@@ -0,0 +1,207 @@
+package couchdb_test
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	. "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestGetPutDesign(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/_design/app", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{
+			"_id": "_design/app",
+			"_rev": "1-619db7ba8551c0de3f3a178775509611",
+			"language": "javascript",
+			"views": {
+				"lib": {"util": "exports.x = 1;"},
+				"by_x": {"map": "function (doc) { emit(doc.x); }", "reduce": "_count"}
+			},
+			"rewrites": [{"from": "/", "to": "index.html"}],
+			"couchapp": {"name": "app"}
+		}`)
+	})
+	c.Handle("PUT /db/_design/app", func(resp ResponseWriter, req *Request) {
+		var body, expected map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&body)
+		json.Unmarshal([]byte(`{
+			"_id": "_design/app",
+			"_rev": "1-619db7ba8551c0de3f3a178775509611",
+			"language": "javascript",
+			"views": {
+				"lib": {"util": "exports.x = 1;"},
+				"by_x": {"map": "function (doc) { emit(doc.x); }", "reduce": "_count"},
+				"by_y": {"map": "function (doc) { emit(doc.y); }"}
+			},
+			"rewrites": [{"from": "/", "to": "index.html"}],
+			"couchapp": {"name": "app"}
+		}`), &expected)
+		check(t, "request body", expected, body)
+		resp.Header().Set("ETag", `"2-619db7ba8551c0de3f3a178775509611"`)
+		resp.WriteHeader(StatusCreated)
+		io.WriteString(resp, `{"id": "_design/app", "ok": true, "rev": "2-619db7ba8551c0de3f3a178775509611"}`)
+	})
+
+	db := c.DB("db")
+	d, err := db.GetDesign("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "d.ID", "_design/app", d.ID)
+	check(t, "d.Views", map[string]couchdb.View{
+		"by_x": {Map: "function (doc) { emit(doc.x); }", Reduce: "_count"},
+	}, d.Views)
+	check(t, "d.ViewLib", json.RawMessage(`{"util": "exports.x = 1;"}`), d.ViewLib)
+	check(t, "d.Rewrites", &couchdb.Rewrites{
+		Rules: []couchdb.RewriteRule{{From: "/", To: "index.html"}},
+	}, d.Rewrites)
+	check(t, "d.Extra", map[string]json.RawMessage{
+		"couchapp": json.RawMessage(`{"name": "app"}`),
+	}, d.Extra)
+
+	d.Views["by_y"] = couchdb.View{Map: "function (doc) { emit(doc.y); }"}
+	newrev, err := db.PutDesign(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "newrev", "2-619db7ba8551c0de3f3a178775509611", newrev)
+	check(t, "d.Rev", newrev, d.Rev)
+}
+
+func TestDesignRewrites(t *testing.T) {
+	var d couchdb.Design
+	input := `{"_id": "_design/app", "rewrites": "function (req) { return {path: '/db/_all_docs'}; }"}`
+	if err := json.Unmarshal([]byte(input), &d); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "d.Rewrites", &couchdb.Rewrites{Function: "function (req) { return {path: '/db/_all_docs'}; }"}, d.Rewrites)
+	enc, err := json.Marshal(&d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "encoded", `{"_id":"_design/app","rewrites":"function (req) { return {path: '/db/_all_docs'}; }"}`, string(enc))
+}
+
+func TestRewrite(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("POST /db/_design/app/_rewrite/api/items", func(resp ResponseWriter, req *Request) {
+		check(t, "query", "limit=2", req.URL.RawQuery)
+		io.WriteString(resp, `{"ok": true}`)
+	})
+
+	resp, err := c.DB("db").Rewrite("POST", "app", "/api/items?limit=2", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	check(t, "status", StatusOK, resp.StatusCode)
+}
+
+func TestDesignSetValidation(t *testing.T) {
+	d := &couchdb.Design{ID: "app"}
+	d.SetValidation(couchdb.RequireRoles("editor"), couchdb.ImmutableFields("type"))
+	expected := `function (newDoc, oldDoc, userCtx, secObj) {
+  var userRoles = userCtx.roles || [];
+  if (userRoles.indexOf("_admin") === -1 && !["editor"].some(function (r) {
+    return userRoles.indexOf(r) !== -1;
+  })) {
+    throw({unauthorized: "writing requires one of the roles: editor"});
+  }
+  if (oldDoc && !oldDoc._deleted && !newDoc._deleted) {
+    ["type"].forEach(function (f) {
+      if (JSON.stringify(newDoc[f]) !== JSON.stringify(oldDoc[f])) {
+        throw({forbidden: "field cannot be changed: " + f});
+      }
+    });
+  }
+}`
+	check(t, "d.ValidateDocUpdate", expected, d.ValidateDocUpdate)
+
+	// Field names are encoded as JavaScript strings.
+	js := couchdb.ValidateFunc(couchdb.RequireFields(`a"b`, "c"))
+	if !strings.Contains(js, `["a\"b","c"].forEach`) {
+		t.Errorf("field names not escaped:\n%s", js)
+	}
+}
+
+func TestTempView(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("POST /db/_temp_view", func(resp ResponseWriter, req *Request) {
+		check(t, "query", "key=%22x%22", req.URL.RawQuery)
+		body, _ := ioutil.ReadAll(req.Body)
+		check(t, "request body", `{"map":"function (doc) { emit(doc.x); }"}`, string(body))
+		io.WriteString(resp, `{"rows": [{"key": "x", "value": null}]}`)
+	})
+
+	var result struct{ Rows []struct{ Key string } }
+	err := c.DB("db").TempView("function (doc) { emit(doc.x); }", "", &result, couchdb.Options{"key": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "rows", 1, len(result.Rows))
+}
+
+func TestTempViewThrowawayDesign(t *testing.T) {
+	var requests []string
+	var ddoc string
+	srv := httptest.NewServer(HandlerFunc(func(resp ResponseWriter, req *Request) {
+		path := req.URL.EscapedPath()
+		defer func() {
+			if ddoc != "" {
+				path = strings.Replace(path, ddoc, "DDOC", 1)
+			}
+			requests = append(requests, req.Method+" "+path)
+		}()
+		switch {
+		case path == "/db/_temp_view":
+			resp.WriteHeader(StatusGone)
+			io.WriteString(resp, `{"error": "gone", "reason": "Temporary views are not supported in CouchDB"}`)
+		case req.Method == "PUT":
+			var d couchdb.Design
+			json.NewDecoder(req.Body).Decode(&d)
+			check(t, "views", map[string]couchdb.View{"view": {Map: "function (doc) {}", Reduce: "_count"}}, d.Views)
+			ddoc = strings.TrimPrefix(path, "/db/")
+			resp.Header().Set("ETag", `"1-x"`)
+			resp.WriteHeader(StatusCreated)
+			io.WriteString(resp, `{"ok": true, "rev": "1-x"}`)
+		case req.Method == "GET":
+			check(t, "query", "group=true", req.URL.RawQuery)
+			io.WriteString(resp, `{"rows": [{"key": null, "value": 3}]}`)
+		case req.Method == "DELETE":
+			check(t, "delete rev", "1-x", req.URL.Query().Get("rev"))
+			resp.Header().Set("ETag", `"2-x"`)
+			io.WriteString(resp, `{"ok": true, "rev": "2-x"}`)
+		case path == "/db/_view_cleanup":
+			resp.WriteHeader(StatusAccepted)
+			io.WriteString(resp, `{"ok": true}`)
+		}
+	}))
+	defer srv.Close()
+	c, err := couchdb.NewClient(srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result struct{ Rows []struct{ Value int } }
+	err = c.DB("db").TempView("function (doc) {}", "_count", &result, couchdb.Options{"group": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "result", 3, result.Rows[0].Value)
+	if !strings.HasPrefix(ddoc, "_design/tmp-") {
+		t.Errorf("unexpected design doc name %q", ddoc)
+	}
+	check(t, "requests", []string{
+		"POST /db/_temp_view",
+		"PUT /db/DDOC",
+		"GET /db/DDOC/_view/view",
+		"DELETE /db/DDOC",
+		"POST /db/_view_cleanup",
+	}, requests)
+}
@@ -0,0 +1,172 @@
+package couchdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change is a changes feed event delivered by a Dispatcher or Follower.
+type Change struct {
+	ID      string
+	Seq     interface{}
+	Deleted bool
+	Revs    []string
+	Doc     json.RawMessage // set if the feed includes documents
+	Dropped int             // set on gap markers of BufferedSink
+}
+
+// change returns the current event of the feed.
+func (f *ChangesFeed) change() *Change {
+	return &Change{
+		ID:      f.ID,
+		Seq:     f.Seq,
+		Deleted: f.Deleted,
+		Revs:    f.ChangesRevs(),
+		Doc:     f.Doc,
+	}
+}
+
+// Dispatcher routes changes feed events to handlers registered for
+// document types or ID prefixes. The document type is read from the
+// TypeField of the included document, so feeds should be opened with
+// the "include_docs" option.
+//
+// Handlers for types and prefixes are functions of the form
+//
+//     func(c *couchdb.Change, doc *T) error
+//
+// where T is the type that the document is decoded into.
+//
+// Events are matched against type handlers first, then against prefix
+// handlers (longest prefix first). Events that match no handler are
+// passed to the default handler, or dropped if there is none.
+type Dispatcher struct {
+	// TypeField is the document field containing the type.
+	// The default is "type".
+	TypeField string
+
+	types    map[string]reflect.Value
+	prefixes []prefixHandler
+	fallback func(*Change) error
+}
+
+type prefixHandler struct {
+	prefix string
+	fn     reflect.Value
+}
+
+var (
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	changeType = reflect.TypeOf((*Change)(nil))
+)
+
+// HandleType registers a handler for documents with the given type.
+// It panics if fn is not a valid handler function or if a handler
+// for the type is already registered.
+func (d *Dispatcher) HandleType(typ string, fn interface{}) {
+	if d.types == nil {
+		d.types = make(map[string]reflect.Value)
+	}
+	if _, ok := d.types[typ]; ok {
+		panic(fmt.Sprintf("couchdb: duplicate handler for type %q", typ))
+	}
+	d.types[typ] = checkHandler(fn)
+}
+
+// HandlePrefix registers a handler for documents whose ID starts with prefix.
+// It panics if fn is not a valid handler function.
+func (d *Dispatcher) HandlePrefix(prefix string, fn interface{}) {
+	d.prefixes = append(d.prefixes, prefixHandler{prefix, checkHandler(fn)})
+	sort.SliceStable(d.prefixes, func(i, j int) bool {
+		return len(d.prefixes[i].prefix) > len(d.prefixes[j].prefix)
+	})
+}
+
+// HandleDefault sets the handler for events that match no other handler.
+func (d *Dispatcher) HandleDefault(fn func(*Change) error) {
+	d.fallback = fn
+}
+
+func checkHandler(fn interface{}) reflect.Value {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 2 || t.NumOut() != 1 ||
+		t.In(0) != changeType || t.In(1).Kind() != reflect.Ptr || t.Out(0) != errorType {
+		panic(fmt.Sprintf("couchdb: invalid dispatcher handler type %v", t))
+	}
+	return v
+}
+
+// Run dispatches all events of the feed. It returns when the feed ends or
+// a handler returns an error. The feed is not closed.
+func (d *Dispatcher) Run(feed *ChangesFeed) error {
+	for feed.Next() {
+		if err := d.Dispatch(feed); err != nil {
+			return err
+		}
+	}
+	return feed.Err()
+}
+
+// Dispatch delivers the current event of the feed to its handler.
+func (d *Dispatcher) Dispatch(feed *ChangesFeed) error {
+	c := feed.change()
+	fn, ok := d.handler(c)
+	if !ok {
+		if d.fallback != nil {
+			return d.fallback(c)
+		}
+		return nil
+	}
+	doc := reflect.New(fn.Type().In(1).Elem())
+	if c.Doc != nil {
+		if err := feed.DB.newDecoder(bytes.NewReader(c.Doc)).Decode(doc.Interface()); err != nil {
+			return fmt.Errorf("couchdb: can't decode document %q: %v", c.ID, err)
+		}
+	}
+	out := fn.Call([]reflect.Value{reflect.ValueOf(c), doc})
+	err, _ := out[0].Interface().(error)
+	return err
+}
+
+func (d *Dispatcher) handler(c *Change) (reflect.Value, bool) {
+	if len(d.types) > 0 && c.Doc != nil {
+		if typ, ok := d.docType(c.Doc); ok {
+			if fn, ok := d.types[typ]; ok {
+				return fn, true
+			}
+		}
+	}
+	for _, h := range d.prefixes {
+		if strings.HasPrefix(c.ID, h.prefix) {
+			return h.fn, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// docType reads the type field of a document. Only the type field is
+// decoded, the document itself is decoded once by Dispatch.
+func (d *Dispatcher) docType(doc json.RawMessage) (string, bool) {
+	field := d.TypeField
+	if field == "" {
+		field = "type"
+	}
+	peek := reflect.New(reflect.StructOf([]reflect.StructField{{
+		Name: "Type",
+		Type: reflect.TypeOf((*string)(nil)),
+		Tag:  reflect.StructTag(`json:"` + field + `"`),
+	}}))
+	if json.Unmarshal(doc, peek.Interface()) != nil {
+		return "", false
+	}
+	typ, _ := peek.Elem().Field(0).Interface().(*string)
+	if typ == nil {
+		return "", false
+	}
+	return *typ, true
+}
@@ -0,0 +1,116 @@
+package couchdb_test
+
+import (
+	"errors"
+	"io"
+	. "net/http"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+type testUser struct {
+	Name string `json:"name"`
+}
+
+type testOrder struct {
+	Total int `json:"total"`
+}
+
+func TestDispatcher(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/_changes", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"results": [
+			{"seq": "1-...", "id": "u1", "changes": [{"rev": "1-a"}], "doc": {"_id": "u1", "type": "user", "name": "alice"}},
+			{"seq": "2-...", "id": "o1", "changes": [{"rev": "1-b"}], "doc": {"_id": "o1", "type": "order", "total": 5}},
+			{"seq": "3-...", "id": "cfg:main", "changes": [{"rev": "2-c"}], "deleted": true, "doc": {"_id": "cfg:main", "_deleted": true}},
+			{"seq": "4-...", "id": "other", "changes": [{"rev": "1-d"}], "doc": {"_id": "other"}}
+		], "last_seq": "4-..."}`)
+	})
+
+	var events []string
+	var d couchdb.Dispatcher
+	d.HandleType("user", func(c *couchdb.Change, u *testUser) error {
+		events = append(events, "user "+u.Name)
+		return nil
+	})
+	d.HandleType("order", func(c *couchdb.Change, o *testOrder) error {
+		check(t, "order total", 5, o.Total)
+		events = append(events, "order "+c.ID)
+		return nil
+	})
+	d.HandlePrefix("cfg:", func(c *couchdb.Change, doc *map[string]interface{}) error {
+		check(t, "c.Deleted", true, c.Deleted)
+		events = append(events, "config "+c.ID)
+		return nil
+	})
+	d.HandleDefault(func(c *couchdb.Change) error {
+		events = append(events, "default "+c.ID)
+		return nil
+	})
+
+	feed, err := c.DB("db").Changes(couchdb.Options{"include_docs": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Run(feed); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "events", []string{"user alice", "order o1", "config cfg:main", "default other"}, events)
+
+	// Handler errors stop the dispatcher.
+	handlerErr := errors.New("handler error")
+	d.HandleDefault(func(c *couchdb.Change) error { return handlerErr })
+	feed, err = c.DB("db").Changes(couchdb.Options{"include_docs": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "error", handlerErr, d.Run(feed))
+	feed.Close()
+}
+
+func TestDispatcherTypeField(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/_changes", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"results": [
+			{"seq": "1-...", "id": "u1", "changes": [{"rev": "1-a"}], "doc": {"_id": "u1", "kind": "user", "name": "alice", "type": "order"}},
+			{"seq": "2-...", "id": "x1", "changes": [{"rev": "1-b"}], "doc": {"_id": "x1", "kind": 1}},
+			{"seq": "3-...", "id": "x2", "changes": [{"rev": "1-c"}], "doc": {"_id": "x2"}}
+		], "last_seq": "3-..."}`)
+	})
+
+	var events []string
+	d := couchdb.Dispatcher{TypeField: "kind"}
+	d.HandleType("user", func(c *couchdb.Change, u *testUser) error {
+		events = append(events, "user "+u.Name)
+		return nil
+	})
+	d.HandleType("", func(c *couchdb.Change, doc *map[string]interface{}) error {
+		events = append(events, "empty type "+c.ID)
+		return nil
+	})
+	d.HandleDefault(func(c *couchdb.Change) error {
+		events = append(events, "default "+c.ID)
+		return nil
+	})
+
+	feed, err := c.DB("db").Changes(couchdb.Options{"include_docs": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer feed.Close()
+	if err := d.Run(feed); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "events", []string{"user alice", "default x1", "default x2"}, events)
+}
+
+func TestDispatcherInvalidHandler(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	var d couchdb.Dispatcher
+	d.HandleType("user", func(u testUser) error { return nil })
+}
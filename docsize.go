@@ -0,0 +1,118 @@
+package couchdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// DocSizeOptions configures the client-side document size check.
+type DocSizeOptions struct {
+	// Max is the size limit of encoded documents in bytes. Larger documents
+	// are rejected with *DocTooLargeError before anything is sent. It should
+	// match the max_document_size setting of the server, which is 8 MB by
+	// default since CouchDB 3.0. Zero disables the check.
+	Max int64
+
+	// OnWarn is called for documents larger than Warn bytes before they
+	// are sent, e.g. to log documents that are approaching the limit.
+	// The id is empty for new documents in BulkDocs that have no _id.
+	Warn   int64
+	OnWarn func(db, id string, size int64)
+}
+
+// SetDocSizeLimit enables checking the size of documents written by Put,
+// Post, PutRaw, BulkDocs and BulkDocsRaw. Without the check, CouchDB rejects
+// large documents with a generic 413 error after the whole body has been
+// uploaded.
+//
+// For BulkDocs, the documents are encoded one more time to determine their
+// sizes. Raw bodies of unknown length and the bodies of BulkDocsRaw are read
+// into memory while the check is enabled.
+func (c *Client) SetDocSizeLimit(opts DocSizeOptions) {
+	c.transport.mu.Lock()
+	c.transport.docSize = opts
+	c.transport.mu.Unlock()
+}
+
+func (t *transport) docSizeOptions() DocSizeOptions {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.docSize
+}
+
+// DocTooLargeError is returned for documents that exceed the limit
+// set by SetDocSizeLimit.
+type DocTooLargeError struct {
+	DB, ID    string
+	Size, Max int64
+}
+
+func (e *DocTooLargeError) Error() string {
+	id := e.ID
+	if id == "" {
+		id = "(new document)"
+	}
+	return fmt.Sprintf("couchdb: document %s in %s is %d bytes, exceeding the limit of %d bytes", id, e.DB, e.Size, e.Max)
+}
+
+// TooLarge checks whether the given error is a *DocTooLargeError or
+// a DatabaseError with StatusCode == 413.
+func TooLarge(err error) bool {
+	if _, ok := err.(*DocTooLargeError); ok {
+		return true
+	}
+	return ErrorStatus(err, http.StatusRequestEntityTooLarge)
+}
+
+// enabled reports whether documents need to be checked.
+func (opts DocSizeOptions) enabled() bool {
+	return opts.Max > 0 || (opts.Warn > 0 && opts.OnWarn != nil)
+}
+
+// checkDocSize checks the size of an encoded document.
+func (db *DB) checkDocSize(opts DocSizeOptions, id string, size int64) error {
+	if opts.Max > 0 && size > opts.Max {
+		return &DocTooLargeError{DB: db.name, ID: id, Size: size, Max: opts.Max}
+	}
+	if opts.OnWarn != nil && opts.Warn > 0 && size > opts.Warn {
+		opts.OnWarn(db.name, id, size)
+	}
+	return nil
+}
+
+// checkNewDocSize checks the size of an encoded document
+// whose ID is taken from its _id field.
+func (db *DB) checkNewDocSize(doc []byte) error {
+	opts := db.docSizeOptions()
+	if !opts.enabled() {
+		return nil
+	}
+	return db.checkDocSize(opts, docID(doc), int64(len(doc)))
+}
+
+// checkBulkDocSizes checks the sizes of documents for BulkDocs.
+func (db *DB) checkBulkDocSizes(docs []interface{}) error {
+	opts := db.docSizeOptions()
+	if !opts.enabled() {
+		return nil
+	}
+	for _, doc := range docs {
+		enc, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		if err := db.checkDocSize(opts, docID(enc), int64(len(enc))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func docID(doc []byte) string {
+	var meta struct {
+		ID string `json:"_id"`
+	}
+	json.Unmarshal(doc, &meta)
+	return meta.ID
+}
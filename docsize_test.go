@@ -0,0 +1,68 @@
+package couchdb_test
+
+import (
+	"io"
+	. "net/http"
+	"strings"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestDocSizeLimit(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("PUT /db/small", func(resp ResponseWriter, req *Request) {
+		resp.Header().Set("ETag", `"1-a"`)
+		resp.WriteHeader(StatusCreated)
+		io.WriteString(resp, `{"ok": true, "id": "small", "rev": "1-a"}`)
+	})
+	c.Handle("PUT /db/server-large", func(resp ResponseWriter, req *Request) {
+		resp.WriteHeader(StatusRequestEntityTooLarge)
+		io.WriteString(resp, `{"error": "document_too_large", "reason": "server-large"}`)
+	})
+
+	var warnings []string
+	c.SetDocSizeLimit(couchdb.DocSizeOptions{
+		Max:  100,
+		Warn: 20,
+		OnWarn: func(db, id string, size int64) {
+			warnings = append(warnings, db+"/"+id)
+		},
+	})
+	db := c.DB("db")
+	large := map[string]string{"data": strings.Repeat("x", 100)}
+
+	if _, err := db.Put("small", map[string]string{"a": "b"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Put("small", map[string]string{"data": strings.Repeat("x", 20)}, ""); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "warnings", []string{"db/small"}, warnings)
+
+	_, err := db.Put("large", large, "")
+	check(t, "error", &couchdb.DocTooLargeError{DB: "db", ID: "large", Size: 111, Max: 100}, err)
+	check(t, "TooLarge", true, couchdb.TooLarge(err))
+
+	body := couchdb.RawBody{Body: strings.NewReader(strings.Repeat(" ", 200)), Length: 200}
+	_, err = db.PutRaw("large", body, "")
+	check(t, "PutRaw TooLarge", true, couchdb.TooLarge(err))
+
+	body = couchdb.RawBody{Body: onlyReader{strings.NewReader(strings.Repeat(" ", 200))}}
+	_, err = db.PutRaw("large", body, "")
+	check(t, "PutRaw unknown length TooLarge", true, couchdb.TooLarge(err))
+
+	_, _, err = db.Post(large)
+	check(t, "Post error", &couchdb.DocTooLargeError{DB: "db", Size: 111, Max: 100}, err)
+
+	_, err = db.BulkDocs([]interface{}{map[string]string{"_id": "a"}, large})
+	check(t, "BulkDocs error", &couchdb.DocTooLargeError{DB: "db", Size: 111, Max: 100}, err)
+
+	raw := `{"docs": [{"_id": "a"}, {"_id": "b", "data": "` + strings.Repeat("x", 100) + `"}]}`
+	_, err = db.BulkDocsRaw(couchdb.RawBody{Body: onlyReader{strings.NewReader(raw)}})
+	check(t, "BulkDocsRaw error", &couchdb.DocTooLargeError{DB: "db", ID: "b", Size: 124, Max: 100}, err)
+
+	c.SetDocSizeLimit(couchdb.DocSizeOptions{})
+	_, err = db.Put("server-large", large, "")
+	check(t, "server TooLarge", true, couchdb.TooLarge(err))
+}
@@ -0,0 +1,110 @@
+package couchdb
+
+import (
+	"sort"
+	"sync"
+)
+
+// DefaultExportSplits divides the ID keyspace into 16 ranges by the first
+// hexadecimal digit. This works well for server-generated UUIDs.
+var DefaultExportSplits = []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "a", "b", "c", "d", "e", "f"}
+
+// ExportOptions configures ExportAllDocs.
+type ExportOptions struct {
+	// Splits are the document IDs at which the keyspace is divided.
+	// n splits produce n+1 ranges. If nil, DefaultExportSplits is used.
+	Splits []string
+
+	// Workers is the number of ranges that are read concurrently.
+	// The default is 4.
+	Workers int
+
+	// Options are added to every _all_docs request, e.g. "include_docs".
+	// The range options "startkey", "endkey" and "inclusive_end" are
+	// set by ExportAllDocs and must not be used.
+	Options Options
+}
+
+// ExportAllDocs reads all rows of the _all_docs view by dividing the ID
+// keyspace into ranges and reading them concurrently. The rows are
+// delivered to sink. Calls to sink never happen concurrently, but rows
+// of different ranges are interleaved.
+//
+// If sink returns an error, the export is stopped and the error is returned.
+func (db *DB) ExportAllDocs(opts ExportOptions, sink func(*Row) error) error {
+	splits := opts.Splits
+	if splits == nil {
+		splits = DefaultExportSplits
+	}
+	splits = append([]string(nil), splits...)
+	sort.Strings(splits)
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = 4
+	}
+
+	var (
+		ranges   = make(chan Options)
+		mu       sync.Mutex // serializes sink calls and protects firstErr
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for rangeOpts := range ranges {
+				if failed() {
+					continue
+				}
+				err := db.exportRange(rangeOpts, func(row *Row) error {
+					mu.Lock()
+					defer mu.Unlock()
+					if firstErr != nil {
+						return firstErr
+					}
+					return sink(row)
+				})
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := 0; i <= len(splits); i++ {
+		rangeOpts := opts.Options.clone()
+		if i > 0 {
+			rangeOpts["startkey"] = splits[i-1]
+		}
+		if i < len(splits) {
+			rangeOpts["endkey"] = splits[i]
+			rangeOpts["inclusive_end"] = false
+		}
+		ranges <- rangeOpts
+	}
+	close(ranges)
+	wg.Wait()
+	return firstErr
+}
+
+func (db *DB) exportRange(opts Options, fn func(*Row) error) error {
+	rows, err := db.AllDocsRows(opts)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := fn(&rows.Row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
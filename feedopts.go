@@ -0,0 +1,145 @@
+package couchdb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// SinceNow is the value of the "since" option that starts a changes
+// feed at the current update sequence:
+//
+//     feed, err := db.Changes(couchdb.Options{"feed": "continuous", "since": couchdb.SinceNow})
+const SinceNow Seq = "now"
+
+// Since returns the value of the "since" option for a sequence reported by
+// the server, e.g. ChangesFeed.LastSeq or DBInfo.UpdateSeq. Opaque sequence
+// strings are sent as-is and escaped for the query string, numbers are
+// sent in decimal form and sequence arrays as JSON. A nil sequence refers
+// to the beginning of the feed. Since returns an empty Seq for values that
+// are not sequences, which is rejected by ValidateFeedOptions.
+func Since(seq interface{}) Seq {
+	if seq == nil {
+		return "0"
+	}
+	s, err := ToSeq(seq)
+	if err != nil {
+		return ""
+	}
+	return s
+}
+
+// ValidateFeedOptions checks the options of a _changes or _db_updates
+// request. The "feed" option must be one of "normal", "longpoll" and
+// "continuous". "since" must be a sequence string, "now", an integer or,
+// for BigCouch servers, a sequence array. "heartbeat" must be a number of
+// milliseconds or true, "timeout" a number of milliseconds. Like CouchDB,
+// ValidateFeedOptions accepts both together, in which case "heartbeat"
+// takes precedence, and accepts them for normal feeds, which ignore them.
+// "doc_ids" and "selector" require the "filter" option to be set to the
+// matching built-in filter, "_doc_ids" or "_selector". "seq_interval" must
+// be a positive integer.
+//
+// Changes and DBUpdates check their options using this function before
+// sending the request.
+func ValidateFeedOptions(opts Options) error {
+	if v, ok := opts["feed"]; ok {
+		if s, ok := optionString(v); !ok || !containsString(feedModes, s) {
+			return fmt.Errorf("couchdb: unsupported value for option \"feed\": %#v", v)
+		}
+	}
+	if v, ok := opts["since"]; ok && !validSince(v) {
+		return fmt.Errorf("couchdb: invalid value for option \"since\": %#v (want sequence or \"now\")", v)
+	}
+	if v, ok := opts["heartbeat"]; ok {
+		if b, isBool := v.(bool); !(isBool && b) && !validMillis(v, true) {
+			return fmt.Errorf("couchdb: invalid value for option \"heartbeat\": %s (want positive milliseconds or true)", describeOption(v))
+		}
+	}
+	if v, ok := opts["timeout"]; ok && !validMillis(v, false) {
+		return fmt.Errorf("couchdb: invalid value for option \"timeout\": %s (want milliseconds)", describeOption(v))
+	}
+	if v, ok := opts["seq_interval"]; ok && !validMillis(v, true) {
+		return fmt.Errorf("couchdb: invalid value for option \"seq_interval\": %s (want positive integer)", describeOption(v))
+	}
+
+	_, docIDs := opts["doc_ids"]
+	_, selector := opts["selector"]
+	if docIDs && selector {
+		return errors.New(`couchdb: option "doc_ids" can't be combined with "selector"`)
+	}
+	if docIDs || selector {
+		option, want := "doc_ids", "_doc_ids"
+		if selector {
+			option, want = "selector", "_selector"
+		}
+		filter, ok := opts["filter"]
+		if !ok {
+			return fmt.Errorf("couchdb: option %q requires filter %q", option, want)
+		}
+		if s, _ := optionString(filter); s != want {
+			return fmt.Errorf("couchdb: filter %#v can't be combined with the built-in %s filter", filter, want)
+		}
+	}
+	return nil
+}
+
+var feedModes = []string{"normal", "longpoll", "continuous"}
+
+// validSince reports whether v is usable as the "since" option.
+// Float values are accepted if integral because CouchDB 1.x
+// sequence numbers decode as float64.
+func validSince(v interface{}) bool {
+	if s, ok := v.(Seq); ok {
+		return s != ""
+	}
+	if _, ok := optionString(v); ok {
+		_, isBool := v.(bool)
+		return !isBool
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() >= 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		return f >= 0 && f == math.Trunc(f)
+	case reflect.Slice, reflect.Array:
+		return rv.Len() > 0
+	}
+	return false
+}
+
+// validMillis reports whether v is a non-negative integer number of
+// milliseconds or, more generally, a count. time.Duration is rejected
+// because it encodes as a duration string, which CouchDB doesn't understand.
+func validMillis(v interface{}, positive bool) bool {
+	if _, ok := v.(time.Duration); ok {
+		return false
+	}
+	var n int64
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return false
+		}
+		n = int64(rv.Uint())
+	default:
+		return false
+	}
+	return n > 0 || (n == 0 && !positive)
+}
+
+func describeOption(v interface{}) string {
+	if d, ok := v.(time.Duration); ok {
+		return fmt.Sprintf("time.Duration %v", d)
+	}
+	return fmt.Sprintf("%#v", v)
+}
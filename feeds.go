@@ -1,9 +1,15 @@
 package couchdb
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // DBUpdatesFeed is an iterator for the _db_updates feed.
@@ -36,8 +42,11 @@ type DBUpdatesFeed struct {
 //
 // http://docs.couchdb.org/en/latest/api/server/common.html#db-updates
 func (c *Client) DBUpdates(options Options) (*DBUpdatesFeed, error) {
-	newopts := options.clone()
+	newopts := c.withDefaults(options).clone()
 	newopts["feed"] = "continuous"
+	if err := ValidateFeedOptions(newopts); err != nil {
+		return nil, err
+	}
 	path, err := new(pathBuilder).addRaw("_db_updates").options(newopts, nil)
 	if err != nil {
 		return nil, err
@@ -48,7 +57,7 @@ func (c *Client) DBUpdates(options Options) (*DBUpdatesFeed, error) {
 	}
 	feed := &DBUpdatesFeed{
 		conn: resp.Body,
-		dec:  json.NewDecoder(resp.Body),
+		dec:  c.newDecoder(resp.Body),
 	}
 	return feed, nil
 }
@@ -107,7 +116,14 @@ type ChangesFeed struct {
 	// This is usually a string, but may also be a number for couchdb 0.x servers.
 	//
 	// For poll-style feeds (feed modes "normal", "longpoll"), this is set to the
-	// last_seq value sent by CouchDB after all feed rows have been read.
+	// last_seq value sent by CouchDB after all feed rows have been read. The same
+	// happens for continuous feeds that end because of the "limit" or "timeout"
+	// options. Use LastSeq to get the position of the feed after iteration.
+	//
+	// If the "seq_interval" option is set, CouchDB computes the sequence only
+	// for every Nth event and Seq is nil for all other events. This reduces
+	// server load for high-volume feeds. LastSeq is not affected by such
+	// events, it always holds the most recent sequence.
 	Seq interface{} `json:"seq"`
 
 	// Pending is the count of remaining items in the feed. This is set for poll-style
@@ -124,10 +140,43 @@ type ChangesFeed struct {
 	// "include_docs" is true.
 	Doc json.RawMessage `json:"doc"`
 
-	end    bool
-	err    error
-	conn   io.Closer
-	parser func() error
+	// Heartbeat is true if the current event is a heartbeat, i.e. an empty line
+	// sent by CouchDB to keep a continuous feed open (see the "heartbeat" option).
+	// Heartbeats are only returned by Next after calling ReportHeartbeats.
+	// All other event fields are empty for heartbeats.
+	Heartbeat bool `json:"-"`
+
+	end        bool
+	err        error
+	conn       io.Closer
+	parser     func() error
+	lastSeq    interface{}
+	heartbeats bool
+	stats      *feedStats
+}
+
+// feedStats holds liveness information of a feed.
+// The fields are accessed atomically.
+type feedStats struct {
+	events      int64
+	bytes       int64
+	lastEventAt int64 // UnixNano
+}
+
+func (s *feedStats) touch() {
+	atomic.StoreInt64(&s.lastEventAt, time.Now().UnixNano())
+}
+
+// countingReader counts the bytes read from a feed connection.
+type countingReader struct {
+	r     io.Reader
+	stats *feedStats
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	atomic.AddInt64(&r.stats.bytes, int64(n))
+	return n, err
 }
 
 // changesRow is the JSON structure of a changes feed row.
@@ -139,12 +188,22 @@ type changesRow struct {
 		Rev string `json:"rev"`
 	} `json:"changes"`
 	Doc     json.RawMessage `json:"doc"`
-	LastSeq bool            `json:"last_seq"`
+	Pending int64           `json:"pending"`
+
+	// LastSeq is set on the final row of a continuous feed.
+	// CouchDB sends the final sequence here. Very old servers
+	// send true and put the sequence into the seq key.
+	LastSeq interface{} `json:"last_seq"`
 }
 
 // apply sets the row as the current event of the feed.
 func (d *changesRow) apply(f *ChangesFeed) error {
+	atomic.AddInt64(&f.stats.events, 1)
+	f.stats.touch()
 	f.Seq = d.Seq
+	if d.Seq != nil {
+		f.lastSeq = d.Seq // nil between seq_interval events
+	}
 	f.ID = d.ID
 	f.Deleted = d.Deleted
 	f.Doc = d.Doc
@@ -154,9 +213,14 @@ func (d *changesRow) apply(f *ChangesFeed) error {
 
 // reset resets the iterator outputs to zero.
 func (f *ChangesFeed) reset() {
-	f.ID, f.Deleted, f.Changes, f.Doc = "", false, nil, nil
+	f.ID, f.Deleted, f.Changes, f.Doc, f.Heartbeat = "", false, nil, nil, false
 }
 
+// changesBodyKeys are the options that are sent in the body of
+// a POST request to _changes. Changes requests using them are
+// always sent as POST.
+var changesBodyKeys = []string{"doc_ids", "selector"}
+
 // Changes opens the _changes feed of a database. This feed receives an event
 // whenever a document is created, updated or deleted.
 //
@@ -173,34 +237,117 @@ func (f *ChangesFeed) reset() {
 //
 // http://docs.couchdb.org/en/latest/api/database/changes.html#db-changes
 func (db *DB) Changes(options Options) (*ChangesFeed, error) {
-	path, err := db.path().addRaw("_changes").options(options, nil)
-	if err != nil {
+	options = db.options(options)
+	if err := ValidateFeedOptions(options); err != nil {
 		return nil, err
 	}
-	resp, err := db.request("GET", path, nil)
+	resp, err := db.queryRequest(db.path().addRaw("_changes"), options, nil, changesBodyKeys)
 	if err != nil {
 		return nil, err
 	}
-	feed := &ChangesFeed{DB: db, conn: resp.Body}
-
-	switch options["feed"] {
-	case nil, "normal", "longpoll":
-		feed.parser, err = feed.pollParser(resp.Body)
+	feed := &ChangesFeed{DB: db, conn: resp.Body, stats: new(feedStats)}
+	feed.stats.touch()
+	body := &countingReader{resp.Body, feed.stats}
+
+	if mode, _ := optionString(options["feed"]); mode == "continuous" {
+		feed.parser = feed.contParser(body)
+	} else {
+		feed.parser, err = feed.pollParser(body)
 		if err != nil {
 			feed.Close()
 			return nil, err
 		}
-	case "continuous":
-		feed.parser = feed.contParser(resp.Body)
-	default:
-		err := fmt.Errorf(`couchdb: unsupported value for option "feed": %#v`, options["feed"])
-		feed.Close()
-		return nil, err
 	}
 
 	return feed, nil
 }
 
+// ChangesFilter selects a filter function for FilteredChanges.
+type ChangesFilter struct {
+	// DDoc is the design document containing the filter,
+	// including the _design/ prefix.
+	DDoc string
+	// Name is the name of the filter function.
+	Name string
+	// Params are made available to the filter function as req.query.
+	// They are sent verbatim and may not use the names of other
+	// _changes options.
+	Params map[string]string
+	// Check makes FilteredChanges verify that the filter function
+	// exists before opening the feed.
+	Check bool
+}
+
+// FilteredChanges opens the _changes feed with a filter function defined in a
+// design document. This is equivalent to setting the "filter" option of
+// Changes, but the filter parameters are never encoded as JSON and cannot
+// override other options.
+//
+// Built-in filters such as _view and _selector can be used through the
+// options of Changes.
+func (db *DB) FilteredChanges(filter ChangesFilter, options Options) (*ChangesFeed, error) {
+	if !strings.HasPrefix(filter.DDoc, "_design/") {
+		return nil, errors.New("couchdb.FilteredChanges: design doc name must start with _design/")
+	}
+	if filter.Name == "" {
+		return nil, errors.New("couchdb.FilteredChanges: empty filter name")
+	}
+	opts := db.options(options)
+	if _, ok := opts["filter"]; ok {
+		return nil, errors.New(`couchdb.FilteredChanges: "filter" option is not allowed`)
+	}
+	merged := make(Options, len(opts)+len(filter.Params)+1)
+	for k, v := range opts {
+		merged[k] = v
+	}
+	for k, v := range filter.Params {
+		if _, ok := merged[k]; ok || k == "filter" || containsString(changesBodyKeys, k) {
+			return nil, fmt.Errorf("couchdb.FilteredChanges: filter parameter %q conflicts with _changes option", k)
+		}
+		merged[k] = v
+	}
+	merged["filter"] = strings.TrimPrefix(filter.DDoc, "_design/") + "/" + filter.Name
+
+	if filter.Check {
+		if err := db.checkFilter(filter.DDoc, filter.Name); err != nil {
+			return nil, err
+		}
+	}
+	return db.Changes(merged)
+}
+
+// checkFilter verifies that a filter function exists.
+func (db *DB) checkFilter(ddoc, name string) error {
+	var doc struct {
+		Filters map[string]string `json:"filters"`
+	}
+	if err := db.Get(ddoc, &doc, nil); err != nil {
+		return err
+	}
+	if _, ok := doc.Filters[name]; !ok {
+		return fmt.Errorf("couchdb: design document %q has no filter %q", ddoc, name)
+	}
+	return nil
+}
+
+// LatestChanges returns the last n changes of the database, newest first.
+// Default options of the database object apply, so documents can be
+// included using db.WithOptions(Options{"include_docs": true}).
+func (db *DB) LatestChanges(n int) ([]*Change, error) {
+	if n <= 0 {
+		return nil, errors.New("couchdb.LatestChanges: n must be positive")
+	}
+	feed, err := db.Changes(Options{"feed": "normal", "descending": true, "limit": n})
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]*Change, 0, n)
+	for feed.Next() {
+		changes = append(changes, feed.change())
+	}
+	return changes, feed.Err()
+}
+
 // Next decodes the next event. It returns false when the feeds end has been
 // reached or an error has occurred.
 func (f *ChangesFeed) Next() bool {
@@ -225,6 +372,60 @@ func (f *ChangesFeed) Close() error {
 	return f.conn.Close()
 }
 
+// LastEventAt returns the time at which the last event or heartbeat was
+// received, or the time the feed was opened if nothing has been received yet.
+// Supervisors can use it to detect stalled feeds. It is safe to call
+// LastEventAt, Events and BytesRead concurrently with Next.
+func (f *ChangesFeed) LastEventAt() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&f.stats.lastEventAt))
+}
+
+// Events returns the number of change events received.
+func (f *ChangesFeed) Events() int64 {
+	return atomic.LoadInt64(&f.stats.events)
+}
+
+// BytesRead returns the number of bytes read from the feed connection.
+func (f *ChangesFeed) BytesRead() int64 {
+	return atomic.LoadInt64(&f.stats.bytes)
+}
+
+// ReportHeartbeats makes Next return heartbeats of continuous feeds as events
+// with the Heartbeat field set. By default, heartbeats are skipped. Consumers
+// can use them to detect stalled connections. Heartbeats are sent only if
+// the "heartbeat" option is set.
+func (f *ChangesFeed) ReportHeartbeats(enable bool) {
+	f.heartbeats = enable
+}
+
+// LastSeq returns the sequence up to which the feed has been read. After the
+// end of the feed has been reached, this is the last_seq value sent by CouchDB.
+// If the feed was closed before that, it is the sequence of the last event
+// returned by Next. This value is suitable as the "since" option of a
+// subsequent request, also for feeds using "limit".
+//
+// For feeds using "descending", LastSeq is the sequence of the oldest change
+// that was read. CouchDB ignores "since" for descending feeds, so such feeds
+// can't be resumed from it.
+func (f *ChangesFeed) LastSeq() interface{} {
+	return f.lastSeq
+}
+
+// Attachments returns the inline attachments of the current document.
+// The document is only available if the feed was opened with the
+// "include_docs" option. Attachment data is included if the "attachments"
+// option is set as well:
+//
+//     feed, err := db.Changes(couchdb.Options{"include_docs": true, "attachments": true})
+//
+// Attachments returns nil if the document has no attachments.
+func (f *ChangesFeed) Attachments() (map[string]*InlineAttachment, error) {
+	if f.Doc == nil {
+		return nil, nil
+	}
+	return InlineAttachments(f.Doc)
+}
+
 // ChangesRevs returns the rev list of the current result row.
 func (f *ChangesFeed) ChangesRevs() []string {
 	revs := make([]string, len(f.Changes))
@@ -235,25 +436,107 @@ func (f *ChangesFeed) ChangesRevs() []string {
 }
 
 func (f *ChangesFeed) contParser(r io.Reader) func() error {
-	dec := json.NewDecoder(r)
+	cr := &contReader{r: bufio.NewReader(r)}
 	return func() error {
-		var row changesRow
-		if err := dec.Decode(&row); err != nil {
-			return err
+		f.reset()
+		var obj []byte
+		for obj == nil {
+			var err error
+			if obj, err = cr.next(); err != nil {
+				return err
+			}
+			if obj == nil {
+				f.stats.touch()
+			}
+			if obj == nil && f.heartbeats {
+				f.Heartbeat = true
+				return nil
+			}
 		}
-		if err := row.apply(f); err != nil {
+		var row changesRow
+		if err := f.DB.newDecoder(bytes.NewReader(obj)).Decode(&row); err != nil {
 			return err
 		}
-		if row.LastSeq {
+		if row.LastSeq != nil {
 			f.end = true
+			f.Seq = row.Seq
+			if row.LastSeq != true {
+				f.Seq = row.LastSeq
+			}
+			f.lastSeq = f.Seq
+			f.Pending = row.Pending
 			return nil
 		}
-		return nil
+		return row.apply(f)
+	}
+}
+
+// contReader splits a continuous feed into JSON objects and heartbeats.
+// CouchDB terminates each object with a newline and sends an additional
+// empty line as heartbeat.
+type contReader struct {
+	r        *bufio.Reader
+	afterObj bool
+	buf      []byte
+}
+
+// next returns the next object of the feed, or nil for a heartbeat.
+// The returned slice is valid until the next call.
+func (cr *contReader) next() ([]byte, error) {
+	for {
+		c, err := cr.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch c {
+		case ' ', '\t', '\r':
+		case '\n':
+			if !cr.afterObj {
+				return nil, nil
+			}
+			cr.afterObj = false
+		case '{':
+			obj, err := cr.readObject()
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			cr.afterObj = true
+			return obj, err
+		default:
+			return nil, fmt.Errorf("unexpected character %q in changes feed", c)
+		}
+	}
+}
+
+// readObject reads a JSON object whose opening brace has been consumed.
+func (cr *contReader) readObject() ([]byte, error) {
+	cr.buf = append(cr.buf[:0], '{')
+	depth, inString, escaped := 1, false, false
+	for depth > 0 {
+		c, err := cr.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		cr.buf = append(cr.buf, c)
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			depth--
+		}
 	}
+	return cr.buf, nil
 }
 
 func (f *ChangesFeed) pollParser(r io.Reader) (func() error, error) {
-	dec := json.NewDecoder(r)
+	dec := f.DB.newDecoder(r)
 	if err := expectTokens(dec, json.Delim('{'), "results", json.Delim('[')); err != nil {
 		return nil, err
 	}
@@ -285,6 +568,7 @@ func (f *ChangesFeed) pollParser(r io.Reader) (func() error, error) {
 				if err := dec.Decode(&f.Seq); err != nil {
 					return fmt.Errorf(`can't decode "last_seq" feed key: %v`, err)
 				}
+				f.lastSeq = f.Seq
 			case "pending":
 				if err := dec.Decode(&f.Pending); err != nil {
 					return fmt.Errorf(`can't decode "pending" feed key: %v`, err)
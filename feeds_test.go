@@ -2,9 +2,15 @@ package couchdb_test
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 	. "net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/fjl/go-couchdb"
 )
@@ -125,6 +131,66 @@ func TestChangesFeedPoll_Doc(t *testing.T) {
 	}
 }
 
+func TestChangesFeedAttachments(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/_changes", func(resp ResponseWriter, req *Request) {
+		check(t, "request query string", "att_encoding_info=true&attachments=true&include_docs=true", req.URL.RawQuery)
+		io.WriteString(resp, `{
+			"results": [
+				{
+					"seq": "1-...",
+					"id": "doc",
+					"doc": {
+						"_id": "doc",
+						"_attachments": {
+							"a.txt": {
+								"content_type": "text/plain",
+								"digest": "md5-XUFAKrxLKna5cZ2REBfFkg==",
+								"revpos": 1,
+								"length": 5,
+								"data": "aGVsbG8="
+							}
+						}
+					},
+					"changes": [{"rev":"1-619db7ba8551c0de3f3a178775509611"}]
+				},
+				{"seq": "2-...", "id": "plain", "doc": {"_id": "plain"}, "changes": []}
+			],
+			"last_seq": "2-..."
+		}`)
+	})
+	feed, err := c.DB("db").Changes(couchdb.Options{
+		"include_docs":      true,
+		"attachments":       true,
+		"att_encoding_info": true,
+	})
+	if err != nil {
+		t.Fatalf("client.Changes error: %v", err)
+	}
+
+	check(t, "feed.Next()", true, feed.Next())
+	atts, err := feed.Attachments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "attachment count", 1, len(atts))
+	a := atts["a.txt"]
+	check(t, "content type", "text/plain", a.ContentType)
+	check(t, "data", []byte("hello"), a.Data)
+	check(t, "length", int64(5), a.Length)
+
+	att := a.Attachment("a.txt")
+	body, _ := ioutil.ReadAll(att.Body)
+	check(t, "attachment body", "hello", string(body))
+	check(t, "attachment md5", "5d41402abc4b2a76b9719d911017c592", fmt.Sprintf("%x", att.MD5))
+
+	check(t, "feed.Next()", true, feed.Next())
+	atts, err = feed.Attachments()
+	check(t, "attachments of plain doc", map[string]*couchdb.InlineAttachment(nil), atts)
+	check(t, "error", error(nil), err)
+	feed.Close()
+}
+
 func TestChangesFeedPoll_SeqInteger(t *testing.T) {
 	c := newTestClient(t)
 	c.Handle("GET /db/_changes", func(resp ResponseWriter, req *Request) {
@@ -283,6 +349,69 @@ func TestChangesFeedCont_SeqInteger(t *testing.T) {
 	}
 }
 
+func TestChangesFeedCont_Heartbeats(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/_changes", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, "\n")
+		io.WriteString(resp, `{"seq": "1-...", "id": "doc", "changes": []}`+"\n")
+		io.WriteString(resp, "\n\n")
+		io.WriteString(resp, `{"seq": "2-...", "id": "doc}{\"", "changes": []}`+"\n")
+		io.WriteString(resp, `{"last_seq": "2-..."}`+"\n")
+	})
+
+	for _, report := range []bool{false, true} {
+		feed, err := c.DB("db").Changes(couchdb.Options{"feed": "continuous", "heartbeat": 1000})
+		if err != nil {
+			t.Fatalf("client.Changes error: %v", err)
+		}
+		feed.ReportHeartbeats(report)
+		var events []string
+		for feed.Next() {
+			if feed.Heartbeat {
+				events = append(events, "heartbeat")
+			} else {
+				events = append(events, feed.ID)
+			}
+		}
+		check(t, "feed.Err()", error(nil), feed.Err())
+		want := []string{"doc", `doc}{"`}
+		if report {
+			want = []string{"heartbeat", "doc", "heartbeat", "heartbeat", `doc}{"`}
+		}
+		check(t, "events", want, events)
+		check(t, "feed.LastSeq()", "2-...", feed.LastSeq())
+	}
+}
+
+func TestChangesFeedLiveness(t *testing.T) {
+	c := newTestClient(t)
+	body := `{"seq": "1-...", "id": "a", "changes": []}` + "\n\n" +
+		`{"seq": "2-...", "id": "b", "changes": []}` + "\n" +
+		`{"last_seq": "2-..."}` + "\n"
+	c.Handle("GET /db/_changes", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, body)
+	})
+
+	start := time.Now()
+	feed, err := c.DB("db").Changes(couchdb.Options{"feed": "continuous"})
+	if err != nil {
+		t.Fatalf("client.Changes error: %v", err)
+	}
+	if feed.LastEventAt().Before(start) {
+		t.Errorf("LastEventAt %v before open time %v", feed.LastEventAt(), start)
+	}
+	check(t, "initial events", int64(0), feed.Events())
+
+	for feed.Next() {
+	}
+	check(t, "feed.Err()", error(nil), feed.Err())
+	check(t, "events", int64(2), feed.Events())
+	check(t, "bytes", int64(len(body)), feed.BytesRead())
+	if feed.LastEventAt().Before(start) {
+		t.Errorf("LastEventAt not updated")
+	}
+}
+
 func TestChangesFeedCont_Doc(t *testing.T) {
 	c := newTestClient(t)
 	c.Handle("GET /db/_changes", func(resp ResponseWriter, req *Request) {
@@ -378,3 +507,292 @@ func TestChangesFeedCont_SeqString(t *testing.T) {
 		t.Fatalf("feed.Close error: %v", err)
 	}
 }
+
+func TestChangesFeedUseNumber(t *testing.T) {
+	c := newTestClient(t)
+	c.SetUseNumber(true)
+	c.Handle("GET /db/_changes", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{
+			"results": [
+				{"seq": 9007199254740993, "id": "doc", "changes": []}
+			],
+			"last_seq": 9007199254740995
+		}`)
+	})
+
+	feed, err := c.DB("db").Changes(nil)
+	if err != nil {
+		t.Fatalf("client.Changes error: %v", err)
+	}
+	check(t, "feed.Next()", true, feed.Next())
+	check(t, "feed.Seq", json.Number("9007199254740993"), feed.Seq)
+	check(t, "feed.Next()", false, feed.Next())
+	check(t, "feed.Err()", error(nil), feed.Err())
+	check(t, "feed.Seq", json.Number("9007199254740995"), feed.Seq)
+}
+
+func TestChangesFeedLastSeq(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/_changes", func(resp ResponseWriter, req *Request) {
+		switch req.URL.Query().Get("feed") {
+		case "continuous":
+			io.WriteString(resp, `{"seq": "5-...", "id": "a", "changes": []}`+"\n")
+			io.WriteString(resp, `{"seq": "4-...", "id": "b", "changes": []}`+"\n")
+			io.WriteString(resp, `{"last_seq": "4-...", "pending": 3}`+"\n")
+		default:
+			io.WriteString(resp, `{
+				"results": [{"seq": "5-...", "id": "a", "changes": []}],
+				"last_seq": "5-...", "pending": 4
+			}`)
+		}
+	})
+
+	t.Log("-- poll feed with limit")
+	feed, err := c.DB("db").Changes(couchdb.Options{"limit": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for feed.Next() {
+	}
+	check(t, "feed.Err()", error(nil), feed.Err())
+	check(t, "feed.LastSeq()", "5-...", feed.LastSeq())
+	check(t, "feed.Pending", int64(4), feed.Pending)
+
+	t.Log("-- continuous feed with descending")
+	opts := couchdb.Options{"feed": "continuous", "descending": true, "limit": 2}
+	feed, err = c.DB("db").Changes(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for feed.Next() {
+	}
+	check(t, "feed.Err()", error(nil), feed.Err())
+	check(t, "feed.LastSeq()", "4-...", feed.LastSeq())
+	check(t, "feed.Seq", "4-...", feed.Seq)
+	check(t, "feed.Pending", int64(3), feed.Pending)
+
+	t.Log("-- closed early")
+	feed, err = c.DB("db").Changes(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed.Next()
+	feed.Close()
+	check(t, "feed.LastSeq()", "5-...", feed.LastSeq())
+}
+
+func TestChangesFeedSeqInterval(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/_changes", func(resp ResponseWriter, req *Request) {
+		check(t, "seq_interval", "2", req.URL.Query().Get("seq_interval"))
+		io.WriteString(resp, `{"seq": null, "id": "a", "changes": []}`+"\n")
+		io.WriteString(resp, `{"seq": "2-...", "id": "b", "changes": []}`+"\n")
+		io.WriteString(resp, `{"seq": null, "id": "c", "changes": []}`+"\n")
+	})
+
+	feed, err := c.DB("db").Changes(couchdb.Options{"feed": "continuous", "seq_interval": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seqs []interface{}
+	for feed.Next() {
+		seqs = append(seqs, feed.Seq)
+	}
+	check(t, "feed.Err()", io.EOF, feed.Err())
+	check(t, "seqs", []interface{}{nil, "2-...", nil}, seqs)
+	check(t, "feed.LastSeq()", "2-...", feed.LastSeq())
+}
+
+func TestChangesFeedCloseReleasesConn(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		conns = make(map[net.Conn]bool)
+	)
+	srv := httptest.NewUnstartedServer(HandlerFunc(func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"seq": "1-...", "id": "doc", "changes": []}`+"\n")
+		resp.(Flusher).Flush()
+		<-req.Context().Done()
+	}))
+	srv.Config.ConnState = func(conn net.Conn, state ConnState) {
+		mu.Lock()
+		defer mu.Unlock()
+		if state == StateClosed {
+			delete(conns, conn)
+		} else {
+			conns[conn] = true
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+	openConns := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(conns)
+	}
+
+	c, err := couchdb.NewClient(srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed, err := c.DB("db").Changes(couchdb.Options{"feed": "continuous"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "feed.Next()", true, feed.Next())
+	feed.Close()
+	c.CloseIdleConnections()
+	for i := 0; openConns() > 0; i++ {
+		if i == 100 {
+			t.Fatalf("%d connections still open after Close", openConns())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFilteredChanges(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/_design/app", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"_id": "_design/app", "filters": {"by_type": "function(doc, req) {}"}}`)
+	})
+	c.Handle("GET /db/_changes", func(resp ResponseWriter, req *Request) {
+		check(t, "request query string", "filter=app%2Fby_type&key=%5B1%5D&since=now&type=user", req.URL.RawQuery)
+		io.WriteString(resp, `{"results": [], "last_seq": "1-x"}`)
+	})
+
+	db := c.DB("db")
+	filter := couchdb.ChangesFilter{
+		DDoc:   "_design/app",
+		Name:   "by_type",
+		Params: map[string]string{"type": "user", "key": "[1]"},
+		Check:  true,
+	}
+	feed, err := db.FilteredChanges(filter, couchdb.Options{"since": "now"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "feed.Next()", false, feed.Next())
+	check(t, "feed.Err()", error(nil), feed.Err())
+
+	filter.Name = "missing"
+	if _, err := db.FilteredChanges(filter, nil); err == nil {
+		t.Error("expected error for missing filter")
+	}
+	filter.Name, filter.Params = "by_type", map[string]string{"since": "0"}
+	if _, err := db.FilteredChanges(filter, couchdb.Options{"since": "now"}); err == nil {
+		t.Error("expected error for conflicting filter parameter")
+	}
+}
+
+func TestLatestChanges(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/_changes", func(resp ResponseWriter, req *Request) {
+		q := req.URL.Query()
+		check(t, "descending", "true", q.Get("descending"))
+		check(t, "limit", "2", q.Get("limit"))
+		check(t, "feed", "normal", q.Get("feed"))
+		io.WriteString(resp, `{"results": [
+			{"seq": "9-a", "id": "doc2", "changes": [{"rev": "3-b"}]},
+			{"seq": "8-a", "id": "doc1", "deleted": true, "changes": [{"rev": "2-a"}]}
+		], "last_seq": "8-a", "pending": 7}`)
+	})
+
+	// A continuous default feed mode is overridden.
+	db := c.DB("db").WithOptions(couchdb.Options{"feed": "continuous"})
+	changes, err := db.LatestChanges(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "changes", []*couchdb.Change{
+		{ID: "doc2", Seq: "9-a", Revs: []string{"3-b"}},
+		{ID: "doc1", Seq: "8-a", Deleted: true, Revs: []string{"2-a"}},
+	}, changes)
+
+	if _, err := db.LatestChanges(0); err == nil {
+		t.Error("expected error for n = 0")
+	}
+}
+
+func TestChangesSince(t *testing.T) {
+	var query string
+	c := newTestClient(t)
+	c.Handle("GET /db/_changes", func(resp ResponseWriter, req *Request) {
+		query = req.URL.RawQuery
+		io.WriteString(resp, `{"results": [], "last_seq": "0"}`)
+	})
+
+	tests := []struct {
+		seq  interface{}
+		want string
+	}{
+		{nil, "since=0"},
+		{"12-g1AAAA+b/c=", "since=12-g1AAAA%2Bb%2Fc%3D"},
+		{float64(1000000), "since=1000000"},
+		{[]interface{}{float64(1), "x"}, "since=%5B1%2C%22x%22%5D"},
+		{couchdb.SinceNow, "since=now"},
+	}
+	for _, test := range tests {
+		feed, err := c.DB("db").Changes(couchdb.Options{"since": couchdb.Since(test.seq)})
+		if err != nil {
+			t.Errorf("since %v: %v", test.seq, err)
+			continue
+		}
+		feed.Close()
+		check(t, "query", test.want, query)
+	}
+}
+
+func TestFeedOptionsValidation(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/_changes", func(resp ResponseWriter, req *Request) {
+		t.Errorf("request sent with invalid options: %s", req.URL.RawQuery)
+	})
+	c.Handle("GET /_db_updates", func(resp ResponseWriter, req *Request) {
+		t.Errorf("request sent with invalid options: %s", req.URL.RawQuery)
+	})
+
+	invalid := []couchdb.Options{
+		{"feed": "eventsource"},
+		{"feed": 1},
+		{"since": true},
+		{"since": -1},
+		{"since": 1.5},
+		{"feed": "continuous", "heartbeat": 30 * time.Second},
+		{"feed": "continuous", "heartbeat": 0},
+		{"feed": "continuous", "heartbeat": false},
+		{"feed": "continuous", "timeout": "60000"},
+		{"doc_ids": []string{"a"}, "selector": map[string]string{}},
+		{"doc_ids": []string{"a"}, "filter": "app/by_type"},
+		{"selector": map[string]string{}, "filter": "_doc_ids"},
+		{"doc_ids": []string{"a"}},
+		{"selector": map[string]string{}},
+		{"seq_interval": 0},
+		{"since": couchdb.Since(true)},
+		{"seq_interval": "100"},
+	}
+	for _, opts := range invalid {
+		if _, err := c.DB("db").Changes(opts); err == nil {
+			t.Errorf("expected error for options %v", opts)
+		}
+	}
+
+	valid := []couchdb.Options{
+		nil,
+		{"feed": "longpoll", "since": "now", "timeout": 0},
+		{"feed": "continuous", "since": 12, "heartbeat": true},
+		{"feed": "continuous", "heartbeat": 1000, "timeout": 1000},
+		{"heartbeat": 1000},
+		{"feed": "normal", "timeout": 1000},
+		{"since": float64(99)},
+		{"since": json.Number("5-abc")},
+		{"doc_ids": []string{"a"}, "filter": "_doc_ids"},
+		{"selector": map[string]string{}, "filter": "_selector"},
+		{"feed": "continuous", "seq_interval": 100},
+		{"since": couchdb.SinceNow},
+		{"since": couchdb.Since(nil)},
+	}
+	for _, opts := range valid {
+		if err := couchdb.ValidateFeedOptions(opts); err != nil {
+			t.Errorf("unexpected error for options %v: %v", opts, err)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package couchdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// FindQuery is a Mango query. Zero values of optional fields
+// are omitted from the request.
+type FindQuery struct {
+	// Selector is required. It is usually a map, e.g.
+	// map[string]interface{}{"type": "user", "age": map[string]int{"$gt": 21}}.
+	Selector interface{} `json:"selector"`
+
+	Fields []string    `json:"fields,omitempty"` // fields to return
+	Sort   []SortField `json:"sort,omitempty"`
+	Limit  int         `json:"limit,omitempty"` // server default is 25
+	Skip   int         `json:"skip,omitempty"`
+
+	// UseIndex is the design document of the index to use,
+	// or a [ddoc, name] array.
+	UseIndex interface{} `json:"use_index,omitempty"`
+
+	// Bookmark continues a previous query. Set it to FindResult.Bookmark
+	// to get the next page of results.
+	Bookmark string `json:"bookmark,omitempty"`
+
+	Conflicts      bool  `json:"conflicts,omitempty"`       // include _conflicts
+	R              int   `json:"r,omitempty"`               // read quorum
+	Update         *bool `json:"update,omitempty"`          // update the index first (default true)
+	Stable         bool  `json:"stable,omitempty"`          // use a stable set of shards
+	ExecutionStats bool  `json:"execution_stats,omitempty"` // fill FindResult.ExecutionStats
+}
+
+// SortField is a sort criterion of a Mango query.
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// MarshalJSON encodes the field as {"field": "asc"} or {"field": "desc"}.
+func (f SortField) MarshalJSON() ([]byte, error) {
+	dir := "asc"
+	if f.Desc {
+		dir = "desc"
+	}
+	return json.Marshal(map[string]string{f.Field: dir})
+}
+
+// FindResult is the response of a Mango query. Set Docs to a pointer
+// to a slice before calling Find to decode the documents:
+//
+//     var docs []Doc
+//     result := &couchdb.FindResult{Docs: &docs}
+//     err := db.Find(query, result)
+type FindResult struct {
+	Docs     interface{} `json:"docs"`
+	Bookmark string      `json:"bookmark"`
+
+	// Warning is set if the query could not use an index
+	// or the index was not optimal.
+	Warning string `json:"warning"`
+
+	// ExecutionStats is set if the query contains
+	// "execution_stats": true.
+	ExecutionStats *ExecutionStats `json:"execution_stats"`
+}
+
+// ExecutionStats describes the work performed by a Mango query.
+type ExecutionStats struct {
+	TotalKeysExamined       int64   `json:"total_keys_examined"`
+	TotalDocsExamined       int64   `json:"total_docs_examined"`
+	TotalQuorumDocsExamined int64   `json:"total_quorum_docs_examined"`
+	ResultsReturned         int64   `json:"results_returned"`
+	ExecutionTimeMs         float64 `json:"execution_time_ms"`
+}
+
+// ExecutionTime returns the server-side execution time of the query.
+func (s *ExecutionStats) ExecutionTime() time.Duration {
+	return time.Duration(s.ExecutionTimeMs * float64(time.Millisecond))
+}
+
+// Find runs a Mango query. The query is encoded as the JSON body of
+// the request. It is usually a *FindQuery, but raw maps such as
+// map[string]interface{}{"selector": ...} work as well. The
+// response is decoded into result, which is usually a *FindResult.
+//
+// http://docs.couchdb.org/en/latest/api/database/find.html
+func (db *DB) Find(query interface{}, result interface{}) error {
+	body, err := json.Marshal(query)
+	if err != nil {
+		return err
+	}
+	path := db.path().addRaw("_find").path()
+	resp, err := db.request("POST", path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	return db.readBody(resp, result)
+}
+
+// FindIterator pages through the results of a Mango query, following
+// bookmarks transparently. It holds only one page of documents in memory.
+// Next is designed to be used in a for loop:
+//
+//     it := db.FindIterator(query)
+//     for it.Next() {
+//         var doc MyDoc
+//         if err := it.Scan(&doc); err != nil {
+//             ...
+//         }
+//     }
+//     err := it.Err()
+type FindIterator struct {
+	// Doc is the current document.
+	Doc json.RawMessage
+
+	db    *DB
+	query FindQuery
+	page  []json.RawMessage
+	end   bool
+	err   error
+}
+
+// FindIterator returns an iterator over all documents matching a Mango
+// query. The Limit of the query is the page size, which defaults to 25.
+// Skip applies to the first page only. The query is not sent until Next
+// is called.
+func (db *DB) FindIterator(query FindQuery) *FindIterator {
+	if query.Limit <= 0 {
+		query.Limit = 25
+	}
+	return &FindIterator{db: db, query: query}
+}
+
+// Next advances to the next document, requesting the next page of results
+// when necessary. It returns false when all documents have been returned
+// or an error has occurred.
+func (it *FindIterator) Next() bool {
+	it.Doc = nil
+	for len(it.page) == 0 {
+		if it.end {
+			return false
+		}
+		if it.err = it.fetch(); it.err != nil {
+			it.end = true
+			return false
+		}
+	}
+	it.Doc, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+func (it *FindIterator) fetch() error {
+	var docs []json.RawMessage
+	result := &FindResult{Docs: &docs}
+	if err := it.db.Find(&it.query, result); err != nil {
+		return err
+	}
+	// A short page is the last one. CouchDB repeats the bookmark
+	// when there are no more results.
+	if len(docs) < it.query.Limit || result.Bookmark == "" || result.Bookmark == it.query.Bookmark {
+		it.end = true
+	}
+	it.page = docs
+	it.query.Bookmark = result.Bookmark
+	it.query.Skip = 0
+	return nil
+}
+
+// Scan decodes the current document into v.
+func (it *FindIterator) Scan(v interface{}) error {
+	if it.Doc == nil {
+		return errors.New("couchdb: FindIterator.Scan called without current document")
+	}
+	return it.db.newDecoder(bytes.NewReader(it.Doc)).Decode(v)
+}
+
+// Bookmark returns the bookmark of the last requested page. It can be
+// set as the Bookmark of a query to resume iteration after that page.
+func (it *FindIterator) Bookmark() string {
+	return it.query.Bookmark
+}
+
+// Err returns the error that ended iteration.
+func (it *FindIterator) Err() error {
+	return it.err
+}
+
+// ExplainResult describes how the server executes a Mango query.
+type ExplainResult struct {
+	DB       string          `json:"dbname"`
+	Index    ExplainIndex    `json:"index"`
+	Selector json.RawMessage `json:"selector"`
+	Limit    int             `json:"limit"`
+	Skip     int             `json:"skip"`
+
+	// Fields is the list of returned fields, or the string "all_fields".
+	Fields interface{} `json:"fields"`
+
+	// MRArgs are the arguments of the underlying view query.
+	// They include the key range that is scanned.
+	MRArgs ExplainMRArgs `json:"mrargs"`
+
+	// Covering is true if the index contains all requested fields,
+	// so documents don't have to be read. CouchDB 3.3 and later.
+	Covering bool `json:"covering"`
+}
+
+// ExplainIndex is the index chosen for a Mango query.
+type ExplainIndex struct {
+	DDoc string          `json:"ddoc"` // empty for the special _all_docs index
+	Name string          `json:"name"`
+	Type string          `json:"type"` // "special", "json" or "text"
+	Def  json.RawMessage `json:"def"`
+}
+
+// ExplainMRArgs are the view query arguments of an explained Mango query.
+type ExplainMRArgs struct {
+	StartKey    json.RawMessage `json:"start_key"`
+	EndKey      json.RawMessage `json:"end_key"`
+	Direction   string          `json:"direction"` // "fwd" or "rev"
+	IncludeDocs bool            `json:"include_docs"`
+	Reduce      bool            `json:"reduce"`
+	Stable      bool            `json:"stable"`
+	ViewType    string          `json:"view_type"`
+}
+
+// FullScan reports whether the query reads all documents of the
+// database because no index matches its selector.
+func (r *ExplainResult) FullScan() bool {
+	return r.Index.Type == "special" && r.Index.Name == "_all_docs"
+}
+
+// Explain returns how a Mango query would be executed without running it.
+// The query has the same form as for Find. Tests can use Explain to verify
+// that queries are served by an index:
+//
+//     exp, err := db.Explain(query)
+//     if err == nil && exp.FullScan() { ... }
+//
+// http://docs.couchdb.org/en/latest/api/database/find.html#db-explain
+func (db *DB) Explain(query interface{}) (*ExplainResult, error) {
+	body, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+	path := db.path().addRaw("_explain").path()
+	resp, err := db.request("POST", path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	result := new(ExplainResult)
+	return result, db.readBody(resp, result)
+}
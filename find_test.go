@@ -0,0 +1,193 @@
+package couchdb_test
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	. "net/http"
+	"testing"
+	"time"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestFind(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("POST /db/_find", func(resp ResponseWriter, req *Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		check(t, "request body", `{"execution_stats":true,"selector":{"field":{"$gt":1}}}`, string(body))
+		io.WriteString(resp, `{
+			"docs": [{"_id": "a", "_rev": "1-a", "field": 2}],
+			"bookmark": "g1AAAA",
+			"warning": "No matching index found, create an index to optimize query time.",
+			"execution_stats": {
+				"total_keys_examined": 0,
+				"total_docs_examined": 3,
+				"total_quorum_docs_examined": 0,
+				"results_returned": 1,
+				"execution_time_ms": 1.5
+			}
+		}`)
+	})
+
+	var docs []testDocument
+	result := &couchdb.FindResult{Docs: &docs}
+	query := map[string]interface{}{
+		"selector":        map[string]interface{}{"field": map[string]int{"$gt": 1}},
+		"execution_stats": true,
+	}
+	if err := c.DB("db").Find(query, result); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "docs", []testDocument{{Rev: "1-a", Field: 2}}, docs)
+	check(t, "bookmark", "g1AAAA", result.Bookmark)
+	check(t, "warning", "No matching index found, create an index to optimize query time.", result.Warning)
+	check(t, "stats", &couchdb.ExecutionStats{TotalDocsExamined: 3, ResultsReturned: 1, ExecutionTimeMs: 1.5}, result.ExecutionStats)
+	check(t, "execution time", 1500*time.Microsecond, result.ExecutionStats.ExecutionTime())
+}
+
+func TestFindQuery(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("POST /db/_find", func(resp ResponseWriter, req *Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		check(t, "request body", `{"selector":{"type":"user"},"fields":["_id","name"],"sort":[{"type":"asc"},{"name":"desc"}],"limit":10,"use_index":["_design/idx","by-name"],"bookmark":"g1AAAA","update":false}`, string(body))
+		io.WriteString(resp, `{"docs": [{"_id": "b", "name": "bob"}], "bookmark": "g2AAAA"}`)
+	})
+
+	noUpdate := false
+	query := &couchdb.FindQuery{
+		Selector: map[string]string{"type": "user"},
+		Fields:   []string{"_id", "name"},
+		Sort:     []couchdb.SortField{{Field: "type"}, {Field: "name", Desc: true}},
+		Limit:    10,
+		UseIndex: []string{"_design/idx", "by-name"},
+		Bookmark: "g1AAAA",
+		Update:   &noUpdate,
+	}
+	var docs []map[string]string
+	result := &couchdb.FindResult{Docs: &docs}
+	if err := c.DB("db").Find(query, result); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "docs", []map[string]string{{"_id": "b", "name": "bob"}}, docs)
+	check(t, "bookmark", "g2AAAA", result.Bookmark)
+	check(t, "stats", (*couchdb.ExecutionStats)(nil), result.ExecutionStats)
+}
+
+func TestExplain(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("POST /db/_explain", func(resp ResponseWriter, req *Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		check(t, "request body", `{"selector":{"year":{"$gt":2010}},"limit":2}`, string(body))
+		io.WriteString(resp, `{
+			"dbname": "db",
+			"index": {
+				"ddoc": "_design/idx",
+				"name": "by-year",
+				"type": "json",
+				"def": {"fields": [{"year": "asc"}]}
+			},
+			"selector": {"year": {"$gt": 2010}},
+			"opts": {"use_index": [], "bookmark": "nil"},
+			"limit": 2,
+			"skip": 0,
+			"fields": "all_fields",
+			"mrargs": {
+				"include_docs": true,
+				"view_type": "map",
+				"reduce": false,
+				"start_key": [2010],
+				"end_key": ["<MAX>"],
+				"direction": "fwd",
+				"stable": false,
+				"update": true
+			}
+		}`)
+	})
+
+	exp, err := c.DB("db").Explain(&couchdb.FindQuery{
+		Selector: map[string]interface{}{"year": map[string]int{"$gt": 2010}},
+		Limit:    2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "index name", "by-year", exp.Index.Name)
+	check(t, "index ddoc", "_design/idx", exp.Index.DDoc)
+	check(t, "full scan", false, exp.FullScan())
+	check(t, "fields", "all_fields", exp.Fields)
+	check(t, "start key", `[2010]`, string(exp.MRArgs.StartKey))
+	check(t, "end key", `["<MAX>"]`, string(exp.MRArgs.EndKey))
+	check(t, "direction", "fwd", exp.MRArgs.Direction)
+
+	all := &couchdb.ExplainResult{Index: couchdb.ExplainIndex{Name: "_all_docs", Type: "special"}}
+	check(t, "full scan", true, all.FullScan())
+}
+
+func TestFindIterator(t *testing.T) {
+	var requests []string
+	c := newTestClient(t)
+	c.Handle("POST /db/_find", func(resp ResponseWriter, req *Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		requests = append(requests, string(body))
+		var query couchdb.FindQuery
+		json.Unmarshal(body, &query)
+		switch query.Bookmark {
+		case "":
+			io.WriteString(resp, `{"docs": [{"_id": "a"}, {"_id": "b"}], "bookmark": "b1"}`)
+		case "b1":
+			io.WriteString(resp, `{"docs": [{"_id": "c"}, {"_id": "d"}], "bookmark": "b2"}`)
+		case "b2":
+			io.WriteString(resp, `{"docs": [{"_id": "e"}], "bookmark": "b3"}`)
+		default:
+			t.Errorf("unexpected bookmark %q", query.Bookmark)
+		}
+	})
+
+	it := c.DB("db").FindIterator(couchdb.FindQuery{
+		Selector: map[string]string{"type": "user"},
+		Limit:    2,
+		Skip:     1,
+	})
+	var ids []string
+	for it.Next() {
+		var doc struct {
+			ID string `json:"_id"`
+		}
+		if err := it.Scan(&doc); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, doc.ID)
+	}
+	check(t, "error", nil, it.Err())
+	check(t, "IDs", []string{"a", "b", "c", "d", "e"}, ids)
+	check(t, "bookmark", "b3", it.Bookmark())
+	check(t, "requests", []string{
+		`{"selector":{"type":"user"},"limit":2,"skip":1}`,
+		`{"selector":{"type":"user"},"limit":2,"bookmark":"b1"}`,
+		`{"selector":{"type":"user"},"limit":2,"bookmark":"b2"}`,
+	}, requests)
+	check(t, "Next after end", false, it.Next())
+}
+
+func TestFindIteratorEmptyLastPage(t *testing.T) {
+	c := newTestClient(t)
+	calls := 0
+	c.Handle("POST /db/_find", func(resp ResponseWriter, req *Request) {
+		calls++
+		if calls == 1 {
+			io.WriteString(resp, `{"docs": [{"_id": "a"}], "bookmark": "b1"}`)
+		} else {
+			io.WriteString(resp, `{"docs": [], "bookmark": "b1"}`)
+		}
+	})
+
+	it := c.DB("db").FindIterator(couchdb.FindQuery{Selector: map[string]string{}, Limit: 1})
+	n := 0
+	for it.Next() {
+		n++
+	}
+	check(t, "error", nil, it.Err())
+	check(t, "doc count", 1, n)
+	check(t, "requests", 2, calls)
+}
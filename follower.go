@@ -0,0 +1,421 @@
+package couchdb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Sink receives changes events from a Follower. Implementations
+// typically forward events to a message broker.
+type Sink interface {
+	Publish(ctx context.Context, c *Change) error
+}
+
+// SinkFunc turns a function into a Sink.
+type SinkFunc func(ctx context.Context, c *Change) error
+
+// Publish calls the function.
+func (f SinkFunc) Publish(ctx context.Context, c *Change) error {
+	return f(ctx, c)
+}
+
+// ChanSink is a Sink that sends events on a channel.
+// Publish blocks until the event is received or the context is canceled.
+type ChanSink chan<- *Change
+
+// Publish sends the event on the channel.
+func (ch ChanSink) Publish(ctx context.Context, c *Change) error {
+	select {
+	case ch <- c:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// OverflowPolicy determines what a BufferedSink does when its buffer is full.
+type OverflowPolicy int
+
+const (
+	// Block makes Publish wait until there is room in the buffer.
+	// This stalls the feed.
+	Block OverflowPolicy = iota
+
+	// DropOldest discards the oldest buffered event. A gap marker is
+	// delivered in place of the discarded events.
+	DropOldest
+)
+
+// ErrSinkClosed is returned by Publish after the sink has been closed.
+var ErrSinkClosed = errors.New("couchdb: sink is closed")
+
+// BufferedSink is a Sink that sends events on a channel through a bounded
+// buffer. Unlike ChanSink, it keeps reading the feed while the consumer
+// is busy, which prevents the connection from stalling and timing out
+// on the server side. What happens when the buffer fills up is determined
+// by the overflow policy.
+//
+// Gap markers are events with no ID whose Dropped field holds the number
+// of discarded events. Consumers can react to them by resynchronizing,
+// e.g. by restarting the follower from an older checkpoint.
+type BufferedSink struct {
+	c      chan *Change
+	policy OverflowPolicy
+	size   int
+
+	mu      sync.Mutex
+	queue   []*Change
+	dropped int  // events discarded before queue[0]
+	closed  bool // set by Close
+	wake    chan struct{}
+	space   chan struct{}
+}
+
+// NewBufferedSink creates a sink that buffers up to size events.
+// One more event may be held while it is waiting to be received.
+func NewBufferedSink(size int, policy OverflowPolicy) *BufferedSink {
+	if size < 1 {
+		size = 1
+	}
+	s := &BufferedSink{
+		c:      make(chan *Change),
+		policy: policy,
+		size:   size,
+		wake:   make(chan struct{}, 1),
+		space:  make(chan struct{}, 1),
+	}
+	go s.deliver()
+	return s
+}
+
+// C returns the channel on which events are delivered.
+// It is closed after Close when all buffered events have been received.
+func (s *BufferedSink) C() <-chan *Change {
+	return s.c
+}
+
+// Publish adds the event to the buffer.
+func (s *BufferedSink) Publish(ctx context.Context, c *Change) error {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return ErrSinkClosed
+		}
+		if len(s.queue) >= s.size && s.policy == DropOldest {
+			s.queue = s.queue[1:]
+			s.dropped++
+		}
+		if len(s.queue) < s.size {
+			s.queue = append(s.queue, c)
+			s.mu.Unlock()
+			signal(s.wake)
+			return nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.space:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Close stops accepting events. Buffered events are still delivered.
+func (s *BufferedSink) Close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	signal(s.wake)
+}
+
+func (s *BufferedSink) deliver() {
+	defer close(s.c)
+	for {
+		s.mu.Lock()
+		var next *Change
+		switch {
+		case s.dropped > 0:
+			next = &Change{Dropped: s.dropped}
+			s.dropped = 0
+		case len(s.queue) > 0:
+			next = s.queue[0]
+			s.queue = s.queue[1:]
+		}
+		closed := s.closed
+		s.mu.Unlock()
+
+		switch {
+		case next != nil:
+			signal(s.space)
+			s.c <- next
+		case closed:
+			return
+		default:
+			<-s.wake
+		}
+	}
+}
+
+// signal performs a non-blocking send on a notification channel.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// MemorySink is a Sink that records all events. It is intended for tests.
+type MemorySink struct {
+	mu     sync.Mutex
+	events []*Change
+}
+
+// Publish records the event.
+func (s *MemorySink) Publish(ctx context.Context, c *Change) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, c)
+	return nil
+}
+
+// Events returns the recorded events.
+func (s *MemorySink) Events() []*Change {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Change(nil), s.events...)
+}
+
+// FollowerOptions configures a Follower.
+type FollowerOptions struct {
+	// Checkpoints stores the position of the follower under Name.
+	// If nil, the follower starts at the sequence in Options["since"],
+	// or at the beginning of the feed. A "since" value of SinceNow is
+	// resolved to the current update sequence when Run is called.
+	Checkpoints CheckpointStore
+	Name        string
+
+	// CheckpointEvery is the number of events after which a checkpoint
+	// is saved. The default is 100. A checkpoint is also saved when Run returns.
+	CheckpointEvery int
+
+	// RetryDelay is the time to wait before reconnecting after the feed
+	// has failed. The default is one second.
+	RetryDelay time.Duration
+
+	// Options are additional options of the changes feed request,
+	// e.g. "include_docs" or "filter". The feed mode is always "continuous".
+	// A heartbeat of 30 seconds is requested unless "heartbeat" or
+	// "timeout" is set.
+	//
+	// With "seq_interval", checkpoints hold the sequence of the last event
+	// that had one, so some events are published again after a restart.
+	Options Options
+}
+
+// Follower reads the changes feed of a database continuously and
+// publishes all events to a Sink. The feed is reopened when the
+// connection fails.
+type Follower struct {
+	db   *DB
+	sink Sink
+	opts FollowerOptions
+
+	seq     interface{}
+	pending int // events since last checkpoint
+
+	mu     sync.Mutex
+	pause  chan struct{} // closed by Pause
+	resume chan struct{} // non-nil while paused, closed by Resume
+}
+
+// NewFollower creates a follower. Call Run to start following.
+func (db *DB) NewFollower(sink Sink, opts FollowerOptions) *Follower {
+	if opts.CheckpointEvery <= 0 {
+		opts.CheckpointEvery = 100
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = time.Second
+	}
+	return &Follower{db: db, sink: sink, opts: opts, pause: make(chan struct{})}
+}
+
+// Pause suspends Run. The feed connection is closed and a checkpoint is
+// saved. Run keeps waiting until Resume is called or its context is
+// canceled. This allows applying backpressure during outages of the
+// downstream system without losing the position in the feed.
+//
+// If the sink calls Pause and then returns an error, the error does not
+// end Run. The event is published again after Resume.
+func (f *Follower) Pause() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.resume == nil {
+		f.resume = make(chan struct{})
+		close(f.pause)
+	}
+}
+
+// Resume continues following after Pause. The feed is reopened
+// at the last published event.
+func (f *Follower) Resume() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.resume != nil {
+		close(f.resume)
+		f.resume = nil
+		f.pause = make(chan struct{})
+	}
+}
+
+// Paused reports whether the follower is paused.
+func (f *Follower) Paused() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.resume != nil
+}
+
+func (f *Follower) pauseState() (pause, resume chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pause, f.resume
+}
+
+// Run follows the feed until the context is canceled or the sink returns
+// an error. Events are published in feed order. After an event has been
+// published successfully, it will not be published again by followers
+// that use the same checkpoint, unless Run is interrupted before the
+// checkpoint is saved.
+func (f *Follower) Run(ctx context.Context) (err error) {
+	f.seq = f.opts.Options["since"]
+	if f.opts.Checkpoints != nil {
+		seq, err := f.opts.Checkpoints.LoadCheckpoint(f.opts.Name)
+		if err != nil {
+			return err
+		}
+		if seq != nil {
+			f.seq = seq
+		}
+	}
+	if s, _ := optionString(f.seq); s == "now" {
+		// Resolve "now" once, so events aren't lost when reconnecting.
+		if f.seq, err = f.db.UpdateSeq(); err != nil {
+			return err
+		}
+	}
+	defer func() {
+		if cerr := f.checkpoint(); err == nil {
+			err = cerr
+		}
+	}()
+
+	for {
+		if _, resume := f.pauseState(); resume != nil {
+			if err := f.checkpoint(); err != nil {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-resume:
+			}
+		}
+		err := f.follow(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if f.Paused() {
+			continue
+		}
+		if serr, ok := err.(sinkError); ok {
+			return serr.err
+		}
+		if err == nil {
+			continue // feed ended normally, reconnect immediately
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(f.opts.RetryDelay):
+		}
+	}
+}
+
+// sinkError wraps errors returned by the sink.
+type sinkError struct{ err error }
+
+func (e sinkError) Error() string { return e.err.Error() }
+
+// follow reads the feed until it fails.
+func (f *Follower) follow(ctx context.Context) error {
+	opts := f.opts.Options.clone()
+	opts["feed"] = "continuous"
+	_, heartbeat := opts["heartbeat"]
+	_, timeout := opts["timeout"]
+	if !heartbeat && !timeout {
+		opts["heartbeat"] = 30000
+	}
+	if f.seq != nil {
+		opts["since"] = f.seq
+	} else {
+		delete(opts, "since")
+	}
+	feed, err := f.db.Changes(opts)
+	if err != nil {
+		return err
+	}
+	defer feed.Close()
+
+	// Close the connection when the context is canceled
+	// or the follower is paused to unblock Next.
+	pause, _ := f.pauseState()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			feed.conn.Close()
+		case <-pause:
+			feed.conn.Close()
+		case <-done:
+		}
+	}()
+
+	for feed.Next() {
+		if err := f.sink.Publish(ctx, feed.change()); err != nil {
+			return sinkError{err}
+		}
+		if feed.Seq != nil {
+			f.seq = feed.Seq
+		}
+		if f.pending++; f.pending >= f.opts.CheckpointEvery {
+			if err := f.checkpoint(); err != nil {
+				return err
+			}
+		}
+	}
+	if feed.Err() == nil {
+		f.seq = feed.LastSeq()
+	}
+	return feed.Err()
+}
+
+func (f *Follower) checkpoint() error {
+	if f.opts.Checkpoints == nil || f.pending == 0 {
+		return nil
+	}
+	if err := f.opts.Checkpoints.SaveCheckpoint(f.opts.Name, f.seq); err != nil {
+		return err
+	}
+	f.pending = 0
+	return nil
+}
+
+// Seq returns the sequence of the last published event.
+// It must not be called while Run is executing.
+func (f *Follower) Seq() interface{} {
+	return f.seq
+}
@@ -0,0 +1,249 @@
+package couchdb_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	. "net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fjl/go-couchdb"
+)
+
+type memCheckpoints struct {
+	mu   sync.Mutex
+	seqs map[string]interface{}
+}
+
+func (m *memCheckpoints) LoadCheckpoint(name string) (interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.seqs[name], nil
+}
+
+func (m *memCheckpoints) SaveCheckpoint(name string, seq interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seqs[name] = seq
+	return nil
+}
+
+func TestFollower(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/_changes", func(resp ResponseWriter, req *Request) {
+		q := req.URL.Query()
+		check(t, "feed", "continuous", q.Get("feed"))
+		switch q.Get("since") {
+		case "1-...":
+			io.WriteString(resp, `{"seq": "2-...", "id": "b", "changes": [{"rev": "1-b"}]}`+"\n")
+			io.WriteString(resp, `{"last_seq": "2-...", "pending": 0}`+"\n")
+		case "2-...":
+			// The connection breaks after one event.
+			io.WriteString(resp, `{"seq": "3-...", "id": "c", "changes": [{"rev": "1-c"}]}`+"\n")
+		default:
+			t.Errorf("unexpected since %q", q.Get("since"))
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mem := new(couchdb.MemorySink)
+	sink := couchdb.SinkFunc(func(ctx context.Context, c *couchdb.Change) error {
+		mem.Publish(ctx, c)
+		if c.ID == "c" {
+			cancel()
+		}
+		return nil
+	})
+	store := &memCheckpoints{seqs: map[string]interface{}{"f": "1-..."}}
+	f := c.DB("db").NewFollower(sink, couchdb.FollowerOptions{
+		Checkpoints: store,
+		Name:        "f",
+		RetryDelay:  time.Millisecond,
+	})
+
+	err := f.Run(ctx)
+	check(t, "error", context.Canceled, err)
+	var ids []string
+	for _, ev := range mem.Events() {
+		ids = append(ids, ev.ID)
+	}
+	check(t, "published IDs", []string{"b", "c"}, ids)
+	check(t, "checkpoint", "3-...", store.seqs["f"])
+}
+
+func TestFollowerSinceNow(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"db_name": "db", "update_seq": "5-..."}`)
+	})
+	c.Handle("GET /db/_changes", func(resp ResponseWriter, req *Request) {
+		check(t, "since", "5-...", req.URL.Query().Get("since"))
+		io.WriteString(resp, `{"seq": "6-...", "id": "a", "changes": [{"rev": "1-a"}]}`+"\n")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sink := couchdb.SinkFunc(func(ctx context.Context, c *couchdb.Change) error {
+		cancel()
+		return nil
+	})
+	store := &memCheckpoints{seqs: map[string]interface{}{}}
+	f := c.DB("db").NewFollower(sink, couchdb.FollowerOptions{
+		Checkpoints: store,
+		Name:        "f",
+		Options:     couchdb.Options{"since": "now"},
+	})
+	check(t, "error", context.Canceled, f.Run(ctx))
+	check(t, "checkpoint", "6-...", store.seqs["f"])
+}
+
+func TestFollowerSinkError(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/_changes", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"seq": "1-...", "id": "a", "changes": [{"rev": "1-a"}]}`+"\n")
+	})
+
+	sinkErr := errors.New("broker unavailable")
+	sink := couchdb.SinkFunc(func(ctx context.Context, c *couchdb.Change) error {
+		return sinkErr
+	})
+	err := c.DB("db").NewFollower(sink, couchdb.FollowerOptions{}).Run(context.Background())
+	check(t, "error", sinkErr, err)
+}
+
+func TestFollowerPause(t *testing.T) {
+	srv := httptest.NewServer(HandlerFunc(func(resp ResponseWriter, req *Request) {
+		switch since := req.URL.Query().Get("since"); since {
+		case "":
+			io.WriteString(resp, `{"seq": 1, "id": "a", "changes": [{"rev": "1-a"}]}`+"\n")
+			io.WriteString(resp, `{"seq": 2, "id": "b", "changes": [{"rev": "1-b"}]}`+"\n")
+		case "1":
+			io.WriteString(resp, `{"seq": 2, "id": "b", "changes": [{"rev": "1-b"}]}`+"\n")
+			io.WriteString(resp, `{"seq": 3, "id": "c", "changes": [{"rev": "1-c"}]}`+"\n")
+		default:
+			t.Errorf("unexpected since %q", since)
+			return
+		}
+		resp.(Flusher).Flush()
+		<-req.Context().Done() // keep the feed open until the client disconnects
+	}))
+	defer srv.Close()
+	c, err := couchdb.NewClient(srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		f      *couchdb.Follower
+		ids    []string
+		paused = make(chan struct{})
+	)
+	sink := couchdb.SinkFunc(func(ctx context.Context, c *couchdb.Change) error {
+		ids = append(ids, c.ID)
+		switch {
+		case c.ID == "b" && len(ids) == 2:
+			// The downstream system is unavailable.
+			f.Pause()
+			close(paused)
+			return errors.New("broker unavailable")
+		case c.ID == "c":
+			cancel()
+		}
+		return nil
+	})
+	store := &memCheckpoints{seqs: map[string]interface{}{}}
+	f = c.DB("db").NewFollower(sink, couchdb.FollowerOptions{Checkpoints: store, Name: "f"})
+
+	errc := make(chan error, 1)
+	go func() { errc <- f.Run(ctx) }()
+	<-paused
+	check(t, "paused", true, f.Paused())
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		store.mu.Lock()
+		seq := store.seqs["f"]
+		store.mu.Unlock()
+		if seq != nil {
+			check(t, "checkpoint while paused", float64(1), seq)
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no checkpoint saved while paused")
+		}
+	}
+	f.Resume()
+
+	check(t, "error", context.Canceled, <-errc)
+	check(t, "paused", false, f.Paused())
+	check(t, "published IDs", []string{"a", "b", "b", "c"}, ids)
+	check(t, "checkpoint", float64(3), store.seqs["f"])
+}
+
+func TestChanSink(t *testing.T) {
+	ch := make(chan *couchdb.Change, 1)
+	sink := couchdb.ChanSink(ch)
+	if err := sink.Publish(context.Background(), &couchdb.Change{ID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "received ID", "a", (<-ch).ID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	check(t, "error", context.Canceled, couchdb.ChanSink(make(chan *couchdb.Change)).Publish(ctx, &couchdb.Change{}))
+}
+
+func TestBufferedSinkBlock(t *testing.T) {
+	sink := couchdb.NewBufferedSink(1, couchdb.Block)
+	bg := context.Background()
+	for _, id := range []string{"a", "b"} {
+		if err := sink.Publish(bg, &couchdb.Change{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// One event is in flight, one is buffered. The next one can't be added.
+	ctx, cancel := context.WithTimeout(bg, 20*time.Millisecond)
+	defer cancel()
+	check(t, "error", context.DeadlineExceeded, sink.Publish(ctx, &couchdb.Change{ID: "c"}))
+
+	sink.Close()
+	check(t, "error after close", couchdb.ErrSinkClosed, sink.Publish(bg, &couchdb.Change{ID: "d"}))
+	var ids []string
+	for c := range sink.C() {
+		ids = append(ids, c.ID)
+	}
+	check(t, "received IDs", []string{"a", "b"}, ids)
+}
+
+func TestBufferedSinkDropOldest(t *testing.T) {
+	sink := couchdb.NewBufferedSink(2, couchdb.DropOldest)
+	ids := []string{"a", "b", "c", "d", "e"}
+	for _, id := range ids {
+		if err := sink.Publish(context.Background(), &couchdb.Change{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sink.Close()
+
+	var received []*couchdb.Change
+	for c := range sink.C() {
+		received = append(received, c)
+	}
+	// Depending on timing, "a" may already be in flight when the
+	// buffer overflows. The last events are always delivered.
+	n := len(received)
+	if n < 3 {
+		t.Fatalf("received %d events, want at least 3", n)
+	}
+	gap := received[n-3]
+	check(t, "gap marker ID", "", gap.ID)
+	check(t, "received count", len(ids), n-1+gap.Dropped)
+	check(t, "last IDs", []string{"d", "e"}, []string{received[n-2].ID, received[n-1].ID})
+	for i, c := range received[:n-3] {
+		check(t, "ID", ids[i], c.ID)
+	}
+}
@@ -0,0 +1,133 @@
+package couchdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ConnectionReport is the result of VerifyConnection.
+type ConnectionReport struct {
+	// Server information from GET /.
+	Version string
+	Vendor  string
+	UUID    string
+
+	// Session information from GET /_session. User is empty
+	// if the client has no credentials.
+	User  string
+	Roles []string
+
+	// UpChecked is true if the /_up endpoint was checked, which is
+	// done for all servers except CouchDB 1.x. Up reports its result.
+	UpChecked bool
+	Up        bool
+}
+
+// VerifyError is returned by VerifyConnection. Step is the check
+// that failed: "server", "session" or "up".
+type VerifyError struct {
+	Step string
+	Err  error
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("couchdb: %s check failed: %v", e.Step, e.Err)
+}
+
+// ErrCredentialsRejected is wrapped by the VerifyError returned when
+// the server treats the client's requests as anonymous even though
+// authentication is configured.
+var ErrCredentialsRejected = errors.New("credentials not accepted by server")
+
+// VerifyConnection checks that the server is reachable, that it accepts the
+// client's credentials and, if supported, that it is ready to serve requests.
+// It is meant to be called at startup to fail early with a precise reason.
+//
+// The returned error is a *VerifyError identifying the failed check.
+// The report contains the information gathered up to that point.
+func (c *Client) VerifyConnection(ctx context.Context) (*ConnectionReport, error) {
+	report := new(ConnectionReport)
+
+	var info struct {
+		Version string `json:"version"`
+		UUID    string `json:"uuid"`
+		Vendor  struct {
+			Name string `json:"name"`
+		} `json:"vendor"`
+	}
+	if err := c.getJSON(ctx, "/", &info); err != nil {
+		return report, &VerifyError{"server", err}
+	}
+	report.Version, report.Vendor, report.UUID = info.Version, info.Vendor.Name, info.UUID
+
+	user, roles, err := c.sessionUser(ctx)
+	if err != nil {
+		return report, &VerifyError{"session", err}
+	}
+	c.mu.RLock()
+	auth := c.auth
+	c.mu.RUnlock()
+	if user == "" && auth != nil {
+		// Session-based Auth implementations log in on the first 401.
+		// GET /_session doesn't fail for anonymous users, so log in here.
+		if r, ok := auth.(Refresher); ok {
+			if err := r.Refresh(c.http, c.prefix, nil); err != nil {
+				return report, &VerifyError{"session", err}
+			}
+			if user, roles, err = c.sessionUser(ctx); err != nil {
+				return report, &VerifyError{"session", err}
+			}
+		}
+		if user == "" && !containsString(roles, "_admin") {
+			return report, &VerifyError{"session", ErrCredentialsRejected}
+		}
+	}
+	report.User, report.Roles = user, roles
+
+	if strings.HasPrefix(report.Version, "1.") {
+		// CouchDB 1.x doesn't support /_up.
+		return report, nil
+	}
+	// Nodes in maintenance mode respond with 404, which
+	// fails the check like any other error.
+	var up struct {
+		Status string `json:"status"`
+	}
+	report.UpChecked = true
+	if err := c.getJSON(ctx, "/_up", &up); err != nil {
+		return report, &VerifyError{"up", err}
+	}
+	report.Up = up.Status == "ok"
+	if !report.Up {
+		return report, &VerifyError{"up", fmt.Errorf("server status is %q", up.Status)}
+	}
+	return report, nil
+}
+
+// sessionUser returns the user name and roles of the current session.
+func (c *Client) sessionUser(ctx context.Context) (string, []string, error) {
+	var session struct {
+		UserCtx struct {
+			Name  string   `json:"name"`
+			Roles []string `json:"roles"`
+		} `json:"userCtx"`
+	}
+	if err := c.getJSON(ctx, "/_session", &session); err != nil {
+		return "", nil, err
+	}
+	return session.UserCtx.Name, session.UserCtx.Roles, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, v interface{}) error {
+	req, err := c.newRequest("GET", path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	return readBody(resp, v)
+}
@@ -0,0 +1,111 @@
+package couchdb_test
+
+import (
+	"context"
+	"io"
+	. "net/http"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestVerifyConnection(t *testing.T) {
+	c := newTestClient(t)
+	c.SetAuth(couchdb.BasicAuth("user", "pass"))
+	c.Handle("GET /", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"couchdb":"Welcome","version":"3.3.2","uuid":"abc","vendor":{"name":"The Apache Software Foundation"}}`)
+	})
+	c.Handle("GET /_session", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"ok":true,"userCtx":{"name":"user","roles":["reader"]}}`)
+	})
+	c.Handle("GET /_up", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"status":"ok"}`)
+	})
+
+	report, err := c.VerifyConnection(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "report", &couchdb.ConnectionReport{
+		Version:   "3.3.2",
+		Vendor:    "The Apache Software Foundation",
+		UUID:      "abc",
+		User:      "user",
+		Roles:     []string{"reader"},
+		UpChecked: true,
+		Up:        true,
+	}, report)
+}
+
+func TestVerifyConnectionRejected(t *testing.T) {
+	c := newTestClient(t)
+	c.SetAuth(couchdb.BasicAuth("user", "wrong"))
+	c.Handle("GET /", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"couchdb":"Welcome","version":"1.6.1"}`)
+	})
+	c.Handle("GET /_session", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"ok":true,"userCtx":{"name":null,"roles":[]}}`)
+	})
+
+	_, err := c.VerifyConnection(context.Background())
+	verr, ok := err.(*couchdb.VerifyError)
+	if !ok {
+		t.Fatalf("expected *VerifyError, got %v", err)
+	}
+	check(t, "step", "session", verr.Step)
+	check(t, "cause", couchdb.ErrCredentialsRejected, verr.Err)
+}
+
+func TestVerifyConnectionNoUp(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"couchdb":"Welcome","version":"1.6.1"}`)
+	})
+	c.Handle("GET /_session", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"ok":true,"userCtx":{"name":null,"roles":[]}}`)
+	})
+	c.Handle("GET /_up", func(resp ResponseWriter, req *Request) {
+		resp.WriteHeader(StatusBadRequest)
+		io.WriteString(resp, `{"error":"illegal_database_name","reason":"Name: '_up'."}`)
+	})
+
+	report, err := c.VerifyConnection(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "version", "1.6.1", report.Version)
+	check(t, "up checked", false, report.UpChecked)
+}
+
+func TestVerifyConnectionMaintenance(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"couchdb":"Welcome","version":"3.3.2"}`)
+	})
+	c.Handle("GET /_session", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"ok":true,"userCtx":{"name":null,"roles":[]}}`)
+	})
+	c.Handle("GET /_up", func(resp ResponseWriter, req *Request) {
+		resp.WriteHeader(StatusNotFound)
+		io.WriteString(resp, `{"status":"maintenance_mode"}`)
+	})
+
+	report, err := c.VerifyConnection(context.Background())
+	if verr, ok := err.(*couchdb.VerifyError); !ok || verr.Step != "up" {
+		t.Fatalf("expected up step error, got %v", err)
+	}
+	check(t, "up checked", true, report.UpChecked)
+	check(t, "up", false, report.Up)
+}
+
+func TestVerifyConnectionServerDown(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /", func(resp ResponseWriter, req *Request) {
+		resp.WriteHeader(StatusServiceUnavailable)
+		io.WriteString(resp, `{"error":"unavailable","reason":"maintenance"}`)
+	})
+	_, err := c.VerifyConnection(context.Background())
+	if verr, ok := err.(*couchdb.VerifyError); !ok || verr.Step != "server" {
+		t.Fatalf("expected server step error, got %v", err)
+	}
+}
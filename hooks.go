@@ -0,0 +1,151 @@
+package couchdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// WriteEvent describes a document write for hooks.
+type WriteEvent struct {
+	DB     *DB
+	Op     string // "put", "post", "delete" or "bulk"
+	ID     string // document ID, empty for Post if the server assigns it
+	Rev    string // revision that is replaced, empty for new documents
+	Doc    map[string]json.RawMessage
+	Delete bool // the document is deleted
+
+	// NewRev and Err are set for hooks that run after the write.
+	NewRev string
+	Err    error
+}
+
+// Set sets a document field. It is meant to be called by hooks that
+// run before the write.
+func (e *WriteEvent) Set(field string, value interface{}) error {
+	if e.Doc == nil {
+		return errors.New("couchdb: can't set field of deleted document")
+	}
+	enc, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("couchdb: can't set field %q: %v", field, err)
+	}
+	e.Doc[field] = enc
+	return nil
+}
+
+// Get decodes a document field into v.
+// It returns false if the field does not exist.
+func (e *WriteEvent) Get(field string, v interface{}) (bool, error) {
+	raw, ok := e.Doc[field]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+// BeforeWriteHook is called before a document is written. It can modify the
+// document through the event. If it returns an error, the write is aborted
+// and the error is returned by the write method. For BulkDocs, the error
+// aborts the whole request.
+type BeforeWriteHook func(*WriteEvent) error
+
+// AfterWriteHook is called after a document has been written or the
+// write has failed.
+type AfterWriteHook func(*WriteEvent)
+
+type writeHooks struct {
+	before []BeforeWriteHook
+	after  []AfterWriteHook
+}
+
+// WithBeforeWrite returns a copy of the database object that calls h before
+// documents are written by Put, Post, Delete and BulkDocs. Hooks run in the
+// order they were added. Other write methods, e.g. BulkWriter and Batch, use
+// BulkDocs and run the hooks as well.
+//
+// For deletions, Doc is nil. Documents written while hooks are registered
+// must encode to JSON objects.
+func (db *DB) WithBeforeWrite(h BeforeWriteHook) *DB {
+	cpy := *db
+	cpy.hooks = new(writeHooks)
+	if db.hooks != nil {
+		*cpy.hooks = *db.hooks
+	}
+	cpy.hooks.before = append(cpy.hooks.before[:len(cpy.hooks.before):len(cpy.hooks.before)], h)
+	return &cpy
+}
+
+// WithAfterWrite returns a copy of the database object that calls h after
+// documents have been written by Put, Post, Delete and BulkDocs. For BulkDocs,
+// h is called for each document. It is not called if the request could not
+// be sent.
+func (db *DB) WithAfterWrite(h AfterWriteHook) *DB {
+	cpy := *db
+	cpy.hooks = new(writeHooks)
+	if db.hooks != nil {
+		*cpy.hooks = *db.hooks
+	}
+	cpy.hooks.after = append(cpy.hooks.after[:len(cpy.hooks.after):len(cpy.hooks.after)], h)
+	return &cpy
+}
+
+// AddWriteHooks registers hooks that are inherited by all database objects
+// created by DB after the call. Either hook may be nil. See DB.WithBeforeWrite
+// and DB.WithAfterWrite.
+func (c *Client) AddWriteHooks(before BeforeWriteHook, after AfterWriteHook) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hooks := new(writeHooks)
+	if c.hooks != nil {
+		*hooks = *c.hooks
+	}
+	if before != nil {
+		hooks.before = append(hooks.before[:len(hooks.before):len(hooks.before)], before)
+	}
+	if after != nil {
+		hooks.after = append(hooks.after[:len(hooks.after):len(hooks.after)], after)
+	}
+	c.hooks = hooks
+}
+
+// beforeWrite creates the event of a write and runs the before hooks.
+// The body is the encoded document, or nil for deletions. It returns
+// the body modified by the hooks.
+func (db *DB) beforeWrite(op, id, rev string, body []byte) (*WriteEvent, []byte, error) {
+	ev := &WriteEvent{DB: db, Op: op, ID: id, Rev: rev, Delete: body == nil}
+	if body != nil {
+		if err := json.Unmarshal(body, &ev.Doc); err != nil || ev.Doc == nil {
+			return nil, nil, errors.New("couchdb: write hooks require documents that encode to JSON objects")
+		}
+		if ev.ID == "" {
+			ev.Get("_id", &ev.ID)
+		}
+		if ev.Rev == "" {
+			ev.Get("_rev", &ev.Rev)
+		}
+		var deleted bool
+		ev.Get("_deleted", &deleted)
+		ev.Delete = deleted
+	}
+	for _, h := range db.hooks.before {
+		if err := h(ev); err != nil {
+			return nil, nil, err
+		}
+	}
+	if body != nil {
+		var err error
+		if body, err = json.Marshal(ev.Doc); err != nil {
+			return nil, nil, err
+		}
+	}
+	return ev, body, nil
+}
+
+// afterWrite runs the after hooks.
+func (db *DB) afterWrite(ev *WriteEvent, newrev string, err error) {
+	ev.NewRev, ev.Err = newrev, err
+	for _, h := range db.hooks.after {
+		h(ev)
+	}
+}
@@ -0,0 +1,73 @@
+package couchdb_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	. "net/http"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestWriteHooks(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("PUT /db/a", func(resp ResponseWriter, req *Request) {
+		var doc map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&doc)
+		check(t, "put doc", map[string]interface{}{"field": float64(1), "type": "item"}, doc)
+		resp.Header().Set("ETag", `"1-a"`)
+		resp.WriteHeader(StatusCreated)
+		io.WriteString(resp, `{"ok": true, "id": "a", "rev": "1-a"}`)
+	})
+	c.Handle("POST /db/_bulk_docs", func(resp ResponseWriter, req *Request) {
+		docs := bulkRequest(t, req)
+		check(t, "bulk docs", []map[string]interface{}{
+			{"_id": "b", "field": float64(2), "type": "item"},
+			{"_id": "c", "_rev": "1-c", "_deleted": true},
+		}, docs)
+		io.WriteString(resp, `[{"id": "b", "rev": "1-b"}, {"id": "c", "error": "conflict", "reason": "Document update conflict."}]`)
+	})
+
+	var log []string
+	db := c.DB("db").
+		WithBeforeWrite(func(ev *couchdb.WriteEvent) error {
+			if ev.Delete {
+				return nil
+			}
+			return ev.Set("type", "item")
+		}).
+		WithAfterWrite(func(ev *couchdb.WriteEvent) {
+			entry := ev.Op + " " + ev.ID + " " + ev.NewRev
+			if ev.Err != nil {
+				entry += " " + ev.Err.Error()
+			}
+			log = append(log, entry)
+		})
+
+	if _, err := db.Put("a", &testDocument{Field: 1}, ""); err != nil {
+		t.Fatal(err)
+	}
+	_, err := db.BulkDocs([]interface{}{
+		map[string]interface{}{"_id": "b", "field": 2},
+		map[string]interface{}{"_id": "c", "_rev": "1-c", "_deleted": true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "log", []string{
+		"put a 1-a",
+		"bulk b 1-b",
+		`bulk c  couchdb: document "c": conflict: Document update conflict.`,
+	}, log)
+
+	// Hooks registered on the copy don't affect the original.
+	hookErr := errors.New("rejected")
+	rejecting := db.WithBeforeWrite(func(*couchdb.WriteEvent) error { return hookErr })
+	if _, err := rejecting.Put("a", &testDocument{}, ""); err != hookErr {
+		t.Errorf("expected hook error, got %v", err)
+	}
+	if _, err := db.Put("a", &testDocument{Field: 1}, ""); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,6 +2,7 @@ package couchdb
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,13 +10,18 @@ import (
 	"net/http"
 	"net/url"
 	"reflect"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Options represents CouchDB query string parameters.
+// Values of slice, array or map type are sent as JSON.
+//
+// Values of type time.Time are sent in RFC 3339 format. For other
+// types implementing fmt.Stringer or json.Marshaler, the value is
+// the result of String or MarshalJSON.
 type Options map[string]interface{}
 
 // clone creates a shallow copy of an Options map
@@ -27,18 +33,69 @@ func (opts Options) clone() (result Options) {
 	return
 }
 
+// merge returns opts with the values of override added.
+// Neither of the maps is modified.
+func (opts Options) merge(override Options) Options {
+	if len(override) == 0 {
+		return opts
+	} else if len(opts) == 0 {
+		return override
+	}
+	result := opts.clone()
+	for k, v := range override {
+		result[k] = v
+	}
+	return result
+}
+
 type transport struct {
-	prefix string // URL prefix
-	http   *http.Client
-	mu     sync.RWMutex
-	auth   Auth
+	prefix     string // URL prefix
+	http       *http.Client
+	mu         sync.RWMutex
+	auth       Auth
+	useNumber  bool
+	useIfMatch bool
+	defaults   Options
+	header     http.Header
+	sem        chan struct{} // limits concurrent requests if non-nil
+	maxURLLen  int           // query requests with longer URLs are sent as POST
+	dbNameMode DBNameMode
+	hooks      *writeHooks // inherited by new DB objects
+
+	// debugCapture is the number of body bytes kept for failed requests.
+	debugCapture int
+
+	docSize DocSizeOptions // checked before writing documents
+
+	// Requests in flight are tracked so Close can cancel them.
+	reqmu    sync.Mutex
+	closed   bool
+	inflight map[*inflightRequest]struct{}
+}
+
+// inflightRequest is a request that has not completed.
+// Requests complete when their response body is closed.
+type inflightRequest struct {
+	cancel context.CancelFunc
 }
 
+// defaultMaxURLLen is the default URL length above which
+// query requests are sent as POST.
+const defaultMaxURLLen = 8000
+
 func newTransport(prefix string, rt http.RoundTripper, auth Auth) *transport {
+	if rt == nil {
+		// Use a dedicated connection pool so CloseIdleConnections
+		// doesn't affect other users of http.DefaultTransport.
+		if dt, ok := http.DefaultTransport.(*http.Transport); ok {
+			rt = dt.Clone()
+		}
+	}
 	return &transport{
-		prefix: strings.TrimRight(prefix, "/"),
-		http:   &http.Client{Transport: rt},
-		auth:   auth,
+		prefix:    strings.TrimRight(prefix, "/"),
+		http:      &http.Client{Transport: rt},
+		auth:      auth,
+		maxURLLen: defaultMaxURLLen,
 	}
 }
 
@@ -48,14 +105,177 @@ func (t *transport) setAuth(a Auth) {
 	t.mu.Unlock()
 }
 
+func (t *transport) setUseNumber(enable bool) {
+	t.mu.Lock()
+	t.useNumber = enable
+	t.mu.Unlock()
+}
+
+func (t *transport) setUseIfMatch(enable bool) {
+	t.mu.Lock()
+	t.useIfMatch = enable
+	t.mu.Unlock()
+}
+
+func (t *transport) setHeader(key, value string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.header == nil {
+		t.header = make(http.Header)
+	}
+	if value == "" {
+		t.header.Del(key)
+	} else {
+		t.header.Set(key, value)
+	}
+}
+
+func (t *transport) setMaxConcurrentRequests(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if n <= 0 {
+		t.sem = nil
+	} else {
+		t.sem = make(chan struct{}, n)
+	}
+}
+
+func (t *transport) setMaxURLLength(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.maxURLLen = n
+}
+
+// acquire waits for a request slot. The returned function
+// releases the slot. It is nil if the number of requests is not limited.
+func (t *transport) acquire(ctx context.Context) (func(), error) {
+	t.mu.RLock()
+	sem := t.sem
+	t.mu.RUnlock()
+	if sem == nil {
+		return nil, nil
+	}
+	select {
+	case sem <- struct{}{}:
+		var once sync.Once
+		return func() { once.Do(func() { <-sem }) }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// track registers a request so that it can be canceled by close.
+// The returned function completes the request.
+func (t *transport) track(req *http.Request) (*http.Request, func(), error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	r := &inflightRequest{cancel}
+	t.reqmu.Lock()
+	defer t.reqmu.Unlock()
+	if t.closed {
+		cancel()
+		return nil, nil, ErrClientClosed
+	}
+	if t.inflight == nil {
+		t.inflight = make(map[*inflightRequest]struct{})
+	}
+	t.inflight[r] = struct{}{}
+	done := func() {
+		t.reqmu.Lock()
+		delete(t.inflight, r)
+		t.reqmu.Unlock()
+		cancel()
+	}
+	return req.WithContext(ctx), done, nil
+}
+
+// close cancels all requests in flight and rejects new requests.
+func (t *transport) close() {
+	t.reqmu.Lock()
+	defer t.reqmu.Unlock()
+	t.closed = true
+	for r := range t.inflight {
+		r.cancel()
+	}
+	t.inflight = nil
+}
+
+// closedErr returns ErrClientClosed instead of err if the transport
+// has been closed, since err is then usually caused by the cancellation.
+func (t *transport) closedErr(err error) error {
+	t.reqmu.Lock()
+	defer t.reqmu.Unlock()
+	if t.closed {
+		return ErrClientClosed
+	}
+	return err
+}
+
+// releaseBody completes the request when the response body is closed.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+func (t *transport) setDefaultOptions(opts Options) {
+	t.mu.Lock()
+	t.defaults = opts.clone()
+	t.mu.Unlock()
+}
+
+// withDefaults merges the client default options into opts.
+func (t *transport) withDefaults(opts Options) Options {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.defaults.merge(opts)
+}
+
+// newDecoder creates a JSON decoder for response data.
+func (t *transport) newDecoder(r io.Reader) *json.Decoder {
+	dec := json.NewDecoder(r)
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.useNumber {
+		dec.UseNumber()
+	}
+	return dec
+}
+
+// readBody decodes a response containing user data, e.g. a document.
+// Unlike the readBody function, it respects the client's number setting.
+func (t *transport) readBody(resp *http.Response, v interface{}) error {
+	if err := t.newDecoder(resp.Body).Decode(v); err != nil {
+		resp.Body.Close()
+		return err
+	}
+	return resp.Body.Close()
+}
+
 func (t *transport) newRequest(method, path string, body io.Reader) (*http.Request, error) {
+	return t.buildRequest(method, path, body, true)
+}
+
+// newAnonRequest creates a request without authentication information.
+func (t *transport) newAnonRequest(method, path string, body io.Reader) (*http.Request, error) {
+	return t.buildRequest(method, path, body, false)
+}
+
+func (t *transport) buildRequest(method, path string, body io.Reader, auth bool) (*http.Request, error) {
 	req, err := http.NewRequest(method, t.prefix+path, body)
 	if err != nil {
 		return nil, err
 	}
 	t.mu.RLock()
 	defer t.mu.RUnlock()
-	if t.auth != nil {
+	for k, v := range t.header {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	if auth && t.auth != nil {
 		t.auth.AddAuth(req)
 	}
 	return req, nil
@@ -72,13 +292,53 @@ func (t *transport) request(method, path string, body io.Reader) (*http.Response
 	if err != nil {
 		return nil, err
 	}
-	if body != nil {
-		req.Header.Set("content-type", "application/json")
+	return t.do(req)
+}
+
+var jsonContentType = []string{"application/json"}
+
+// do sends a request created by newRequest.
+// Status codes >= 400 are treated as errors.
+func (t *transport) do(req *http.Request) (*http.Response, error) {
+	// Header keys are given in canonical form because Get and Set
+	// would allocate when canonicalizing them.
+	if req.Body != nil && len(req.Header["Content-Type"]) == 0 {
+		req.Header["Content-Type"] = jsonContentType
 	}
 
-	resp, err := t.http.Do(req)
+	req, done, err := t.track(req)
 	if err != nil {
 		return nil, err
+	}
+	release, err := t.acquire(req.Context())
+	if err != nil {
+		done()
+		return nil, t.closedErr(err)
+	}
+	if release != nil {
+		complete := done
+		done = func() { release(); complete() }
+	}
+	var reqBody *captureBuffer
+	limit := t.debugCaptureLimit()
+	if limit > 0 {
+		reqBody = captureRequest(req, limit)
+	}
+	resp, err := t.http.Do(req)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		if retry := t.refreshRequest(req); retry != nil {
+			resp.Body.Close()
+			req = retry
+			resp, err = t.http.Do(req)
+		}
+	}
+	if err != nil {
+		done()
+		return nil, t.closedErr(err)
+	}
+	resp.Body = &releaseBody{resp.Body, done}
+	if resp.StatusCode >= 400 && reqBody != nil {
+		return nil, captureError(req, resp, reqBody, limit)
 	} else if resp.StatusCode >= 400 {
 		return nil, parseError(req, resp) // the Body is closed by parseError
 	} else {
@@ -86,6 +346,32 @@ func (t *transport) request(method, path string, body io.Reader) (*http.Response
 	}
 }
 
+// refreshRequest refreshes the credentials of a Refresher and returns
+// a copy of req that carries the new credentials. It returns nil if
+// the request can't be retried.
+func (t *transport) refreshRequest(req *http.Request) *http.Request {
+	t.mu.RLock()
+	r, ok := t.auth.(Refresher)
+	t.mu.RUnlock()
+	if !ok || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return nil
+	}
+	if err := r.Refresh(t.http, t.prefix, req); err != nil {
+		return nil
+	}
+	retry := req.Clone(req.Context())
+	retry.Header.Del("Authorization")
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil
+		}
+		retry.Body = body
+	}
+	r.AddAuth(retry)
+	return retry
+}
+
 // closedRequest sends an HTTP request and discards the response body.
 func (t *transport) closedRequest(method, path string, body io.Reader) (*http.Response, error) {
 	resp, err := t.request(method, path, body)
@@ -96,11 +382,37 @@ func (t *transport) closedRequest(method, path string, body io.Reader) (*http.Re
 }
 
 // pathBuilder assists with constructing CouchDB request paths.
+//
+// The buffer is taken from pathBufPool on first use and returned when the
+// path is built. A pathBuilder must not be modified after calling path.
 type pathBuilder struct {
-	buf     bytes.Buffer
+	buf     *bytes.Buffer
+	built   string
 	inQuery bool
 }
 
+var pathBufPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// buffer returns the buffer of the builder.
+func (p *pathBuilder) buffer() *bytes.Buffer {
+	if p.buf == nil {
+		p.checkNotInQuery()
+		p.buf = pathBufPool.Get().(*bytes.Buffer)
+	}
+	return p.buf
+}
+
+// release returns the buffer to the pool.
+func (p *pathBuilder) release() {
+	if p.buf != nil {
+		p.buf.Reset()
+		pathBufPool.Put(p.buf)
+		p.buf = nil
+	}
+}
+
 // dbpath returns the root path to a database.
 func dbpath(name string) string {
 	// TODO: would be nice to use url.PathEscape here,
@@ -110,7 +422,12 @@ func dbpath(name string) string {
 
 // path returns the built path.
 func (p *pathBuilder) path() string {
-	return p.buf.String()
+	if p.buf != nil {
+		p.built = p.buf.String()
+		p.release()
+	}
+	p.inQuery = true
+	return p.built
 }
 
 func (p *pathBuilder) checkNotInQuery() {
@@ -143,57 +460,60 @@ func (p *pathBuilder) docID(id string) *pathBuilder {
 
 // add adds a segment to the path.
 func (p *pathBuilder) add(segment string) *pathBuilder {
-	p.checkNotInQuery()
-	p.buf.WriteByte('/')
+	buf := p.buffer()
+	buf.WriteByte('/')
 	// TODO: would be nice to use url.PathEscape here,
 	// but it only became available in Go 1.8.
-	p.buf.WriteString(url.QueryEscape(segment))
+	writeQueryEscaped(buf, segment)
 	return p
 }
 
 // addRaw adds an unescaped segment to the path.
 func (p *pathBuilder) addRaw(path string) *pathBuilder {
-	p.checkNotInQuery()
-	p.buf.WriteByte('/')
-	p.buf.WriteString(path)
+	buf := p.buffer()
+	buf.WriteByte('/')
+	buf.WriteString(path)
 	return p
 }
 
 // rev adds a revision to the query string.
 // It returns the built path.
 func (p *pathBuilder) rev(rev string) string {
-	p.checkNotInQuery()
+	buf := p.buffer()
 	p.inQuery = true
 	if rev != "" {
-		p.buf.WriteString("?rev=")
-		p.buf.WriteString(url.QueryEscape(rev))
+		buf.WriteString("?rev=")
+		writeQueryEscaped(buf, rev)
 	}
 	return p.path()
 }
 
-// options encodes the given options to the query.
+// options encodes the given options to the query. Values of keys
+// in jskeys are JSON-encoded, as are all list and object values.
 func (p *pathBuilder) options(opts Options, jskeys []string) (string, error) {
-	p.checkNotInQuery()
+	buf := p.buffer()
 	p.inQuery = true
 
-	// Sort keys by name.
-	var keys = make([]string, len(opts))
-	var i int
+	// Sort keys by name. Option maps are small, so insertion sort
+	// on a stack-allocated array avoids allocating for the common case.
+	var keysArray [16]string
+	keys := keysArray[:0]
 	for k := range opts {
-		keys[i] = k
-		i++
+		keys = append(keys, k)
+		for i := len(keys) - 1; i > 0 && keys[i] < keys[i-1]; i-- {
+			keys[i], keys[i-1] = keys[i-1], keys[i]
+		}
 	}
-	sort.Strings(keys)
 
 	// Encode to query string.
-	p.buf.WriteByte('?')
+	buf.WriteByte('?')
 	amp := false
 	for _, k := range keys {
 		if amp {
-			p.buf.WriteByte('&')
+			buf.WriteByte('&')
 		}
-		p.buf.WriteString(url.QueryEscape(k))
-		p.buf.WriteByte('=')
+		writeQueryEscaped(buf, k)
+		buf.WriteByte('=')
 		isjson := false
 		for _, jskey := range jskeys {
 			if k == jskey {
@@ -204,11 +524,13 @@ func (p *pathBuilder) options(opts Options, jskeys []string) (string, error) {
 		if isjson {
 			jsonv, err := json.Marshal(opts[k])
 			if err != nil {
+				p.release()
 				return "", fmt.Errorf("invalid option %q: %v", k, err)
 			}
-			p.buf.WriteString(url.QueryEscape(string(jsonv)))
+			writeQueryEscapedBytes(buf, jsonv)
 		} else {
-			if err := encval(&p.buf, k, opts[k]); err != nil {
+			if err := encval(buf, k, opts[k]); err != nil {
+				p.release()
 				return "", fmt.Errorf("invalid option %q: %v", k, err)
 			}
 		}
@@ -217,30 +539,82 @@ func (p *pathBuilder) options(opts Options, jskeys []string) (string, error) {
 	return p.path(), nil
 }
 
-func encval(w io.Writer, k string, v interface{}) error {
+func encval(buf *bytes.Buffer, k string, v interface{}) error {
 	if v == nil {
 		return errors.New("value is nil")
 	}
+	switch v := v.(type) {
+	case time.Time:
+		var scratch [64]byte
+		writeQueryEscapedBytes(buf, v.AppendFormat(scratch[:0], time.RFC3339Nano))
+		return nil
+	case fmt.Stringer:
+		writeQueryEscaped(buf, v.String())
+		return nil
+	case json.Marshaler:
+		jsonv, err := v.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		writeQueryEscapedBytes(buf, jsonv)
+		return nil
+	}
+
+	var scratch [64]byte
 	rv := reflect.ValueOf(v)
-	var str string
 	switch rv.Kind() {
 	case reflect.String:
-		str = url.QueryEscape(rv.String())
+		writeQueryEscaped(buf, rv.String())
 	case reflect.Bool:
-		str = strconv.FormatBool(rv.Bool())
+		buf.Write(strconv.AppendBool(scratch[:0], rv.Bool()))
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		str = strconv.FormatInt(rv.Int(), 10)
+		buf.Write(strconv.AppendInt(scratch[:0], rv.Int(), 10))
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		str = strconv.FormatUint(rv.Uint(), 10)
+		buf.Write(strconv.AppendUint(scratch[:0], rv.Uint(), 10))
 	case reflect.Float32:
-		str = strconv.FormatFloat(rv.Float(), 'f', -1, 32)
+		buf.Write(strconv.AppendFloat(scratch[:0], rv.Float(), 'f', -1, 32))
 	case reflect.Float64:
-		str = strconv.FormatFloat(rv.Float(), 'f', -1, 64)
+		buf.Write(strconv.AppendFloat(scratch[:0], rv.Float(), 'f', -1, 64))
+	case reflect.Slice, reflect.Array, reflect.Map:
+		jsonv, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		writeQueryEscapedBytes(buf, jsonv)
 	default:
 		return fmt.Errorf("unsupported type: %s", rv.Type())
 	}
-	_, err := io.WriteString(w, str)
-	return err
+	return nil
+}
+
+// writeQueryEscaped writes s to buf, escaped like url.QueryEscape
+// but without allocating an intermediate string.
+func writeQueryEscaped(buf *bytes.Buffer, s string) {
+	for i := 0; i < len(s); i++ {
+		writeQueryEscapedByte(buf, s[i])
+	}
+}
+
+// writeQueryEscapedBytes is like writeQueryEscaped, for byte slices.
+func writeQueryEscapedBytes(buf *bytes.Buffer, b []byte) {
+	for _, c := range b {
+		writeQueryEscapedByte(buf, c)
+	}
+}
+
+func writeQueryEscapedByte(buf *bytes.Buffer, c byte) {
+	const hex = "0123456789ABCDEF"
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+		c == '-', c == '_', c == '.', c == '~':
+		buf.WriteByte(c)
+	case c == ' ':
+		buf.WriteByte('+')
+	default:
+		buf.WriteByte('%')
+		buf.WriteByte(hex[c>>4])
+		buf.WriteByte(hex[c&15])
+	}
 }
 
 // responseRev returns the unquoted Etag of a response.
@@ -254,6 +628,33 @@ func responseRev(resp *http.Response, err error) (string, error) {
 	}
 }
 
+// writeRev returns the revision created by a write request and closes the
+// response body. The revision is taken from the Etag header, or from the
+// "rev" field of the response body if the header is missing. Writes that
+// were accepted without creating a revision, e.g. in batch mode, have
+// status 202 and no revision. For those, writeRev returns an empty revision.
+func writeRev(resp *http.Response, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if etag := resp.Header.Get("Etag"); len(etag) > 2 {
+		return etag[1 : len(etag)-1], nil
+	}
+	var result struct {
+		Rev string `json:"rev"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	switch {
+	case result.Rev != "":
+		return result.Rev, nil
+	case resp.StatusCode == http.StatusAccepted:
+		return "", nil
+	default:
+		return "", fmt.Errorf("couchdb: missing Etag header in response")
+	}
+}
+
 func readBody(resp *http.Response, v interface{}) error {
 	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
 		resp.Body.Close()
@@ -272,6 +673,11 @@ type Error struct {
 	// These two fields will be empty for HEAD requests.
 	ErrorCode string // Error reason provided by CouchDB
 	Reason    string // Error message provided by CouchDB
+
+	// The beginning of the request and response bodies.
+	// These are only set if enabled using Client.SetDebugCapture.
+	RequestBody  []byte
+	ResponseBody []byte
 }
 
 func (e *Error) Error() string {
@@ -301,11 +707,24 @@ func Conflict(err error) bool {
 	return ErrorStatus(err, http.StatusConflict)
 }
 
+// Forbidden checks whether the given error is a DatabaseError
+// with StatusCode == 403, e.g. a rejection by validate_doc_update.
+func Forbidden(err error) bool {
+	return ErrorStatus(err, http.StatusForbidden)
+}
+
 // ErrorStatus checks whether the given error is a DatabaseError
-// with a matching statusCode.
+// or DocError with a matching statusCode.
 func ErrorStatus(err error, statusCode int) bool {
-	dberr, ok := err.(*Error)
-	return ok && dberr.StatusCode == statusCode
+	switch err := err.(type) {
+	case *Error:
+		return err.StatusCode == statusCode
+	case *DocError:
+		return err.StatusCode == statusCode
+	case *AdminRequiredError:
+		return err.Err.StatusCode == statusCode
+	}
+	return false
 }
 
 func parseError(req *http.Request, resp *http.Response) error {
@@ -314,6 +733,8 @@ func parseError(req *http.Request, resp *http.Response) error {
 		if err := readBody(resp, &reply); err != nil {
 			return fmt.Errorf("couldn't decode CouchDB error: %v", err)
 		}
+	} else {
+		resp.Body.Close()
 	}
 	return &Error{
 		Method:     req.Method,
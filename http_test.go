@@ -1,8 +1,13 @@
 package couchdb_test
 
 import (
+	"io"
 	. "net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/fjl/go-couchdb"
 )
 
 type testauth struct{ called bool }
@@ -33,3 +38,41 @@ func TestClientSetAuth(t *testing.T) {
 		t.Error("AddAuth was called after removing Auth instance")
 	}
 }
+
+func TestClientClose(t *testing.T) {
+	srv := httptest.NewServer(HandlerFunc(func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"seq": "1-a", "id": "doc", "changes": [{"rev": "1-a"}]}`+"\n")
+		resp.(Flusher).Flush()
+		<-req.Context().Done()
+	}))
+	defer srv.Close()
+	c, err := couchdb.NewClient(srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feed, err := c.DB("db").Changes(couchdb.Options{"feed": "continuous"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !feed.Next() {
+		t.Fatal("no event:", feed.Err())
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		c.Close()
+	}()
+	if feed.Next() {
+		t.Fatal("feed not closed")
+	}
+	if feed.Err() == nil {
+		t.Error("no error after Close")
+	}
+
+	if _, err := c.DB("db").Info(); err != couchdb.ErrClientClosed {
+		t.Errorf("wrong error from closed DB: %v", err)
+	}
+	if _, err := c.AllDBs(); err != couchdb.ErrClientClosed {
+		t.Errorf("wrong error from closed client: %v", err)
+	}
+}
@@ -0,0 +1,265 @@
+package couchdb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// IDGenerator creates document IDs on the client side.
+// Implementations must be safe for concurrent use.
+type IDGenerator interface {
+	NewID() string
+}
+
+// IDGeneratorFunc turns a function into an IDGenerator.
+type IDGeneratorFunc func() string
+
+// NewID calls the function.
+func (f IDGeneratorFunc) NewID() string { return f() }
+
+// WithIDGenerator returns a copy of the database object that uses gen
+// to assign IDs to documents stored by Post. If gen is nil, the server
+// assigns IDs.
+func (db *DB) WithIDGenerator(gen IDGenerator) *DB {
+	cpy := *db
+	cpy.idgen = gen
+	return &cpy
+}
+
+// IDError is returned for invalid document IDs.
+type IDError struct {
+	ID     string
+	Reason string
+}
+
+func (e *IDError) Error() string {
+	return fmt.Sprintf("couchdb: invalid document ID %q: %s", e.ID, e.Reason)
+}
+
+// ValidateDocID checks whether id is a valid document ID. IDs must be
+// non-empty UTF-8 strings. IDs beginning with an underscore are reserved,
+// except for design documents (_design/) and local documents (_local/).
+// The returned error is an *IDError.
+func ValidateDocID(id string) error {
+	switch {
+	case id == "":
+		return &IDError{id, "empty ID"}
+	case !utf8.ValidString(id):
+		return &IDError{id, "not valid UTF-8"}
+	case strings.HasPrefix(id, "_design/"), strings.HasPrefix(id, "_local/"):
+		if strings.IndexByte(id, '/') == len(id)-1 {
+			return &IDError{id, "empty design or local document name"}
+		}
+	case id[0] == '_':
+		return &IDError{id, "IDs beginning with '_' are reserved"}
+	}
+	return nil
+}
+
+// WithIDValidation returns a copy of the database object that checks
+// document IDs with ValidateDocID before storing documents with Put
+// and Post. Invalid IDs are reported without contacting the server.
+func (db *DB) WithIDValidation(enable bool) *DB {
+	cpy := *db
+	cpy.checkIDs = enable
+	return &cpy
+}
+
+// Post stores a new document and returns its ID and revision.
+// If the database object has an ID generator, the ID is created on the
+// client and the document is stored using Put. Otherwise the server
+// assigns a random ID.
+func (db *DB) Post(doc interface{}) (id, rev string, err error) {
+	if db.idgen != nil {
+		id = db.idgen.NewID()
+		rev, err = db.Put(id, doc, "")
+		return id, rev, err
+	}
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return "", "", err
+	}
+	if db.checkIDs {
+		var meta struct {
+			ID *string `json:"_id"`
+		}
+		json.Unmarshal(body, &meta)
+		if meta.ID != nil {
+			if err := ValidateDocID(*meta.ID); err != nil {
+				return "", "", err
+			}
+		}
+	}
+	var ev *WriteEvent
+	if db.hooks != nil {
+		if ev, body, err = db.beforeWrite("post", "", "", body); err != nil {
+			return "", "", err
+		}
+	}
+	if err := db.checkNewDocSize(body); err != nil {
+		return "", "", err
+	}
+	var result struct {
+		ID  string `json:"id"`
+		Rev string `json:"rev"`
+	}
+	resp, err := db.request("POST", db.path().path(), bytes.NewReader(body))
+	if err == nil {
+		err = readBody(resp, &result)
+	}
+	if ev != nil {
+		if ev.ID == "" {
+			ev.ID = result.ID
+		}
+		db.afterWrite(ev, result.Rev, err)
+	}
+	return result.ID, result.Rev, err
+}
+
+// UUIDv7 returns a generator of version 7 UUIDs (RFC 9562). These IDs start
+// with a millisecond timestamp, so documents created close in time are
+// stored close to each other in the database B-tree. IDs created by the same
+// generator are strictly increasing.
+func UUIDv7() IDGenerator {
+	return &uuidv7{}
+}
+
+type uuidv7 struct {
+	mu  sync.Mutex
+	ms  uint64
+	seq uint16 // 12-bit counter for IDs in the same millisecond
+}
+
+func (g *uuidv7) NewID() string {
+	var id [16]byte
+	g.mu.Lock()
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	if ms > g.ms {
+		g.ms = ms
+		g.seq = uint16(randUint64() & 0x7ff) // leave room for increments
+	} else if g.seq++; g.seq > 0xfff {
+		g.ms++
+		g.seq = 0
+	}
+	binary.BigEndian.PutUint64(id[:8], g.ms<<16|uint64(g.seq))
+	g.mu.Unlock()
+
+	id[6] = 0x70 | id[6]&0x0f // version
+	rand.Read(id[8:])
+	id[8] = 0x80 | id[8]&0x3f // variant
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], id[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], id[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], id[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], id[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], id[10:])
+	return string(buf[:])
+}
+
+// ULID returns a generator of ULIDs (https://github.com/ulid/spec).
+// Like UUIDv7, ULIDs start with a millisecond timestamp. IDs created by
+// the same generator are strictly increasing.
+func ULID() IDGenerator {
+	return &ulid{}
+}
+
+type ulid struct {
+	mu      sync.Mutex
+	ms      uint64
+	entropy [10]byte
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func (g *ulid) NewID() string {
+	var id [16]byte
+	g.mu.Lock()
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	if ms > g.ms {
+		g.ms = ms
+		rand.Read(g.entropy[:])
+	} else if !increment(g.entropy[:]) {
+		g.ms++ // entropy overflow, move to the next millisecond
+	}
+	binary.BigEndian.PutUint64(id[:8], g.ms<<16)
+	copy(id[6:], g.entropy[:])
+	g.mu.Unlock()
+
+	// Encode 128 bits as 26 base32 characters, most significant first.
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+	var buf [26]byte
+	for i := 25; i >= 0; i-- {
+		buf[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(buf[:])
+}
+
+// increment adds one to a big-endian number.
+// It returns false if the number overflowed.
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// SequentialIDs returns a generator that works like the "sequential" UUID
+// algorithm of CouchDB: IDs consist of prefix, a random 26 character hex
+// string and a 6 character hex suffix that is incremented by a random amount
+// for every ID. The random part is renewed when the suffix overflows.
+func SequentialIDs(prefix string) IDGenerator {
+	g := &sequential{prefix: prefix}
+	g.renew()
+	return g
+}
+
+type sequential struct {
+	prefix string
+	mu     sync.Mutex
+	base   string
+	suffix uint64
+}
+
+func (g *sequential) renew() {
+	var b [13]byte
+	rand.Read(b[:])
+	g.base = hex.EncodeToString(b[:])
+	g.suffix = randUint64() & 0xfff
+}
+
+func (g *sequential) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.suffix += 1 + randUint64()&0xffe
+	if g.suffix > 0xffffff {
+		g.renew()
+	}
+	var suffix [4]byte
+	binary.BigEndian.PutUint32(suffix[:], uint32(g.suffix))
+	return g.prefix + g.base + hex.EncodeToString(suffix[1:])
+}
+
+func randUint64() uint64 {
+	var b [8]byte
+	rand.Read(b[:])
+	return binary.BigEndian.Uint64(b[:])
+}
@@ -0,0 +1,97 @@
+package couchdb_test
+
+import (
+	"encoding/json"
+	"io"
+	. "net/http"
+	"regexp"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestIDGenerators(t *testing.T) {
+	tests := []struct {
+		name string
+		gen  couchdb.IDGenerator
+		re   *regexp.Regexp
+	}{
+		{"UUIDv7", couchdb.UUIDv7(), regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+		{"ULID", couchdb.ULID(), regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)},
+		{"SequentialIDs", couchdb.SequentialIDs("user:"), regexp.MustCompile(`^user:[0-9a-f]{32}$`)},
+	}
+	for _, test := range tests {
+		prev := ""
+		for i := 0; i < 5000; i++ {
+			id := test.gen.NewID()
+			if !test.re.MatchString(id) {
+				t.Fatalf("%s: invalid ID %q", test.name, id)
+			}
+			// SequentialIDs renews the random part when the suffix overflows.
+			if id <= prev && test.name != "SequentialIDs" {
+				t.Fatalf("%s: ID %q not greater than previous ID %q", test.name, id, prev)
+			}
+			prev = id
+		}
+	}
+}
+
+func TestPost(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("POST /db", func(resp ResponseWriter, req *Request) {
+		var doc map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&doc)
+		check(t, "request body", map[string]interface{}{"field": float64(1)}, doc)
+		resp.WriteHeader(StatusCreated)
+		io.WriteString(resp, `{"id": "server-id", "ok": true, "rev": "1-619db7ba8551c0de3f3a178775509611"}`)
+	})
+	c.Handle("PUT /db/client-id", func(resp ResponseWriter, req *Request) {
+		resp.Header().Set("ETag", `"1-619db7ba8551c0de3f3a178775509611"`)
+		resp.WriteHeader(StatusCreated)
+		io.WriteString(resp, `{"id": "client-id", "ok": true, "rev": "1-619db7ba8551c0de3f3a178775509611"}`)
+	})
+
+	id, rev, err := c.DB("db").Post(&testDocument{Field: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "id", "server-id", id)
+	check(t, "rev", "1-619db7ba8551c0de3f3a178775509611", rev)
+
+	gen := couchdb.IDGeneratorFunc(func() string { return "client-id" })
+	id, rev, err = c.DB("db").WithIDGenerator(gen).Post(&testDocument{Field: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "id", "client-id", id)
+	check(t, "rev", "1-619db7ba8551c0de3f3a178775509611", rev)
+}
+
+func TestValidateDocID(t *testing.T) {
+	valid := []string{"a", "doc-1", "_design/app", "_local/checkpoint", "a/b", "ü"}
+	for _, id := range valid {
+		if err := couchdb.ValidateDocID(id); err != nil {
+			t.Errorf("%q: unexpected error: %v", id, err)
+		}
+	}
+	invalid := []string{"", "_foo", "_design/", "_local/", "\xff"}
+	for _, id := range invalid {
+		err := couchdb.ValidateDocID(id)
+		if _, ok := err.(*couchdb.IDError); !ok {
+			t.Errorf("%q: expected *IDError, got %v", id, err)
+		}
+	}
+}
+
+func TestWithIDValidation(t *testing.T) {
+	c := newTestClient(t)
+	db := c.DB("db").WithIDValidation(true)
+
+	// No requests are sent for invalid IDs.
+	_, err := db.Put("_foo", &testDocument{}, "")
+	check(t, "Put error", `couchdb: invalid document ID "_foo": IDs beginning with '_' are reserved`, err.Error())
+	_, _, err = db.Post(map[string]string{"_id": "_bar"})
+	if _, ok := err.(*couchdb.IDError); !ok {
+		t.Errorf("expected *IDError from Post, got %v", err)
+	}
+}
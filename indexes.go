@@ -0,0 +1,98 @@
+package couchdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IndexProgress reports the state of a view index build.
+type IndexProgress struct {
+	IndexSeq int64 // sequence number the index has reached
+	DBSeq    int64 // sequence number of the database
+}
+
+// WaitOptions configures WaitForIndexes.
+type WaitOptions struct {
+	// Interval is the time between polls. The default is one second.
+	Interval time.Duration
+
+	// Progress is called after every poll where the index is not up to date.
+	Progress func(IndexProgress)
+}
+
+// WaitForIndexes triggers an update of the view index of a design document
+// and waits until the index has caught up with the update sequence that
+// the database had when WaitForIndexes was called. This is useful after
+// deploying new views and before sending traffic to them.
+//
+// The update is triggered by querying a view with update=lazy and the
+// default options of the client and database object. The index state is
+// polled using the _info endpoint of the design document. The context
+// applies to all requests and can be used to stop waiting.
+func (db *DB) WaitForIndexes(ctx context.Context, ddoc string, opts WaitOptions) error {
+	if !strings.HasPrefix(ddoc, "_design/") {
+		return errors.New("couchdb.WaitForIndexes: design doc name must start with _design/")
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	db = db.WithContext(ctx)
+
+	// Query a view to start the index update in the background.
+	var doc struct {
+		Views map[string]interface{} `json:"views"`
+	}
+	if err := db.Get(ddoc, &doc, nil); err != nil {
+		return err
+	}
+	if len(doc.Views) == 0 {
+		return nil
+	}
+	views := make([]string, 0, len(doc.Views))
+	for name := range doc.Views {
+		views = append(views, name)
+	}
+	sort.Strings(views)
+	viewOpts := db.options(Options{"update": UpdateLazy, "limit": 0})
+	if _, ok := viewOpts["stale"]; ok {
+		// A default "stale" option can't be combined with "update".
+		viewOpts = viewOpts.clone()
+		delete(viewOpts, "stale")
+	}
+	resp, err := db.viewRequest(db.path().docID(ddoc).addRaw("_view").add(views[0]), viewOpts)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	dbinfo, err := db.Info()
+	if err != nil {
+		return err
+	}
+	progress := IndexProgress{DBSeq: seqNumber(dbinfo.UpdateSeq)}
+	if progress.DBSeq < 0 {
+		return fmt.Errorf("couchdb.WaitForIndexes: invalid database update_seq %v", dbinfo.UpdateSeq)
+	}
+	for {
+		info, err := db.DesignInfo(ddoc)
+		if err != nil {
+			return err
+		}
+		progress.IndexSeq = seqNumber(info.ViewIndex.UpdateSeq)
+		if progress.IndexSeq >= progress.DBSeq {
+			return nil
+		}
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(opts.Interval):
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package couchdb_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	. "net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestDBInfo(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{
+			"db_name": "db",
+			"doc_count": 10,
+			"doc_del_count": 2,
+			"update_seq": "15-g1AAAA",
+			"compact_running": false,
+			"sizes": {"file": 300, "external": 100, "active": 200}
+		}`)
+	})
+
+	info, err := c.DB("db").Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &couchdb.DBInfo{
+		Name:        "db",
+		DocCount:    10,
+		DocDelCount: 2,
+		UpdateSeq:   "15-g1AAAA",
+		Sizes:       couchdb.Sizes{File: 300, External: 100, Active: 200},
+	}
+	check(t, "info", expected, info)
+}
+
+func TestUpdateSeq(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db2", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"db_name": "db2", "update_seq": "15-g1AAAA"}`)
+	})
+	c.Handle("GET /db1", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"db_name": "db1", "update_seq": 15, "committed_update_seq": 14}`)
+	})
+
+	seq, err := c.DB("db2").UpdateSeq()
+	check(t, "error", nil, err)
+	check(t, "seq", couchdb.Seq("15-g1AAAA"), seq)
+	check(t, "seq.Number()", int64(15), seq.Number())
+	seq, err = c.DB("db2").CommittedUpdateSeq()
+	check(t, "error", nil, err)
+	check(t, "committed seq", couchdb.Seq("15-g1AAAA"), seq)
+
+	seq, err = c.DB("db1").UpdateSeq()
+	check(t, "error", nil, err)
+	check(t, "seq", couchdb.Seq("15"), seq)
+	seq, err = c.DB("db1").CommittedUpdateSeq()
+	check(t, "error", nil, err)
+	check(t, "committed seq", couchdb.Seq("14"), seq)
+}
+
+func TestToSeq(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want couchdb.Seq
+	}{
+		{"7-abc", "7-abc"},
+		{float64(7), "7"},
+		{json.Number("9007199254740993"), "9007199254740993"},
+		{[]interface{}{float64(1), "x"}, `[1,"x"]`},
+	}
+	for _, test := range tests {
+		seq, err := couchdb.ToSeq(test.in)
+		if err != nil {
+			t.Errorf("ToSeq(%#v): %v", test.in, err)
+			continue
+		}
+		check(t, "seq", test.want, seq)
+	}
+	for _, in := range []interface{}{nil, 1.5, true} {
+		if _, err := couchdb.ToSeq(in); err == nil {
+			t.Errorf("ToSeq(%#v): expected error", in)
+		}
+	}
+}
+
+func TestSeqLag(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"db_name": "db", "update_seq": "15-g1AAAA"}`)
+	})
+	db := c.DB("db")
+
+	lag, err := db.SeqLag("12-g1AAAB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "lag", &couchdb.SeqLag{Seq: "12-g1AAAB", UpdateSeq: "15-g1AAAA", Pending: 3}, lag)
+
+	lag, err = db.SeqLag(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "pending from start", int64(15), lag.Pending)
+
+	// Sequences from another node may be ahead.
+	lag, err = db.SeqLag(float64(20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "pending ahead", int64(0), lag.Pending)
+
+	if _, err := db.SeqLag("bogus"); err == nil {
+		t.Error("expected error for unparsable seq")
+	}
+}
+
+func TestCheckpointLag(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"db_name": "db", "update_seq": "15-g1AAAA"}`)
+	})
+	c.Handle("GET /db/_local/follower", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"_id": "_local/follower", "_rev": "0-1", "seq": "10-g1AAAC"}`)
+	})
+	db := c.DB("db")
+
+	lag, err := db.CheckpointLag(couchdb.LocalCheckpoints(db), "follower")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "pending", int64(5), lag.Pending)
+}
+
+func TestWaitForIndexes(t *testing.T) {
+	c := newTestClient(t)
+	c.SetDefaultOptions(couchdb.Options{"stable": true, "stale": "ok"})
+	var ctxValue interface{}
+	c.Handle("GET /db/_design/test", func(resp ResponseWriter, req *Request) {
+		ctxValue = req.Context().Value(ctxKey{})
+		io.WriteString(resp, `{"_id": "_design/test", "views": {"b": {}, "a": {}}}`)
+	})
+	c.Handle("GET /db/_design/test/_view/a", func(resp ResponseWriter, req *Request) {
+		expected := url.Values{"update": {"lazy"}, "stable": {"true"}, "limit": {"0"}}
+		check(t, "view query", expected, req.URL.Query())
+		io.WriteString(resp, `{"total_rows": 0, "offset": 0, "rows": []}`)
+	})
+	c.Handle("GET /db", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"db_name": "db", "update_seq": "20-g1AAAA"}`)
+	})
+	indexSeq := []string{"5", "12", "20"}
+	c.Handle("GET /db/_design/test/_info", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"name": "test", "view_index": {"update_seq": `+indexSeq[0]+`}}`)
+		indexSeq = indexSeq[1:]
+	})
+
+	var progress []couchdb.IndexProgress
+	opts := couchdb.WaitOptions{
+		Interval: time.Millisecond,
+		Progress: func(p couchdb.IndexProgress) { progress = append(progress, p) },
+	}
+	if err := c.DB("db").WaitForIndexes(context.Background(), "_design/test", opts); err != nil {
+		t.Fatal(err)
+	}
+	expected := []couchdb.IndexProgress{{IndexSeq: 5, DBSeq: 20}, {IndexSeq: 12, DBSeq: 20}}
+	check(t, "progress", expected, progress)
+
+	// Cancellation.
+	indexSeq = []string{"1", "1", "1"}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "wait"))
+	opts.Progress = func(couchdb.IndexProgress) { cancel() }
+	err := c.DB("db").WaitForIndexes(ctx, "_design/test", opts)
+	check(t, "error", context.Canceled, err)
+
+	check(t, "request context", "wait", ctxValue)
+}
@@ -0,0 +1,222 @@
+package couchdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Sizes contains size information of a database or view index.
+type Sizes struct {
+	File     int64 `json:"file"`     // size of the file on disk
+	External int64 `json:"external"` // uncompressed size of the data
+	Active   int64 `json:"active"`   // size of live data in the file
+}
+
+// DBInfo contains information about a database.
+type DBInfo struct {
+	Name           string `json:"db_name"`
+	DocCount       int64  `json:"doc_count"`
+	DocDelCount    int64  `json:"doc_del_count"`
+	CompactRunning bool   `json:"compact_running"`
+	Sizes          Sizes  `json:"sizes"`
+
+	// UpdateSeq is the current update sequence of the database.
+	// Like ChangesFeed.Seq, it is a string for CouchDB 2.x and later
+	// and a number for older servers.
+	UpdateSeq interface{} `json:"update_seq"`
+
+	// CommittedUpdateSeq is the update sequence of the last change written
+	// to disk. It is reported by CouchDB 1.x only.
+	CommittedUpdateSeq interface{} `json:"committed_update_seq"`
+
+	// DiskSize and DataSize are reported by CouchDB 1.x.
+	// Newer servers report Sizes instead.
+	DiskSize int64 `json:"disk_size"`
+	DataSize int64 `json:"data_size"`
+}
+
+// Info retrieves information about the database.
+func (db *DB) Info() (*DBInfo, error) {
+	resp, err := db.request("GET", db.path().path(), nil)
+	if err != nil {
+		return nil, err
+	}
+	info := new(DBInfo)
+	return info, readBody(resp, info)
+}
+
+// ViewIndexInfo contains information about the view index of a design document.
+type ViewIndexInfo struct {
+	Signature      string `json:"signature"`
+	Language       string `json:"language"`
+	UpdaterRunning bool   `json:"updater_running"`
+	CompactRunning bool   `json:"compact_running"`
+	WaitingClients int64  `json:"waiting_clients"`
+	Sizes          Sizes  `json:"sizes"`
+
+	// UpdateSeq is the update sequence of the database that
+	// the index reflects.
+	UpdateSeq interface{} `json:"update_seq"`
+
+	// DiskSize and DataSize are reported by CouchDB 1.x.
+	DiskSize int64 `json:"disk_size"`
+	DataSize int64 `json:"data_size"`
+}
+
+// DesignInfo is the result of DB.DesignInfo.
+type DesignInfo struct {
+	Name      string        `json:"name"`
+	ViewIndex ViewIndexInfo `json:"view_index"`
+}
+
+// DesignInfo retrieves information about the view index of a design document.
+// The ddoc argument must start with "_design/".
+func (db *DB) DesignInfo(ddoc string) (*DesignInfo, error) {
+	path := db.path().docID(ddoc).addRaw("_info").path()
+	resp, err := db.request("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	info := new(DesignInfo)
+	return info, readBody(resp, info)
+}
+
+// Seq is a database update sequence. CouchDB 2.x and later use opaque
+// strings, older servers use numbers, which are stored in decimal form.
+// A Seq can be used as the "since" option of Changes.
+type Seq string
+
+// ToSeq converts a sequence decoded from JSON, e.g. ChangesFeed.Seq,
+// to a Seq. Sequence arrays of BigCouch servers are kept as JSON text.
+func ToSeq(v interface{}) (Seq, error) {
+	switch v := v.(type) {
+	case Seq:
+		return v, nil
+	case string:
+		return Seq(v), nil
+	case json.Number:
+		return Seq(v.String()), nil
+	case float64:
+		if v < 0 || v != math.Trunc(v) {
+			break
+		}
+		return Seq(strconv.FormatFloat(v, 'f', -1, 64)), nil
+	case []interface{}:
+		enc, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return Seq(enc), nil
+	}
+	return "", fmt.Errorf("couchdb: invalid update sequence %#v", v)
+}
+
+// Number returns the numeric prefix of the sequence, or -1 if it has none.
+// For clustered databases, this is only an estimate of the number of
+// changes. It is suitable for monitoring, but not for comparing sequences.
+func (s Seq) Number() int64 {
+	return seqNumber(string(s))
+}
+
+// UpdateSeq returns the current update sequence of the database.
+// Changes made after this call appear in a changes feed started at
+// the returned sequence.
+func (db *DB) UpdateSeq() (Seq, error) {
+	info, err := db.Info()
+	if err != nil {
+		return "", err
+	}
+	return ToSeq(info.UpdateSeq)
+}
+
+// CommittedUpdateSeq returns the update sequence of the last change that
+// has been written to disk. Servers that don't report it, i.e. CouchDB 2.x
+// and later, always commit changes before acknowledging them, so the
+// current update sequence is returned for them.
+func (db *DB) CommittedUpdateSeq() (Seq, error) {
+	info, err := db.Info()
+	if err != nil {
+		return "", err
+	}
+	if info.CommittedUpdateSeq != nil {
+		return ToSeq(info.CommittedUpdateSeq)
+	}
+	return ToSeq(info.UpdateSeq)
+}
+
+// SeqLag is the distance between a sequence and the current update
+// sequence of a database.
+type SeqLag struct {
+	Seq       interface{} // the sequence that was checked
+	UpdateSeq interface{} // current update sequence of the database
+
+	// Pending is the approximate number of changes after Seq.
+	// For clustered databases, sequences are opaque and their numeric
+	// prefix is only an estimate, so Pending should be used for
+	// monitoring only.
+	Pending int64
+}
+
+// SeqLag reports how far seq is behind the current update sequence
+// of the database. A nil seq refers to the beginning of the database.
+func (db *DB) SeqLag(seq interface{}) (*SeqLag, error) {
+	var n int64
+	if seq != nil {
+		if n = seqNumber(seq); n < 0 {
+			return nil, fmt.Errorf("couchdb: can't parse sequence %v", seq)
+		}
+	}
+	info, err := db.Info()
+	if err != nil {
+		return nil, err
+	}
+	current := seqNumber(info.UpdateSeq)
+	if current < 0 {
+		return nil, fmt.Errorf("couchdb: can't parse update_seq %v", info.UpdateSeq)
+	}
+	lag := &SeqLag{Seq: seq, UpdateSeq: info.UpdateSeq, Pending: current - n}
+	if lag.Pending < 0 {
+		lag.Pending = 0
+	}
+	return lag, nil
+}
+
+// CheckpointLag is like SeqLag, for the sequence stored under the given
+// checkpoint name. It can be used to monitor the backlog of a Follower.
+func (db *DB) CheckpointLag(store CheckpointStore, name string) (*SeqLag, error) {
+	seq, err := store.LoadCheckpoint(name)
+	if err != nil {
+		return nil, err
+	}
+	return db.SeqLag(seq)
+}
+
+// seqNumber returns the numeric part of an update sequence.
+// For opaque sequences of CouchDB 2.x and later, this is the
+// sum of the shard sequences. It returns -1 if seq is invalid.
+func seqNumber(seq interface{}) int64 {
+	var s string
+	switch seq := seq.(type) {
+	case float64:
+		return int64(seq)
+	case json.Number:
+		s = seq.String()
+	case string:
+		s = seq
+	case Seq:
+		s = string(seq)
+	default:
+		return -1
+	}
+	if i := strings.IndexByte(s, '-'); i > 0 {
+		s = s[:i]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
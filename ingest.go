@@ -0,0 +1,254 @@
+package couchdb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IngestOptions configures an Ingester.
+type IngestOptions struct {
+	MinBatch       int // smallest batch size, default 10
+	MaxBatch       int // largest batch size, default 1000
+	MaxConcurrency int // largest number of concurrent requests, default 8
+
+	// TargetLatency is the request duration above which the
+	// ingester slows down. The default is 2s.
+	TargetLatency time.Duration
+
+	// Backoff is the time to wait after a request was rejected with
+	// status 429 (Too Many Requests). It doubles with each consecutive
+	// rejection, up to 32 times the initial value. The default is 1s.
+	Backoff time.Duration
+
+	// MaxRetries is the number of times a rejected batch is retried
+	// before Ingest fails. The default is 10.
+	MaxRetries int
+
+	// OnAdjust is called when the batch size or concurrency changes.
+	OnAdjust func(batchSize, concurrency int)
+}
+
+func (o IngestOptions) withDefaults() IngestOptions {
+	if o.MinBatch <= 0 {
+		o.MinBatch = 10
+	}
+	if o.MaxBatch <= 0 {
+		o.MaxBatch = 1000
+	}
+	if o.MaxBatch < o.MinBatch {
+		o.MaxBatch = o.MinBatch
+	}
+	if o.MaxConcurrency <= 0 {
+		o.MaxConcurrency = 8
+	}
+	if o.TargetLatency <= 0 {
+		o.TargetLatency = 2 * time.Second
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = time.Second
+	}
+	if o.MaxRetries <= 0 {
+		o.MaxRetries = 10
+	}
+	return o
+}
+
+// Ingester writes large numbers of documents using _bulk_docs, adapting the
+// batch size and the number of concurrent requests to the capacity of the
+// server. It uses additive increase, multiplicative decrease: every fast
+// request increases the rate a little, while requests rejected with status
+// 429 or slower than the target latency halve it. This keeps throughput
+// close to the limits of rate-limited services such as Cloudant.
+//
+// The state of the controller is kept across calls to Ingest.
+type Ingester struct {
+	db   *DB
+	opts IngestOptions
+
+	mu          sync.Mutex
+	batch       int
+	window      float64 // concurrency, grows fractionally
+	rejected    int     // consecutive 429 responses
+	rateLimited int64
+}
+
+// NewIngester creates an ingester for the database.
+// It starts with the smallest batch size and one request at a time.
+func (db *DB) NewIngester(opts IngestOptions) *Ingester {
+	opts = opts.withDefaults()
+	return &Ingester{db: db, opts: opts, batch: opts.MinBatch, window: 1}
+}
+
+// State returns the current batch size and concurrency.
+func (in *Ingester) State() (batchSize, concurrency int) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.batch, int(in.window)
+}
+
+// RateLimited returns the number of requests rejected with status 429.
+func (in *Ingester) RateLimited() int64 {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.rateLimited
+}
+
+// success records a request that completed in the given time.
+func (in *Ingester) success(latency time.Duration) {
+	in.mu.Lock()
+	in.rejected = 0
+	if latency > in.opts.TargetLatency {
+		in.decrease()
+		return
+	}
+	oldBatch, oldConc := in.batch, int(in.window)
+	if in.batch += in.opts.MinBatch; in.batch > in.opts.MaxBatch {
+		in.batch = in.opts.MaxBatch
+	}
+	// Grow the window by about one per round of requests.
+	if in.window += 1 / in.window; in.window > float64(in.opts.MaxConcurrency) {
+		in.window = float64(in.opts.MaxConcurrency)
+	}
+	in.notify(oldBatch, oldConc)
+}
+
+// reject records a request rejected with status 429. It returns
+// the time to wait before sending more requests.
+func (in *Ingester) reject() time.Duration {
+	in.mu.Lock()
+	in.rateLimited++
+	if in.rejected < 5 {
+		in.rejected++
+	}
+	wait := in.opts.Backoff << uint(in.rejected-1)
+	in.decrease()
+	return wait
+}
+
+// decrease halves the rate. It must be called with in.mu held
+// and releases it.
+func (in *Ingester) decrease() {
+	oldBatch, oldConc := in.batch, int(in.window)
+	if in.batch /= 2; in.batch < in.opts.MinBatch {
+		in.batch = in.opts.MinBatch
+	}
+	if in.window /= 2; in.window < 1 {
+		in.window = 1
+	}
+	in.notify(oldBatch, oldConc)
+}
+
+// notify calls OnAdjust if the state changed. It must be called
+// with in.mu held and releases it.
+func (in *Ingester) notify(oldBatch, oldConc int) {
+	batch, conc := in.batch, int(in.window)
+	in.mu.Unlock()
+	if in.opts.OnAdjust != nil && (batch != oldBatch || conc != oldConc) {
+		in.opts.OnAdjust(batch, conc)
+	}
+}
+
+// ingestBatch is a range of documents sent in one request.
+type ingestBatch struct {
+	start, n int
+	attempts int
+	results  []BulkResult
+	err      error
+	latency  time.Duration
+}
+
+// Ingest writes docs and returns one result for each document, in the same
+// order. As with BulkDocs, individual documents can fail even if the
+// returned error is nil. An error is returned if a request fails for a
+// reason other than rate limiting, if a batch is rejected more than
+// MaxRetries times or if the context is canceled. Requests in flight are
+// completed before Ingest returns.
+func (in *Ingester) Ingest(ctx context.Context, docs []interface{}) ([]BulkResult, error) {
+	var (
+		results  = make([]BulkResult, len(docs))
+		next     int
+		retry    []*ingestBatch
+		inflight int
+		done     = make(chan *ingestBatch)
+		resumeAt time.Time
+		failure  error
+		ctxDone  = ctx.Done()
+	)
+	for {
+		// Start requests while the window allows.
+		for failure == nil && time.Now().After(resumeAt) {
+			batchSize, concurrency := in.State()
+			if inflight >= concurrency {
+				break
+			}
+			var b *ingestBatch
+			if len(retry) > 0 {
+				b, retry = retry[0], retry[1:]
+			} else if next < len(docs) {
+				b = &ingestBatch{start: next, n: batchSize}
+				if next+b.n > len(docs) {
+					b.n = len(docs) - next
+				}
+				next += b.n
+			} else {
+				break
+			}
+			inflight++
+			go in.send(b, docs[b.start:b.start+b.n], done)
+		}
+		if inflight == 0 && (failure != nil || (next == len(docs) && len(retry) == 0)) {
+			return results, failure
+		}
+
+		var timer *time.Timer
+		var wait <-chan time.Time
+		if d := time.Until(resumeAt); d > 0 && failure == nil {
+			timer = time.NewTimer(d)
+			wait = timer.C
+		}
+		select {
+		case b := <-done:
+			inflight--
+			switch {
+			case ErrorStatus(b.err, http.StatusTooManyRequests):
+				if b.attempts <= in.opts.MaxRetries {
+					resumeAt = time.Now().Add(in.reject())
+					retry = append(retry, b)
+				} else if failure == nil {
+					failure = fmt.Errorf("couchdb: batch rejected %d times: %v", b.attempts, b.err)
+				}
+			case b.err != nil:
+				if failure == nil {
+					failure = b.err
+				}
+			case len(b.results) != b.n:
+				if failure == nil {
+					failure = fmt.Errorf("couchdb: _bulk_docs returned %d results for %d documents", len(b.results), b.n)
+				}
+			default:
+				copy(results[b.start:], b.results)
+				in.success(b.latency)
+			}
+		case <-wait:
+		case <-ctxDone:
+			ctxDone = nil
+			if failure == nil {
+				failure = ctx.Err()
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (in *Ingester) send(b *ingestBatch, docs []interface{}, done chan<- *ingestBatch) {
+	b.attempts++
+	start := time.Now()
+	b.results, b.err = in.db.BulkDocs(docs)
+	b.latency = time.Since(start)
+	done <- b
+}
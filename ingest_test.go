@@ -0,0 +1,111 @@
+package couchdb_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	. "net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fjl/go-couchdb"
+)
+
+// ingestHandler answers _bulk_docs requests. If reject returns true for
+// a request, it is answered with status 429.
+func ingestHandler(t *testing.T, reject func(n int) bool) (func(ResponseWriter, *Request), func() []int) {
+	var mu sync.Mutex
+	var sizes []int
+	handler := func(resp ResponseWriter, req *Request) {
+		docs := bulkRequest(t, req)
+		mu.Lock()
+		n := len(sizes)
+		sizes = append(sizes, len(docs))
+		mu.Unlock()
+		if reject(n) {
+			resp.WriteHeader(StatusTooManyRequests)
+			io.WriteString(resp, `{"error":"too_many_requests","reason":"You've exceeded your rate limit allowance."}`)
+			return
+		}
+		results := make([]couchdb.BulkResult, len(docs))
+		for i, doc := range docs {
+			results[i] = couchdb.BulkResult{ID: doc["_id"].(string), Rev: "1-x"}
+		}
+		json.NewEncoder(resp).Encode(results)
+	}
+	get := func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int(nil), sizes...)
+	}
+	return handler, get
+}
+
+func ingestDocs(n int) []interface{} {
+	docs := make([]interface{}, n)
+	for i := range docs {
+		docs[i] = map[string]interface{}{"_id": fmt.Sprintf("doc%03d", i)}
+	}
+	return docs
+}
+
+func TestIngesterIncrease(t *testing.T) {
+	c := newTestClient(t)
+	handler, sizes := ingestHandler(t, func(int) bool { return false })
+	c.Handle("POST /db/_bulk_docs", handler)
+
+	in := c.DB("db").NewIngester(couchdb.IngestOptions{MinBatch: 10, MaxBatch: 30, MaxConcurrency: 1})
+	results, err := in.Ingest(context.Background(), ingestDocs(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "batch sizes", []int{10, 20, 30, 30, 10}, sizes())
+	check(t, "result count", 100, len(results))
+	check(t, "last result", couchdb.BulkResult{ID: "doc099", Rev: "1-x"}, results[99])
+	batch, conc := in.State()
+	check(t, "final batch size", 30, batch)
+	check(t, "final concurrency", 1, conc)
+}
+
+func TestIngesterRateLimited(t *testing.T) {
+	c := newTestClient(t)
+	handler, sizes := ingestHandler(t, func(n int) bool { return n == 2 })
+	c.Handle("POST /db/_bulk_docs", handler)
+
+	var adjustments [][2]int
+	in := c.DB("db").NewIngester(couchdb.IngestOptions{
+		MinBatch:       10,
+		MaxConcurrency: 1,
+		Backoff:        time.Millisecond,
+		OnAdjust:       func(b, c int) { adjustments = append(adjustments, [2]int{b, c}) },
+	})
+	results, err := in.Ingest(context.Background(), ingestDocs(60))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The third request (30 docs) is rejected and retried with the same
+	// documents. The rate is halved afterwards.
+	check(t, "batch sizes", []int{10, 20, 30, 30}, sizes())
+	check(t, "rate limited", int64(1), in.RateLimited())
+	check(t, "adjustments", [][2]int{{20, 1}, {30, 1}, {15, 1}, {25, 1}}, adjustments)
+	for i, r := range results {
+		if r.ID != fmt.Sprintf("doc%03d", i) {
+			t.Fatalf("result %d has ID %q", i, r.ID)
+		}
+	}
+}
+
+func TestIngesterMaxRetries(t *testing.T) {
+	c := newTestClient(t)
+	handler, sizes := ingestHandler(t, func(int) bool { return true })
+	c.Handle("POST /db/_bulk_docs", handler)
+
+	in := c.DB("db").NewIngester(couchdb.IngestOptions{Backoff: time.Millisecond, MaxRetries: 2})
+	_, err := in.Ingest(context.Background(), ingestDocs(5))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	check(t, "request count", 3, len(sizes()))
+}
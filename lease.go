@@ -0,0 +1,146 @@
+package couchdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrLeaseLost is returned by Lease.Renew and Lease.Release when the lease
+// document was modified by another writer, e.g. because the lease expired
+// and was acquired by another owner.
+var ErrLeaseLost = errors.New("couchdb: lease lost")
+
+// LeaseHeldError is returned by AcquireLease if the lease is held by another
+// owner and has not expired.
+type LeaseHeldError struct {
+	ID      string
+	Owner   string
+	Expires time.Time
+}
+
+func (e *LeaseHeldError) Error() string {
+	return fmt.Sprintf("couchdb: lease %q is held by %q until %v", e.ID, e.Owner, e.Expires.Format(time.RFC3339))
+}
+
+// Lease is a time-limited claim on a document. Lease documents store the
+// owner in the "owner" field and the expiry time in the "expires" field,
+// encoded like UnixMillis. Other fields of the document are preserved.
+//
+// Leases rely on revision compare-and-swap: every change of the lease is a
+// write using the revision that was last seen, so two owners can't both
+// succeed. Owners must renew the lease before it expires. Since clocks of
+// different machines may disagree, the TTL should be much larger than the
+// expected clock skew.
+//
+// A Lease must not be used concurrently.
+type Lease struct {
+	db      *DB
+	id      string
+	owner   string
+	rev     string
+	expires time.Time
+	doc     map[string]json.RawMessage
+}
+
+// leaseFields are the lease fields of a document.
+type leaseFields struct {
+	Rev     string     `json:"_rev"`
+	Owner   string     `json:"owner"`
+	Expires UnixMillis `json:"expires"`
+}
+
+// AcquireLease acquires the lease stored in the document with the given ID.
+// It succeeds if the document does not exist, if the lease is not held, if it
+// has expired or if it is already held by owner. If the lease is held by
+// another owner, the error is a *LeaseHeldError.
+func (db *DB) AcquireLease(id, owner string, ttl time.Duration) (*Lease, error) {
+	if owner == "" {
+		return nil, errors.New("couchdb.AcquireLease: empty owner")
+	}
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		var raw json.RawMessage
+		if err = db.Get(id, &raw, nil); err != nil && !NotFound(err) {
+			return nil, err
+		}
+		l := &Lease{db: db, id: id, owner: owner, doc: make(map[string]json.RawMessage)}
+		if raw != nil {
+			var cur leaseFields
+			if err := json.Unmarshal(raw, &cur); err != nil {
+				return nil, fmt.Errorf("couchdb: invalid lease document %q: %v", id, err)
+			}
+			if cur.Owner != "" && cur.Owner != owner && time.Now().Before(cur.Expires.Time) {
+				return nil, &LeaseHeldError{ID: id, Owner: cur.Owner, Expires: cur.Expires.Time}
+			}
+			json.Unmarshal(raw, &l.doc)
+			l.rev = cur.Rev
+		}
+		if err = l.store(owner, time.Now().Add(ttl)); !Conflict(err) {
+			if err != nil {
+				return nil, err
+			}
+			return l, nil
+		}
+	}
+	return nil, err
+}
+
+// ID returns the ID of the lease document.
+func (l *Lease) ID() string {
+	return l.id
+}
+
+// Owner returns the owner of the lease.
+func (l *Lease) Owner() string {
+	return l.owner
+}
+
+// Rev returns the current revision of the lease document.
+func (l *Lease) Rev() string {
+	return l.rev
+}
+
+// Expires returns the time at which the lease expires.
+func (l *Lease) Expires() time.Time {
+	return l.expires
+}
+
+// Renew extends the lease by ttl from now. It returns ErrLeaseLost if the
+// lease document was changed by someone else.
+func (l *Lease) Renew(ttl time.Duration) error {
+	return l.casStore(l.owner, time.Now().Add(ttl))
+}
+
+// Release gives up the lease. It returns ErrLeaseLost if the lease
+// document was changed by someone else.
+func (l *Lease) Release() error {
+	return l.casStore("", time.Time{})
+}
+
+func (l *Lease) casStore(owner string, expires time.Time) error {
+	err := l.store(owner, expires)
+	if Conflict(err) {
+		return ErrLeaseLost
+	}
+	return err
+}
+
+// store writes the lease document using the last known revision.
+func (l *Lease) store(owner string, expires time.Time) error {
+	if owner == "" {
+		delete(l.doc, "owner")
+		delete(l.doc, "expires")
+	} else {
+		l.doc["owner"], _ = json.Marshal(owner)
+		l.doc["expires"], _ = UnixMillis{expires}.MarshalJSON()
+	}
+	delete(l.doc, "_rev")
+	newrev, err := l.db.Put(l.id, l.doc, l.rev)
+	if err != nil {
+		return err
+	}
+	l.rev, l.expires = newrev, expires
+	return nil
+}
@@ -0,0 +1,116 @@
+package couchdb_test
+
+import (
+	"encoding/json"
+	"io"
+	. "net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fjl/go-couchdb"
+)
+
+// casDocument serves a single document and implements revision checks.
+type casDocument struct {
+	t   *testing.T
+	gen int
+	doc map[string]interface{}
+}
+
+func (d *casDocument) rev() string {
+	if d.gen == 0 {
+		return ""
+	}
+	return strconv.Itoa(d.gen) + "-x"
+}
+
+func (d *casDocument) register(c *testClient, path string) {
+	c.Handle("GET "+path, func(resp ResponseWriter, req *Request) {
+		if d.doc == nil {
+			resp.WriteHeader(StatusNotFound)
+			io.WriteString(resp, `{"error": "not_found", "reason": "missing"}`)
+			return
+		}
+		d.doc["_rev"] = d.rev()
+		json.NewEncoder(resp).Encode(d.doc)
+	})
+	c.Handle("PUT "+path, func(resp ResponseWriter, req *Request) {
+		if req.URL.Query().Get("rev") != d.rev() {
+			resp.WriteHeader(StatusConflict)
+			io.WriteString(resp, `{"error": "conflict", "reason": "Document update conflict."}`)
+			return
+		}
+		d.doc = nil
+		if err := json.NewDecoder(req.Body).Decode(&d.doc); err != nil {
+			d.t.Fatal(err)
+		}
+		d.gen++
+		resp.Header().Set("ETag", `"`+d.rev()+`"`)
+		resp.WriteHeader(StatusCreated)
+		io.WriteString(resp, `{"ok": true, "rev": "`+d.rev()+`"}`)
+	})
+}
+
+func TestTouch(t *testing.T) {
+	c := newTestClient(t)
+	d := &casDocument{t: t, gen: 1, doc: map[string]interface{}{"name": "worker-1"}}
+	d.register(c, "/db/hb")
+
+	before := time.Now().UnixNano() / int64(time.Millisecond)
+	rev, err := c.DB("db").Touch("hb", "seen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "rev", "2-x", rev)
+	check(t, "name", "worker-1", d.doc["name"])
+	if seen, _ := d.doc["seen"].(float64); int64(seen) < before {
+		t.Errorf("wrong timestamp %v, want >= %d", d.doc["seen"], before)
+	}
+}
+
+func TestLease(t *testing.T) {
+	c := newTestClient(t)
+	d := &casDocument{t: t}
+	d.register(c, "/db/lock")
+	db := c.DB("db")
+
+	l, err := db.AcquireLease("lock", "a", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "owner field", "a", d.doc["owner"])
+	check(t, "rev", "1-x", l.Rev())
+
+	// Another owner can't acquire the lease while it is held.
+	_, err = db.AcquireLease("lock", "b", time.Minute)
+	if held, ok := err.(*couchdb.LeaseHeldError); !ok || held.Owner != "a" {
+		t.Fatalf("expected LeaseHeldError for owner a, got %v", err)
+	}
+
+	if err := l.Renew(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "rev after renew", "2-x", l.Rev())
+
+	// After the lease has expired, it can be taken over.
+	d.doc["expires"] = 0
+	d.gen++
+	l2, err := db.AcquireLease("lock", "b", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Renew(time.Minute); err != couchdb.ErrLeaseLost {
+		t.Fatalf("expected ErrLeaseLost, got %v", err)
+	}
+
+	if err := l2.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.doc["owner"]; ok {
+		t.Error("owner field not removed after release")
+	}
+	if _, err := db.AcquireLease("lock", "a", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+}
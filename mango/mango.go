@@ -0,0 +1,186 @@
+// Package mango builds selectors for Mango queries.
+//
+// Selectors are created from field conditions and combined using logical
+// operators:
+//
+//     sel := mango.Field("age").Gt(21).And(mango.Field("type").Eq("user"))
+//
+// encodes as
+//
+//     {"$and": [{"age": {"$gt": 21}}, {"type": {"$eq": "user"}}]}
+//
+// Selectors can be used as the Selector of couchdb.FindQuery and as the
+// "selector" option of the changes feed.
+package mango
+
+import "encoding/json"
+
+// Selector is a Mango selector. The zero value matches all documents.
+type Selector struct {
+	m map[string]interface{}
+}
+
+// MarshalJSON encodes the selector.
+func (s Selector) MarshalJSON() ([]byte, error) {
+	if s.m == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(s.m)
+}
+
+// And returns a selector matching documents matched by s and all others.
+func (s Selector) And(others ...Selector) Selector {
+	return And(append([]Selector{s}, others...)...)
+}
+
+// Or returns a selector matching documents matched by s or any of others.
+func (s Selector) Or(others ...Selector) Selector {
+	return Or(append([]Selector{s}, others...)...)
+}
+
+// And returns a selector matching documents matched by all selectors.
+// Nested $and selectors are flattened.
+func And(sels ...Selector) Selector {
+	return combine("$and", sels)
+}
+
+// Or returns a selector matching documents matched by any of the selectors.
+// Nested $or selectors are flattened.
+func Or(sels ...Selector) Selector {
+	return combine("$or", sels)
+}
+
+// Nor returns a selector matching documents matched by none of the selectors.
+func Nor(sels ...Selector) Selector {
+	return op("$nor", list(sels))
+}
+
+// Not returns a selector matching documents not matched by s.
+func Not(s Selector) Selector {
+	return op("$not", s)
+}
+
+func combine(operator string, sels []Selector) Selector {
+	var flat []Selector
+	for _, s := range sels {
+		if inner, ok := s.m[operator].([]interface{}); ok && len(s.m) == 1 {
+			for _, x := range inner {
+				flat = append(flat, x.(Selector))
+			}
+		} else {
+			flat = append(flat, s)
+		}
+	}
+	if len(flat) == 1 {
+		return flat[0]
+	}
+	return op(operator, list(flat))
+}
+
+func list(sels []Selector) []interface{} {
+	l := make([]interface{}, len(sels))
+	for i, s := range sels {
+		l[i] = s
+	}
+	return l
+}
+
+func op(operator string, arg interface{}) Selector {
+	return Selector{map[string]interface{}{operator: arg}}
+}
+
+// FieldRef refers to a document field. Its methods create conditions on the field.
+type FieldRef struct {
+	name string
+}
+
+// Field refers to a document field. Nested fields are separated by dots,
+// e.g. "address.city". Dots in field names must be escaped with a backslash.
+func Field(name string) FieldRef {
+	return FieldRef{name}
+}
+
+// Elem refers to the array element inside ElemMatch and AllMatch, for
+// arrays that don't contain objects:
+//
+//     mango.Field("tags").ElemMatch(mango.Elem().Eq("go"))
+func Elem() FieldRef {
+	return FieldRef{}
+}
+
+func (f FieldRef) cond(operator string, arg interface{}) Selector {
+	if f.name == "" {
+		return op(operator, arg)
+	}
+	return Selector{map[string]interface{}{f.name: map[string]interface{}{operator: arg}}}
+}
+
+// Eq matches if the field is equal to v.
+func (f FieldRef) Eq(v interface{}) Selector { return f.cond("$eq", v) }
+
+// Ne matches if the field is not equal to v.
+func (f FieldRef) Ne(v interface{}) Selector { return f.cond("$ne", v) }
+
+// Gt matches if the field is greater than v.
+func (f FieldRef) Gt(v interface{}) Selector { return f.cond("$gt", v) }
+
+// Gte matches if the field is greater than or equal to v.
+func (f FieldRef) Gte(v interface{}) Selector { return f.cond("$gte", v) }
+
+// Lt matches if the field is less than v.
+func (f FieldRef) Lt(v interface{}) Selector { return f.cond("$lt", v) }
+
+// Lte matches if the field is less than or equal to v.
+func (f FieldRef) Lte(v interface{}) Selector { return f.cond("$lte", v) }
+
+// In matches if the field is equal to one of the values.
+func (f FieldRef) In(values ...interface{}) Selector { return f.cond("$in", nonNil(values)) }
+
+// Nin matches if the field is equal to none of the values.
+func (f FieldRef) Nin(values ...interface{}) Selector { return f.cond("$nin", nonNil(values)) }
+
+// All matches arrays that contain all of the values.
+func (f FieldRef) All(values ...interface{}) Selector { return f.cond("$all", nonNil(values)) }
+
+// Exists matches if the field exists, or if it doesn't exist when
+// exists is false.
+func (f FieldRef) Exists(exists bool) Selector { return f.cond("$exists", exists) }
+
+// Type matches if the field has the given JSON type: "null", "boolean",
+// "number", "string", "array" or "object".
+func (f FieldRef) Type(typ string) Selector { return f.cond("$type", typ) }
+
+// Size matches arrays of the given length.
+func (f FieldRef) Size(n int) Selector { return f.cond("$size", n) }
+
+// Mod matches integers whose remainder of division by divisor is remainder.
+func (f FieldRef) Mod(divisor, remainder int) Selector {
+	return f.cond("$mod", []int{divisor, remainder})
+}
+
+// Regex matches strings against a regular expression
+// in the syntax of Erlang's re module.
+func (f FieldRef) Regex(re string) Selector { return f.cond("$regex", re) }
+
+// ElemMatch matches arrays that contain an element matched by s.
+func (f FieldRef) ElemMatch(s Selector) Selector { return f.cond("$elemMatch", s) }
+
+// AllMatch matches arrays whose elements are all matched by s.
+func (f FieldRef) AllMatch(s Selector) Selector { return f.cond("$allMatch", s) }
+
+// Match applies s to the field, which must be an object. This is
+// equivalent to prefixing the field names in s with the field name.
+func (f FieldRef) Match(s Selector) Selector {
+	if f.name == "" {
+		return s
+	}
+	return Selector{map[string]interface{}{f.name: s}}
+}
+
+// nonNil makes empty value lists encode as [] instead of null.
+func nonNil(values []interface{}) []interface{} {
+	if values == nil {
+		return []interface{}{}
+	}
+	return values
+}
@@ -0,0 +1,82 @@
+package mango_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/fjl/go-couchdb/mango"
+)
+
+func TestSelectorJSON(t *testing.T) {
+	tests := []struct {
+		sel  mango.Selector
+		want string
+	}{
+		{
+			sel:  mango.Selector{},
+			want: `{}`,
+		},
+		{
+			sel:  mango.Field("age").Gt(21).And(mango.Field("type").Eq("user")),
+			want: `{"$and":[{"age":{"$gt":21}},{"type":{"$eq":"user"}}]}`,
+		},
+		{
+			sel:  mango.And(mango.Field("a").Eq(1), mango.Field("b").Eq(2)).And(mango.Field("c").Eq(3)),
+			want: `{"$and":[{"a":{"$eq":1}},{"b":{"$eq":2}},{"c":{"$eq":3}}]}`,
+		},
+		{
+			sel:  mango.Field("a").Eq(1).Or(mango.Field("b").Exists(false)),
+			want: `{"$or":[{"a":{"$eq":1}},{"b":{"$exists":false}}]}`,
+		},
+		{
+			sel:  mango.And(mango.Field("a").Eq(1)),
+			want: `{"a":{"$eq":1}}`,
+		},
+		{
+			sel:  mango.Not(mango.Field("status").In("archived", "deleted")),
+			want: `{"$not":{"status":{"$in":["archived","deleted"]}}}`,
+		},
+		{
+			sel:  mango.Nor(mango.Field("x").Nin(), mango.Field("y").Size(2)),
+			want: `{"$nor":[{"x":{"$nin":[]}},{"y":{"$size":2}}]}`,
+		},
+		{
+			sel:  mango.Field("tags").ElemMatch(mango.Elem().Eq("go")),
+			want: `{"tags":{"$elemMatch":{"$eq":"go"}}}`,
+		},
+		{
+			sel: mango.Field("items").AllMatch(
+				mango.Field("qty").Gte(1).And(mango.Field("sku").Regex("^A"))),
+			want: `{"items":{"$allMatch":{"$and":[{"qty":{"$gte":1}},{"sku":{"$regex":"^A"}}]}}}`,
+		},
+		{
+			sel:  mango.Field("address").Match(mango.Field("city").Eq("Berlin")),
+			want: `{"address":{"city":{"$eq":"Berlin"}}}`,
+		},
+		{
+			sel:  mango.Field("n").Mod(4, 1).And(mango.Field("v").Type("number"), mango.Field("l").All("a", "b")),
+			want: `{"$and":[{"n":{"$mod":[4,1]}},{"v":{"$type":"number"}},{"l":{"$all":["a","b"]}}]}`,
+		},
+	}
+	for _, test := range tests {
+		enc, err := json.Marshal(test.sel)
+		if err != nil {
+			t.Errorf("marshal error: %v", err)
+			continue
+		}
+		if string(enc) != test.want {
+			t.Errorf("wrong JSON:\n got  %s\n want %s", enc, test.want)
+		}
+	}
+}
+
+func TestSelectorInQuery(t *testing.T) {
+	query := map[string]interface{}{"selector": mango.Field("type").Ne("design")}
+	enc, err := json.Marshal(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"selector":{"type":{"$ne":"design"}}}`; string(enc) != want {
+		t.Errorf("wrong JSON:\n got  %s\n want %s", enc, want)
+	}
+}
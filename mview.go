@@ -0,0 +1,177 @@
+package couchdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// MapFunc computes the derived documents of a source document by calling
+// emit for each of them. It is not called for deleted documents, which
+// have no derived documents.
+type MapFunc func(id string, doc json.RawMessage, emit func(key string, value interface{})) error
+
+// MaterializedViewOptions configures a MaterializedView.
+type MaterializedViewOptions struct {
+	// Checkpoints stores the position in the source feed under Name.
+	// The default is LocalCheckpoints(target) and the name "mview".
+	Checkpoints CheckpointStore
+	Name        string
+
+	// Options are additional options of the source changes feed,
+	// e.g. "filter". The "include_docs" option is always set.
+	Options Options
+}
+
+// MaterializedView keeps a target database in sync with the output of a
+// map function applied to the documents of a source database. This can be
+// used to chain map/reduce steps.
+//
+// Every emitted key/value pair becomes a target document with ID
+// "<source ID>:<key>" of the form
+//
+//     {"_id": "<source ID>:<key>", "source": "<source ID>", "key": "<key>", "value": <value>}
+//
+// In target IDs, the characters ':' and '%' of the source ID are escaped
+// as "%3A" and "%25", so the ID prefix of each source is unique.
+//
+// When a source document changes, its target documents are updated and
+// target documents that are no longer emitted are deleted. Target documents
+// whose value didn't change are not written.
+type MaterializedView struct {
+	source, target *DB
+	fn             MapFunc
+	follower       *Follower
+}
+
+type mviewDoc struct {
+	ID      string          `json:"_id"`
+	Rev     string          `json:"_rev,omitempty"`
+	Deleted bool            `json:"_deleted,omitempty"`
+	Source  string          `json:"source,omitempty"`
+	Key     string          `json:"key,omitempty"`
+	Value   json.RawMessage `json:"value,omitempty"`
+}
+
+// NewMaterializedView creates a materialized view. Call Run to build it
+// and keep it up to date.
+func NewMaterializedView(source, target *DB, fn MapFunc, opts MaterializedViewOptions) *MaterializedView {
+	if opts.Checkpoints == nil {
+		opts.Checkpoints = LocalCheckpoints(target)
+	}
+	if opts.Name == "" {
+		opts.Name = "mview"
+	}
+	mv := &MaterializedView{source: source, target: target, fn: fn}
+	mv.follower = source.NewFollower(SinkFunc(mv.apply), FollowerOptions{
+		Checkpoints:     opts.Checkpoints,
+		Name:            opts.Name,
+		CheckpointEvery: 100,
+		Options:         opts.Options.merge(Options{"include_docs": true}),
+	})
+	return mv
+}
+
+// Run processes the changes of the source database until the context is
+// canceled or an error occurs. On the first run, the whole source database
+// is processed. Later runs continue at the last checkpoint.
+func (mv *MaterializedView) Run(ctx context.Context) error {
+	return mv.follower.Run(ctx)
+}
+
+// apply updates the target documents of a changed source document.
+func (mv *MaterializedView) apply(ctx context.Context, c *Change) error {
+	if strings.HasPrefix(c.ID, "_design/") {
+		return nil
+	}
+	// Compute new target documents.
+	prefix := mviewIDEscaper.Replace(c.ID) + ":"
+	emitted := make(map[string]*mviewDoc)
+	if !c.Deleted {
+		var emitErr error
+		emit := func(key string, value interface{}) {
+			enc, err := json.Marshal(value)
+			if err != nil {
+				emitErr = err
+				return
+			}
+			id := prefix + key
+			emitted[id] = &mviewDoc{ID: id, Source: c.ID, Key: key, Value: enc}
+		}
+		if err := mv.fn(c.ID, c.Doc, emit); err != nil {
+			return err
+		}
+		if emitErr != nil {
+			return emitErr
+		}
+	}
+
+	// Find existing target documents.
+	var existing struct {
+		Rows []struct {
+			ID  string   `json:"id"`
+			Doc mviewDoc `json:"doc"`
+		} `json:"rows"`
+	}
+	err := mv.target.AllDocs(&existing, Options{
+		"startkey":     prefix,
+		"endkey":       prefix + "\ufff0",
+		"include_docs": true,
+	})
+	if err != nil {
+		return err
+	}
+	var updates []interface{}
+	for _, row := range existing.Rows {
+		doc := row.Doc
+		if doc.Source != c.ID {
+			continue // not a target document of this source
+		}
+		if newdoc, ok := emitted[row.ID]; ok {
+			if bytes.Equal(compactJSON(newdoc.Value), compactJSON(doc.Value)) {
+				delete(emitted, row.ID) // unchanged
+			} else {
+				newdoc.Rev = doc.Rev
+			}
+		} else {
+			updates = append(updates, &mviewDoc{ID: row.ID, Rev: doc.Rev, Deleted: true})
+		}
+	}
+	ids := make([]string, 0, len(emitted))
+	for id := range emitted {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		updates = append(updates, emitted[id])
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	results, err := mv.target.BulkDocs(updates)
+	if err != nil {
+		return err
+	}
+	var failed []BulkResult
+	for _, r := range results {
+		if r.Error != "" {
+			failed = append(failed, r)
+		}
+	}
+	if len(failed) > 0 {
+		return &BulkError{Failed: failed}
+	}
+	return nil
+}
+
+var mviewIDEscaper = strings.NewReplacer("%", "%25", ":", "%3A")
+
+func compactJSON(v json.RawMessage) []byte {
+	var buf bytes.Buffer
+	if json.Compact(&buf, v) != nil {
+		return v
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,122 @@
+package couchdb_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	. "net/http"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestMaterializedView(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /src/_changes", func(resp ResponseWriter, req *Request) {
+		check(t, "include_docs", "true", req.URL.Query().Get("include_docs"))
+		io.WriteString(resp, `{"seq": "1-...", "id": "order1", "changes": [{"rev": "2-a"}],
+			"doc": {"_id": "order1", "items": {"apple": 2, "pear": 1}}}`+"\n")
+	})
+	c.Handle("GET /dst/_all_docs", func(resp ResponseWriter, req *Request) {
+		check(t, "startkey", `"order1:"`, req.URL.Query().Get("startkey"))
+		io.WriteString(resp, `{"rows": [
+			{"id": "order1:apple", "doc": {"_id": "order1:apple", "_rev": "1-x", "source": "order1", "key": "apple", "value": 2}},
+			{"id": "order1:plum", "doc": {"_id": "order1:plum", "_rev": "1-y", "source": "order1", "key": "plum", "value": 3}}
+		]}`)
+	})
+	var written []map[string]interface{}
+	c.Handle("POST /dst/_bulk_docs", func(resp ResponseWriter, req *Request) {
+		var body struct{ Docs []map[string]interface{} }
+		json.NewDecoder(req.Body).Decode(&body)
+		written = body.Docs
+		io.WriteString(resp, `[{"id": "order1:plum", "rev": "2-y"}, {"id": "order1:pear", "rev": "1-z"}]`)
+	})
+	c.Handle("GET /dst/_local/mview", func(resp ResponseWriter, req *Request) {
+		resp.WriteHeader(StatusNotFound)
+		io.WriteString(resp, `{"error": "not_found", "reason": "missing"}`)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.Handle("PUT /dst/_local/mview", func(resp ResponseWriter, req *Request) {
+		resp.Header().Set("ETag", `"0-1"`)
+		resp.WriteHeader(StatusCreated)
+		io.WriteString(resp, `{"ok": true, "id": "_local/mview", "rev": "0-1"}`)
+	})
+
+	fn := func(id string, doc json.RawMessage, emit func(string, interface{})) error {
+		var order struct{ Items map[string]int }
+		if err := json.Unmarshal(doc, &order); err != nil {
+			return err
+		}
+		for item, n := range order.Items {
+			emit(item, n)
+		}
+		cancel()
+		return nil
+	}
+	mv := couchdb.NewMaterializedView(c.DB("src"), c.DB("dst"), fn, couchdb.MaterializedViewOptions{})
+	check(t, "error", context.Canceled, mv.Run(ctx))
+
+	expected := []map[string]interface{}{
+		{"_id": "order1:plum", "_rev": "1-y", "_deleted": true},
+		{"_id": "order1:pear", "source": "order1", "key": "pear", "value": float64(1)},
+	}
+	check(t, "written docs", expected, written)
+}
+
+func TestMaterializedViewPrefixSources(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /src/_changes", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"seq": "1-...", "id": "a", "changes": [{"rev": "2-a"}], "doc": {"_id": "a"}}`+"\n")
+		io.WriteString(resp, `{"seq": "2-...", "id": "a:b", "changes": [{"rev": "1-b"}], "doc": {"_id": "a:b"}}`+"\n")
+	})
+	c.Handle("GET /dst/_all_docs", func(resp ResponseWriter, req *Request) {
+		switch start := req.URL.Query().Get("startkey"); start {
+		case `"a:"`:
+			// The range also contains a document of source "a:b",
+			// e.g. one written before IDs were escaped.
+			io.WriteString(resp, `{"rows": [
+				{"id": "a:b:key", "doc": {"_id": "a:b:key", "_rev": "1-x", "source": "a:b", "key": "key", "value": 1}},
+				{"id": "a:old", "doc": {"_id": "a:old", "_rev": "1-y", "source": "a", "key": "old", "value": 1}}
+			]}`)
+		case `"a%3Ab:"`:
+			io.WriteString(resp, `{"rows": []}`)
+		default:
+			t.Errorf("unexpected startkey %s", start)
+		}
+	})
+	var written []map[string]interface{}
+	c.Handle("POST /dst/_bulk_docs", func(resp ResponseWriter, req *Request) {
+		var body struct{ Docs []map[string]interface{} }
+		json.NewDecoder(req.Body).Decode(&body)
+		written = append(written, body.Docs...)
+		io.WriteString(resp, `[{"id": "x", "rev": "1-x"}]`)
+	})
+	c.Handle("GET /dst/_local/mview", func(resp ResponseWriter, req *Request) {
+		resp.WriteHeader(StatusNotFound)
+		io.WriteString(resp, `{"error": "not_found", "reason": "missing"}`)
+	})
+	c.Handle("PUT /dst/_local/mview", func(resp ResponseWriter, req *Request) {
+		resp.Header().Set("ETag", `"0-1"`)
+		resp.WriteHeader(StatusCreated)
+		io.WriteString(resp, `{"ok": true, "id": "_local/mview", "rev": "0-1"}`)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fn := func(id string, doc json.RawMessage, emit func(string, interface{})) error {
+		if id == "a:b" {
+			emit("key", 1)
+			cancel()
+		}
+		return nil
+	}
+	mv := couchdb.NewMaterializedView(c.DB("src"), c.DB("dst"), fn, couchdb.MaterializedViewOptions{})
+	check(t, "error", context.Canceled, mv.Run(ctx))
+
+	expected := []map[string]interface{}{
+		{"_id": "a:old", "_rev": "1-y", "_deleted": true},
+		{"_id": "a%3Ab:key", "source": "a:b", "key": "key", "value": float64(1)},
+	}
+	check(t, "written docs", expected, written)
+}
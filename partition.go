@@ -0,0 +1,149 @@
+package couchdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ValidatePartitionKey checks whether key can be used as the partition of
+// a document ID in a partitioned database. Partition keys must be non-empty,
+// must not contain ':' and must not begin with '_'.
+func ValidatePartitionKey(key string) error {
+	switch {
+	case key == "":
+		return errors.New("couchdb: empty partition key")
+	case key[0] == '_':
+		return fmt.Errorf("couchdb: partition key %q begins with '_'", key)
+	case strings.IndexByte(key, ':') != -1:
+		return fmt.Errorf("couchdb: partition key %q contains ':'", key)
+	}
+	return nil
+}
+
+// PartitionID builds the ID of a document in a partitioned database.
+func PartitionID(partition, docid string) (string, error) {
+	if err := ValidatePartitionKey(partition); err != nil {
+		return "", err
+	}
+	if docid == "" {
+		return "", errors.New("couchdb: empty document ID")
+	}
+	return partition + ":" + docid, nil
+}
+
+// SplitPartitionID splits the ID of a document in a partitioned database
+// into the partition key and the rest of the ID. It returns false if the
+// ID doesn't have a valid partition prefix.
+func SplitPartitionID(id string) (partition, docid string, ok bool) {
+	i := strings.IndexByte(id, ':')
+	if i == -1 || i == len(id)-1 || ValidatePartitionKey(id[:i]) != nil {
+		return "", "", false
+	}
+	return id[:i], id[i+1:], true
+}
+
+// Partition provides access to a single partition of a partitioned database.
+// Document IDs passed to its methods don't include the partition key; it is
+// added automatically.
+type Partition struct {
+	db  *DB
+	key string
+	err error // set if key is invalid
+}
+
+// Partition returns an object for accessing a partition of the database.
+// If the key is invalid, all methods of the partition return an error.
+func (db *DB) Partition(key string) *Partition {
+	return &Partition{db: db, key: key, err: ValidatePartitionKey(key)}
+}
+
+// Key returns the partition key.
+func (p *Partition) Key() string {
+	return p.key
+}
+
+// ID returns the full document ID of docid in the partition.
+func (p *Partition) ID(docid string) (string, error) {
+	if p.err != nil {
+		return "", p.err
+	}
+	return PartitionID(p.key, docid)
+}
+
+// Get retrieves a document of the partition. See DB.Get.
+func (p *Partition) Get(docid string, doc interface{}, opts Options) error {
+	id, err := p.ID(docid)
+	if err != nil {
+		return err
+	}
+	return p.db.Get(id, doc, opts)
+}
+
+// Put stores a document in the partition. See DB.Put.
+func (p *Partition) Put(docid string, doc interface{}, rev string) (newrev string, err error) {
+	id, err := p.ID(docid)
+	if err != nil {
+		return "", err
+	}
+	return p.db.Put(id, doc, rev)
+}
+
+// Delete marks a document revision in the partition as deleted. See DB.Delete.
+func (p *Partition) Delete(docid, rev string) (newrev string, err error) {
+	id, err := p.ID(docid)
+	if err != nil {
+		return "", err
+	}
+	return p.db.Delete(id, rev)
+}
+
+// AllDocs invokes the _all_docs view of the partition. See DB.AllDocs.
+func (p *Partition) AllDocs(result interface{}, opts Options) error {
+	if p.err != nil {
+		return p.err
+	}
+	resp, err := p.db.viewRequest(p.path().addRaw("_all_docs"), p.db.options(opts))
+	if err != nil {
+		return err
+	}
+	return p.db.readBody(resp, result)
+}
+
+// View invokes a view, returning only rows of the partition. See DB.View.
+func (p *Partition) View(ddoc, view string, result interface{}, opts Options) error {
+	if p.err != nil {
+		return p.err
+	}
+	if !strings.HasPrefix(ddoc, "_design/") {
+		return errors.New("couchdb.Partition.View: design doc name must start with _design/")
+	}
+	path := p.path().docID(ddoc).addRaw("_view").add(view)
+	resp, err := p.db.viewRequest(path, p.db.options(opts))
+	if err != nil {
+		return err
+	}
+	return p.db.readBody(resp, result)
+}
+
+// Find runs a Mango query on the partition. See DB.Find.
+func (p *Partition) Find(query interface{}, result interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	body, err := json.Marshal(query)
+	if err != nil {
+		return err
+	}
+	resp, err := p.db.request("POST", p.path().addRaw("_find").path(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	return p.db.readBody(resp, result)
+}
+
+func (p *Partition) path() *pathBuilder {
+	return p.db.path().addRaw("_partition").add(p.key)
+}
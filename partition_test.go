@@ -0,0 +1,65 @@
+package couchdb_test
+
+import (
+	"io"
+	. "net/http"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestPartitionID(t *testing.T) {
+	id, err := couchdb.PartitionID("sensor-1", "reading:42")
+	check(t, "id", "sensor-1:reading:42", id)
+	check(t, "err", nil, err)
+
+	part, docid, ok := couchdb.SplitPartitionID(id)
+	check(t, "split", []interface{}{"sensor-1", "reading:42", true}, []interface{}{part, docid, ok})
+
+	for _, key := range []string{"", "_x", "a:b"} {
+		if _, err := couchdb.PartitionID(key, "doc"); err == nil {
+			t.Errorf("expected error for partition key %q", key)
+		}
+	}
+	for _, id := range []string{"doc", ":doc", "p:", "_design/x"} {
+		if _, _, ok := couchdb.SplitPartitionID(id); ok {
+			t.Errorf("SplitPartitionID(%q) returned ok", id)
+		}
+	}
+}
+
+func TestPartition(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("PUT /db/sensor-1%3Ar1", func(resp ResponseWriter, req *Request) {
+		resp.Header().Set("ETag", `"1-a"`)
+		resp.WriteHeader(StatusCreated)
+		io.WriteString(resp, `{"ok": true, "id": "sensor-1:r1", "rev": "1-a"}`)
+	})
+	c.Handle("GET /db/_partition/sensor-1/_all_docs", func(resp ResponseWriter, req *Request) {
+		check(t, "query", "limit=1", req.URL.RawQuery)
+		io.WriteString(resp, `{"rows": [{"id": "sensor-1:r1", "key": "sensor-1:r1", "value": {"rev": "1-a"}}]}`)
+	})
+	c.Handle("GET /db/_partition/sensor-1/_design/d/_view/v", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"rows": []}`)
+	})
+
+	p := c.DB("db").Partition("sensor-1")
+	rev, err := p.Put("r1", &testDocument{Field: 1}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "rev", "1-a", rev)
+
+	var result struct{ Rows []struct{ ID string } }
+	if err := p.AllDocs(&result, couchdb.Options{"limit": 1}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "row ID", "sensor-1:r1", result.Rows[0].ID)
+	if err := p.View("_design/d", "v", &result, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.DB("db").Partition("a:b").Put("r1", &testDocument{}, ""); err == nil {
+		t.Error("expected error for invalid partition key")
+	}
+}
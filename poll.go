@@ -0,0 +1,108 @@
+package couchdb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"net/http"
+)
+
+// ListPoller detects changes of the database list or the document list of
+// a database without transferring the listing when nothing has changed. It
+// is meant for user interfaces that refresh listings periodically.
+//
+// The listing is requested with If-None-Match when the server provided an
+// ETag. For document listings, the update sequence of the database is
+// checked before the listing is requested. A ListPoller must not be used
+// concurrently.
+type ListPoller struct {
+	t    *transport
+	c    *Client // nil for document listings
+	db   *DB     // nil for the database list
+	path string
+	err  error // set if the options are invalid
+
+	polled bool
+	etag   string
+	seq    interface{}
+	hash   [sha256.Size]byte
+}
+
+// AllDBsPoller creates a poller for the list of databases.
+func (c *Client) AllDBsPoller() *ListPoller {
+	return &ListPoller{t: c.transport, c: c, path: "/_all_dbs"}
+}
+
+// AllDocsPoller creates a poller for the _all_docs view of the database,
+// queried with the given options.
+func (db *DB) AllDocsPoller(opts Options) *ListPoller {
+	p := &ListPoller{t: db.transport, db: db}
+	opts = db.options(opts)
+	if p.err = ValidateViewOptions(opts); p.err == nil {
+		p.path, p.err = db.path().addRaw("_all_docs").options(opts, viewJsonKeys)
+	}
+	return p
+}
+
+// Poll fetches the listing if it has changed since the last call and
+// decodes it into result. It reports whether result was set. The first
+// call always fetches the listing.
+func (p *ListPoller) Poll(result interface{}) (changed bool, err error) {
+	if p.err != nil {
+		return false, p.err
+	}
+	var seq interface{}
+	if p.db != nil {
+		info, err := p.db.Info()
+		if err != nil {
+			return false, err
+		}
+		if p.polled && seqEqual(info.UpdateSeq, p.seq) {
+			return false, nil
+		}
+		seq = info.UpdateSeq
+	}
+
+	var req *http.Request
+	if p.db != nil {
+		req, err = p.db.newRequest("GET", p.path, nil)
+	} else {
+		req, err = p.c.newRequest("GET", p.path, nil)
+	}
+	if err != nil {
+		return false, err
+	}
+	if p.polled && p.etag != "" {
+		req.Header.Set("If-None-Match", p.etag)
+	}
+	resp, err := p.t.do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		p.seq = seq
+		return false, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	// Servers that don't send an ETag return the full listing
+	// every time. Compare the content to avoid reporting a change.
+	hash := sha256.Sum256(body)
+	if !p.polled || hash != p.hash {
+		if err := p.t.newDecoder(bytes.NewReader(body)).Decode(result); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+	p.polled, p.etag, p.seq, p.hash = true, resp.Header.Get("Etag"), seq, hash
+	return changed, nil
+}
+
+// Reset makes the next call to Poll fetch the listing.
+func (p *ListPoller) Reset() {
+	p.polled, p.etag, p.seq = false, "", nil
+}
@@ -0,0 +1,70 @@
+package couchdb_test
+
+import (
+	"io"
+	. "net/http"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestAllDBsPoller(t *testing.T) {
+	c := newTestClient(t)
+	list := `["a","b"]`
+	c.Handle("GET /_all_dbs", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, list)
+	})
+
+	p := c.AllDBsPoller()
+	poll := func(name string, wantChanged bool, want []string) {
+		var names []string
+		changed, err := p.Poll(&names)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, name+" changed", wantChanged, changed)
+		check(t, name+" result", want, names)
+	}
+	poll("first", true, []string{"a", "b"})
+	poll("same content", false, nil)
+	list = `["a","b","c"]`
+	poll("new content", true, []string{"a", "b", "c"})
+
+	p.Reset()
+	poll("after reset", true, []string{"a", "b", "c"})
+}
+
+func TestAllDocsPoller(t *testing.T) {
+	c := newTestClient(t)
+	seq := `"1-a"`
+	c.Handle("GET /db", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"db_name": "db", "update_seq": `+seq+`}`)
+	})
+	var requests []string
+	c.Handle("GET /db/_all_docs", func(resp ResponseWriter, req *Request) {
+		check(t, "limit", "10", req.URL.Query().Get("limit"))
+		requests = append(requests, req.Header.Get("If-None-Match"))
+		resp.Header().Set("ETag", `"v1"`)
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			resp.WriteHeader(StatusNotModified)
+			return
+		}
+		io.WriteString(resp, `{"total_rows": 0, "offset": 0, "rows": []}`)
+	})
+
+	p := c.DB("db").AllDocsPoller(couchdb.Options{"limit": 10})
+	var result struct{ TotalRows int64 }
+	for i, want := range []bool{true, false, false} {
+		if i == 2 {
+			seq = `"2-a"`
+		}
+		changed, err := p.Poll(&result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, "changed", want, changed)
+	}
+	// The second poll is answered by the update sequence alone,
+	// the third one by the ETag.
+	check(t, "requests", []string{"", `"v1"`}, requests)
+}
@@ -0,0 +1,240 @@
+package couchdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// BulkGetResult is a document returned by BulkGet.
+type BulkGetResult struct {
+	ID  string
+	Doc json.RawMessage // nil if Err is set
+	Err error           // *DocError reported by the server for this document
+}
+
+// BulkGet retrieves multiple documents in a single request.
+// The result contains one element for each ID, in the same order.
+// Documents that could not be retrieved have the Err field set,
+// use NotFound to check whether a document doesn't exist.
+//
+// This requires CouchDB 2.0 or later.
+//
+// http://docs.couchdb.org/en/latest/api/database/bulk-api.html#db-bulk-get
+func (db *DB) BulkGet(ids []string) ([]BulkGetResult, error) {
+	type docref struct {
+		ID string `json:"id"`
+	}
+	reqdocs := make([]docref, len(ids))
+	for i, id := range ids {
+		reqdocs[i].ID = id
+	}
+	body, err := json.Marshal(struct {
+		Docs []docref `json:"docs"`
+	}{reqdocs})
+	if err != nil {
+		return nil, err
+	}
+	path := db.path().addRaw("_bulk_get").path()
+	resp, err := db.request("POST", path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	var reply struct {
+		Results []struct {
+			ID   string `json:"id"`
+			Docs []struct {
+				OK    json.RawMessage `json:"ok"`
+				Error *struct {
+					Error  string `json:"error"`
+					Reason string `json:"reason"`
+				} `json:"error"`
+			} `json:"docs"`
+		} `json:"results"`
+	}
+	if err := readBody(resp, &reply); err != nil {
+		return nil, err
+	}
+
+	results := make([]BulkGetResult, len(reply.Results))
+	for i, r := range reply.Results {
+		results[i].ID = r.ID
+		if len(r.Docs) == 0 {
+			results[i].Err = docError(r.ID, "not_found", "missing")
+			continue
+		}
+		d := r.Docs[0]
+		if d.Error != nil {
+			results[i].Err = docError(r.ID, d.Error.Error, d.Error.Reason)
+		} else {
+			results[i].Doc = d.OK
+		}
+	}
+	return results, nil
+}
+
+// PoolOptions configures the worker pool used by ForEachDoc and UpdateDocs.
+type PoolOptions struct {
+	Workers   int // number of concurrent requests, default 4
+	BatchSize int // number of documents per request, default 100
+}
+
+func (o PoolOptions) withDefaults() PoolOptions {
+	if o.Workers <= 0 {
+		o.Workers = 4
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 100
+	}
+	return o
+}
+
+// DocErrors collects the errors of bulk helpers by document ID.
+type DocErrors map[string]error
+
+func (e DocErrors) Error() string {
+	ids := make([]string, 0, len(e))
+	for id := range e {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if len(ids) > 3 {
+		ids = append(ids[:3], "...")
+	}
+	return fmt.Sprintf("couchdb: %d document(s) failed: %s", len(e), strings.Join(ids, ", "))
+}
+
+// ForEachDoc fetches all documents whose IDs are received from the ids
+// channel and calls fn for each of them. Documents are fetched in batches
+// using BulkGet, with up to opts.Workers requests in flight at the same time.
+// fn is called concurrently from multiple goroutines.
+//
+// ForEachDoc returns when the ids channel is closed and all documents have been
+// processed. Documents that could not be fetched or for which fn returned an
+// error are reported in the returned DocErrors.
+func (db *DB) ForEachDoc(ids <-chan string, opts PoolOptions, fn func(id string, doc json.RawMessage) error) error {
+	return db.runPool(ids, opts, func(batch []BulkGetResult, errs *poolErrors) {
+		for _, r := range batch {
+			if r.Err != nil {
+				errs.add(r.ID, r.Err)
+			} else if err := fn(r.ID, r.Doc); err != nil {
+				errs.add(r.ID, err)
+			}
+		}
+	})
+}
+
+// UpdateDocs fetches all documents whose IDs are received from the ids channel,
+// calls fn to compute the new content of each document and writes the results
+// back using BulkDocs. The revision of the fetched document is used for the
+// update, the returned value does not need to contain _id or _rev. If fn returns
+// nil, the document is left unchanged. fn is called concurrently from multiple
+// goroutines.
+//
+// Concurrency and error reporting work like ForEachDoc. Documents that were
+// modified since they were fetched are reported with a conflict error.
+func (db *DB) UpdateDocs(ids <-chan string, opts PoolOptions, fn func(id string, doc json.RawMessage) (interface{}, error)) error {
+	return db.runPool(ids, opts, func(batch []BulkGetResult, errs *poolErrors) {
+		var ops []*bulkOp
+		for _, r := range batch {
+			if r.Err != nil {
+				errs.add(r.ID, r.Err)
+				continue
+			}
+			newdoc, err := fn(r.ID, r.Doc)
+			if err != nil {
+				errs.add(r.ID, err)
+				continue
+			} else if newdoc == nil {
+				continue
+			}
+			var meta struct {
+				Rev string `json:"_rev"`
+			}
+			json.Unmarshal(r.Doc, &meta)
+			op, err := newBulkOp(r.ID, newdoc, meta.Rev)
+			if err != nil {
+				errs.add(r.ID, err)
+				continue
+			}
+			ops = append(ops, op)
+		}
+		if len(ops) == 0 {
+			return
+		}
+		docs := make([]interface{}, len(ops))
+		for i, op := range ops {
+			docs[i] = op.doc
+		}
+		results, err := db.BulkDocs(docs)
+		if err != nil {
+			for _, op := range ops {
+				errs.add(op.id(), err)
+			}
+			return
+		}
+		for _, res := range results {
+			if err := res.Err(); err != nil {
+				errs.add(res.ID, err)
+			}
+		}
+	})
+}
+
+type poolErrors struct {
+	mu   sync.Mutex
+	errs DocErrors
+}
+
+func (e *poolErrors) add(id string, err error) {
+	e.mu.Lock()
+	e.errs[id] = err
+	e.mu.Unlock()
+}
+
+// runPool reads ids into batches and fetches them concurrently.
+func (db *DB) runPool(ids <-chan string, opts PoolOptions, process func([]BulkGetResult, *poolErrors)) error {
+	opts = opts.withDefaults()
+	errs := &poolErrors{errs: make(DocErrors)}
+	batches := make(chan []string)
+
+	var wg sync.WaitGroup
+	wg.Add(opts.Workers)
+	for i := 0; i < opts.Workers; i++ {
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				results, err := db.BulkGet(batch)
+				if err != nil {
+					for _, id := range batch {
+						errs.add(id, err)
+					}
+					continue
+				}
+				process(results, errs)
+			}
+		}()
+	}
+
+	batch := make([]string, 0, opts.BatchSize)
+	for id := range ids {
+		batch = append(batch, id)
+		if len(batch) == opts.BatchSize {
+			batches <- batch
+			batch = make([]string, 0, opts.BatchSize)
+		}
+	}
+	if len(batch) > 0 {
+		batches <- batch
+	}
+	close(batches)
+	wg.Wait()
+
+	if len(errs.errs) > 0 {
+		return errs.errs
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package couchdb_test
+
+import (
+	"encoding/json"
+	"io"
+	. "net/http"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+// bulkGetHandler serves _bulk_get requests from a map of documents.
+func bulkGetHandler(t *testing.T, docs map[string]string) func(ResponseWriter, *Request) {
+	return func(resp ResponseWriter, req *Request) {
+		var body struct{ Docs []struct{ ID string } }
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Errorf("can't decode _bulk_get request: %v", err)
+		}
+		type result struct {
+			ID   string        `json:"id"`
+			Docs []interface{} `json:"docs"`
+		}
+		var results []result
+		for _, d := range body.Docs {
+			r := result{ID: d.ID}
+			if doc, ok := docs[d.ID]; ok {
+				r.Docs = append(r.Docs, map[string]interface{}{"ok": json.RawMessage(doc)})
+			} else {
+				r.Docs = append(r.Docs, map[string]interface{}{
+					"error": map[string]string{"id": d.ID, "error": "not_found", "reason": "missing"},
+				})
+			}
+			results = append(results, r)
+		}
+		json.NewEncoder(resp).Encode(map[string]interface{}{"results": results})
+	}
+}
+
+func TestBulkGet(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("POST /db/_bulk_get", bulkGetHandler(t, map[string]string{
+		"a": `{"_id":"a","_rev":"1-a","field":1}`,
+	}))
+
+	results, err := c.DB("db").BulkGet([]string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "number of results", 2, len(results))
+	check(t, "results[0].Doc", json.RawMessage(`{"_id":"a","_rev":"1-a","field":1}`), results[0].Doc)
+	check(t, "results[0].Err", nil, results[0].Err)
+	check(t, "results[1].ID", "b", results[1].ID)
+	check(t, "couchdb.NotFound(results[1].Err)", true, couchdb.NotFound(results[1].Err))
+	if derr, ok := results[1].Err.(*couchdb.DocError); !ok || derr.ID != "b" {
+		t.Errorf("expected *couchdb.DocError for b, got %#v", results[1].Err)
+	}
+}
+
+func idChan(ids ...string) <-chan string {
+	c := make(chan string, len(ids))
+	for _, id := range ids {
+		c <- id
+	}
+	close(c)
+	return c
+}
+
+func TestForEachDoc(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("POST /db/_bulk_get", bulkGetHandler(t, map[string]string{
+		"a": `{"_id":"a","field":1}`,
+		"b": `{"_id":"b","field":2}`,
+		"c": `{"_id":"c","field":3}`,
+	}))
+
+	var (
+		mu   sync.Mutex
+		seen []string
+	)
+	opts := couchdb.PoolOptions{Workers: 2, BatchSize: 2}
+	err := c.DB("db").ForEachDoc(idChan("a", "b", "c", "d"), opts, func(id string, doc json.RawMessage) error {
+		mu.Lock()
+		seen = append(seen, id)
+		mu.Unlock()
+		return nil
+	})
+	sort.Strings(seen)
+	check(t, "seen IDs", []string{"a", "b", "c"}, seen)
+
+	errs, ok := err.(couchdb.DocErrors)
+	if !ok {
+		t.Fatalf("expected couchdb.DocErrors, got %#v", err)
+	}
+	check(t, "number of errors", 1, len(errs))
+	check(t, "couchdb.NotFound(errs[d])", true, couchdb.NotFound(errs["d"]))
+}
+
+func TestUpdateDocs(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("POST /db/_bulk_get", bulkGetHandler(t, map[string]string{
+		"a": `{"_id":"a","_rev":"1-a","field":1}`,
+		"b": `{"_id":"b","_rev":"1-b","field":2}`,
+	}))
+	c.Handle("POST /db/_bulk_docs", func(resp ResponseWriter, req *Request) {
+		docs := bulkRequest(t, req)
+		check(t, "updated docs", []map[string]interface{}{
+			{"_id": "a", "_rev": "1-a", "field": float64(2)},
+		}, docs)
+		io.WriteString(resp, `[{"id": "a", "error": "conflict", "reason": "Document update conflict."}]`)
+	})
+
+	opts := couchdb.PoolOptions{Workers: 1}
+	err := c.DB("db").UpdateDocs(idChan("a", "b"), opts, func(id string, doc json.RawMessage) (interface{}, error) {
+		if id == "b" {
+			return nil, nil // unchanged
+		}
+		var d testDocument
+		json.Unmarshal(doc, &d)
+		d.Field++
+		return &d, nil
+	})
+
+	errs, ok := err.(couchdb.DocErrors)
+	if !ok {
+		t.Fatalf("expected couchdb.DocErrors, got %#v", err)
+	}
+	check(t, "number of errors", 1, len(errs))
+	check(t, "couchdb.Conflict(errs[a])", true, couchdb.Conflict(errs["a"]))
+	if _, ok := errs["a"].(*couchdb.DocError); !ok {
+		t.Errorf("expected *couchdb.DocError, got %#v", errs["a"])
+	}
+}
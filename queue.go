@@ -0,0 +1,291 @@
+package couchdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Task states.
+const (
+	TaskPending = "pending" // waiting to be run, possibly after a delay
+	TaskRunning = "running" // claimed by a worker
+	TaskDone    = "done"    // completed successfully
+	TaskDead    = "dead"    // failed MaxAttempts times
+)
+
+// QueueOptions configures a Queue.
+type QueueOptions struct {
+	// Worker identifies the worker in the claimed_by field of tasks.
+	Worker string
+
+	// MaxAttempts is the number of times a task is run before it is
+	// marked dead. The default is 5.
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry of a failed task.
+	// It doubles with every attempt, up to MaxBackoff. The defaults
+	// are one second and ten minutes.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Lease is the time a claimed task may run. If the worker doesn't
+	// finish the task within this time, e.g. because it crashed, other
+	// workers may claim the task again. The default is five minutes.
+	Lease time.Duration
+
+	// RetryDelay is the time to wait before reconnecting after
+	// the changes feed has failed. See FollowerOptions.
+	RetryDelay time.Duration
+}
+
+// Queue is a task queue stored in a database. Each task is a document:
+//
+//     {
+//       "type": "task",
+//       "state": "pending",      // see TaskPending etc.
+//       "payload": {...},        // arbitrary JSON value
+//       "attempts": 0,           // number of started attempts
+//       "not_before": 1600000000000,  // optional, Unix milliseconds
+//       "claimed_by": "worker-1",
+//       "lease_expires": 1600000000000,
+//       "error": "..."           // error of the last failed attempt
+//     }
+//
+// Workers follow the changes feed of the database and claim pending tasks
+// by writing them with state "running" using the revision they have seen.
+// If two workers try to claim the same task, only one write succeeds.
+// Since the format is plain JSON, workers written in other languages can
+// share the queue by following the same protocol.
+//
+// Tasks are run at least once: a task whose worker fails to record its
+// completion before the lease expires is run again.
+type Queue struct {
+	db   *DB
+	opts QueueOptions
+}
+
+// Task is a claimed task.
+type Task struct {
+	ID       string
+	Payload  json.RawMessage
+	Attempts int    // number of attempts, including the current one
+	Error    string // error of the previous attempt
+}
+
+// Decode decodes the payload of the task into v.
+func (t *Task) Decode(v interface{}) error {
+	return json.Unmarshal(t.Payload, v)
+}
+
+// TaskHandler runs a task. If it returns an error,
+// the task is retried later or marked dead.
+type TaskHandler func(ctx context.Context, task *Task) error
+
+type taskDoc struct {
+	ID           string          `json:"_id,omitempty"`
+	Rev          string          `json:"_rev,omitempty"`
+	Type         string          `json:"type"`
+	State        string          `json:"state"`
+	Payload      json.RawMessage `json:"payload"`
+	Attempts     int             `json:"attempts"`
+	NotBefore    UnixMillis      `json:"not_before"`
+	ClaimedBy    string          `json:"claimed_by,omitempty"`
+	LeaseExpires UnixMillis      `json:"lease_expires"`
+	Error        string          `json:"error,omitempty"`
+}
+
+// NewQueue creates a queue stored in db.
+func (db *DB) NewQueue(opts QueueOptions) *Queue {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 10 * time.Minute
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = 5 * time.Minute
+	}
+	return &Queue{db: db, opts: opts}
+}
+
+// Enqueue adds tasks with the given payloads. The tasks are written in a
+// single _bulk_docs request. It returns the IDs of the new tasks. If some
+// tasks could not be stored, the error is a *BulkError and the IDs of those
+// tasks are empty.
+func (q *Queue) Enqueue(payloads ...interface{}) ([]string, error) {
+	docs := make([]interface{}, len(payloads))
+	for i, p := range payloads {
+		enc, err := json.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		docs[i] = &taskDoc{Type: "task", State: TaskPending, Payload: enc}
+	}
+	results, err := q.db.BulkDocs(docs)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(results))
+	var failed []BulkResult
+	for i, res := range results {
+		if res.Error != "" {
+			failed = append(failed, res)
+		} else {
+			ids[i] = res.ID
+		}
+	}
+	if failed != nil {
+		return ids, &BulkError{Failed: failed}
+	}
+	return ids, nil
+}
+
+// Requeue resets a task to the pending state, e.g. to retry a dead task.
+func (q *Queue) Requeue(id string) error {
+	_, err := q.db.Update(id, func(raw json.RawMessage) (interface{}, error) {
+		if raw == nil {
+			return nil, errors.New("couchdb: task " + id + " does not exist")
+		}
+		var doc taskDoc
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return nil, err
+		}
+		doc.State, doc.Attempts, doc.NotBefore = TaskPending, 0, UnixMillis{}
+		doc.ClaimedBy, doc.LeaseExpires = "", UnixMillis{}
+		return &doc, nil
+	})
+	return err
+}
+
+// Run claims and runs tasks until the context is canceled or writing a task
+// fails. Tasks are run one at a time; start several workers for parallelism.
+func (q *Queue) Run(ctx context.Context, handler TaskHandler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	changes := make(chan *Change)
+	f := q.db.NewFollower(ChanSink(changes), FollowerOptions{
+		RetryDelay: q.opts.RetryDelay,
+		Options:    Options{"include_docs": true},
+	})
+	ferr := make(chan error, 1)
+	go func() { ferr <- f.Run(ctx) }()
+
+	// scheduled contains tasks that can't be claimed yet.
+	scheduled := make(map[string]time.Time)
+	for {
+		var wakeup <-chan time.Time
+		if at, ok := earliest(scheduled); ok {
+			wakeup = time.After(time.Until(at))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-ferr:
+			return err
+		case c := <-changes:
+			delete(scheduled, c.ID)
+			if c.Deleted || c.Doc == nil {
+				continue
+			}
+			if err := q.process(ctx, c.Doc, handler, scheduled); err != nil {
+				return err
+			}
+		case <-wakeup:
+			for id, at := range scheduled {
+				if time.Now().Before(at) {
+					continue
+				}
+				delete(scheduled, id)
+				var raw json.RawMessage
+				if err := q.db.Get(id, &raw, nil); NotFound(err) {
+					continue
+				} else if err != nil {
+					return err
+				}
+				if err := q.process(ctx, raw, handler, scheduled); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func earliest(scheduled map[string]time.Time) (time.Time, bool) {
+	var min time.Time
+	for _, at := range scheduled {
+		if min.IsZero() || at.Before(min) {
+			min = at
+		}
+	}
+	return min, !min.IsZero()
+}
+
+// process claims and runs a task if it is due.
+func (q *Queue) process(ctx context.Context, raw json.RawMessage, handler TaskHandler, scheduled map[string]time.Time) error {
+	var doc taskDoc
+	if err := json.Unmarshal(raw, &doc); err != nil || doc.Type != "task" {
+		return nil // not a task
+	}
+	now := time.Now()
+	switch {
+	case doc.State == TaskPending && now.Before(doc.NotBefore.Time):
+		scheduled[doc.ID] = doc.NotBefore.Time
+		return nil
+	case doc.State == TaskRunning && now.Before(doc.LeaseExpires.Time):
+		scheduled[doc.ID] = doc.LeaseExpires.Time
+		return nil
+	case doc.State != TaskPending && doc.State != TaskRunning:
+		return nil
+	}
+
+	// Claim the task.
+	prevErr := doc.Error
+	doc.State, doc.ClaimedBy = TaskRunning, q.opts.Worker
+	doc.LeaseExpires = UnixMillis{now.Add(q.opts.Lease)}
+	doc.Attempts++
+	rev, err := q.db.Put(doc.ID, &doc, doc.Rev)
+	if Conflict(err) {
+		return nil // claimed by another worker
+	} else if err != nil {
+		return err
+	}
+	doc.Rev = rev
+
+	herr := handler(ctx, &Task{ID: doc.ID, Payload: doc.Payload, Attempts: doc.Attempts, Error: prevErr})
+	if ctx.Err() != nil {
+		// The task will be claimed again when the lease expires.
+		return ctx.Err()
+	}
+	doc.LeaseExpires = UnixMillis{}
+	switch {
+	case herr == nil:
+		doc.State, doc.Error = TaskDone, ""
+	case doc.Attempts >= q.opts.MaxAttempts:
+		doc.State, doc.Error = TaskDead, herr.Error()
+	default:
+		doc.State, doc.Error = TaskPending, herr.Error()
+		doc.NotBefore = UnixMillis{time.Now().Add(q.backoff(doc.Attempts))}
+	}
+	if _, err := q.db.Put(doc.ID, &doc, doc.Rev); err != nil && !Conflict(err) {
+		return err
+	}
+	return nil
+}
+
+// backoff returns the retry delay after the given number of attempts.
+func (q *Queue) backoff(attempts int) time.Duration {
+	d := q.opts.Backoff
+	for i := 1; i < attempts && d < q.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > q.opts.MaxBackoff {
+		d = q.opts.MaxBackoff
+	}
+	return d
+}
@@ -0,0 +1,182 @@
+package couchdb_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	. "net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fjl/go-couchdb"
+)
+
+// fakeQueueDB stores task documents and serves them through
+// a continuous changes feed.
+type fakeQueueDB struct {
+	t    *testing.T
+	mu   sync.Mutex
+	seq  int
+	docs map[string]*fakeQueueDoc
+}
+
+type fakeQueueDoc struct {
+	gen, seq int
+	fields   map[string]interface{}
+}
+
+func (d *fakeQueueDoc) rev() string {
+	return strconv.Itoa(d.gen) + "-x"
+}
+
+func (db *fakeQueueDB) state(id string) (string, int) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	doc := db.docs[id].fields
+	return doc["state"].(string), int(doc["attempts"].(float64))
+}
+
+func (db *fakeQueueDB) put(id, rev string, fields map[string]interface{}) (string, bool) {
+	doc := db.docs[id]
+	if doc == nil {
+		doc = &fakeQueueDoc{}
+		db.docs[id] = doc
+	}
+	if (doc.gen == 0 && rev != "") || (doc.gen > 0 && rev != doc.rev()) {
+		return "", false
+	}
+	db.seq++
+	doc.gen, doc.seq, doc.fields = doc.gen+1, db.seq, fields
+	fields["_id"], fields["_rev"] = id, doc.rev()
+	return doc.rev(), true
+}
+
+func (db *fakeQueueDB) register(c *testClient, ids ...string) {
+	c.Handle("POST /q/_bulk_docs", func(resp ResponseWriter, req *Request) {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		var results []map[string]string
+		for i, doc := range bulkRequest(db.t, req) {
+			rev, _ := db.put(ids[i], "", doc)
+			results = append(results, map[string]string{"id": ids[i], "rev": rev})
+		}
+		json.NewEncoder(resp).Encode(results)
+	})
+	c.Handle("GET /q/_changes", func(resp ResponseWriter, req *Request) {
+		since, _ := strconv.Atoi(req.URL.Query().Get("since"))
+		db.mu.Lock()
+		var rows []string
+		for id, doc := range db.docs {
+			if doc.seq > since {
+				enc, _ := json.Marshal(doc.fields)
+				rows = append(rows, fmt.Sprintf(`{"seq": %d, "id": %q, "changes": [{"rev": %q}], "doc": %s}`, doc.seq, id, doc.rev(), enc))
+			}
+		}
+		last := db.seq
+		db.mu.Unlock()
+		if len(rows) == 0 {
+			time.Sleep(2 * time.Millisecond)
+		}
+		for _, row := range rows {
+			io.WriteString(resp, row+"\n")
+		}
+		fmt.Fprintf(resp, `{"last_seq": %d}`+"\n", last)
+	})
+	for _, id := range ids {
+		id := id
+		c.Handle("GET /q/"+id, func(resp ResponseWriter, req *Request) {
+			db.mu.Lock()
+			defer db.mu.Unlock()
+			json.NewEncoder(resp).Encode(db.docs[id].fields)
+		})
+		c.Handle("PUT /q/"+id, func(resp ResponseWriter, req *Request) {
+			var fields map[string]interface{}
+			json.NewDecoder(req.Body).Decode(&fields)
+			db.mu.Lock()
+			defer db.mu.Unlock()
+			rev, ok := db.put(id, req.URL.Query().Get("rev"), fields)
+			if !ok {
+				resp.WriteHeader(StatusConflict)
+				io.WriteString(resp, `{"error": "conflict", "reason": "Document update conflict."}`)
+				return
+			}
+			resp.Header().Set("ETag", `"`+rev+`"`)
+			resp.WriteHeader(StatusCreated)
+			io.WriteString(resp, `{"ok": true, "id": "`+id+`", "rev": "`+rev+`"}`)
+		})
+	}
+}
+
+func TestQueue(t *testing.T) {
+	c := newTestClient(t)
+	fake := &fakeQueueDB{t: t, docs: make(map[string]*fakeQueueDoc)}
+	fake.register(c, "t1", "t2")
+
+	q := c.DB("q").NewQueue(couchdb.QueueOptions{
+		Worker:      "w1",
+		MaxAttempts: 3,
+		Backoff:     5 * time.Millisecond,
+		RetryDelay:  time.Millisecond,
+	})
+	ids, err := q.Enqueue(map[string]string{"job": "ok"}, map[string]string{"job": "fail"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "ids", []string{"t1", "t2"}, ids)
+
+	var mu sync.Mutex
+	var runs []string
+	handler := func(ctx context.Context, task *couchdb.Task) error {
+		var payload struct{ Job string }
+		if err := task.Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		runs = append(runs, fmt.Sprintf("%s/%d", payload.Job, task.Attempts))
+		mu.Unlock()
+		if payload.Job == "fail" {
+			return errors.New("boom")
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- q.Run(ctx, handler) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s1, _ := fake.state("t1")
+		s2, _ := fake.state("t2")
+		if s1 == couchdb.TaskDone && s2 == couchdb.TaskDead {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("tasks not finished: t1 %s, t2 %s", s1, s2)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	check(t, "Run error", context.Canceled, <-done)
+
+	_, attempts := fake.state("t2")
+	check(t, "attempts", 3, attempts)
+	fake.mu.Lock()
+	check(t, "error", "boom", fake.docs["t2"].fields["error"])
+	check(t, "claimed_by", "w1", fake.docs["t2"].fields["claimed_by"])
+	fake.mu.Unlock()
+	mu.Lock()
+	check(t, "runs", 4, len(runs))
+	mu.Unlock()
+
+	// Dead tasks can be requeued.
+	if err := q.Requeue("t2"); err != nil {
+		t.Fatal(err)
+	}
+	state, attempts := fake.state("t2")
+	check(t, "requeued state", couchdb.TaskPending, state)
+	check(t, "requeued attempts", 0, attempts)
+}
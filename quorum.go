@@ -0,0 +1,80 @@
+package couchdb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Quorum contains the number of replicas that must respond to document
+// reads (R) and acknowledge writes (W) in a CouchDB cluster. Zero values
+// leave the choice to the server, which defaults to a majority of replicas.
+type Quorum struct {
+	R int
+	W int
+}
+
+// WithQuorum returns a copy of the database object that sends the quorum
+// parameters with document requests. R applies to Get and GetMeta, unless
+// the "r" option is given. W applies to Put, Delete and other requests that
+// modify a single document.
+func (db *DB) WithQuorum(q Quorum) *DB {
+	cpy := *db
+	cpy.quorum = q
+	return &cpy
+}
+
+// readOptions returns the options of a document read.
+func (db *DB) readOptions(opts Options) Options {
+	opts = db.options(opts)
+	if _, ok := opts["r"]; db.quorum.R > 0 && !ok {
+		opts = opts.clone()
+		opts["r"] = db.quorum.R
+	}
+	return opts
+}
+
+// verifyAttempts is the number of reads performed by PutVerified.
+const verifyAttempts = 5
+
+// PutVerified stores a document like Put and then reads it back until
+// the read returns the new revision or a later one. Reads use the read
+// quorum set by WithQuorum. This guards against stale reads right after
+// a write, which can happen in clusters because writes are acknowledged
+// before all replicas have been updated.
+//
+// If the new revision can't be read after several attempts, the write
+// has still been applied and newrev is returned along with the error.
+func (db *DB) PutVerified(id string, doc interface{}, rev string) (newrev string, err error) {
+	if newrev, err = db.Put(id, doc, rev); err != nil {
+		return "", err
+	}
+	delay := 20 * time.Millisecond
+	var seen string
+	for attempt := 0; attempt < verifyAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		var current struct {
+			Rev string `json:"_rev"`
+		}
+		err := db.Get(id, &current, nil)
+		if err != nil && !NotFound(err) {
+			return newrev, err
+		}
+		seen = current.Rev
+		if seen == newrev || revGeneration(seen) > revGeneration(newrev) {
+			return newrev, nil
+		}
+	}
+	return newrev, fmt.Errorf("couchdb: read of %q returned revision %q after writing %q", id, seen, newrev)
+}
+
+// revGeneration returns the number before the dash of a revision,
+// or zero if it is malformed.
+func revGeneration(rev string) int {
+	n, _ := strconv.Atoi(strings.SplitN(rev, "-", 2)[0])
+	return n
+}
@@ -0,0 +1,68 @@
+package couchdb_test
+
+import (
+	"fmt"
+	"io"
+	. "net/http"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestQuorum(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/doc", func(resp ResponseWriter, req *Request) {
+		check(t, "GET query", "r=3", req.URL.RawQuery)
+		io.WriteString(resp, `{"_id": "doc", "_rev": "1-a", "field": 1}`)
+	})
+	c.Handle("PUT /db/doc", func(resp ResponseWriter, req *Request) {
+		check(t, "PUT query", "rev=1-a&w=3", req.URL.RawQuery)
+		resp.Header().Set("ETag", `"2-b"`)
+		resp.WriteHeader(StatusCreated)
+		io.WriteString(resp, `{"ok": true, "rev": "2-b"}`)
+	})
+	c.Handle("DELETE /db/doc", func(resp ResponseWriter, req *Request) {
+		check(t, "DELETE query", "rev=2-b&w=3", req.URL.RawQuery)
+		resp.Header().Set("ETag", `"3-c"`)
+		io.WriteString(resp, `{"ok": true, "rev": "3-c"}`)
+	})
+
+	db := c.DB("db").WithQuorum(couchdb.Quorum{R: 3, W: 3})
+	var doc testDocument
+	if err := db.Get("doc", &doc, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Put("doc", &doc, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Delete("doc", "2-b"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPutVerified(t *testing.T) {
+	c := newTestClient(t)
+	reads := 0
+	c.Handle("PUT /db/doc", func(resp ResponseWriter, req *Request) {
+		resp.Header().Set("ETag", `"2-b"`)
+		resp.WriteHeader(StatusCreated)
+		io.WriteString(resp, `{"ok": true, "rev": "2-b"}`)
+	})
+	c.Handle("GET /db/doc", func(resp ResponseWriter, req *Request) {
+		check(t, "GET query", "r=2", req.URL.RawQuery)
+		reads++
+		rev := "1-a"
+		if reads == 3 {
+			rev = "2-b"
+		}
+		fmt.Fprintf(resp, `{"_id": "doc", "_rev": %q}`, rev)
+	})
+
+	db := c.DB("db").WithQuorum(couchdb.Quorum{R: 2})
+	newrev, err := db.PutVerified("doc", &testDocument{Rev: "1-a"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "newrev", "2-b", newrev)
+	check(t, "reads", 3, reads)
+}
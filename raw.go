@@ -0,0 +1,133 @@
+package couchdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// RawBody is a request body that is sent as-is instead of being encoded
+// with json.Marshal, e.g. a document that was read from a backup file.
+type RawBody struct {
+	Body io.Reader
+
+	// Length is the size of Body in bytes. If it is zero, the size is
+	// unknown and the body is sent with chunked transfer encoding.
+	Length int64
+
+	// Type is the content type of the body. The default is "application/json".
+	Type string
+}
+
+var errNilRawBody = errors.New("couchdb: RawBody has nil Body")
+
+// setBody sets the length and content type of a request for b.
+// Requests with raw bodies can't be retried after refreshing
+// credentials because the body can only be read once.
+func (b RawBody) setBody(req *http.Request) {
+	if b.Length > 0 {
+		req.ContentLength = b.Length
+	}
+	if b.Type != "" {
+		req.Header.Set("content-type", b.Type)
+	}
+}
+
+// PutRaw stores an encoded document into the given database. It is like Put,
+// but the body is streamed to the server without decoding it. If rev is
+// empty, the revision is taken from the _rev field of the document by
+// the server.
+//
+// If write hooks are registered, the body is read into memory and
+// decoded so hooks can inspect the document.
+func (db *DB) PutRaw(id string, body RawBody, rev string) (newrev string, err error) {
+	if body.Body == nil {
+		return "", errNilRawBody
+	}
+	if db.hooks != nil {
+		doc, err := ioutil.ReadAll(body.Body)
+		if err != nil {
+			return "", err
+		}
+		return db.Put(id, json.RawMessage(doc), rev)
+	}
+	if db.checkIDs {
+		if err := ValidateDocID(id); err != nil {
+			return "", err
+		}
+	}
+	if opts := db.docSizeOptions(); opts.enabled() {
+		if body.Length <= 0 {
+			doc, err := ioutil.ReadAll(body.Body)
+			if err != nil {
+				return "", err
+			}
+			body.Body, body.Length = bytes.NewReader(doc), int64(len(doc))
+		}
+		if err := db.checkDocSize(opts, id, body.Length); err != nil {
+			return "", err
+		}
+	}
+	req, err := db.newRevRequest("PUT", db.path().docID(id), rev, body.Body)
+	if err != nil {
+		return "", err
+	}
+	body.setBody(req)
+	return writeRev(db.do(req))
+}
+
+// BulkDocsRaw is like BulkDocs, but sends an encoded request body of the
+// form {"docs": [...]} without decoding it.
+//
+// If write hooks are registered, the body is read into memory and
+// decoded so hooks can inspect the documents.
+func (db *DB) BulkDocsRaw(body RawBody) ([]BulkResult, error) {
+	if body.Body == nil {
+		return nil, errNilRawBody
+	}
+	if db.hooks != nil {
+		var req struct {
+			Docs []json.RawMessage `json:"docs"`
+		}
+		if err := json.NewDecoder(body.Body).Decode(&req); err != nil {
+			return nil, err
+		}
+		docs := make([]interface{}, len(req.Docs))
+		for i, doc := range req.Docs {
+			docs[i] = doc
+		}
+		return db.BulkDocs(docs)
+	}
+	if opts := db.docSizeOptions(); opts.enabled() {
+		enc, err := ioutil.ReadAll(body.Body)
+		if err != nil {
+			return nil, err
+		}
+		var req struct {
+			Docs []json.RawMessage `json:"docs"`
+		}
+		if err := json.Unmarshal(enc, &req); err != nil {
+			return nil, err
+		}
+		for _, doc := range req.Docs {
+			if err := db.checkDocSize(opts, docID(doc), int64(len(doc))); err != nil {
+				return nil, err
+			}
+		}
+		body.Body, body.Length = bytes.NewReader(enc), int64(len(enc))
+	}
+	req, err := db.newRequest("POST", db.path().addRaw("_bulk_docs").path(), body.Body)
+	if err != nil {
+		return nil, err
+	}
+	body.setBody(req)
+	resp, err := db.do(req)
+	if err != nil {
+		return nil, err
+	}
+	var results []BulkResult
+	return results, readBody(resp, &results)
+}
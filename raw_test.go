@@ -0,0 +1,78 @@
+package couchdb_test
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	. "net/http"
+	"strings"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+// onlyReader hides the type of a reader from net/http,
+// which would otherwise determine the body length itself.
+type onlyReader struct{ io.Reader }
+
+func TestPutRaw(t *testing.T) {
+	doc := `{"_id": "a", "field": 1}`
+	c := newTestClient(t)
+	c.Handle("PUT /db/a", func(resp ResponseWriter, req *Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		check(t, "body", doc, string(body))
+		check(t, "content length", int64(len(doc)), req.ContentLength)
+		check(t, "content type", "application/json", req.Header.Get("content-type"))
+		check(t, "rev", "1-a", req.URL.Query().Get("rev"))
+		resp.Header().Set("ETag", `"2-a"`)
+		resp.WriteHeader(StatusCreated)
+		io.WriteString(resp, `{"ok": true, "id": "a", "rev": "2-a"}`)
+	})
+
+	body := couchdb.RawBody{Body: onlyReader{strings.NewReader(doc)}, Length: int64(len(doc))}
+	rev, err := c.DB("db").PutRaw("a", body, "1-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "rev", "2-a", rev)
+}
+
+func TestPutRawHooks(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("PUT /db/a", func(resp ResponseWriter, req *Request) {
+		var doc map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&doc)
+		check(t, "doc", map[string]interface{}{"field": float64(1), "type": "item"}, doc)
+		resp.Header().Set("ETag", `"1-a"`)
+		resp.WriteHeader(StatusCreated)
+		io.WriteString(resp, `{"ok": true, "id": "a", "rev": "1-a"}`)
+	})
+
+	db := c.DB("db").WithBeforeWrite(func(ev *couchdb.WriteEvent) error {
+		return ev.Set("type", "item")
+	})
+	body := couchdb.RawBody{Body: strings.NewReader(`{"field": 1}`)}
+	if _, err := db.PutRaw("a", body, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBulkDocsRaw(t *testing.T) {
+	docs := `{"docs": [{"_id": "a"}, {"_id": "b"}]}`
+	c := newTestClient(t)
+	c.Handle("POST /db/_bulk_docs", func(resp ResponseWriter, req *Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		check(t, "body", docs, string(body))
+		check(t, "content type", "application/json; charset=utf-8", req.Header.Get("content-type"))
+		io.WriteString(resp, `[{"id": "a", "rev": "1-a"}, {"id": "b", "error": "conflict", "reason": "Document update conflict."}]`)
+	})
+
+	body := couchdb.RawBody{Body: onlyReader{strings.NewReader(docs)}, Type: "application/json; charset=utf-8"}
+	results, err := c.DB("db").BulkDocsRaw(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "result count", 2, len(results))
+	check(t, "rev", "1-a", results[0].Rev)
+	check(t, "conflict", true, couchdb.Conflict(results[1].Err()))
+}
@@ -0,0 +1,165 @@
+package couchdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Row is a row of a view result.
+type Row struct {
+	ID    string          `json:"id"`
+	Key   json.RawMessage `json:"key"`
+	Value json.RawMessage `json:"value"`
+
+	// The document. This is populated only if the query option
+	// "include_docs" is true.
+	Doc json.RawMessage `json:"doc"`
+
+	// Error is set for rows of key lookups that didn't match
+	// a document, e.g. "not_found".
+	Error string `json:"error"`
+}
+
+// Rows is an iterator over the rows of a view result. Unlike View
+// and AllDocs, which decode the whole response at once, Rows decodes
+// one row at a time while reading the response. This is useful for large
+// results that should not be held in memory.
+//
+// On each call to the Next method, the embedded Row is updated for the current
+// row. Next is designed to be used in a for loop:
+//
+//     rows, err := db.AllDocsRows(nil)
+//     ...
+//     for rows.Next() {
+//         fmt.Println(rows.ID)
+//     }
+//     err = rows.Err()
+//     ...
+type Rows struct {
+	Row
+
+	// TotalRows and Offset are set from the corresponding
+	// keys of the response if the server sends them.
+	TotalRows int64
+	Offset    int64
+
+	end  bool
+	err  error
+	conn io.Closer
+	dec  *json.Decoder
+}
+
+// AllDocsRows invokes the _all_docs view of a database and returns
+// an iterator over the result rows. The options are the same as for AllDocs.
+func (db *DB) AllDocsRows(opts Options) (*Rows, error) {
+	return db.rows(db.path().addRaw("_all_docs"), db.options(opts))
+}
+
+// ViewRows invokes a view and returns an iterator over the result rows.
+// The arguments are the same as for View.
+func (db *DB) ViewRows(ddoc, view string, opts Options) (*Rows, error) {
+	if !strings.HasPrefix(ddoc, "_design/") {
+		return nil, errors.New("couchdb.ViewRows: design doc name must start with _design/")
+	}
+	return db.rows(db.path().docID(ddoc).addRaw("_view").add(view), db.options(opts))
+}
+
+func (db *DB) rows(p *pathBuilder, opts Options) (*Rows, error) {
+	resp, err := db.viewRequest(p, opts)
+	if err != nil {
+		return nil, err
+	}
+	rows := &Rows{conn: resp.Body, dec: db.newDecoder(resp.Body)}
+	if err := rows.readHeader(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	return rows, nil
+}
+
+// readHeader decodes the object keys before the "rows" array.
+func (r *Rows) readHeader() error {
+	if err := expectTokens(r.dec, json.Delim('{')); err != nil {
+		return err
+	}
+	for r.dec.More() {
+		key, err := r.dec.Token()
+		if err != nil {
+			return err
+		}
+		if key == "rows" {
+			return expectTokens(r.dec, json.Delim('['))
+		}
+		if err := r.decodeKey(key); err != nil {
+			return err
+		}
+	}
+	return errors.New(`couchdb: view result has no "rows" key`)
+}
+
+func (r *Rows) decodeKey(key json.Token) error {
+	switch key {
+	case "total_rows":
+		if err := r.dec.Decode(&r.TotalRows); err != nil {
+			return fmt.Errorf(`can't decode "total_rows" key: %v`, err)
+		}
+	case "offset":
+		if err := r.dec.Decode(&r.Offset); err != nil {
+			return fmt.Errorf(`can't decode "offset" key: %v`, err)
+		}
+	default:
+		if err := skipValue(r.dec); err != nil {
+			return fmt.Errorf(`can't skip over %q key: %v`, key, err)
+		}
+	}
+	return nil
+}
+
+// Next decodes the next row. It returns false when the end of the
+// result has been reached or an error has occurred.
+func (r *Rows) Next() bool {
+	if r.end {
+		return false
+	}
+	r.Row = Row{}
+	if r.err = r.next(); r.err != nil || r.end {
+		r.Close()
+	}
+	return !r.end
+}
+
+func (r *Rows) next() error {
+	if r.dec.More() {
+		return r.dec.Decode(&r.Row)
+	}
+	// End of rows reached, decode trailing object keys.
+	r.end = true
+	if err := expectTokens(r.dec, json.Delim(']')); err != nil {
+		return err
+	}
+	for r.dec.More() {
+		key, err := r.dec.Token()
+		if err != nil {
+			return err
+		}
+		if err := r.decodeKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Err returns the last error that occurred during iteration.
+func (r *Rows) Err() error {
+	return r.err
+}
+
+// Close terminates the connection of the iterator.
+// If Next returns false, the iterator has already been closed.
+func (r *Rows) Close() error {
+	r.end = true
+	return r.conn.Close()
+}
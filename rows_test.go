@@ -0,0 +1,113 @@
+package couchdb_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	. "net/http"
+	"net/url"
+	"sort"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestAllDocsRows(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/_all_docs", func(resp ResponseWriter, req *Request) {
+		check(t, "request query values", url.Values{"include_docs": {"true"}}, req.URL.Query())
+		io.WriteString(resp, `{
+			"total_rows": 2, "offset": 0, "update_seq": {"x": [1]},
+			"rows": [
+				{"id": "a", "key": "a", "value": {"rev": "1-a"}, "doc": {"_id": "a"}},
+				{"key": "b", "error": "not_found"}
+			],
+			"foobar": 1
+		}`)
+	})
+
+	rows, err := c.DB("db").AllDocsRows(couchdb.Options{"include_docs": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "rows.TotalRows", int64(2), rows.TotalRows)
+
+	t.Log("-- first row")
+	check(t, "rows.Next()", true, rows.Next())
+	check(t, "rows.ID", "a", rows.ID)
+	check(t, "rows.Key", json.RawMessage(`"a"`), rows.Key)
+	check(t, "rows.Value", json.RawMessage(`{"rev": "1-a"}`), rows.Value)
+	check(t, "rows.Doc", json.RawMessage(`{"_id": "a"}`), rows.Doc)
+
+	t.Log("-- second row")
+	check(t, "rows.Next()", true, rows.Next())
+	check(t, "rows.ID", "", rows.ID)
+	check(t, "rows.Error", "not_found", rows.Error)
+
+	t.Log("-- end of rows")
+	check(t, "rows.Next()", false, rows.Next())
+	check(t, "rows.Err()", error(nil), rows.Err())
+	check(t, "rows.Row", couchdb.Row{}, rows.Row)
+}
+
+func TestViewRows(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/_design/test/_view/v", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"rows": [{"id": "a", "key": 1, "value": null}], "total_rows": 5, "offset": 4}`)
+	})
+
+	rows, err := c.DB("db").ViewRows("_design/test", "v", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "rows.Next()", true, rows.Next())
+	check(t, "rows.Key", json.RawMessage(`1`), rows.Key)
+	check(t, "rows.Next()", false, rows.Next())
+	check(t, "rows.Err()", error(nil), rows.Err())
+	check(t, "rows.TotalRows", int64(5), rows.TotalRows)
+	check(t, "rows.Offset", int64(4), rows.Offset)
+
+	if _, err := c.DB("db").ViewRows("test", "v", nil); err == nil {
+		t.Error("expected error for ddoc without _design/ prefix")
+	}
+}
+
+func TestExportAllDocs(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/_all_docs", func(resp ResponseWriter, req *Request) {
+		q := req.URL.Query()
+		var id string
+		switch {
+		case q.Get("startkey") == "" && q.Get("endkey") == `"m"`:
+			id = "b"
+		case q.Get("startkey") == `"m"` && q.Get("endkey") == "":
+			id = "x"
+		default:
+			t.Errorf("unexpected range query %v", q)
+		}
+		if q.Get("endkey") != "" {
+			check(t, "inclusive_end", "false", q.Get("inclusive_end"))
+		}
+		json.NewEncoder(resp).Encode(map[string]interface{}{
+			"rows": []map[string]string{{"id": id, "key": id}},
+		})
+	})
+
+	var ids []string
+	opts := couchdb.ExportOptions{Splits: []string{"m"}, Workers: 2}
+	err := c.DB("db").ExportAllDocs(opts, func(row *couchdb.Row) error {
+		ids = append(ids, row.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(ids)
+	check(t, "exported IDs", []string{"b", "x"}, ids)
+
+	sinkErr := errors.New("sink error")
+	err = c.DB("db").ExportAllDocs(opts, func(row *couchdb.Row) error {
+		return sinkErr
+	})
+	check(t, "error", sinkErr, err)
+}
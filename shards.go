@@ -0,0 +1,86 @@
+package couchdb
+
+import "sort"
+
+// ShardMap describes the placement of the shards of a clustered database.
+type ShardMap struct {
+	// Shards maps shard ranges, e.g. "00000000-7fffffff",
+	// to the names of the nodes holding a copy of the shard.
+	Shards map[string][]string `json:"shards"`
+}
+
+// Ranges returns the shard ranges in ascending order.
+func (m *ShardMap) Ranges() []string {
+	ranges := make([]string, 0, len(m.Shards))
+	for r := range m.Shards {
+		ranges = append(ranges, r)
+	}
+	sort.Strings(ranges)
+	return ranges
+}
+
+// Nodes returns the names of all nodes holding shards of the database.
+func (m *ShardMap) Nodes() []string {
+	var nodes []string
+	for _, list := range m.Shards {
+		for _, n := range list {
+			if !containsString(nodes, n) {
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// NodeRanges returns the shard ranges held by the given node.
+func (m *ShardMap) NodeRanges(node string) []string {
+	var ranges []string
+	for _, r := range m.Ranges() {
+		if containsString(m.Shards[r], node) {
+			ranges = append(ranges, r)
+		}
+	}
+	return ranges
+}
+
+// DocShard describes the shard that holds a document.
+type DocShard struct {
+	Range string   `json:"range"`
+	Nodes []string `json:"nodes"`
+}
+
+// Shards retrieves the shard map of the database.
+// This requires CouchDB 2.0 or later.
+//
+// http://docs.couchdb.org/en/latest/api/database/shard.html
+func (db *DB) Shards() (*ShardMap, error) {
+	path := db.path().addRaw("_shards").path()
+	resp, err := db.request("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	m := new(ShardMap)
+	return m, readBody(resp, m)
+}
+
+// DocShard retrieves the shard that holds the document with the given ID.
+// The document does not need to exist.
+func (db *DB) DocShard(id string) (*DocShard, error) {
+	path := db.path().addRaw("_shards").docID(id).path()
+	resp, err := db.request("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	s := new(DocShard)
+	return s, readBody(resp, s)
+}
+
+// SyncShards forces the synchronization of all copies of the shards of the
+// database, e.g. after a node was down for maintenance. Synchronization
+// happens in the background.
+//
+// http://docs.couchdb.org/en/latest/api/database/shard.html#db-sync-shards
+func (db *DB) SyncShards() error {
+	return db.postCompact(db.path().addRaw("_sync_shards").path())
+}
@@ -0,0 +1,52 @@
+package couchdb_test
+
+import (
+	"io"
+	. "net/http"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestShards(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/_shards", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"shards": {
+			"80000000-ffffffff": ["couchdb@n2", "couchdb@n3"],
+			"00000000-7fffffff": ["couchdb@n1", "couchdb@n2"]
+		}}`)
+	})
+	c.Handle("GET /db/_shards/doc", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"range": "00000000-7fffffff", "nodes": ["couchdb@n1", "couchdb@n2"]}`)
+	})
+
+	db := c.DB("db")
+	m, err := db.Shards()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "ranges", []string{"00000000-7fffffff", "80000000-ffffffff"}, m.Ranges())
+	check(t, "nodes", []string{"couchdb@n1", "couchdb@n2", "couchdb@n3"}, m.Nodes())
+	check(t, "node ranges", []string{"80000000-ffffffff"}, m.NodeRanges("couchdb@n3"))
+
+	s, err := db.DocShard("doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "doc shard", &couchdb.DocShard{
+		Range: "00000000-7fffffff",
+		Nodes: []string{"couchdb@n1", "couchdb@n2"},
+	}, s)
+}
+
+func TestSyncShards(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("POST /db/_sync_shards", func(resp ResponseWriter, req *Request) {
+		check(t, "content type", "application/json", req.Header.Get("Content-Type"))
+		resp.WriteHeader(StatusAccepted)
+		io.WriteString(resp, `{"ok": true}`)
+	})
+	if err := c.DB("db").SyncShards(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,234 @@
+package couchdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Stat is a single metric of the node statistics.
+type Stat struct {
+	Type  string // "counter", "gauge" or "histogram"
+	Desc  string
+	Value float64 // value of counters and gauges
+
+	// Histogram is set for metrics of type "histogram".
+	Histogram *Histogram
+}
+
+// Histogram contains the summary of a histogram metric.
+// Latencies are reported in milliseconds.
+type Histogram struct {
+	N           int64
+	Min, Max    float64
+	Mean        float64
+	Median      float64
+	Percentiles map[int]float64 // e.g. Percentiles[99]
+}
+
+// NodeStats retrieves the statistics of a cluster node. If node is empty,
+// the statistics of the node handling the request are returned. The result
+// is keyed by metric name, with the path components joined by ".", e.g.
+// "couchdb.httpd.requests".
+//
+// http://docs.couchdb.org/en/latest/api/server/common.html#node-node-name-stats
+func (c *Client) NodeStats(node string) (map[string]Stat, error) {
+	if node == "" {
+		node = "_local"
+	}
+	resp, err := c.request("GET", new(pathBuilder).addRaw("_node").add(node).addRaw("_stats").path(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]json.RawMessage
+	if err := readBody(resp, &raw); err != nil {
+		return nil, err
+	}
+	stats := make(map[string]Stat)
+	if err := flattenStats(stats, "", raw); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func flattenStats(stats map[string]Stat, prefix string, obj map[string]json.RawMessage) error {
+	for k, v := range obj {
+		var sub map[string]json.RawMessage
+		if err := json.Unmarshal(v, &sub); err != nil {
+			continue // not an object, e.g. a description at the wrong level
+		}
+		name := k
+		if prefix != "" {
+			name = prefix + "." + k
+		}
+		if _, ok := sub["type"]; !ok {
+			if err := flattenStats(stats, name, sub); err != nil {
+				return err
+			}
+			continue
+		}
+		stat, err := decodeStat(sub)
+		if err != nil {
+			return fmt.Errorf("couchdb: invalid stat %q: %v", name, err)
+		}
+		stats[name] = stat
+	}
+	return nil
+}
+
+func decodeStat(obj map[string]json.RawMessage) (Stat, error) {
+	var s Stat
+	json.Unmarshal(obj["type"], &s.Type)
+	json.Unmarshal(obj["desc"], &s.Desc)
+	if s.Type != "histogram" {
+		return s, json.Unmarshal(obj["value"], &s.Value)
+	}
+	var h struct {
+		N          int64        `json:"n"`
+		Min        float64      `json:"min"`
+		Max        float64      `json:"max"`
+		Mean       float64      `json:"arithmetic_mean"`
+		Median     float64      `json:"median"`
+		Percentile [][2]float64 `json:"percentile"`
+	}
+	if err := json.Unmarshal(obj["value"], &h); err != nil {
+		return s, err
+	}
+	s.Histogram = &Histogram{
+		N:           h.N,
+		Min:         h.Min,
+		Max:         h.Max,
+		Mean:        h.Mean,
+		Median:      h.Median,
+		Percentiles: make(map[int]float64, len(h.Percentile)),
+	}
+	for _, p := range h.Percentile {
+		s.Histogram.Percentiles[int(p[0])] = p[1]
+	}
+	return s, nil
+}
+
+// Metrics receives the values computed by a StatsSampler.
+// Implementations typically forward them to a monitoring system.
+type Metrics interface {
+	// Gauge records the current value of a metric.
+	Gauge(name string, value float64)
+}
+
+// StatsOptions configures a StatsSampler.
+type StatsOptions struct {
+	// Node is the node whose statistics are sampled.
+	// The default is the node handling the requests.
+	Node string
+
+	// Stats are the names of the metrics that are reported, e.g.
+	// "couchdb.httpd.requests". If nil, all metrics are reported.
+	Stats []string
+
+	// Interval is the time between samples taken by Run.
+	// The default is ten seconds.
+	Interval time.Duration
+
+	// OnError is called by Run when a sample cannot be taken.
+	OnError func(error)
+}
+
+// StatsSampler periodically fetches node statistics and reports them
+// to a Metrics implementation:
+//
+// For counters, the change since the previous sample is reported as
+// "<name>.delta" and the rate per second as "<name>.rate". The first
+// sample only establishes the baseline for counters.
+//
+// Gauges are reported under their name.
+//
+// For histograms, "<name>.mean", "<name>.median", "<name>.max" and
+// "<name>.p<N>" for all percentiles are reported.
+type StatsSampler struct {
+	c       *Client
+	metrics Metrics
+	opts    StatsOptions
+
+	mu       sync.Mutex
+	last     map[string]float64
+	lastTime time.Time
+}
+
+// NewStatsSampler creates a sampler. Call Sample to take a single sample
+// or Run to take samples periodically.
+func (c *Client) NewStatsSampler(m Metrics, opts StatsOptions) *StatsSampler {
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	return &StatsSampler{c: c, metrics: m, opts: opts}
+}
+
+// Sample fetches the statistics and reports them.
+func (s *StatsSampler) Sample() error {
+	stats, err := s.c.NodeStats(s.opts.Node)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := s.opts.Stats
+	if names == nil {
+		for name := range stats {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	counters := make(map[string]float64)
+	for _, name := range names {
+		stat, ok := stats[name]
+		if !ok {
+			continue
+		}
+		switch {
+		case stat.Type == "counter":
+			counters[name] = stat.Value
+			if prev, ok := s.last[name]; ok && stat.Value >= prev {
+				delta := stat.Value - prev
+				s.metrics.Gauge(name+".delta", delta)
+				if secs := now.Sub(s.lastTime).Seconds(); secs > 0 {
+					s.metrics.Gauge(name+".rate", delta/secs)
+				}
+			}
+		case stat.Histogram != nil:
+			h := stat.Histogram
+			s.metrics.Gauge(name+".mean", h.Mean)
+			s.metrics.Gauge(name+".median", h.Median)
+			s.metrics.Gauge(name+".max", h.Max)
+			for p, v := range h.Percentiles {
+				s.metrics.Gauge(name+".p"+strconv.Itoa(p), v)
+			}
+		default:
+			s.metrics.Gauge(name, stat.Value)
+		}
+	}
+	s.last = counters
+	s.lastTime = now
+	return nil
+}
+
+// Run takes samples until the context is canceled.
+func (s *StatsSampler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Sample(); err != nil && s.opts.OnError != nil {
+			s.opts.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package couchdb_test
+
+import (
+	"io"
+	. "net/http"
+	"strconv"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+type testMetrics map[string]float64
+
+func (m testMetrics) Gauge(name string, value float64) {
+	m[name] = value
+}
+
+func TestNodeStats(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /_node/_local/_stats", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{
+			"couchdb": {
+				"httpd": {
+					"requests": {"value": 100, "type": "counter", "desc": "number of HTTP requests"}
+				},
+				"open_databases": {"value": 5, "type": "gauge", "desc": "number of open databases"},
+				"request_time": {
+					"value": {
+						"n": 10, "min": 1, "max": 20, "arithmetic_mean": 5, "median": 4,
+						"percentile": [[50, 4], [99, 19]]
+					},
+					"type": "histogram",
+					"desc": "length of a request inside CouchDB without MochiWeb"
+				}
+			}
+		}`)
+	})
+
+	stats, err := c.NodeStats("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]couchdb.Stat{
+		"couchdb.httpd.requests": {Type: "counter", Desc: "number of HTTP requests", Value: 100},
+		"couchdb.open_databases": {Type: "gauge", Desc: "number of open databases", Value: 5},
+		"couchdb.request_time": {
+			Type: "histogram",
+			Desc: "length of a request inside CouchDB without MochiWeb",
+			Histogram: &couchdb.Histogram{
+				N: 10, Min: 1, Max: 20, Mean: 5, Median: 4,
+				Percentiles: map[int]float64{50: 4, 99: 19},
+			},
+		},
+	}
+	check(t, "stats", expected, stats)
+}
+
+func TestStatsSampler(t *testing.T) {
+	c := newTestClient(t)
+	requests := 100
+	c.Handle("GET /_node/n1/_stats", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"couchdb": {
+			"httpd": {"requests": {"value": `+strconv.Itoa(requests)+`, "type": "counter"}},
+			"open_databases": {"value": 5, "type": "gauge"}
+		}}`)
+		requests += 30
+	})
+
+	m := make(testMetrics)
+	s := c.NewStatsSampler(m, couchdb.StatsOptions{
+		Node:  "n1",
+		Stats: []string{"couchdb.httpd.requests", "couchdb.open_databases"},
+	})
+	if err := s.Sample(); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "metrics after first sample", testMetrics{"couchdb.open_databases": 5}, m)
+
+	if err := s.Sample(); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "requests.delta", 30.0, m["couchdb.httpd.requests.delta"])
+	if m["couchdb.httpd.requests.rate"] <= 0 {
+		t.Errorf("requests.rate not reported")
+	}
+}
@@ -0,0 +1,130 @@
+package couchdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// UnixMillis is a time value that is encoded in JSON as the number of
+// milliseconds since the Unix epoch. Many CouchDB datasets store timestamps
+// in this format instead of ISO 8601 strings.
+//
+// The zero value is encoded as JSON null. Decoding null yields the zero value.
+type UnixMillis struct {
+	time.Time
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t UnixMillis) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return strconv.AppendInt(nil, toMillis(t.Time), 10), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *UnixMillis) UnmarshalJSON(input []byte) error {
+	if bytes.Equal(input, []byte("null")) {
+		t.Time = time.Time{}
+		return nil
+	}
+	ms, err := decodeMillis(input)
+	if err != nil {
+		return fmt.Errorf("couchdb: invalid UnixMillis value %s: %v", input, err)
+	}
+	t.Time = fromMillis(ms)
+	return nil
+}
+
+// NullUnixMillis is like UnixMillis, but distinguishes JSON null from the
+// zero time. Valid is false if the value was null and true for any time value,
+// including the zero time. Like UnixMillis, the time is encoded as the number
+// of milliseconds since the Unix epoch.
+//
+// UnmarshalJSON is only invoked for fields that are present in the input, so
+// a field that was absent from the document can be told apart from one that was
+// null by setting Valid to true before decoding.
+type NullUnixMillis struct {
+	Time  time.Time
+	Valid bool // Valid is true if Time is not NULL
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t NullUnixMillis) MarshalJSON() ([]byte, error) {
+	if !t.Valid {
+		return []byte("null"), nil
+	}
+	return strconv.AppendInt(nil, toMillis(t.Time), 10), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *NullUnixMillis) UnmarshalJSON(input []byte) error {
+	if bytes.Equal(input, []byte("null")) {
+		t.Time, t.Valid = time.Time{}, false
+		return nil
+	}
+	ms, err := decodeMillis(input)
+	if err != nil {
+		return fmt.Errorf("couchdb: invalid NullUnixMillis value %s: %v", input, err)
+	}
+	t.Time, t.Valid = fromMillis(ms), true
+	return nil
+}
+
+// Duration is a time.Duration that is encoded in JSON as an
+// integer number of milliseconds.
+type Duration time.Duration
+
+// String returns the duration formatted like time.Duration.
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return strconv.AppendInt(nil, int64(time.Duration(d)/time.Millisecond), 10), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(input []byte) error {
+	if bytes.Equal(input, []byte("null")) {
+		return nil
+	}
+	ms, err := decodeMillis(input)
+	if err != nil {
+		return fmt.Errorf("couchdb: invalid Duration value %s: %v", input, err)
+	}
+	*d = Duration(ms * int64(time.Millisecond))
+	return nil
+}
+
+// decodeMillis decodes a JSON number. Fractional values are truncated.
+func decodeMillis(input []byte) (int64, error) {
+	var n json.Number
+	if err := json.Unmarshal(input, &n); err != nil {
+		return 0, err
+	}
+	if ms, err := n.Int64(); err == nil {
+		return ms, nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return 0, err
+	}
+	if f > math.MaxInt64 || f < math.MinInt64 {
+		return 0, fmt.Errorf("value out of range")
+	}
+	return int64(f), nil
+}
+
+func toMillis(t time.Time) int64 {
+	return t.Unix()*1000 + int64(t.Nanosecond())/int64(time.Millisecond)
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond))
+}
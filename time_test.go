@@ -0,0 +1,93 @@
+package couchdb_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/fjl/go-couchdb"
+)
+
+type timeDocument struct {
+	Created couchdb.UnixMillis `json:"created"`
+	TTL     couchdb.Duration   `json:"ttl"`
+}
+
+func TestUnixMillisJSON(t *testing.T) {
+	doc := timeDocument{
+		Created: couchdb.UnixMillis{Time: time.Unix(1500000000, 123000000)},
+		TTL:     couchdb.Duration(90 * time.Second),
+	}
+	enc, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "encoded doc", `{"created":1500000000123,"ttl":90000}`, string(enc))
+
+	var dec timeDocument
+	if err := json.Unmarshal(enc, &dec); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "decoded created", true, dec.Created.Equal(doc.Created.Time))
+	check(t, "decoded ttl", doc.TTL, dec.TTL)
+}
+
+func TestUnixMillisNull(t *testing.T) {
+	enc, err := json.Marshal(timeDocument{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "encoded doc", `{"created":null,"ttl":0}`, string(enc))
+
+	var dec timeDocument
+	if err := json.Unmarshal([]byte(`{"created":null}`), &dec); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "decoded created is zero", true, dec.Created.IsZero())
+}
+
+func TestUnixMillisInvalid(t *testing.T) {
+	var dec timeDocument
+	if err := json.Unmarshal([]byte(`{"created":"yesterday"}`), &dec); err == nil {
+		t.Error("expected error for non-numeric value")
+	}
+	if err := json.Unmarshal([]byte(`{"created":1.5e3}`), &dec); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "decoded created", time.Unix(1, 500000000), dec.Created.Time)
+}
+
+func TestNullUnixMillis(t *testing.T) {
+	type doc struct {
+		T couchdb.NullUnixMillis `json:"t"`
+	}
+	tests := []struct {
+		input string
+		valid bool
+		zero  bool
+	}{
+		{input: `{"t":null}`, valid: false, zero: true},
+		{input: `{"t":-62135596800000}`, valid: true, zero: true},
+		{input: `{"t":1500000000123}`, valid: true, zero: false},
+	}
+	for _, test := range tests {
+		var d doc
+		if err := json.Unmarshal([]byte(test.input), &d); err != nil {
+			t.Fatalf("%s: %v", test.input, err)
+		}
+		check(t, test.input+" Valid", test.valid, d.T.Valid)
+		check(t, test.input+" IsZero", test.zero, d.T.Time.IsZero())
+		enc, err := json.Marshal(d)
+		if err != nil {
+			t.Fatalf("%s: %v", test.input, err)
+		}
+		check(t, test.input+" re-encoded", test.input, string(enc))
+	}
+
+	// Fields absent from the input are not touched by the decoder.
+	d := doc{T: couchdb.NullUnixMillis{Valid: true}}
+	if err := json.Unmarshal([]byte(`{}`), &d); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "absent field Valid", true, d.T.Valid)
+}
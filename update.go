@@ -0,0 +1,109 @@
+package couchdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// maxUpdateAttempts is the number of times Update tries to store a document
+// before giving up on conflicts.
+const maxUpdateAttempts = 10
+
+// Upsert stores a document, overwriting any existing revision.
+// The current revision is fetched before storing the document and replaces
+// the _rev field of doc, if any. If another writer updates the document in
+// between, the operation is retried once.
+func (db *DB) Upsert(id string, doc interface{}) (newrev string, err error) {
+	enc, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(enc, &fields); err != nil {
+		return "", fmt.Errorf("couchdb: can't upsert %q: %v", id, err)
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		var rev string
+		rev, err = db.Rev(id)
+		if err != nil && !NotFound(err) {
+			return "", err
+		}
+		if rev == "" {
+			delete(fields, "_rev")
+		} else {
+			fields["_rev"], _ = json.Marshal(rev)
+		}
+		newrev, err = db.Put(id, fields, rev)
+		if !Conflict(err) {
+			return newrev, err
+		}
+	}
+	return "", err
+}
+
+// UpdateFunc computes the new content of a document. The argument is
+// the current document, or nil if the document does not exist. If the
+// function returns a nil document, the update is aborted.
+type UpdateFunc func(raw json.RawMessage) (newdoc interface{}, err error)
+
+// Update performs a read-modify-write cycle on a document. It fetches the
+// document, applies fn and stores the result using the revision that was read.
+// If the document was modified concurrently, the cycle is repeated.
+//
+// If fn returns an error, Update returns it without storing anything. If fn returns
+// a nil document, Update returns the current revision of the document.
+func (db *DB) Update(id string, fn UpdateFunc) (newrev string, err error) {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		var raw json.RawMessage
+		if err := db.Get(id, &raw, nil); err != nil && !NotFound(err) {
+			return "", err
+		}
+		var current struct {
+			Rev string `json:"_rev"`
+		}
+		if raw != nil {
+			if err := json.Unmarshal(raw, &current); err != nil {
+				return "", err
+			}
+		}
+
+		newdoc, err := fn(raw)
+		if err != nil {
+			return "", err
+		} else if newdoc == nil {
+			return current.Rev, nil
+		}
+		newrev, err = db.Put(id, newdoc, current.Rev)
+		if !Conflict(err) {
+			return newrev, err
+		}
+	}
+	return "", fmt.Errorf("couchdb: update of %q failed after %d conflicts", id, maxUpdateAttempts)
+}
+
+// Touch sets a field of a document to the current time, encoded like
+// UnixMillis. The other fields of the document are stored unchanged. If the
+// document does not exist, it is created with the field as its only content.
+// Conflicts are retried like Update. Touch is meant for heartbeat documents.
+//
+// CouchDB has no partial document updates: every write, including writes
+// through _bulk_docs, replaces the whole document body. Touch therefore
+// reads and writes the full document, so heartbeat documents should be
+// kept small. Attachment data is not transferred because the document is
+// read with attachment stubs, which keep the attachments when it is stored.
+// Updating a field without transferring the document requires an update
+// function (_update) in a design document.
+func (db *DB) Touch(id, field string) (newrev string, err error) {
+	return db.Update(id, func(raw json.RawMessage) (interface{}, error) {
+		doc := make(map[string]json.RawMessage)
+		if raw != nil {
+			if err := json.Unmarshal(raw, &doc); err != nil {
+				return nil, fmt.Errorf("couchdb: can't touch %q: %v", id, err)
+			}
+		}
+		now, _ := UnixMillis{time.Now()}.MarshalJSON()
+		doc[field] = now
+		return doc, nil
+	})
+}
@@ -0,0 +1,136 @@
+package couchdb_test
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	. "net/http"
+	"testing"
+)
+
+func TestUpsertRetry(t *testing.T) {
+	c := newTestClient(t)
+	revs := []string{`"1-a"`, `"2-a"`}
+	c.Handle("HEAD /db/doc", func(resp ResponseWriter, req *Request) {
+		resp.Header().Set("ETag", revs[0])
+		revs = revs[1:]
+	})
+	puts := 0
+	c.Handle("PUT /db/doc", func(resp ResponseWriter, req *Request) {
+		puts++
+		if puts == 1 {
+			check(t, "first PUT query", "rev=1-a", req.URL.RawQuery)
+			resp.WriteHeader(StatusConflict)
+			io.WriteString(resp, `{"error":"conflict","reason":"Document update conflict."}`)
+			return
+		}
+		check(t, "second PUT query", "rev=2-a", req.URL.RawQuery)
+		resp.Header().Set("ETag", `"3-a"`)
+		resp.WriteHeader(StatusCreated)
+	})
+
+	rev, err := c.DB("db").Upsert("doc", &testDocument{Field: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "returned rev", "3-a", rev)
+}
+
+func TestUpsertNew(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("HEAD /db/doc", func(resp ResponseWriter, req *Request) {
+		resp.WriteHeader(StatusNotFound)
+	})
+	c.Handle("PUT /db/doc", func(resp ResponseWriter, req *Request) {
+		check(t, "PUT query", "", req.URL.RawQuery)
+		resp.Header().Set("ETag", `"1-a"`)
+		resp.WriteHeader(StatusCreated)
+	})
+
+	rev, err := c.DB("db").Upsert("doc", &testDocument{Field: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "returned rev", "1-a", rev)
+}
+
+func TestUpsertStaleRev(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("HEAD /db/doc", func(resp ResponseWriter, req *Request) {
+		resp.Header().Set("ETag", `"5-a"`)
+	})
+	c.Handle("PUT /db/doc", func(resp ResponseWriter, req *Request) {
+		var body map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&body)
+		check(t, "PUT query", "rev=5-a", req.URL.RawQuery)
+		check(t, "body", map[string]interface{}{"_rev": "5-a", "field": float64(1)}, body)
+		resp.Header().Set("ETag", `"6-a"`)
+		resp.WriteHeader(StatusCreated)
+	})
+
+	// The document was read at revision 2 and modified since.
+	doc := map[string]interface{}{"_rev": "2-a", "field": 1}
+	rev, err := c.DB("db").Upsert("doc", doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "returned rev", "6-a", rev)
+}
+
+func TestUpdate(t *testing.T) {
+	c := newTestClient(t)
+	gets := 0
+	c.Handle("GET /db/doc", func(resp ResponseWriter, req *Request) {
+		gets++
+		if gets == 1 {
+			io.WriteString(resp, `{"_id":"doc","_rev":"1-a","field":1}`)
+		} else {
+			io.WriteString(resp, `{"_id":"doc","_rev":"2-a","field":5}`)
+		}
+	})
+	c.Handle("PUT /db/doc", func(resp ResponseWriter, req *Request) {
+		if req.URL.RawQuery == "rev=1-a" {
+			resp.WriteHeader(StatusConflict)
+			io.WriteString(resp, `{"error":"conflict","reason":"Document update conflict."}`)
+			return
+		}
+		check(t, "PUT query", "rev=2-a", req.URL.RawQuery)
+		body, _ := ioutil.ReadAll(req.Body)
+		check(t, "PUT body", `{"_rev":"2-a","field":6}`, string(body))
+		resp.Header().Set("ETag", `"3-a"`)
+		resp.WriteHeader(StatusCreated)
+	})
+
+	rev, err := c.DB("db").Update("doc", func(raw json.RawMessage) (interface{}, error) {
+		var doc testDocument
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return nil, err
+		}
+		doc.Field++
+		return &doc, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "returned rev", "3-a", rev)
+	check(t, "number of GETs", 2, gets)
+}
+
+func TestUpdateMissingAbort(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db/doc", func(resp ResponseWriter, req *Request) {
+		resp.WriteHeader(StatusNotFound)
+		io.WriteString(resp, `{"error":"not_found","reason":"missing"}`)
+	})
+
+	var got json.RawMessage
+	rev, err := c.DB("db").Update("doc", func(raw json.RawMessage) (interface{}, error) {
+		got = raw
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "raw doc", json.RawMessage(nil), got)
+	check(t, "returned rev", "", rev)
+}
@@ -0,0 +1,134 @@
+package couchdb
+
+import (
+	"sync"
+	"time"
+)
+
+// UserDocPrefix is the prefix of document IDs in the _users database.
+const UserDocPrefix = "org.couchdb.user:"
+
+// UserRolesOptions configures a UserRoles cache.
+type UserRolesOptions struct {
+	// DB is the name of the users database.
+	// The default is "_users".
+	DB string
+
+	// TTL is the time for which roles are cached.
+	// The default is one minute.
+	TTL time.Duration
+
+	// MaxEntries is the maximum number of cached users.
+	// The default is 1000.
+	MaxEntries int
+}
+
+// UserRoles looks up the roles of users in the users database, for services
+// that make authorization decisions the way CouchDB does, e.g. by matching
+// the roles against the members of a security object. Roles are cached,
+// so changes to a user document take up to TTL to become visible unless
+// Invalidate is called.
+//
+// Reading user documents requires server admin rights. Server admins
+// configured on the nodes don't have a user document and are not found.
+//
+// It is safe to use a UserRoles from more than one goroutine.
+type UserRoles struct {
+	db   *DB
+	opts UserRolesOptions
+
+	mu      sync.Mutex
+	entries map[string]userRolesEntry
+}
+
+type userRolesEntry struct {
+	roles   []string
+	err     error // set if the user doesn't exist
+	expires time.Time
+}
+
+// NewUserRoles creates a roles cache for the users database of the server.
+func (c *Client) NewUserRoles(opts UserRolesOptions) *UserRoles {
+	if opts.DB == "" {
+		opts.DB = "_users"
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = time.Minute
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = 1000
+	}
+	return &UserRoles{
+		db:      c.DB(opts.DB),
+		opts:    opts,
+		entries: make(map[string]userRolesEntry),
+	}
+}
+
+// Roles returns the roles of the named user. If the user doesn't exist,
+// the error satisfies NotFound. Unknown users are cached as well.
+func (r *UserRoles) Roles(name string) ([]string, error) {
+	now := time.Now()
+	r.mu.Lock()
+	e, ok := r.entries[name]
+	r.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return copyStrings(e.roles), e.err
+	}
+
+	var doc struct {
+		Roles []string `json:"roles"`
+	}
+	e = userRolesEntry{expires: now.Add(r.opts.TTL)}
+	if err := r.db.Get(UserDocPrefix+name, &doc, nil); NotFound(err) {
+		e.err = err
+	} else if err != nil {
+		return nil, err
+	} else {
+		e.roles = doc.Roles
+	}
+
+	r.mu.Lock()
+	r.add(name, e, now)
+	r.mu.Unlock()
+	return copyStrings(e.roles), e.err
+}
+
+// add stores an entry, evicting expired entries if the cache is full.
+func (r *UserRoles) add(name string, e userRolesEntry, now time.Time) {
+	if _, ok := r.entries[name]; !ok && len(r.entries) >= r.opts.MaxEntries {
+		for k, old := range r.entries {
+			if !now.Before(old.expires) {
+				delete(r.entries, k)
+			}
+		}
+		// Drop an arbitrary entry if none has expired.
+		for k := range r.entries {
+			if len(r.entries) < r.opts.MaxEntries {
+				break
+			}
+			delete(r.entries, k)
+		}
+	}
+	r.entries[name] = e
+}
+
+// Invalidate removes the named users from the cache.
+// If no names are given, all users are removed.
+func (r *UserRoles) Invalidate(names ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(names) == 0 {
+		r.entries = make(map[string]userRolesEntry)
+	}
+	for _, name := range names {
+		delete(r.entries, name)
+	}
+}
+
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string(nil), s...)
+}
@@ -0,0 +1,50 @@
+package couchdb_test
+
+import (
+	"io"
+	. "net/http"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestUserRoles(t *testing.T) {
+	c := newTestClient(t)
+	requests := 0
+	c.Handle("GET /_users/org.couchdb.user%3Aalice", func(resp ResponseWriter, req *Request) {
+		requests++
+		io.WriteString(resp, `{
+			"_id": "org.couchdb.user:alice",
+			"name": "alice",
+			"type": "user",
+			"roles": ["editor", "reviewer"]
+		}`)
+	})
+	c.Handle("GET /_users/org.couchdb.user%3Abob", func(resp ResponseWriter, req *Request) {
+		requests++
+		resp.WriteHeader(StatusNotFound)
+		io.WriteString(resp, `{"error": "not_found", "reason": "missing"}`)
+	})
+
+	roles := c.NewUserRoles(couchdb.UserRolesOptions{})
+	for i := 0; i < 2; i++ {
+		got, err := roles.Roles("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, "roles", []string{"editor", "reviewer"}, got)
+		got[0] = "modified"
+	}
+	check(t, "requests", 1, requests)
+
+	for i := 0; i < 2; i++ {
+		if _, err := roles.Roles("bob"); !couchdb.NotFound(err) {
+			t.Fatalf("expected NotFound error, got %v", err)
+		}
+	}
+	check(t, "requests including bob", 2, requests)
+
+	roles.Invalidate("alice")
+	roles.Roles("alice")
+	check(t, "requests after Invalidate", 3, requests)
+}
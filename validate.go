@@ -0,0 +1,83 @@
+package couchdb
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ValidationRule is a check performed by a generated validate_doc_update
+// function. Rules are created by RequireFields, RequireRoles and
+// ImmutableFields.
+type ValidationRule struct {
+	js string
+}
+
+// RequireFields rejects documents that lack any of the given fields.
+// Deletions are always allowed.
+func RequireFields(fields ...string) ValidationRule {
+	return ValidationRule{`if (!newDoc._deleted) {
+    ` + jsStringArray(fields) + `.forEach(function (f) {
+      if (newDoc[f] === undefined || newDoc[f] === null) {
+        throw({forbidden: "missing required field: " + f});
+      }
+    });
+  }`}
+}
+
+// RequireRoles rejects writes by users that have none of the given roles.
+// Server admins can always write.
+func RequireRoles(roles ...string) ValidationRule {
+	return ValidationRule{`var userRoles = userCtx.roles || [];
+  if (userRoles.indexOf("_admin") === -1 && !` + jsStringArray(roles) + `.some(function (r) {
+    return userRoles.indexOf(r) !== -1;
+  })) {
+    throw({unauthorized: ` + jsString("writing requires one of the roles: "+strings.Join(roles, ", ")) + `});
+  }`}
+}
+
+// ImmutableFields rejects updates that change the value of any of the given
+// fields after the document has been created. Deletions are always allowed.
+func ImmutableFields(fields ...string) ValidationRule {
+	return ValidationRule{`if (oldDoc && !oldDoc._deleted && !newDoc._deleted) {
+    ` + jsStringArray(fields) + `.forEach(function (f) {
+      if (JSON.stringify(newDoc[f]) !== JSON.stringify(oldDoc[f])) {
+        throw({forbidden: "field cannot be changed: " + f});
+      }
+    });
+  }`}
+}
+
+// ValidateFunc generates the source of a validate_doc_update function
+// that applies the given rules in order.
+func ValidateFunc(rules ...ValidationRule) string {
+	var b strings.Builder
+	b.WriteString("function (newDoc, oldDoc, userCtx, secObj) {\n")
+	for _, r := range rules {
+		b.WriteString("  ")
+		b.WriteString(r.js)
+		b.WriteString("\n")
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// SetValidation sets the validate_doc_update function of the design
+// document to a function generated from rules.
+func (d *Design) SetValidation(rules ...ValidationRule) {
+	d.ValidateDocUpdate = ValidateFunc(rules...)
+}
+
+// jsString encodes s as a JavaScript string literal. JSON strings are
+// valid JavaScript because encoding/json escapes U+2028 and U+2029.
+func jsString(s string) string {
+	enc, _ := json.Marshal(s)
+	return string(enc)
+}
+
+func jsStringArray(list []string) string {
+	if list == nil {
+		list = []string{}
+	}
+	enc, _ := json.Marshal(list)
+	return string(enc)
+}
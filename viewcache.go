@@ -0,0 +1,217 @@
+package couchdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ViewCacheOptions configures a ViewCache.
+type ViewCacheOptions struct {
+	// MaxLag is the number of database updates a cached result may be
+	// behind the current update sequence. If zero, any update of the
+	// database invalidates all cached results.
+	MaxLag int64
+
+	// SeqInterval is the minimum time between requests for the update
+	// sequence of the database. Within the interval, cached results are
+	// returned without contacting the server. If zero, the sequence is
+	// checked by every query.
+	SeqInterval time.Duration
+
+	// MaxEntries is the maximum number of cached results.
+	// The default is 1000.
+	MaxEntries int
+}
+
+// ViewCache caches the results of view queries. Entries are keyed by the
+// signature of the design document's view index and the query options, so
+// changing a design document invalidates the results of its views. Cached
+// results are discarded when the update sequence of the database advances
+// more than MaxLag updates past the sequence at which they were fetched.
+//
+// It is safe to use a ViewCache from more than one goroutine.
+type ViewCache struct {
+	db   *DB
+	opts ViewCacheOptions
+
+	mu      sync.Mutex
+	seq     interface{} // last known update sequence
+	seqTime time.Time
+	sigs    map[string]viewCacheSig
+	entries map[string]*viewCacheEntry
+}
+
+type viewCacheSig struct {
+	sig string
+	seq interface{} // update sequence at which sig was fetched
+}
+
+type viewCacheEntry struct {
+	seq     interface{}
+	added   time.Time
+	content []byte
+}
+
+// NewViewCache creates a view cache for the database.
+func (db *DB) NewViewCache(opts ViewCacheOptions) *ViewCache {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = 1000
+	}
+	return &ViewCache{
+		db:      db,
+		opts:    opts,
+		sigs:    make(map[string]viewCacheSig),
+		entries: make(map[string]*viewCacheEntry),
+	}
+}
+
+// View invokes a view like DB.View, returning a cached result
+// if possible.
+func (c *ViewCache) View(ddoc, view string, result interface{}, opts Options) error {
+	if !strings.HasPrefix(ddoc, "_design/") {
+		return errors.New("couchdb.ViewCache.View: design doc name must start with _design/")
+	}
+	opts = c.db.options(opts)
+	if err := ValidateViewOptions(opts); err != nil {
+		return err
+	}
+	query, err := new(pathBuilder).options(opts, viewJsonKeys)
+	if err != nil {
+		return err
+	}
+	seq, err := c.updateSeq()
+	if err != nil {
+		return err
+	}
+	sig, err := c.signature(ddoc, seq)
+	if err != nil {
+		return err
+	}
+	key := sig + "\x00" + view + "\x00" + query
+
+	c.mu.Lock()
+	e := c.entries[key]
+	if e != nil && !c.fresh(e, seq) {
+		delete(c.entries, key)
+		e = nil
+	}
+	c.mu.Unlock()
+	if e != nil {
+		return c.db.newDecoder(bytes.NewReader(e.content)).Decode(result)
+	}
+
+	var content json.RawMessage
+	if err := c.db.View(ddoc, view, &content, opts); err != nil {
+		return err
+	}
+	c.add(key, &viewCacheEntry{seq: seq, added: time.Now(), content: content})
+	return c.db.newDecoder(bytes.NewReader(content)).Decode(result)
+}
+
+// Invalidate removes all cached results.
+func (c *ViewCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq, c.seqTime = nil, time.Time{}
+	c.sigs = make(map[string]viewCacheSig)
+	c.entries = make(map[string]*viewCacheEntry)
+}
+
+// Len returns the number of cached results.
+func (c *ViewCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// updateSeq returns the update sequence of the database, fetching it
+// if SeqInterval has passed since the last request.
+func (c *ViewCache) updateSeq() (interface{}, error) {
+	c.mu.Lock()
+	if c.seq != nil && c.opts.SeqInterval > 0 && time.Since(c.seqTime) < c.opts.SeqInterval {
+		defer c.mu.Unlock()
+		return c.seq, nil
+	}
+	c.mu.Unlock()
+
+	info, err := c.db.Info()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.seq, c.seqTime = info.UpdateSeq, time.Now()
+	c.mu.Unlock()
+	return info.UpdateSeq, nil
+}
+
+// signature returns the view index signature of ddoc. The signature is
+// fetched again whenever the database has changed since it was last
+// fetched, because the design document may have been updated.
+func (c *ViewCache) signature(ddoc string, seq interface{}) (string, error) {
+	c.mu.Lock()
+	s, ok := c.sigs[ddoc]
+	c.mu.Unlock()
+	if ok && seqEqual(s.seq, seq) {
+		return s.sig, nil
+	}
+
+	info, err := c.db.DesignInfo(ddoc)
+	if err != nil {
+		return "", err
+	}
+	if info.ViewIndex.Signature == "" {
+		return "", fmt.Errorf("couchdb.ViewCache: %s has no view index signature", ddoc)
+	}
+	c.mu.Lock()
+	c.sigs[ddoc] = viewCacheSig{info.ViewIndex.Signature, seq}
+	c.mu.Unlock()
+	return info.ViewIndex.Signature, nil
+}
+
+// fresh reports whether e may be returned at the given update sequence.
+// It must be called with c.mu held.
+func (c *ViewCache) fresh(e *viewCacheEntry, seq interface{}) bool {
+	if seqEqual(e.seq, seq) {
+		return true
+	}
+	cur, then := seqNumber(seq), seqNumber(e.seq)
+	if cur < 0 || then < 0 {
+		return false
+	}
+	return cur-then <= c.opts.MaxLag
+}
+
+// add stores a cache entry. If the cache is full, stale entries are removed
+// first, then the oldest entry.
+func (c *ViewCache) add(key string, e *viewCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.opts.MaxEntries {
+		for k, old := range c.entries {
+			if !c.fresh(old, e.seq) {
+				delete(c.entries, k)
+			}
+		}
+		for len(c.entries) >= c.opts.MaxEntries {
+			var oldest string
+			for k, old := range c.entries {
+				if oldest == "" || old.added.Before(c.entries[oldest].added) {
+					oldest = k
+				}
+			}
+			delete(c.entries, oldest)
+		}
+	}
+	c.entries[key] = e
+}
+
+// seqEqual reports whether two update sequences are the same.
+func seqEqual(a, b interface{}) bool {
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
@@ -0,0 +1,79 @@
+package couchdb_test
+
+import (
+	"io"
+	. "net/http"
+	"strconv"
+	"testing"
+
+	"github.com/fjl/go-couchdb"
+)
+
+func TestViewCache(t *testing.T) {
+	c := newTestClient(t)
+	seq, sig := 10, "abc"
+	c.Handle("GET /db", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"db_name": "db", "update_seq": "`+strconv.Itoa(seq)+`-g1AAAA"}`)
+	})
+	c.Handle("GET /db/_design/d/_info", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"name": "d", "view_index": {"signature": "`+sig+`"}}`)
+	})
+	queries := 0
+	c.Handle("GET /db/_design/d/_view/v", func(resp ResponseWriter, req *Request) {
+		queries++
+		io.WriteString(resp, `{"total_rows": 1, "offset": 0, "rows": [{"key": `+strconv.Itoa(queries)+`}]}`)
+	})
+
+	cache := c.DB("db").NewViewCache(couchdb.ViewCacheOptions{MaxLag: 5})
+	query := func(opts couchdb.Options) int {
+		var result struct {
+			Rows []struct{ Key int } `json:"rows"`
+		}
+		if err := cache.View("_design/d", "v", &result, opts); err != nil {
+			t.Fatal(err)
+		}
+		return result.Rows[0].Key
+	}
+
+	check(t, "first query", 1, query(nil))
+	check(t, "cached query", 1, query(nil))
+	check(t, "different options", 2, query(couchdb.Options{"limit": 1}))
+	check(t, "cached options", 2, query(couchdb.Options{"limit": 1}))
+
+	// Updates within MaxLag are tolerated.
+	seq = 15
+	check(t, "within lag", 1, query(nil))
+	seq = 16
+	check(t, "beyond lag", 3, query(nil))
+
+	// A changed design document invalidates its views.
+	seq, sig = 17, "def"
+	check(t, "new signature", 4, query(nil))
+	check(t, "cached new signature", 4, query(nil))
+
+	cache.Invalidate()
+	check(t, "len after invalidate", 0, cache.Len())
+	check(t, "after invalidate", 5, query(nil))
+}
+
+func TestViewCacheEviction(t *testing.T) {
+	c := newTestClient(t)
+	c.Handle("GET /db", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"db_name": "db", "update_seq": 1}`)
+	})
+	c.Handle("GET /db/_design/d/_info", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"name": "d", "view_index": {"signature": "abc"}}`)
+	})
+	c.Handle("GET /db/_design/d/_view/v", func(resp ResponseWriter, req *Request) {
+		io.WriteString(resp, `{"rows": []}`)
+	})
+
+	cache := c.DB("db").NewViewCache(couchdb.ViewCacheOptions{MaxEntries: 2})
+	for i := 0; i < 5; i++ {
+		var result interface{}
+		if err := cache.View("_design/d", "v", &result, couchdb.Options{"skip": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(t, "len", 2, cache.Len())
+}
@@ -0,0 +1,104 @@
+package couchdb
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+)
+
+// ViewUpdate is the value of the "update" view option, which controls
+// whether the index is updated before the query is answered.
+type ViewUpdate string
+
+const (
+	UpdateTrue  ViewUpdate = "true"  // update the index first (default)
+	UpdateFalse ViewUpdate = "false" // return the current index content
+	UpdateLazy  ViewUpdate = "lazy"  // like UpdateFalse, but update the index afterwards
+)
+
+// ViewStable is the value of the "stable" view option. If true, results
+// come from a stable set of shard replicas, which avoids seeing rows
+// appear and disappear between queries.
+type ViewStable bool
+
+const (
+	StableTrue  ViewStable = true
+	StableFalse ViewStable = false
+)
+
+// ViewStale is the value of the deprecated "stale" view option of
+// CouchDB 1.x. StaleOK is equivalent to update=false with stable=true,
+// StaleUpdateAfter to update=lazy with stable=true.
+type ViewStale string
+
+const (
+	StaleOK          ViewStale = "ok"
+	StaleUpdateAfter ViewStale = "update_after"
+)
+
+// ValidateViewOptions checks the values of the "update", "stable" and
+// "stale" options, which can be given either as the typed constants or
+// as plain values. It also rejects combining "stale" with the other two,
+// which CouchDB doesn't allow. View queries check their options using
+// this function before sending the request.
+func ValidateViewOptions(opts Options) error {
+	for _, o := range freshnessOptions {
+		v, ok := opts[o.name]
+		if !ok {
+			continue
+		}
+		if s, ok := optionString(v); !ok || !containsString(o.values, s) {
+			return fmt.Errorf("couchdb: invalid value for option %q: %#v", o.name, v)
+		}
+	}
+	if _, ok := opts["stale"]; ok && (opts["update"] != nil || opts["stable"] != nil) {
+		return fmt.Errorf(`couchdb: option "stale" can't be combined with "update" or "stable"`)
+	}
+	return nil
+}
+
+var freshnessOptions = []struct {
+	name   string
+	values []string
+}{
+	{"update", []string{"true", "false", "lazy"}},
+	{"stable", []string{"true", "false"}},
+	{"stale", []string{"ok", "update_after"}},
+}
+
+// optionString returns the query string encoding of
+// string, bool and fmt.Stringer option values.
+func optionString(v interface{}) (string, bool) {
+	if s, ok := v.(fmt.Stringer); ok {
+		return s.String(), true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), true
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), true
+	}
+	return "", false
+}
+
+// EncodeViewOptions returns the query string sent by View for the given
+// options, without the leading '?'. Options are encoded the same way for
+// AllDocs. This is useful for matching recorded view requests in tests.
+func EncodeViewOptions(opts Options) (string, error) {
+	q, err := new(pathBuilder).options(opts, viewJsonKeys)
+	if err != nil {
+		return "", err
+	}
+	return q[1:], nil
+}
+
+// viewRequest validates the options of a view query and sends it.
+func (db *DB) viewRequest(p *pathBuilder, opts Options) (*http.Response, error) {
+	if err := ValidateViewOptions(opts); err != nil {
+		p.release()
+		return nil, err
+	}
+	return db.queryRequest(p, opts, viewJsonKeys, nil)
+}